@@ -0,0 +1,392 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Analytics bucket sizes
+const (
+	IntervalHour  = "hour"
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// Analytics groupings. The cashier grouping is by the login that rang the
+// sale up; sales from before logins were recorded belong to the owner.
+const (
+	GroupByProduct       = "product"
+	GroupByCategory      = "category"
+	GroupByPaymentMethod = "payment_method"
+	GroupByCashier       = "cashier"
+)
+
+const (
+	maxAnalyticsBuckets = 1000
+	defaultAnalyticsTop = 10
+	maxAnalyticsTop     = 100
+)
+
+// analyticsCashier is the login a sales line is attributed to
+const analyticsCashier = "CASE WHEN sales_transactions.cashier_id = 0 THEN sales_transactions.user_id ELSE sales_transactions.cashier_id END"
+
+// analyticsGroupings maps each grouping to the key and label it reads
+var analyticsGroupings = map[string]struct{ key, label string }{
+	GroupByProduct:       {key: "CAST(sales_transactions.product_id AS CHAR)", label: "products.name"},
+	GroupByCategory:      {key: "COALESCE(products.category, '')", label: "COALESCE(products.category, '')"},
+	GroupByPaymentMethod: {key: "sales_transactions.payment_method", label: "sales_transactions.payment_method"},
+	GroupByCashier:       {key: "CAST(" + analyticsCashier + " AS CHAR)", label: "COALESCE(cashiers.full_name, '')"},
+}
+
+// SalesFigures are the measures analytics reports for a period, bucket or
+// group. Revenue includes the tax collected; profit and margin are taken on
+// NetRevenue, the revenue less tax.
+type SalesFigures struct {
+	Revenue      float64 `json:"revenue"`
+	NetRevenue   float64 `json:"net_revenue"`
+	Cost         float64 `json:"cost"`
+	GrossProfit  float64 `json:"gross_profit"`
+	GrossMargin  float64 `json:"gross_margin"`
+	Quantity     int     `json:"quantity"`
+	Transactions int     `json:"transactions"`
+	AverageSale  float64 `json:"average_sale"`
+}
+
+// SalesBucket is one step of the analytics time series. PreviousRevenue is
+// the revenue of the matching bucket of the previous period.
+type SalesBucket struct {
+	Start time.Time `json:"start"`
+	SalesFigures
+	PreviousRevenue float64 `json:"previous_revenue"`
+}
+
+// SalesGroup is one product, category, payment method or cashier
+type SalesGroup struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	SalesFigures
+	// Share is the group's percentage of revenue for the period
+	Share           float64  `json:"share"`
+	PreviousRevenue float64  `json:"previous_revenue"`
+	Change          *float64 `json:"change"`
+}
+
+// SalesComparison is the previous period of the same length and how the
+// period changed against it, in percent. A change is null when the
+// previous period had nothing to compare with.
+type SalesComparison struct {
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	Figures SalesFigures `json:"figures"`
+	Changes struct {
+		Revenue      *float64 `json:"revenue"`
+		GrossProfit  *float64 `json:"gross_profit"`
+		Quantity     *float64 `json:"quantity"`
+		Transactions *float64 `json:"transactions"`
+		AverageSale  *float64 `json:"average_sale"`
+	} `json:"changes"`
+}
+
+// SalesAnalytics is the analytics report for a date range
+type SalesAnalytics struct {
+	From     time.Time       `json:"from"`
+	To       time.Time       `json:"to"`
+	Interval string          `json:"interval"`
+	GroupBy  string          `json:"group_by"`
+	Figures  SalesFigures    `json:"figures"`
+	Previous SalesComparison `json:"previous"`
+	Series   []SalesBucket   `json:"series"`
+	// Top holds the top groups by revenue, and TopByQuantity and
+	// TopByProfit the same groups ranked by units and gross profit
+	Top           []SalesGroup `json:"top"`
+	TopByQuantity []SalesGroup `json:"top_by_quantity"`
+	TopByProfit   []SalesGroup `json:"top_by_profit"`
+}
+
+// salesAccumulator adds up sales lines, counting each receipt once
+type salesAccumulator struct {
+	figures  SalesFigures
+	receipts map[uint]bool
+}
+
+func (acc *salesAccumulator) add(line analyticsLine) {
+	acc.figures.Revenue += line.TotalAmount
+	acc.figures.NetRevenue += line.TotalAmount - line.TaxAmount
+	acc.figures.Cost += line.TotalCost
+	acc.figures.Quantity += line.Quantity
+	// Returns are negative lines against the original receipt
+	if line.SaleReturnID == 0 {
+		if acc.receipts == nil {
+			acc.receipts = make(map[uint]bool)
+		}
+		acc.receipts[line.ReceiptID] = true
+	}
+}
+
+func (acc *salesAccumulator) result() SalesFigures {
+	figures := acc.figures
+	figures.Revenue = roundMoney(figures.Revenue)
+	figures.NetRevenue = roundMoney(figures.NetRevenue)
+	figures.Cost = roundMoney(figures.Cost)
+	figures.GrossProfit = roundMoney(figures.NetRevenue - figures.Cost)
+	figures.GrossMargin = grossMarginPercent(figures.NetRevenue, figures.Cost)
+	figures.Transactions = len(acc.receipts)
+	if figures.Transactions > 0 {
+		figures.AverageSale = roundMoney(figures.Revenue / float64(figures.Transactions))
+	}
+	return figures
+}
+
+// analyticsLine is a sales transaction as analytics reads it
+type analyticsLine struct {
+	CreatedAt    time.Time
+	ReceiptID    uint
+	SaleReturnID uint
+	Quantity     int
+	TotalAmount  float64
+	TaxAmount    float64
+	TotalCost    float64
+	GroupKey     string
+	GroupLabel   string
+}
+
+// salesPeriod is a period's sales added up in total, by bucket and by group
+type salesPeriod struct {
+	total   salesAccumulator
+	buckets []salesAccumulator
+	groups  map[string]*salesAccumulator
+	labels  map[string]string
+}
+
+// bucketStart truncates a time to the start of its bucket. Weeks start on
+// Sunday like the weekly figures in the sales metrics.
+func bucketStart(t time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case IntervalWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return day.AddDate(0, 0, -int(day.Weekday()))
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func nextBucket(t time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalHour:
+		return t.Add(time.Hour)
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// bucketStarts lists the buckets covering [start, end)
+func bucketStarts(start, end time.Time, interval string) []time.Time {
+	var starts []time.Time
+	for t := bucketStart(start, interval); t.Before(end); t = nextBucket(t, interval) {
+		starts = append(starts, t)
+		if len(starts) > maxAnalyticsBuckets {
+			break
+		}
+	}
+	return starts
+}
+
+// loadSalesPeriod reads the sales lines between start and end and adds them
+// up by bucket and by group. Lines are bucketed here rather than in SQL so
+// the same query works on every database.
+func loadSalesPeriod(db *gorm.DB, userID uint, start, end time.Time, interval, groupBy string) (*salesPeriod, error) {
+	starts := bucketStarts(start, end, interval)
+	period := &salesPeriod{
+		buckets: make([]salesAccumulator, len(starts)),
+		groups:  make(map[string]*salesAccumulator),
+		labels:  make(map[string]string),
+	}
+	grouping := analyticsGroupings[groupBy]
+
+	rows, err := db.Table("sales_transactions").
+		Select("sales_transactions.created_at, sales_transactions.receipt_id, sales_transactions.sale_return_id, sales_transactions.quantity, sales_transactions.total_amount, sales_transactions.tax_amount, sales_transactions.total_cost, "+
+			grouping.key+" as group_key, "+grouping.label+" as group_label").
+		Joins("JOIN products ON sales_transactions.product_id = products.id").
+		Joins("LEFT JOIN users cashiers ON cashiers.id = "+analyticsCashier).
+		Where("sales_transactions.user_id = ? AND sales_transactions.created_at >= ? AND sales_transactions.created_at < ?", userID, start, end).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line analyticsLine
+		if err := db.ScanRows(rows, &line); err != nil {
+			return nil, err
+		}
+		period.total.add(line)
+
+		at := bucketStart(line.CreatedAt.In(start.Location()), interval)
+		index := sort.Search(len(starts), func(i int) bool { return !starts[i].Before(at) })
+		if index < len(starts) && starts[index].Equal(at) {
+			period.buckets[index].add(line)
+		}
+
+		group, ok := period.groups[line.GroupKey]
+		if !ok {
+			group = &salesAccumulator{}
+			period.groups[line.GroupKey] = group
+			period.labels[line.GroupKey] = line.GroupLabel
+		}
+		group.add(line)
+	}
+	return period, rows.Err()
+}
+
+// percentChange is how much current changed on previous, or nil if there
+// was nothing before to compare with
+func percentChange(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := roundMoney((current - previous) / previous * 100)
+	return &change
+}
+
+// groupLabel names groups whose key is empty
+func groupLabel(groupBy, label string) string {
+	if label != "" {
+		return label
+	}
+	switch groupBy {
+	case GroupByCategory:
+		return "Uncategorised"
+	case GroupByCashier:
+		return "Unknown cashier"
+	}
+	return "Unknown"
+}
+
+// topGroups ranks groups by a measure and keeps the first n
+func topGroups(groups []SalesGroup, n int, less func(a, b SalesGroup) bool) []SalesGroup {
+	ranked := make([]SalesGroup, len(groups))
+	copy(ranked, groups)
+	sort.SliceStable(ranked, func(i, j int) bool { return less(ranked[i], ranked[j]) })
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// FetchSalesAnalytics reports sales between ?startDate= and ?endDate=
+// (YYYY-MM-DD, default this month), bucketed by ?interval= (hour, day,
+// week or month), grouped by ?group_by= (product, category,
+// payment_method or cashier) with the ?top= groups, and compared with the
+// period of the same length just before.
+func (im *SalesManagementHandler) FetchSalesAnalytics(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	start, end, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid date range. Use YYYY-MM-DD"})
+		return
+	}
+	interval := c.DefaultQuery("interval", IntervalDay)
+	switch interval {
+	case IntervalHour, IntervalDay, IntervalWeek, IntervalMonth:
+	default:
+		c.JSON(400, gin.H{"error": "interval must be hour, day, week or month"})
+		return
+	}
+	groupBy := c.DefaultQuery("group_by", GroupByProduct)
+	if _, ok := analyticsGroupings[groupBy]; !ok {
+		c.JSON(400, gin.H{"error": "group_by must be product, category, payment_method or cashier"})
+		return
+	}
+	top := defaultAnalyticsTop
+	if value := c.Query("top"); value != "" {
+		top, err = strconv.Atoi(value)
+		if err != nil || top < 1 {
+			c.JSON(400, gin.H{"error": "top must be a positive whole number"})
+			return
+		}
+		top = min(top, maxAnalyticsTop)
+	}
+	if len(bucketStarts(start, end, interval)) > maxAnalyticsBuckets {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Date range has more than %d %s buckets. Use a longer interval", maxAnalyticsBuckets, interval)})
+		return
+	}
+
+	previousStart := start.Add(-end.Sub(start))
+	current, err := loadSalesPeriod(im.db, userID, start, end, interval, groupBy)
+	if err != nil {
+		utils.ErrorLogger("Failed to fetch sales analytics for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch sales analytics"})
+		return
+	}
+	previous, err := loadSalesPeriod(im.db, userID, previousStart, start, interval, groupBy)
+	if err != nil {
+		utils.ErrorLogger("Failed to fetch previous period sales analytics for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch sales analytics"})
+		return
+	}
+
+	report := SalesAnalytics{
+		From:     start,
+		To:       end,
+		Interval: interval,
+		GroupBy:  groupBy,
+		Figures:  current.total.result(),
+		Previous: SalesComparison{From: previousStart, To: start, Figures: previous.total.result()},
+		Series:   []SalesBucket{},
+	}
+	now, before := report.Figures, report.Previous.Figures
+	report.Previous.Changes.Revenue = percentChange(now.Revenue, before.Revenue)
+	report.Previous.Changes.GrossProfit = percentChange(now.GrossProfit, before.GrossProfit)
+	report.Previous.Changes.Quantity = percentChange(float64(now.Quantity), float64(before.Quantity))
+	report.Previous.Changes.Transactions = percentChange(float64(now.Transactions), float64(before.Transactions))
+	report.Previous.Changes.AverageSale = percentChange(now.AverageSale, before.AverageSale)
+
+	// Buckets line up with the previous period's by position
+	for i, at := range bucketStarts(start, end, interval) {
+		bucket := SalesBucket{Start: at, SalesFigures: current.buckets[i].result()}
+		if i < len(previous.buckets) {
+			bucket.PreviousRevenue = previous.buckets[i].result().Revenue
+		}
+		report.Series = append(report.Series, bucket)
+	}
+
+	groups := make([]SalesGroup, 0, len(current.groups))
+	for key, acc := range current.groups {
+		group := SalesGroup{Key: key, Label: groupLabel(groupBy, current.labels[key]), SalesFigures: acc.result()}
+		if report.Figures.Revenue != 0 {
+			group.Share = roundMoney(group.Revenue / report.Figures.Revenue * 100)
+		}
+		if before, ok := previous.groups[key]; ok {
+			group.PreviousRevenue = before.result().Revenue
+		}
+		group.Change = percentChange(group.Revenue, group.PreviousRevenue)
+		groups = append(groups, group)
+	}
+	// Ties fall back to the label so the lists are stable
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Label < groups[j].Label })
+	report.Top = topGroups(groups, top, func(a, b SalesGroup) bool { return a.Revenue > b.Revenue })
+	report.TopByQuantity = topGroups(groups, top, func(a, b SalesGroup) bool { return a.Quantity > b.Quantity })
+	report.TopByProfit = topGroups(groups, top, func(a, b SalesGroup) bool { return a.GrossProfit > b.GrossProfit })
+
+	c.JSON(200, report)
+}
@@ -62,9 +62,18 @@ func (auth *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Staff sign in to their owner's business; user_id is always the
+	// business and staff_id the login acting in it
+	businessID := user.ID
+	if user.BusinessID != nil {
+		businessID = *user.BusinessID
+	}
+
 	// Generate JWT token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":   user.ID,
+		"user_id":   businessID,
+		"staff_id":  user.ID,
+		"role":      user.Role,
 		"email":     user.Email,
 		"full_name": user.FullName,
 		"exp":       time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
@@ -83,11 +92,13 @@ func (auth *AuthHandler) Login(c *gin.Context) {
 		"token":   tokenString,
 		"user": gin.H{
 			"id":            user.ID,
+			"business_id":   businessID,
 			"full_name":     user.FullName,
 			"email":         user.Email,
 			"business_name": user.BusinessName,
 			"telephone":     user.Telephone,
 			"location":      user.Location,
+			"role":          user.Role,
 		},
 	})
 }
@@ -0,0 +1,363 @@
+package controllers
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Measures associations can be ranked by
+const (
+	BasketSortLift       = "lift"
+	BasketSortConfidence = "confidence"
+	BasketSortSupport    = "support"
+)
+
+const (
+	defaultBasketTop      = 20
+	maxBasketTop          = 100
+	defaultBasketMinCount = 2
+)
+
+// basketPair is two products with the lower id first
+type basketPair struct{ a, b uint }
+
+// baskets counts how many receipts hold each product and each pair of
+// products over a period
+type baskets struct {
+	receipts int
+	products map[uint]int
+	pairs    map[basketPair]int
+	names    map[uint]string
+}
+
+// loadBaskets reads the products on each receipt in the period. Voided
+// receipts and lines returned in full are left out, as the customer did not
+// leave with them.
+func loadBaskets(db *gorm.DB, userID uint, start, end time.Time) (*baskets, error) {
+	counts := &baskets{products: make(map[uint]int), pairs: make(map[basketPair]int), names: make(map[uint]string)}
+
+	rows, err := db.Table("items").
+		Select("DISTINCT items.receipt_id, items.product_id").
+		Joins("JOIN receipts ON items.receipt_id = receipts.id").
+		Where("receipts.user_id = ? AND receipts.created_at >= ? AND receipts.created_at < ?", userID, start, end).
+		Where("receipts.status <> ? AND items.quantity > items.returned_quantity", models.ReceiptVoided).
+		Order("items.receipt_id").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var receiptID uint
+	var basket []uint
+	flush := func() {
+		if len(basket) == 0 {
+			return
+		}
+		counts.receipts++
+		sort.Slice(basket, func(i, j int) bool { return basket[i] < basket[j] })
+		for i, a := range basket {
+			counts.products[a]++
+			for _, b := range basket[i+1:] {
+				counts.pairs[basketPair{a, b}]++
+			}
+		}
+		basket = basket[:0]
+	}
+	for rows.Next() {
+		var line struct {
+			ReceiptID uint
+			ProductID uint
+		}
+		if err := db.ScanRows(rows, &line); err != nil {
+			return nil, err
+		}
+		if line.ReceiptID != receiptID {
+			flush()
+			receiptID = line.ReceiptID
+		}
+		basket = append(basket, line.ProductID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	if len(counts.products) > 0 {
+		ids := make([]uint, 0, len(counts.products))
+		for id := range counts.products {
+			ids = append(ids, id)
+		}
+		var products []models.Product
+		if err := db.Select("id, name").Where("id IN ?", ids).Find(&products).Error; err != nil {
+			return nil, err
+		}
+		for _, product := range products {
+			counts.names[product.ID] = product.Name
+		}
+	}
+	return counts, nil
+}
+
+// measures are support, confidence and lift of buying with after buying
+// from. Support is the percentage of receipts holding both, confidence the
+// percentage of receipts with from that also hold with, and lift how many
+// times likelier with is alongside from than on any receipt.
+func (counts *baskets) measures(together int, from, with uint) (support, confidence, lift float64) {
+	total := float64(counts.receipts)
+	support = float64(together) / total
+	confidence = float64(together) / float64(counts.products[from])
+	lift = confidence / (float64(counts.products[with]) / total)
+	return roundMoney(support * 100), roundMoney(confidence * 100), roundMoney(lift)
+}
+
+// ProductAssociation is a pair of products bought together. Confidence is
+// of buying the second after the first, ReverseConfidence the other way;
+// support and lift are the same both ways. Support and confidence are
+// percentages.
+type ProductAssociation struct {
+	ProductID         uint    `json:"product_id"`
+	ProductName       string  `json:"product_name"`
+	WithProductID     uint    `json:"with_product_id"`
+	WithProductName   string  `json:"with_product_name"`
+	Receipts          int     `json:"receipts"`
+	Support           float64 `json:"support"`
+	Confidence        float64 `json:"confidence"`
+	ReverseConfidence float64 `json:"reverse_confidence"`
+	Lift              float64 `json:"lift"`
+}
+
+// BasketAnalysis is the top associations over a period
+type BasketAnalysis struct {
+	From         time.Time            `json:"from"`
+	To           time.Time            `json:"to"`
+	Receipts     int                  `json:"receipts"`
+	SortBy       string               `json:"sort_by"`
+	MinReceipts  int                  `json:"min_receipts"`
+	Associations []ProductAssociation `json:"associations"`
+}
+
+// AlsoBought is a product bought on receipts with the one asked about
+type AlsoBought struct {
+	ProductID   uint    `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Receipts    int     `json:"receipts"`
+	Support     float64 `json:"support"`
+	Confidence  float64 `json:"confidence"`
+	Lift        float64 `json:"lift"`
+}
+
+// AlsoBoughtReport is what customers who bought a product also bought
+type AlsoBoughtReport struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Receipts    int       `json:"receipts"`
+	ProductID   uint      `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	// ProductReceipts is how many receipts held the product
+	ProductReceipts int          `json:"product_receipts"`
+	SortBy          string       `json:"sort_by"`
+	MinReceipts     int          `json:"min_receipts"`
+	AlsoBought      []AlsoBought `json:"also_bought"`
+}
+
+// parseBasketQuery reads the period and ?sort=, ?top= and ?min_receipts=,
+// the fewest receipts a pair must share to be reported
+func parseBasketQuery(c *gin.Context, defaultSort string) (start, end time.Time, sortBy string, top, minReceipts int, err error) {
+	start, end, err = parseDateRange(c)
+	if err != nil {
+		return start, end, "", 0, 0, errors.New("Invalid date range. Use YYYY-MM-DD")
+	}
+	sortBy = c.DefaultQuery("sort", defaultSort)
+	switch sortBy {
+	case BasketSortLift, BasketSortConfidence, BasketSortSupport:
+	default:
+		return start, end, "", 0, 0, errors.New("sort must be lift, confidence or support")
+	}
+	top = defaultBasketTop
+	if value := c.Query("top"); value != "" {
+		top, err = strconv.Atoi(value)
+		if err != nil || top < 1 {
+			return start, end, "", 0, 0, errors.New("top must be a positive whole number")
+		}
+		top = min(top, maxBasketTop)
+	}
+	minReceipts = defaultBasketMinCount
+	if value := c.Query("min_receipts"); value != "" {
+		minReceipts, err = strconv.Atoi(value)
+		if err != nil || minReceipts < 1 {
+			return start, end, "", 0, 0, errors.New("min_receipts must be a positive whole number")
+		}
+	}
+	return start, end, sortBy, top, minReceipts, nil
+}
+
+// basketRank is the measure associations are ordered by
+func basketRank(sortBy string, support, confidence, lift float64) float64 {
+	switch sortBy {
+	case BasketSortConfidence:
+		return confidence
+	case BasketSortSupport:
+		return support
+	}
+	return lift
+}
+
+// FetchBasketAnalysis reports the products most often bought together
+func (im *SalesManagementHandler) FetchBasketAnalysis(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+	start, end, sortBy, top, minReceipts, err := parseBasketQuery(c, BasketSortLift)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	counts, err := loadBaskets(im.db, userID, start, end)
+	if err != nil {
+		utils.ErrorLogger("Failed to load baskets for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch basket analysis"})
+		return
+	}
+
+	associations := []ProductAssociation{}
+	for pair, together := range counts.pairs {
+		if together < minReceipts {
+			continue
+		}
+		// Lead with the product whose buyers more often pick up the other
+		from, with := pair.a, pair.b
+		if counts.products[with] < counts.products[from] {
+			from, with = with, from
+		}
+		support, confidence, lift := counts.measures(together, from, with)
+		_, reverse, _ := counts.measures(together, with, from)
+		associations = append(associations, ProductAssociation{
+			ProductID:         from,
+			ProductName:       counts.names[from],
+			WithProductID:     with,
+			WithProductName:   counts.names[with],
+			Receipts:          together,
+			Support:           support,
+			Confidence:        confidence,
+			ReverseConfidence: reverse,
+			Lift:              lift,
+		})
+	}
+	sort.Slice(associations, func(i, j int) bool {
+		a, b := associations[i], associations[j]
+		rankA, rankB := basketRank(sortBy, a.Support, a.Confidence, a.Lift), basketRank(sortBy, b.Support, b.Confidence, b.Lift)
+		if rankA != rankB {
+			return rankA > rankB
+		}
+		if a.Receipts != b.Receipts {
+			return a.Receipts > b.Receipts
+		}
+		if a.ProductID != b.ProductID {
+			return a.ProductID < b.ProductID
+		}
+		return a.WithProductID < b.WithProductID
+	})
+	if len(associations) > top {
+		associations = associations[:top]
+	}
+
+	c.JSON(200, BasketAnalysis{
+		From:         start,
+		To:           end,
+		Receipts:     counts.receipts,
+		SortBy:       sortBy,
+		MinReceipts:  minReceipts,
+		Associations: associations,
+	})
+}
+
+// FetchAlsoBought reports what customers who bought a product also bought,
+// ranked by confidence unless ?sort= says otherwise
+func (im *SalesManagementHandler) FetchAlsoBought(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var product models.Product
+	if err := im.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "Product not found"})
+			return
+		}
+		utils.ErrorLogger("Failed to load product %s: %v", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Failed to fetch also bought products"})
+		return
+	}
+	start, end, sortBy, top, minReceipts, err := parseBasketQuery(c, BasketSortConfidence)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	counts, err := loadBaskets(im.db, userID, start, end)
+	if err != nil {
+		utils.ErrorLogger("Failed to load baskets for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch also bought products"})
+		return
+	}
+
+	alsoBought := []AlsoBought{}
+	for pair, together := range counts.pairs {
+		if together < minReceipts || (pair.a != product.ID && pair.b != product.ID) {
+			continue
+		}
+		with := pair.a
+		if with == product.ID {
+			with = pair.b
+		}
+		support, confidence, lift := counts.measures(together, product.ID, with)
+		alsoBought = append(alsoBought, AlsoBought{
+			ProductID:   with,
+			ProductName: counts.names[with],
+			Receipts:    together,
+			Support:     support,
+			Confidence:  confidence,
+			Lift:        lift,
+		})
+	}
+	sort.Slice(alsoBought, func(i, j int) bool {
+		a, b := alsoBought[i], alsoBought[j]
+		rankA, rankB := basketRank(sortBy, a.Support, a.Confidence, a.Lift), basketRank(sortBy, b.Support, b.Confidence, b.Lift)
+		if rankA != rankB {
+			return rankA > rankB
+		}
+		if a.Receipts != b.Receipts {
+			return a.Receipts > b.Receipts
+		}
+		return a.ProductID < b.ProductID
+	})
+	if len(alsoBought) > top {
+		alsoBought = alsoBought[:top]
+	}
+
+	c.JSON(200, AlsoBoughtReport{
+		From:            start,
+		To:              end,
+		Receipts:        counts.receipts,
+		ProductID:       product.ID,
+		ProductName:     product.Name,
+		ProductReceipts: counts.products[product.ID],
+		SortBy:          sortBy,
+		MinReceipts:     minReceipts,
+		AlsoBought:      alsoBought,
+	})
+}
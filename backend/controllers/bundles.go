@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// bundleComponentStock is a bundle component together with its current stock
+type bundleComponentStock struct {
+	models.BundleComponent
+	ComponentName       string  `json:"component_name"`
+	AverageCost         float64 `json:"average_cost"`
+	StockQuantity       int     `json:"stock_quantity"`
+	NegativeStockPolicy string  `json:"negative_stock_policy,omitempty"`
+}
+
+// loadBundleComponents returns the components of a bundle with their stock on hand
+func loadBundleComponents(db *gorm.DB, userID, bundleID uint) ([]bundleComponentStock, error) {
+	var components []bundleComponentStock
+	err := db.Table("bundle_components").
+		Select("bundle_components.*, products.name as component_name, products.average_cost as average_cost, products.negative_stock_policy as negative_stock_policy, COALESCE(inventory.quantity, 0) as stock_quantity").
+		Joins("JOIN products ON bundle_components.component_id = products.id").
+		Joins("LEFT JOIN inventory ON inventory.product_id = products.id AND inventory.user_id = bundle_components.user_id").
+		Where("bundle_components.user_id = ? AND bundle_components.bundle_id = ?", userID, bundleID).
+		Order("bundle_components.id").
+		Scan(&components).Error
+	return components, err
+}
+
+// loadBundlesComponents loads the components of several bundles at once, by bundle
+func loadBundlesComponents(db *gorm.DB, userID uint, bundleIDs []uint) (map[uint][]bundleComponentStock, error) {
+	bundles := make(map[uint][]bundleComponentStock)
+	if len(bundleIDs) == 0 {
+		return bundles, nil
+	}
+
+	var components []bundleComponentStock
+	err := db.Table("bundle_components").
+		Select("bundle_components.*, products.name as component_name, products.average_cost as average_cost, products.negative_stock_policy as negative_stock_policy, COALESCE(inventory.quantity, 0) as stock_quantity").
+		Joins("JOIN products ON bundle_components.component_id = products.id").
+		Joins("LEFT JOIN inventory ON inventory.product_id = products.id AND inventory.user_id = bundle_components.user_id").
+		Where("bundle_components.user_id = ? AND bundle_components.bundle_id IN ?", userID, bundleIDs).
+		Order("bundle_components.id").
+		Scan(&components).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, component := range components {
+		bundles[component.BundleID] = append(bundles[component.BundleID], component)
+	}
+	return bundles, nil
+}
+
+// bundleAvailability is the number of complete bundles the component stock can make up
+func bundleAvailability(components []bundleComponentStock) int {
+	if len(components) == 0 {
+		return 0
+	}
+	available := -1
+	for _, component := range components {
+		possible := 0
+		if component.StockQuantity > 0 && component.Quantity > 0 {
+			possible = component.StockQuantity / component.Quantity
+		}
+		if available == -1 || possible < available {
+			available = possible
+		}
+	}
+	return available
+}
+
+// bundleUnitCost is the cost of one bundle at the components' average cost
+func bundleUnitCost(components []bundleComponentStock) float64 {
+	var cost float64
+	for _, component := range components {
+		cost += component.AverageCost * float64(component.Quantity)
+	}
+	return roundMoney(cost)
+}
+
+// productQuantity returns stock on hand for a product, deriving it from
+// component stock when the product is a bundle.
+func productQuantity(db *gorm.DB, userID uint, product models.Product) int {
+	if product.IsBundle {
+		components, err := loadBundleComponents(db, userID, product.ID)
+		if err != nil {
+			utils.ErrorLogger("Failed to load bundle components for product %d: %v", product.ID, err)
+			return 0
+		}
+		return bundleAvailability(components)
+	}
+
+	var inventory models.Inventory
+	if err := db.Where("product_id = ? AND user_id = ?", product.ID, userID).First(&inventory).Error; err != nil {
+		return 0
+	}
+	return inventory.Quantity
+}
+
+// SetBundleComponents defines the products and quantities that make up a bundle
+func (im *InventoryManagementHandler) SetBundleComponents(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input struct {
+		Components []struct {
+			ProductID uint `json:"product_id" binding:"required"`
+			Quantity  int  `json:"quantity" binding:"required"`
+		} `json:"components" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse bundle components request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(input.Components) == 0 {
+		c.JSON(400, gin.H{"error": "At least one component is required"})
+		return
+	}
+
+	var bundle models.Product
+	if err := im.Db.Where("id = ? AND user_id = ?", id, userID).First(&bundle).Error; err != nil {
+		utils.WarningLogger("Bundle product not found for user %d: %v", userID, err)
+		c.JSON(404, gin.H{"error": "Product not found"})
+		return
+	}
+
+	// A component cannot become a bundle, as nested bundles are not
+	// supported, and a bundle's stock is its components' so it cannot hold
+	// any of its own
+	var memberships int64
+	if err := im.Db.Model(&models.BundleComponent{}).Where("component_id = ? AND user_id = ?", bundle.ID, userID).Count(&memberships).Error; err != nil {
+		utils.ErrorLogger("Failed to check bundles containing product %d: %v", bundle.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to save bundle components"})
+		return
+	}
+	if memberships > 0 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Product %d is a component of another bundle. Nested bundles are not supported", bundle.ID)})
+		return
+	}
+	if !bundle.IsBundle {
+		if onHand := productQuantity(im.Db, userID, bundle); onHand > 0 {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Product %d has %d in stock. Sell or adjust it to zero before making it a bundle", bundle.ID, onHand)})
+			return
+		}
+	}
+
+	seen := make(map[uint]bool)
+	for _, component := range input.Components {
+		if component.Quantity <= 0 {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Quantity for component %d must be greater than 0", component.ProductID)})
+			return
+		}
+		if component.ProductID == bundle.ID {
+			c.JSON(400, gin.H{"error": "A bundle cannot contain itself"})
+			return
+		}
+		if seen[component.ProductID] {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Component %d is listed more than once", component.ProductID)})
+			return
+		}
+		seen[component.ProductID] = true
+
+		var product models.Product
+		if err := im.Db.Where("id = ? AND user_id = ?", component.ProductID, userID).First(&product).Error; err != nil {
+			c.JSON(404, gin.H{"error": fmt.Sprintf("Component product %d not found", component.ProductID)})
+			return
+		}
+		if product.IsBundle {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Component %d is itself a bundle. Nested bundles are not supported", component.ProductID)})
+			return
+		}
+		if !product.Active {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Component %d is archived", component.ProductID)})
+			return
+		}
+	}
+
+	err := im.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bundle_id = ? AND user_id = ?", bundle.ID, userID).Delete(&models.BundleComponent{}).Error; err != nil {
+			return err
+		}
+		for _, component := range input.Components {
+			if err := tx.Create(&models.BundleComponent{
+				UserID:      userID,
+				BundleID:    bundle.ID,
+				ComponentID: component.ProductID,
+				Quantity:    component.Quantity,
+				CreatedAt:   time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&bundle).Update("is_bundle", true).Error
+	})
+	if err != nil {
+		utils.ErrorLogger("Failed to save bundle components for product %s: %v", id, err)
+		c.JSON(500, gin.H{"error": "Failed to save bundle components"})
+		return
+	}
+
+	utils.InfoLogger("Saved %d components for bundle %s of user %d", len(input.Components), id, userID)
+	im.GetBundleComponents(c)
+}
+
+// GetBundleComponents lists a bundle's components and how many bundles are available
+func (im *InventoryManagementHandler) GetBundleComponents(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var bundle models.Product
+	if err := im.Db.Where("id = ? AND user_id = ?", id, userID).First(&bundle).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Product not found"})
+		return
+	}
+	if !bundle.IsBundle {
+		c.JSON(400, gin.H{"error": "Product is not a bundle"})
+		return
+	}
+
+	components, err := loadBundleComponents(im.Db, userID, bundle.ID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load bundle components for product %s: %v", id, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch bundle components"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"product":    bundle,
+		"components": components,
+		"available":  bundleAvailability(components),
+		"unit_cost":  bundleUnitCost(components),
+	})
+}
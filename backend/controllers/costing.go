@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"math"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"gorm.io/gorm"
+)
+
+// weightedAverageCost returns the moving average unit cost after receiving
+// quantity units at unitCost on top of onHand units valued at currentCost.
+// Negative stock on hand carries no value, so it does not dilute the new cost.
+func weightedAverageCost(onHand int, currentCost float64, quantity int, unitCost float64) float64 {
+	if quantity <= 0 {
+		return currentCost
+	}
+	if onHand < 0 {
+		onHand = 0
+	}
+	totalUnits := onHand + quantity
+	totalValue := float64(onHand)*currentCost + float64(quantity)*unitCost
+	return roundMoney(totalValue / float64(totalUnits))
+}
+
+// receiveAtCost folds quantity units coming back into stock at unitCost into
+// the product's average cost. onHand is the stock after they arrived.
+func receiveAtCost(tx *gorm.DB, userID, productID uint, onHand, quantity int, unitCost float64) error {
+	var product models.Product
+	if err := tx.Select("id", "average_cost").Where("id = ? AND user_id = ?", productID, userID).First(&product).Error; err != nil {
+		return err
+	}
+	average := weightedAverageCost(onHand-quantity, product.AverageCost, quantity, unitCost)
+	if average == product.AverageCost {
+		return nil
+	}
+	return tx.Model(&product).Update("average_cost", average).Error
+}
+
+// grossMarginPercent returns the gross profit as a percentage of revenue.
+func grossMarginPercent(revenue, cost float64) float64 {
+	if revenue == 0 {
+		return 0
+	}
+	return roundMoney((revenue - cost) / revenue * 100)
+}
+
+// roundMoney rounds an amount to the nearest cent.
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -16,16 +16,39 @@ func NewCreditManager(db *gorm.DB) *CreditManager {
 	return &CreditManager{Db: db}
 }
 
+var creditListSpec = listSpec[models.CreditTransaction]{
+	id: listField[models.CreditTransaction]{column: "credit_transactions.id", kind: listNumber, value: func(r models.CreditTransaction) any { return r.ID }},
+	fields: map[string]listField[models.CreditTransaction]{
+		"name":          {column: "credit_transactions.name", kind: listText, value: func(r models.CreditTransaction) any { return r.Name }},
+		"phone_number":  {column: "credit_transactions.phone_number", kind: listText},
+		"customer_id":   {column: "credit_transactions.customer_id", kind: listNumber},
+		"receipt_id":    {column: "credit_transactions.receipt_id", kind: listNumber},
+		"status":        {column: "credit_transactions.status", kind: listText, value: func(r models.CreditTransaction) any { return r.Status }},
+		"credit_amount": {column: "credit_transactions.credit_amount", kind: listNumber, value: func(r models.CreditTransaction) any { return r.CreditAmount }},
+		"balance_due":   {column: "credit_transactions.balance_due", kind: listNumber, value: func(r models.CreditTransaction) any { return r.BalanceDue }},
+		"created_at":    {column: "credit_transactions.created_at", kind: listTime, value: func(r models.CreditTransaction) any { return r.CreatedAt }},
+	},
+	defaultSort: "-created_at",
+}
+
 func (cm *CreditManager) GetCreditsHistory(c *gin.Context) {
 	userID := c.GetUint("userID")
 	var transactions []models.CreditTransaction
 
-	if err := cm.Db.Where("user_id = ?", userID).Find(&transactions).Error; err != nil {
+	list, err := parseListQuery(c, creditListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := cm.Db.Model(&models.CreditTransaction{}).Where("user_id = ?", userID)
+	if err := list.find(query, &transactions); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching credit transactions"})
 		return
 	}
 
 	customerCredits := make(map[uint]*models.CreditCustomer)
+	var order []uint
 
 	for _, transaction := range transactions {
 		customerID := transaction.ID
@@ -39,6 +62,7 @@ func (cm *CreditManager) GetCreditsHistory(c *gin.Context) {
 				LastPaymentDate: transaction.CreatedAt,
 				Status:          "active",
 			}
+			order = append(order, customerID)
 		}
 
 		customer := customerCredits[customerID]
@@ -55,9 +79,10 @@ func (cm *CreditManager) GetCreditsHistory(c *gin.Context) {
 		}
 	}
 
+	// Keep the page in the order it was read
 	creditCustomers := make([]models.CreditCustomer, 0, len(customerCredits))
-	for _, customer := range customerCredits {
-		creditCustomers = append(creditCustomers, *customer)
+	for _, customerID := range order {
+		creditCustomers = append(creditCustomers, *customerCredits[customerID])
 	}
 
 	c.JSON(http.StatusOK, creditCustomers)
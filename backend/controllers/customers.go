@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errCustomerNotFound = errors.New("customer not found")
+	errCustomerPhone    = errors.New("invalid customer phone number")
+)
+
+type CustomerHandler struct {
+	db *gorm.DB
+}
+
+func NewCustomerHandler(db *gorm.DB) *CustomerHandler {
+	return &CustomerHandler{db: db}
+}
+
+// findOrCreateCustomer returns the customer with a phone number, creating
+// them under name when they are new. A customer's saved name is kept.
+func findOrCreateCustomer(tx *gorm.DB, userID uint, name, phone string) (*models.Customer, error) {
+	normalised, err := utils.NormalisePhone(phone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errCustomerPhone, phone)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = normalised
+	}
+
+	customer := models.Customer{UserID: userID, Name: name, Phone: normalised}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&customer).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ? AND phone = ?", userID, normalised).First(&customer).Error; err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// resolveSaleCustomer links a sale to a customer, by ID or by phone number,
+// and fills in the sale's customer name and phone from the customer record.
+// Sales without either are anonymous and return nil.
+func resolveSaleCustomer(tx *gorm.DB, userID uint, saleData *SaleData) (*models.Customer, error) {
+	var customer *models.Customer
+	switch {
+	case saleData.CustomerID != 0:
+		var found models.Customer
+		err := tx.Where("id = ? AND user_id = ?", saleData.CustomerID, userID).First(&found).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", errCustomerNotFound, saleData.CustomerID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		customer = &found
+	case strings.TrimSpace(saleData.CustomerPhone) != "":
+		found, err := findOrCreateCustomer(tx, userID, saleData.CustomerName, saleData.CustomerPhone)
+		if err != nil {
+			return nil, err
+		}
+		customer = found
+	default:
+		return nil, nil
+	}
+
+	if strings.TrimSpace(saleData.CustomerName) == "" {
+		saleData.CustomerName = customer.Name
+	}
+	saleData.CustomerPhone = customer.Phone
+	return customer, nil
+}
+
+// customerInput is the editable part of a customer
+type customerInput struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+	Email string `json:"email"`
+	Notes string `json:"notes"`
+}
+
+// CreateCustomer adds a customer. Phone numbers are unique per business.
+func (ch *CustomerHandler) CreateCustomer(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input customerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse customer request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if strings.TrimSpace(input.Name) == "" {
+		c.JSON(400, gin.H{"error": "Customer name is required"})
+		return
+	}
+	phone, err := utils.NormalisePhone(input.Phone)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "A valid phone number is required"})
+		return
+	}
+
+	var existing int64
+	if err := ch.db.Model(&models.Customer{}).Where("user_id = ? AND phone = ?", userID, phone).Count(&existing).Error; err != nil {
+		utils.ErrorLogger("Failed to check customer phone for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to create customer"})
+		return
+	}
+	if existing > 0 {
+		c.JSON(409, gin.H{"error": fmt.Sprintf("A customer with phone %s already exists", phone)})
+		return
+	}
+
+	customer := models.Customer{
+		UserID: userID,
+		Name:   strings.TrimSpace(input.Name),
+		Phone:  phone,
+		Email:  strings.TrimSpace(input.Email),
+		Notes:  input.Notes,
+	}
+	if err := ch.db.Create(&customer).Error; err != nil {
+		utils.ErrorLogger("Failed to create customer for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to create customer"})
+		return
+	}
+
+	c.JSON(201, customer)
+}
+
+var customerListSpec = listSpec[models.Customer]{
+	id: listField[models.Customer]{column: "customers.id", kind: listNumber, value: func(r models.Customer) any { return r.ID }},
+	fields: map[string]listField[models.Customer]{
+		"name":       {column: "customers.name", kind: listText, value: func(r models.Customer) any { return r.Name }},
+		"phone":      {column: "customers.phone", kind: listText, value: func(r models.Customer) any { return r.Phone }},
+		"email":      {column: "customers.email", kind: listText},
+		"created_at": {column: "customers.created_at", kind: listTime, value: func(r models.Customer) any { return r.CreatedAt }},
+	},
+	defaultSort: "name",
+	params:      []string{"q"},
+}
+
+// SearchCustomers lists customers, filtered by ?q= against name or phone
+func (ch *CustomerHandler) SearchCustomers(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	list, err := parseListQuery(c, customerListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := ch.db.Model(&models.Customer{}).Where("user_id = ?", userID)
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		// Search phones by their significant digits so 0712... finds 254712...
+		digits := strings.TrimLeft(strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, q), "0")
+		if digits != "" {
+			query = query.Where("LOWER(name) LIKE ? OR phone LIKE ?", "%"+strings.ToLower(q)+"%", "%"+digits+"%")
+		} else {
+			query = query.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(q)+"%")
+		}
+	}
+
+	var customers []models.Customer
+	if err := list.find(query, &customers); err != nil {
+		utils.ErrorLogger("Failed to search customers for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch customers"})
+		return
+	}
+
+	c.JSON(200, customers)
+}
+
+// loadCustomer loads one of the user's customers by the :id parameter
+func (ch *CustomerHandler) loadCustomer(c *gin.Context, userID uint) (*models.Customer, bool) {
+	var customer models.Customer
+	err := ch.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&customer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "Customer not found"})
+		return nil, false
+	}
+	if err != nil {
+		utils.ErrorLogger("Failed to load customer %s: %v", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Failed to load customer"})
+		return nil, false
+	}
+	return &customer, true
+}
+
+// customerSummary totals what a customer has bought and owes
+type customerSummary struct {
+	Receipts   int64   `json:"receipts"`
+	TotalSpent float64 `json:"total_spent"`
+	BalanceDue float64 `json:"balance_due"`
+}
+
+func loadCustomerSummary(db *gorm.DB, customer models.Customer) (customerSummary, error) {
+	var summary customerSummary
+	if err := db.Model(&models.Receipt{}).
+		Select("COUNT(*) as receipts, COALESCE(SUM(total_amount), 0) as total_spent").
+		Where("user_id = ? AND customer_id = ? AND status <> ?", customer.UserID, customer.ID, models.ReceiptVoided).
+		Scan(&summary).Error; err != nil {
+		return summary, err
+	}
+	if err := db.Model(&models.CreditTransaction{}).
+		Select("COALESCE(SUM(balance_due), 0)").
+		Where("user_id = ? AND customer_id = ? AND status = ?", customer.UserID, customer.ID, models.CreditPending).
+		Scan(&summary.BalanceDue).Error; err != nil {
+		return summary, err
+	}
+	summary.TotalSpent = roundMoney(summary.TotalSpent)
+	summary.BalanceDue = roundMoney(summary.BalanceDue)
+	return summary, nil
+}
+
+// GetCustomer returns a customer with their spending and balance
+func (ch *CustomerHandler) GetCustomer(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	customer, ok := ch.loadCustomer(c, userID)
+	if !ok {
+		return
+	}
+	summary, err := loadCustomerSummary(ch.db, *customer)
+	if err != nil {
+		utils.ErrorLogger("Failed to summarise customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to load customer"})
+		return
+	}
+
+	c.JSON(200, gin.H{"customer": customer, "summary": summary})
+}
+
+// UpdateCustomer edits a customer's details
+func (ch *CustomerHandler) UpdateCustomer(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	customer, ok := ch.loadCustomer(c, userID)
+	if !ok {
+		return
+	}
+
+	var input customerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse customer request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if name := strings.TrimSpace(input.Name); name != "" {
+		customer.Name = name
+	}
+	if input.Phone != "" {
+		phone, err := utils.NormalisePhone(input.Phone)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid phone number"})
+			return
+		}
+		var taken int64
+		if err := ch.db.Model(&models.Customer{}).Where("user_id = ? AND phone = ? AND id <> ?", userID, phone, customer.ID).Count(&taken).Error; err != nil {
+			utils.ErrorLogger("Failed to check customer phone for user %d: %v", userID, err)
+			c.JSON(500, gin.H{"error": "Failed to update customer"})
+			return
+		}
+		if taken > 0 {
+			c.JSON(409, gin.H{"error": fmt.Sprintf("Another customer already has phone %s", phone)})
+			return
+		}
+		customer.Phone = phone
+	}
+	customer.Email = strings.TrimSpace(input.Email)
+	customer.Notes = input.Notes
+
+	if err := ch.db.Save(customer).Error; err != nil {
+		utils.ErrorLogger("Failed to update customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to update customer"})
+		return
+	}
+
+	c.JSON(200, customer)
+}
+
+// DeleteCustomer removes a customer with no sales or credits. Customers
+// with history are kept so their receipts still say who bought.
+func (ch *CustomerHandler) DeleteCustomer(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	customer, ok := ch.loadCustomer(c, userID)
+	if !ok {
+		return
+	}
+
+	var receipts, credits int64
+	if err := ch.db.Model(&models.Receipt{}).Where("customer_id = ?", customer.ID).Count(&receipts).Error; err != nil {
+		utils.ErrorLogger("Failed to check receipts for customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to delete customer"})
+		return
+	}
+	if err := ch.db.Model(&models.CreditTransaction{}).Where("customer_id = ?", customer.ID).Count(&credits).Error; err != nil {
+		utils.ErrorLogger("Failed to check credits for customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to delete customer"})
+		return
+	}
+	if receipts > 0 || credits > 0 {
+		c.JSON(409, gin.H{"error": "Customer has purchase history and cannot be deleted"})
+		return
+	}
+
+	if err := ch.db.Delete(customer).Error; err != nil {
+		utils.ErrorLogger("Failed to delete customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to delete customer"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Customer deleted"})
+}
+
+// GetCustomerHistory returns a customer's receipts, newest first, with
+// their items and payments, and their credits
+func (ch *CustomerHandler) GetCustomerHistory(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	customer, ok := ch.loadCustomer(c, userID)
+	if !ok {
+		return
+	}
+
+	var receipts []models.Receipt
+	if err := ch.db.Preload("Items").Preload("Payments").
+		Where("user_id = ? AND customer_id = ?", userID, customer.ID).
+		Order("date DESC").
+		Find(&receipts).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch receipts for customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch purchase history"})
+		return
+	}
+
+	var credits []models.CreditTransaction
+	if err := ch.db.Where("user_id = ? AND customer_id = ?", userID, customer.ID).
+		Order("created_at DESC").
+		Find(&credits).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch credits for customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch purchase history"})
+		return
+	}
+
+	summary, err := loadCustomerSummary(ch.db, *customer)
+	if err != nil {
+		utils.ErrorLogger("Failed to summarise customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch purchase history"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"customer": customer,
+		"summary":  summary,
+		"receipts": receipts,
+		"credits":  credits,
+	})
+}
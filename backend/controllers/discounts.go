@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"gorm.io/gorm"
+)
+
+var (
+	errCouponInvalid   = errors.New("invalid coupon")
+	errCouponExhausted = errors.New("coupon usage limit reached")
+)
+
+// appliedDiscount is one discount given on a sale line or basket
+type appliedDiscount struct {
+	Source      string
+	Description string
+	PromotionID *uint
+	CouponID    *uint
+	Amount      float64
+}
+
+// pricedLine is a sale line with its stock taken and its price worked out
+type pricedLine struct {
+	Request        SellRequest
+	Product        models.Product
+	UnitCost       float64
+	StockException string
+	ListPrice      float64
+	Discounts      []appliedDiscount
+	Overrides      []models.PriceOverride
+}
+
+func (l *pricedLine) listAmount() float64 {
+	return roundMoney(l.ListPrice * float64(l.Request.Quantity))
+}
+
+func (l *pricedLine) discountAmount() float64 {
+	var total float64
+	for _, discount := range l.Discounts {
+		total += discount.Amount
+	}
+	return roundMoney(total)
+}
+
+func (l *pricedLine) netAmount() float64 {
+	return roundMoney(l.listAmount() - l.discountAmount())
+}
+
+// discountError is a cashier discount that cannot be applied to a line
+type discountError struct {
+	error
+}
+
+// priceLine prices a line from the product's list price at a time, less
+// the best running promotion, or at a keyed Amount, then less any cashier
+// discount. Keyed prices and discounts must pass the override authoriser.
+// Lines with an agreed price are priced as agreed instead.
+func priceLine(db *gorm.DB, userID uint, product models.Product, request SellRequest, promotions []models.Promotion, overrides *overrideAuthoriser, at time.Time) (*pricedLine, error) {
+	if request.agreed != nil {
+		return agreedLine(product, request), nil
+	}
+
+	listPrice, err := effectivePrice(db, userID, product.ID, at)
+	if err != nil {
+		return nil, err
+	}
+	line := &pricedLine{Request: request, Product: product, ListPrice: listPrice}
+
+	if request.Amount > 0 && math.Abs(request.Amount-line.listAmount()) > 0.005 {
+		if err := overrides.authorise(request.OverrideReason); err != nil {
+			return nil, err
+		}
+		line.Discounts = append(line.Discounts, appliedDiscount{
+			Source:      models.DiscountSourceOverride,
+			Description: "Price override: " + request.OverrideReason,
+			Amount:      roundMoney(line.listAmount() - request.Amount),
+		})
+		line.Overrides = append(line.Overrides, models.PriceOverride{
+			Kind:          models.OverridePrice,
+			ListAmount:    line.listAmount(),
+			ChargedAmount: roundMoney(request.Amount),
+			Reason:        request.OverrideReason,
+		})
+	} else if promotion, discount := bestPromotion(promotions, product, request.Quantity, line.ListPrice); promotion != nil {
+		line.Discounts = append(line.Discounts, appliedDiscount{
+			Source:      models.DiscountSourcePromotion,
+			Description: promotion.Name,
+			PromotionID: &promotion.ID,
+			Amount:      discount,
+		})
+	}
+
+	discount, err := manualDiscount(request.DiscountType, request.DiscountValue, line.netAmount())
+	if err != nil {
+		return nil, discountError{err}
+	}
+	if discount > 0 {
+		if err := overrides.authorise(request.OverrideReason); err != nil {
+			return nil, err
+		}
+		line.Overrides = append(line.Overrides, models.PriceOverride{
+			Kind:          models.OverrideLineDiscount,
+			ListAmount:    line.netAmount(),
+			ChargedAmount: roundMoney(line.netAmount() - discount),
+			Reason:        request.OverrideReason,
+		})
+		line.Discounts = append(line.Discounts, appliedDiscount{
+			Source:      models.DiscountSourceLine,
+			Description: "Line discount",
+			Amount:      discount,
+		})
+	}
+	return line, nil
+}
+
+// agreedLine prices a line at the list price and discount agreed on its
+// quotation or layaway. Keyed prices and discounts on it were authorised
+// when they were agreed, so they are not overrides of the sale.
+func agreedLine(product models.Product, request SellRequest) *pricedLine {
+	agreed := request.agreed
+	line := &pricedLine{Request: request, Product: product, ListPrice: agreed.ListPrice}
+	if agreed.DiscountAmount != 0 {
+		line.Discounts = append(line.Discounts, appliedDiscount{
+			Source:      agreed.Source,
+			Description: agreed.Description,
+			Amount:      agreed.DiscountAmount,
+		})
+	}
+	return line
+}
+
+// lineErrorStatus maps a priceLine error to an HTTP status
+func lineErrorStatus(err error) int {
+	var invalid discountError
+	if errors.As(err, &invalid) {
+		return 400
+	}
+	return overrideErrorStatus(err)
+}
+
+// manualDiscount works out a cashier-entered percentage or fixed discount on amount
+func manualDiscount(discountType string, value, amount float64) (float64, error) {
+	switch strings.ToUpper(discountType) {
+	case "":
+		if value != 0 {
+			return 0, errors.New("Discount type is required with a discount value")
+		}
+		return 0, nil
+	case models.DiscountPercent:
+		if value < 0 || value > 100 {
+			return 0, errors.New("Percentage discounts must be between 0 and 100")
+		}
+		return roundMoney(amount * value / 100), nil
+	case models.DiscountFixed:
+		if value < 0 || value > amount {
+			return 0, fmt.Errorf("Fixed discount must be between 0 and %.2f", amount)
+		}
+		return roundMoney(value), nil
+	}
+	return 0, fmt.Errorf("Unknown discount type %s", discountType)
+}
+
+// inDailyWindow reports whether at falls inside an "HH:MM" window. Windows
+// that end before they start run past midnight.
+func inDailyWindow(start, end string, at time.Time) bool {
+	if start == "" || end == "" {
+		return true
+	}
+	now := at.Format("15:04")
+	if start <= end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// loadActivePromotions returns the promotions running for a business at a time
+func loadActivePromotions(db *gorm.DB, userID uint, at time.Time) ([]models.Promotion, error) {
+	var promotions []models.Promotion
+	if err := db.Where("user_id = ? AND active = ? AND starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", userID, true, at, at).
+		Find(&promotions).Error; err != nil {
+		return nil, err
+	}
+
+	running := promotions[:0]
+	for _, promotion := range promotions {
+		if inDailyWindow(promotion.DailyStart, promotion.DailyEnd, at) {
+			running = append(running, promotion)
+		}
+	}
+	return running, nil
+}
+
+// promotionDiscount is what a promotion takes off quantity units at unitPrice
+func promotionDiscount(promotion models.Promotion, quantity int, unitPrice float64) float64 {
+	var discount float64
+	switch promotion.Type {
+	case models.PromotionPercentOff:
+		discount = unitPrice * float64(quantity) * promotion.Value / 100
+	case models.PromotionAmountOff:
+		discount = min(promotion.Value, unitPrice) * float64(quantity)
+	case models.PromotionFixedPrice:
+		discount = max(unitPrice-promotion.Value, 0) * float64(quantity)
+	case models.PromotionBuyXGetY:
+		group := promotion.BuyQuantity + promotion.FreeQuantity
+		if promotion.BuyQuantity <= 0 || promotion.FreeQuantity <= 0 {
+			return 0
+		}
+		discount = float64(quantity/group*promotion.FreeQuantity) * unitPrice
+	}
+	return roundMoney(max(discount, 0))
+}
+
+// bestPromotion picks the running promotion that saves the customer most on
+// a line. Promotions do not stack.
+func bestPromotion(promotions []models.Promotion, product models.Product, quantity int, unitPrice float64) (*models.Promotion, float64) {
+	var best *models.Promotion
+	var bestDiscount float64
+	for i := range promotions {
+		promotion := promotions[i]
+		if promotion.ProductID != nil && *promotion.ProductID != product.ID {
+			continue
+		}
+		if promotion.Category != "" && !strings.EqualFold(promotion.Category, product.Category) {
+			continue
+		}
+		if discount := promotionDiscount(promotion, quantity, unitPrice); discount > bestDiscount {
+			best, bestDiscount = &promotions[i], discount
+		}
+	}
+	return best, bestDiscount
+}
+
+// allocateDiscount spreads a basket discount over the lines in proportion to
+// their net amounts, so each line's stored net adds up to the receipt total.
+func allocateDiscount(lines []*pricedLine, discount appliedDiscount) {
+	var basket float64
+	for _, line := range lines {
+		basket += line.netAmount()
+	}
+	if basket <= 0 || discount.Amount <= 0 {
+		return
+	}
+
+	remaining := discount.Amount
+	for i, line := range lines {
+		share := roundMoney(discount.Amount * line.netAmount() / basket)
+		if i == len(lines)-1 {
+			share = roundMoney(remaining)
+		}
+		remaining -= share
+		lineDiscount := discount
+		lineDiscount.Amount = share
+		line.Discounts = append(line.Discounts, lineDiscount)
+	}
+}
+
+// redeemCoupon checks a coupon code against the basket and uses it once.
+// The usage count is bumped with a conditional UPDATE so two tills cannot
+// both take the last use.
+func redeemCoupon(tx *gorm.DB, userID uint, code string, basket float64, at time.Time) (models.Coupon, float64, error) {
+	var coupon models.Coupon
+	err := tx.Where("user_id = ? AND code = ? AND active = ?", userID, strings.ToUpper(strings.TrimSpace(code)), true).First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return coupon, 0, fmt.Errorf("%w: %s not found", errCouponInvalid, code)
+	}
+	if err != nil {
+		return coupon, 0, err
+	}
+	if coupon.StartsAt != nil && at.Before(*coupon.StartsAt) {
+		return coupon, 0, fmt.Errorf("%w: %s is not valid until %s", errCouponInvalid, coupon.Code, coupon.StartsAt.Format("2006-01-02"))
+	}
+	if coupon.ExpiresAt != nil && !at.Before(*coupon.ExpiresAt) {
+		return coupon, 0, fmt.Errorf("%w: %s has expired", errCouponInvalid, coupon.Code)
+	}
+	if basket < coupon.MinSpend {
+		return coupon, 0, fmt.Errorf("%w: %s needs a minimum spend of %.2f", errCouponInvalid, coupon.Code, coupon.MinSpend)
+	}
+
+	discount, err := manualDiscount(coupon.DiscountType, coupon.Value, basket)
+	if err != nil {
+		// A fixed coupon worth more than the basket takes the basket to zero
+		discount = basket
+	}
+
+	result := tx.Model(&models.Coupon{}).
+		Where("id = ? AND (usage_limit = 0 OR times_used < usage_limit)", coupon.ID).
+		Update("times_used", gorm.Expr("times_used + 1"))
+	if result.Error != nil {
+		return coupon, 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return coupon, 0, errCouponExhausted
+	}
+	return coupon, discount, nil
+}
@@ -0,0 +1,681 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultForecastHistory = 90
+	minForecastHistory     = 14
+	maxForecastHistory     = 730
+	defaultForecastDays    = 14
+	maxForecastDays        = 90
+	defaultForecastAlpha   = 0.3
+	// forecastWindow is the days averaged to seed the smoothed level
+	forecastWindow = 7
+	// forecastZ is how many standard errors either side the band spans,
+	// for roughly 95% of days
+	forecastZ = 1.96
+	// maxStockOutDays is how far ahead a stock-out is looked for
+	maxStockOutDays = 365
+)
+
+// demandModel is a product's daily demand as a smoothed level scaled by a
+// factor for each day of the week
+type demandModel struct {
+	level float64
+	// seasonal is the weekday's demand relative to an average day, Sunday first
+	seasonal [7]float64
+	// sigma is the standard deviation of the one day ahead errors made while
+	// fitting
+	sigma float64
+	mean  float64
+}
+
+// fitDemand fits a model to daily demand, where series[i] is the demand on
+// the day i days after first. Weekday factors are each weekday's average
+// over the overall average, once there are two weeks to go on. Demand with
+// those factors taken out is seeded with the moving average of the first
+// week and then exponentially smoothed with alpha.
+func fitDemand(series []float64, first time.Time, alpha float64) demandModel {
+	model := demandModel{}
+	for weekday := range model.seasonal {
+		model.seasonal[weekday] = 1
+	}
+	if len(series) == 0 {
+		return model
+	}
+
+	var total float64
+	var weekdayTotals [7]float64
+	var weekdayDays [7]int
+	for i, demand := range series {
+		total += demand
+		weekday := first.AddDate(0, 0, i).Weekday()
+		weekdayTotals[weekday] += demand
+		weekdayDays[weekday]++
+	}
+	model.mean = total / float64(len(series))
+	if len(series) >= 2*forecastWindow && model.mean > 0 {
+		for weekday := range model.seasonal {
+			if weekdayDays[weekday] > 0 {
+				model.seasonal[weekday] = weekdayTotals[weekday] / float64(weekdayDays[weekday]) / model.mean
+			}
+		}
+	}
+
+	// Demand with the day of the week taken out. Days the business never
+	// sells on carry no information about the level.
+	adjusted := func(i int) (float64, bool) {
+		factor := model.seasonal[first.AddDate(0, 0, i).Weekday()]
+		if factor == 0 {
+			return 0, false
+		}
+		return series[i] / factor, true
+	}
+
+	seed := min(forecastWindow, len(series))
+	var seeded float64
+	var seedDays int
+	for i := 0; i < seed; i++ {
+		if value, ok := adjusted(i); ok {
+			seeded += value
+			seedDays++
+		}
+	}
+	if seedDays > 0 {
+		model.level = seeded / float64(seedDays)
+	}
+
+	var squares float64
+	var errorDays int
+	for i := seed; i < len(series); i++ {
+		predicted := model.level * model.seasonal[first.AddDate(0, 0, i).Weekday()]
+		squares += (series[i] - predicted) * (series[i] - predicted)
+		errorDays++
+		if value, ok := adjusted(i); ok {
+			model.level = alpha*value + (1-alpha)*model.level
+		}
+	}
+	if errorDays > 0 {
+		model.sigma = math.Sqrt(squares / float64(errorDays))
+	}
+	return model
+}
+
+// predict is the expected demand on a day and the band around it
+func (model demandModel) predict(day time.Time) (forecast, lower, upper float64) {
+	forecast = model.level * model.seasonal[day.Weekday()]
+	spread := forecastZ * model.sigma
+	return forecast, math.Max(0, forecast-spread), forecast + spread
+}
+
+// stockOuts finds the days stock runs out on when demand follows the
+// forecast, the top of the band and the bottom of it. A nil date means it
+// lasts past maxStockOutDays.
+func (model demandModel) stockOuts(stock int, from time.Time) (expected, earliest, latest *string) {
+	if stock <= 0 {
+		day := from.Format("2006-01-02")
+		return &day, &day, &day
+	}
+	var forecastTotal, upperTotal, lowerTotal float64
+	for i := 0; i < maxStockOutDays && latest == nil; i++ {
+		day := from.AddDate(0, 0, i)
+		forecast, lower, upper := model.predict(day)
+		forecastTotal += forecast
+		upperTotal += upper
+		lowerTotal += lower
+		date := day.Format("2006-01-02")
+		if earliest == nil && upperTotal >= float64(stock) {
+			earliest = &date
+		}
+		if expected == nil && forecastTotal >= float64(stock) {
+			expected = &date
+		}
+		if lowerTotal >= float64(stock) {
+			latest = &date
+		}
+	}
+	return expected, earliest, latest
+}
+
+// localDay is midnight of the day t falls on in loc
+func localDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// daysBetween counts calendar days from one local midnight to another,
+// whatever daylight saving does in between
+func daysBetween(from, to time.Time) int {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(end.Sub(start).Hours() / 24)
+}
+
+// loadDailyDemand reads the units of each product sold on each day from
+// first up to end, net of returns and in the business's timezone. Bundles
+// sold count towards their components as well as themselves. A productID of
+// 0 loads every product.
+func loadDailyDemand(db *gorm.DB, userID, productID uint, first, end time.Time) (map[uint][]float64, error) {
+	components, err := loadBundleMakeup(db, userID, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	days := daysBetween(first, end)
+	query := db.Model(&models.SalesTransaction{}).
+		Select("product_id, quantity, created_at").
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, first, end)
+	if productID != 0 {
+		productIDs := []uint{productID}
+		for bundleID := range components {
+			productIDs = append(productIDs, bundleID)
+		}
+		query = query.Where("product_id IN ?", productIDs)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	demand := make(map[uint][]float64)
+	add := func(productID uint, index int, quantity float64) {
+		series, ok := demand[productID]
+		if !ok {
+			series = make([]float64, days)
+			demand[productID] = series
+		}
+		series[index] += quantity
+	}
+	for rows.Next() {
+		var line struct {
+			ProductID uint
+			Quantity  int
+			CreatedAt time.Time
+		}
+		if err := db.ScanRows(rows, &line); err != nil {
+			return nil, err
+		}
+		index := daysBetween(first, line.CreatedAt.In(first.Location()))
+		if index < 0 || index >= days {
+			continue
+		}
+		add(line.ProductID, index, float64(line.Quantity))
+		for _, component := range components[line.ProductID] {
+			add(component.ComponentID, index, float64(line.Quantity*component.Quantity))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// A day with more returned than sold had no demand, not negative demand
+	for _, series := range demand {
+		for i := range series {
+			series[i] = math.Max(0, series[i])
+		}
+	}
+	return demand, nil
+}
+
+// loadBundleMakeup loads the components of the user's bundles, by bundle.
+// A componentID other than 0 only loads the bundles it is part of.
+func loadBundleMakeup(db *gorm.DB, userID, componentID uint) (map[uint][]models.BundleComponent, error) {
+	query := db.Where("user_id = ?", userID)
+	if componentID != 0 {
+		query = query.Where("component_id = ?", componentID)
+	}
+	var components []models.BundleComponent
+	if err := query.Find(&components).Error; err != nil {
+		return nil, err
+	}
+	bundles := make(map[uint][]models.BundleComponent)
+	for _, component := range components {
+		bundles[component.BundleID] = append(bundles[component.BundleID], component)
+	}
+	return bundles, nil
+}
+
+// sinceCreated drops the days of a product's series from before it was
+// added, which would otherwise count as days it sold nothing
+func sinceCreated(series []float64, first time.Time, product models.Product) ([]float64, time.Time) {
+	skip := daysBetween(first, localDay(product.CreatedAt, first.Location()))
+	if skip <= 0 {
+		return series, first
+	}
+	skip = min(skip, len(series))
+	return series[skip:], first.AddDate(0, 0, skip)
+}
+
+// loadStockOnHand is the stock of each product in the inventory
+func loadStockOnHand(db *gorm.DB, userID uint, productIDs []uint) (map[uint]int, error) {
+	var rows []struct {
+		ProductID uint
+		Quantity  int
+	}
+	if err := db.Model(&models.Inventory{}).
+		Select("product_id, SUM(quantity) as quantity").
+		Where("user_id = ? AND product_id IN ?", userID, productIDs).
+		Group("product_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	stock := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		stock[row.ProductID] = row.Quantity
+	}
+	return stock, nil
+}
+
+// forecastQuery is the options a forecast is asked for with
+type forecastQuery struct {
+	history int
+	days    int
+	alpha   float64
+}
+
+// parseForecastQuery reads ?history= days of sales to fit on, ?days= to
+// forecast and ?alpha=, the weight smoothing gives the latest day
+func parseForecastQuery(c *gin.Context) (forecastQuery, error) {
+	query := forecastQuery{history: defaultForecastHistory, days: defaultForecastDays, alpha: defaultForecastAlpha}
+	if value := c.Query("history"); value != "" {
+		history, err := strconv.Atoi(value)
+		if err != nil || history < minForecastHistory || history > maxForecastHistory {
+			return query, errors.New("history must be a whole number of days from 14 to 730")
+		}
+		query.history = history
+	}
+	if value := c.Query("days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 || days > maxForecastDays {
+			return query, errors.New("days must be a whole number from 1 to 90")
+		}
+		query.days = days
+	}
+	if value := c.Query("alpha"); value != "" {
+		alpha, err := strconv.ParseFloat(value, 64)
+		if err != nil || alpha <= 0 || alpha >= 1 {
+			return query, errors.New("alpha must be between 0 and 1")
+		}
+		query.alpha = alpha
+	}
+	return query, nil
+}
+
+// forecastProduct loads the product a forecast is asked for, answering
+// the request itself when it cannot
+func (im *SalesManagementHandler) forecastProduct(c *gin.Context, userID uint) (*models.Product, bool) {
+	var product models.Product
+	err := im.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&product).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "Product not found"})
+		return nil, false
+	}
+	if err != nil {
+		utils.ErrorLogger("Failed to load product %s: %v", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Failed to load product"})
+		return nil, false
+	}
+	return &product, true
+}
+
+// ForecastDay is the demand expected on one day and the band it should
+// fall in
+type ForecastDay struct {
+	Date     string  `json:"date"`
+	Forecast float64 `json:"forecast"`
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+}
+
+// DemandForecast is a product's forecast daily demand from today. The
+// stock-out dates are when current stock runs out at the forecast, the top
+// of the band (earliest) and the bottom of it (latest); null when it lasts
+// beyond a year or the product has no stock record.
+type DemandForecast struct {
+	ProductID   uint    `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Timezone    string  `json:"timezone"`
+	HistoryFrom string  `json:"history_from"`
+	HistoryDays int     `json:"history_days"`
+	Alpha       float64 `json:"alpha"`
+	// AverageDailyDemand is over the history
+	AverageDailyDemand float64 `json:"average_daily_demand"`
+	Level              float64 `json:"level"`
+	// Seasonality is each weekday's demand relative to an average day
+	Seasonality      map[string]float64 `json:"seasonality"`
+	ErrorStdDev      float64            `json:"error_std_dev"`
+	StockOnHand      *int               `json:"stock_on_hand"`
+	StockOutDate     *string            `json:"stock_out_date"`
+	StockOutEarliest *string            `json:"stock_out_earliest"`
+	StockOutLatest   *string            `json:"stock_out_latest"`
+	Days             []ForecastDay      `json:"days"`
+}
+
+// buildForecast reports a fitted model over the days from today
+func buildForecast(product models.Product, model demandModel, query forecastQuery, historyFrom, today time.Time, stock *int) DemandForecast {
+	forecast := DemandForecast{
+		ProductID:          product.ID,
+		ProductName:        product.Name,
+		Timezone:           today.Location().String(),
+		HistoryFrom:        historyFrom.Format("2006-01-02"),
+		HistoryDays:        daysBetween(historyFrom, today),
+		Alpha:              query.alpha,
+		AverageDailyDemand: roundMoney(model.mean),
+		Level:              roundMoney(model.level),
+		Seasonality:        make(map[string]float64, 7),
+		ErrorStdDev:        roundMoney(model.sigma),
+		StockOnHand:        stock,
+		Days:               make([]ForecastDay, 0, query.days),
+	}
+	for weekday, factor := range model.seasonal {
+		forecast.Seasonality[time.Weekday(weekday).String()] = roundMoney(factor)
+	}
+	for i := 0; i < query.days; i++ {
+		day := today.AddDate(0, 0, i)
+		expected, lower, upper := model.predict(day)
+		forecast.Days = append(forecast.Days, ForecastDay{
+			Date:     day.Format("2006-01-02"),
+			Forecast: roundMoney(expected),
+			Lower:    roundMoney(lower),
+			Upper:    roundMoney(upper),
+		})
+	}
+	if stock != nil {
+		forecast.StockOutDate, forecast.StockOutEarliest, forecast.StockOutLatest = model.stockOuts(*stock, today)
+	}
+	return forecast
+}
+
+// FetchDemandForecast forecasts a product's daily demand from the sales of
+// the last ?history= days, not counting today's, which are still coming in
+func (im *SalesManagementHandler) FetchDemandForecast(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+	query, err := parseForecastQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	product, ok := im.forecastProduct(c, userID)
+	if !ok {
+		return
+	}
+
+	settings, err := loadBusinessSettings(im.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load business settings"})
+		return
+	}
+	today := localDay(time.Now(), businessLocation(settings))
+	historyFrom := today.AddDate(0, 0, -query.history)
+	demand, err := loadDailyDemand(im.db, userID, product.ID, historyFrom, today)
+	if err != nil {
+		utils.ErrorLogger("Failed to load demand for product %d: %v", product.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to forecast demand"})
+		return
+	}
+	stocks, err := loadStockOnHand(im.db, userID, []uint{product.ID})
+	if err != nil {
+		utils.ErrorLogger("Failed to load stock for product %d: %v", product.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to forecast demand"})
+		return
+	}
+
+	var stock *int
+	if quantity, ok := stocks[product.ID]; ok {
+		stock = &quantity
+	}
+	series := demand[product.ID]
+	if series == nil {
+		series = make([]float64, query.history)
+	}
+	series, historyFrom = sinceCreated(series, historyFrom, *product)
+	c.JSON(200, buildForecast(*product, fitDemand(series, historyFrom, query.alpha), query, historyFrom, today, stock))
+}
+
+// StockOutForecast is when an active product is forecast to run out
+type StockOutForecast struct {
+	ProductID   uint   `json:"product_id"`
+	ProductName string `json:"product_name"`
+	StockOnHand int    `json:"stock_on_hand"`
+	// Demand is the total forecast over the requested days
+	Demand           float64 `json:"demand"`
+	StockOutDate     *string `json:"stock_out_date"`
+	StockOutEarliest *string `json:"stock_out_earliest"`
+	StockOutLatest   *string `json:"stock_out_latest"`
+}
+
+// FetchStockOutForecasts forecasts every active stocked product and lists
+// them soonest to run out first. Products not forecast to run out within a
+// year come last.
+func (im *SalesManagementHandler) FetchStockOutForecasts(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+	query, err := parseForecastQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var products []models.Product
+	if err := im.db.Where("user_id = ? AND active = ? AND is_bundle = ?", userID, true, false).Find(&products).Error; err != nil {
+		utils.ErrorLogger("Failed to load products for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to forecast stock-outs"})
+		return
+	}
+	settings, err := loadBusinessSettings(im.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load business settings"})
+		return
+	}
+	today := localDay(time.Now(), businessLocation(settings))
+	historyFrom := today.AddDate(0, 0, -query.history)
+	demand, err := loadDailyDemand(im.db, userID, 0, historyFrom, today)
+	if err != nil {
+		utils.ErrorLogger("Failed to load demand for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to forecast stock-outs"})
+		return
+	}
+	ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	stocks, err := loadStockOnHand(im.db, userID, ids)
+	if err != nil {
+		utils.ErrorLogger("Failed to load stock for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to forecast stock-outs"})
+		return
+	}
+
+	forecasts := []StockOutForecast{}
+	for _, product := range products {
+		stock, ok := stocks[product.ID]
+		if !ok {
+			continue
+		}
+		series := demand[product.ID]
+		if series == nil {
+			series = make([]float64, query.history)
+		}
+		series, first := sinceCreated(series, historyFrom, product)
+		model := fitDemand(series, first, query.alpha)
+		forecast := StockOutForecast{ProductID: product.ID, ProductName: product.Name, StockOnHand: stock}
+		for i := 0; i < query.days; i++ {
+			expected, _, _ := model.predict(today.AddDate(0, 0, i))
+			forecast.Demand += expected
+		}
+		forecast.Demand = roundMoney(forecast.Demand)
+		forecast.StockOutDate, forecast.StockOutEarliest, forecast.StockOutLatest = model.stockOuts(stock, today)
+		forecasts = append(forecasts, forecast)
+	}
+	sort.SliceStable(forecasts, func(i, j int) bool {
+		a, b := forecasts[i].StockOutDate, forecasts[j].StockOutDate
+		switch {
+		case a == nil || b == nil:
+			return a != nil && b == nil
+		case *a != *b:
+			return *a < *b
+		}
+		return forecasts[i].ProductID < forecasts[j].ProductID
+	})
+
+	c.JSON(200, forecasts)
+}
+
+// BacktestDay compares a day held out of fitting with its forecast
+type BacktestDay struct {
+	ForecastDay
+	Actual float64 `json:"actual"`
+}
+
+// DemandBacktest is how a forecast fitted without the last ?days= days of
+// sales did against what actually sold on them. MAPE only counts days
+// with sales; WAPE, total error over total sold, copes with slow sellers.
+// NaiveMAE is the error of simply repeating the average of the week before
+// the holdout, which the forecast should beat to be worth trusting.
+type DemandBacktest struct {
+	ProductID   uint     `json:"product_id"`
+	ProductName string   `json:"product_name"`
+	Timezone    string   `json:"timezone"`
+	FitFrom     string   `json:"fit_from"`
+	HoldoutFrom string   `json:"holdout_from"`
+	HoldoutTo   string   `json:"holdout_to"`
+	Alpha       float64  `json:"alpha"`
+	Actual      float64  `json:"actual"`
+	Forecast    float64  `json:"forecast"`
+	MAE         float64  `json:"mae"`
+	RMSE        float64  `json:"rmse"`
+	MAPE        *float64 `json:"mape"`
+	WAPE        *float64 `json:"wape"`
+	// Bias is the average of forecast less actual; positive over-forecasts
+	Bias     float64 `json:"bias"`
+	NaiveMAE float64 `json:"naive_mae"`
+	// Coverage is the percentage of days that fell inside the band
+	Coverage float64       `json:"coverage"`
+	Days     []BacktestDay `json:"days"`
+}
+
+// FetchDemandBacktest fits a product's forecast on the ?history= days before
+// the last ?days= days and scores it against the sales on those days
+func (im *SalesManagementHandler) FetchDemandBacktest(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+	query, err := parseForecastQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	product, ok := im.forecastProduct(c, userID)
+	if !ok {
+		return
+	}
+
+	settings, err := loadBusinessSettings(im.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load business settings"})
+		return
+	}
+	today := localDay(time.Now(), businessLocation(settings))
+	holdoutFrom := today.AddDate(0, 0, -query.days)
+	fitFrom := holdoutFrom.AddDate(0, 0, -query.history)
+	demand, err := loadDailyDemand(im.db, userID, product.ID, fitFrom, today)
+	if err != nil {
+		utils.ErrorLogger("Failed to load demand for product %d: %v", product.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to back-test forecast"})
+		return
+	}
+	series := demand[product.ID]
+	if series == nil {
+		series = make([]float64, query.history+query.days)
+	}
+	fitted, holdout := series[:query.history], series[query.history:]
+	fitted, fitFrom = sinceCreated(fitted, fitFrom, *product)
+	model := fitDemand(fitted, fitFrom, query.alpha)
+
+	var naive float64
+	if week := fitted[max(0, len(fitted)-forecastWindow):]; len(week) > 0 {
+		for _, demand := range week {
+			naive += demand
+		}
+		naive /= float64(len(week))
+	}
+
+	report := DemandBacktest{
+		ProductID:   product.ID,
+		ProductName: product.Name,
+		Timezone:    today.Location().String(),
+		FitFrom:     fitFrom.Format("2006-01-02"),
+		HoldoutFrom: holdoutFrom.Format("2006-01-02"),
+		HoldoutTo:   today.AddDate(0, 0, -1).Format("2006-01-02"),
+		Alpha:       query.alpha,
+		Days:        make([]BacktestDay, 0, len(holdout)),
+	}
+	var absolute, squares, signed, naiveAbsolute, percentages float64
+	var salesDays, covered int
+	for i, actual := range holdout {
+		day := holdoutFrom.AddDate(0, 0, i)
+		expected, lower, upper := model.predict(day)
+		miss := expected - actual
+		absolute += math.Abs(miss)
+		squares += miss * miss
+		signed += miss
+		naiveAbsolute += math.Abs(naive - actual)
+		if actual > 0 {
+			percentages += math.Abs(miss) / actual
+			salesDays++
+		}
+		if actual >= lower && actual <= upper {
+			covered++
+		}
+		report.Actual += actual
+		report.Forecast += expected
+		report.Days = append(report.Days, BacktestDay{
+			ForecastDay: ForecastDay{Date: day.Format("2006-01-02"), Forecast: roundMoney(expected), Lower: roundMoney(lower), Upper: roundMoney(upper)},
+			Actual:      actual,
+		})
+	}
+	days := float64(len(holdout))
+	report.MAE = roundMoney(absolute / days)
+	report.RMSE = roundMoney(math.Sqrt(squares / days))
+	report.Bias = roundMoney(signed / days)
+	report.NaiveMAE = roundMoney(naiveAbsolute / days)
+	report.Coverage = roundMoney(float64(covered) * 100 / days)
+	if salesDays > 0 {
+		mape := roundMoney(percentages * 100 / float64(salesDays))
+		report.MAPE = &mape
+	}
+	if report.Actual > 0 {
+		wape := roundMoney(absolute * 100 / report.Actual)
+		report.WAPE = &wape
+	}
+	report.Actual = roundMoney(report.Actual)
+	report.Forecast = roundMoney(report.Forecast)
+
+	c.JSON(200, report)
+}
@@ -0,0 +1,342 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	rollupBatchSize    = 500
+	defaultHeatmapDays = 28
+	maxHeatmapDays     = 366
+)
+
+var errRollupBusy = errors.New("Sales rollup is being refreshed by another request")
+
+// businessLocation is the timezone a business reports in, falling back to
+// the default when it has none or an unknown one
+func businessLocation(settings models.BusinessSettings) *time.Location {
+	if settings.Timezone != "" {
+		if location, err := time.LoadLocation(settings.Timezone); err == nil {
+			return location
+		}
+	}
+	location, err := time.LoadLocation(models.DefaultTimezone)
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
+
+type rollupCell struct {
+	productID uint
+	day       string
+	hour      int
+}
+
+// rollupLine is a sales transaction as the rollup reads it
+type rollupLine struct {
+	ID           uint
+	ProductID    uint
+	SaleReturnID uint
+	Quantity     int
+	TotalAmount  float64
+	CreatedAt    time.Time
+}
+
+// resetSalesRollup throws the rollup away when the business has changed
+// timezone since it was built, so it is rebuilt in the new one
+func resetSalesRollup(db *gorm.DB, userID uint, location *time.Location) error {
+	state := models.SalesRollupState{UserID: userID, Timezone: location.String()}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&state).Error; err != nil {
+		return err
+	}
+	if err := db.Where("user_id = ?", userID).First(&state).Error; err != nil {
+		return err
+	}
+	if state.Timezone == location.String() {
+		return nil
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	result := tx.Model(&models.SalesRollupState{}).
+		Where("user_id = ? AND timezone = ?", userID, state.Timezone).
+		Update("timezone", location.String())
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Another request has already reset it
+		tx.Rollback()
+		return nil
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.SalesHourlyRollup{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Model(&models.SalesTransaction{}).
+		Where("user_id = ? AND rolled_up = ?", userID, true).
+		Update("rolled_up", false).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	utils.InfoLogger("Rebuilding sales rollup for user %d in %s (was %s)", userID, location, state.Timezone)
+	return tx.Commit().Error
+}
+
+// refreshSalesRollup adds sales transactions not yet counted to the hourly
+// rollup. Lines are claimed by flagging them before their hours are added
+// to, so two refreshes running at once never count a line twice; the one
+// that loses returns errRollupBusy.
+func refreshSalesRollup(db *gorm.DB, userID uint, location *time.Location) error {
+	if err := resetSalesRollup(db, userID, location); err != nil {
+		return err
+	}
+
+	for {
+		var lines []rollupLine
+		if err := db.Model(&models.SalesTransaction{}).
+			Select("id, product_id, sale_return_id, quantity, total_amount, created_at").
+			Where("user_id = ? AND rolled_up = ?", userID, false).
+			Order("id").
+			Limit(rollupBatchSize).
+			Scan(&lines).Error; err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			break
+		}
+
+		ids := make([]uint, 0, len(lines))
+		cells := make(map[rollupCell]*models.SalesHourlyRollup)
+		for _, line := range lines {
+			ids = append(ids, line.ID)
+			local := line.CreatedAt.In(location)
+			key := rollupCell{productID: line.ProductID, day: local.Format("2006-01-02"), hour: local.Hour()}
+			cell, ok := cells[key]
+			if !ok {
+				cell = &models.SalesHourlyRollup{UserID: userID, ProductID: key.productID, Day: key.day, Hour: key.hour, Weekday: int(local.Weekday())}
+				cells[key] = cell
+			}
+			if line.SaleReturnID == 0 {
+				cell.Transactions++
+			}
+			cell.Quantity += line.Quantity
+			cell.Revenue += line.TotalAmount
+		}
+
+		tx := db.Begin()
+		if tx.Error != nil {
+			return tx.Error
+		}
+		result := tx.Model(&models.SalesTransaction{}).
+			Where("id IN ? AND rolled_up = ?", ids, false).
+			Update("rolled_up", true)
+		if result.Error != nil {
+			tx.Rollback()
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(ids)) {
+			tx.Rollback()
+			return errRollupBusy
+		}
+		for _, cell := range cells {
+			cell.Revenue = roundMoney(cell.Revenue)
+			if err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "user_id"}, {Name: "product_id"}, {Name: "day"}, {Name: "hour"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"transactions": gorm.Expr("transactions + ?", cell.Transactions),
+					"quantity":     gorm.Expr("quantity + ?", cell.Quantity),
+					"revenue":      gorm.Expr("revenue + ?", cell.Revenue),
+					"updated_at":   time.Now(),
+				}),
+			}).Create(cell).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+		if len(lines) < rollupBatchSize {
+			break
+		}
+	}
+
+	return db.Model(&models.SalesRollupState{}).Where("user_id = ?", userID).Update("refreshed_at", time.Now()).Error
+}
+
+// HeatmapCell is the sales in one hour of one day of the week over the
+// window. AverageRevenue is per occurrence of that day in the window.
+type HeatmapCell struct {
+	Transactions   int     `json:"transactions"`
+	Quantity       int     `json:"quantity"`
+	Revenue        float64 `json:"revenue"`
+	AverageRevenue float64 `json:"average_revenue"`
+}
+
+// HeatmapPeak is the busiest hour of the week
+type HeatmapPeak struct {
+	Weekday string `json:"weekday"`
+	Hour    int    `json:"hour"`
+	HeatmapCell
+}
+
+// SalesHeatmap is sales by day of week (Sunday first) and hour of day in
+// the business's timezone
+type SalesHeatmap struct {
+	Timezone    string             `json:"timezone"`
+	From        string             `json:"from"`
+	To          string             `json:"to"`
+	Days        int                `json:"days"`
+	ProductID   uint               `json:"product_id,omitempty"`
+	Category    string             `json:"category,omitempty"`
+	Weekdays    [7]string          `json:"weekdays"`
+	Cells       [7][24]HeatmapCell `json:"cells"`
+	ByWeekday   [7]HeatmapCell     `json:"by_weekday"`
+	ByHour      [24]HeatmapCell    `json:"by_hour"`
+	Busiest     *HeatmapPeak       `json:"busiest"`
+	RefreshedAt time.Time          `json:"refreshed_at"`
+}
+
+// FetchSalesHeatmap reports sales by day of week and hour over the last
+// ?days= days (default 28), optionally for one ?product_id= or ?category=.
+// It reads the hourly rollup after bringing it up to date.
+func (im *SalesManagementHandler) FetchSalesHeatmap(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	days := defaultHeatmapDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxHeatmapDays {
+			c.JSON(400, gin.H{"error": "days must be a whole number from 1 to 366"})
+			return
+		}
+		days = parsed
+	}
+	var productID uint
+	if value := c.Query("product_id"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid product_id"})
+			return
+		}
+		productID = uint(parsed)
+	}
+	category := strings.TrimSpace(c.Query("category"))
+
+	settings, err := loadBusinessSettings(im.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load business settings"})
+		return
+	}
+	location := businessLocation(settings)
+
+	err = refreshSalesRollup(im.db, userID, location)
+	if errors.Is(err, errRollupBusy) {
+		utils.WarningLogger("Sales rollup for user %d is busy, reading it as it stands", userID)
+	} else if err != nil {
+		utils.ErrorLogger("Failed to refresh sales rollup for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch sales heatmap"})
+		return
+	}
+
+	today := time.Now().In(location)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, location)
+	from := today.AddDate(0, 0, -(days - 1))
+	heatmap := SalesHeatmap{
+		Timezone:  location.String(),
+		From:      from.Format("2006-01-02"),
+		To:        today.Format("2006-01-02"),
+		Days:      days,
+		ProductID: productID,
+		Category:  category,
+	}
+	for weekday := range heatmap.Weekdays {
+		heatmap.Weekdays[weekday] = time.Weekday(weekday).String()
+	}
+
+	query := im.db.Table("sales_hourly_rollups").
+		Select("sales_hourly_rollups.weekday, sales_hourly_rollups.hour, SUM(sales_hourly_rollups.transactions) as transactions, SUM(sales_hourly_rollups.quantity) as quantity, SUM(sales_hourly_rollups.revenue) as revenue").
+		Where("sales_hourly_rollups.user_id = ? AND sales_hourly_rollups.day >= ? AND sales_hourly_rollups.day <= ?", userID, heatmap.From, heatmap.To).
+		Group("sales_hourly_rollups.weekday, sales_hourly_rollups.hour")
+	if productID != 0 {
+		query = query.Where("sales_hourly_rollups.product_id = ?", productID)
+	}
+	if category != "" {
+		query = query.Joins("JOIN products ON products.id = sales_hourly_rollups.product_id").
+			Where("LOWER(products.category) = ?", strings.ToLower(category))
+	}
+	var cells []struct {
+		Weekday      int
+		Hour         int
+		Transactions int
+		Quantity     int
+		Revenue      float64
+	}
+	if err := query.Scan(&cells).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch sales heatmap for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch sales heatmap"})
+		return
+	}
+
+	// How many times each day of the week falls in the window
+	var occurrences [7]int
+	for day := from; !day.After(today); day = day.AddDate(0, 0, 1) {
+		occurrences[day.Weekday()]++
+	}
+	for _, cell := range cells {
+		if cell.Weekday < 0 || cell.Weekday > 6 || cell.Hour < 0 || cell.Hour > 23 {
+			continue
+		}
+		heatmap.Cells[cell.Weekday][cell.Hour] = HeatmapCell{Transactions: cell.Transactions, Quantity: cell.Quantity, Revenue: roundMoney(cell.Revenue)}
+	}
+	for weekday := range heatmap.Cells {
+		for hour := range heatmap.Cells[weekday] {
+			cell := &heatmap.Cells[weekday][hour]
+			if occurrences[weekday] > 0 {
+				cell.AverageRevenue = roundMoney(cell.Revenue / float64(occurrences[weekday]))
+			}
+			for _, total := range []*HeatmapCell{&heatmap.ByWeekday[weekday], &heatmap.ByHour[hour]} {
+				total.Transactions += cell.Transactions
+				total.Quantity += cell.Quantity
+				total.Revenue = roundMoney(total.Revenue + cell.Revenue)
+			}
+			if cell.Transactions > 0 && (heatmap.Busiest == nil || cell.Transactions > heatmap.Busiest.Transactions ||
+				(cell.Transactions == heatmap.Busiest.Transactions && cell.Revenue > heatmap.Busiest.Revenue)) {
+				heatmap.Busiest = &HeatmapPeak{Weekday: heatmap.Weekdays[weekday], Hour: hour, HeatmapCell: *cell}
+			}
+		}
+		if occurrences[weekday] > 0 {
+			heatmap.ByWeekday[weekday].AverageRevenue = roundMoney(heatmap.ByWeekday[weekday].Revenue / float64(occurrences[weekday]))
+		}
+	}
+	for hour := range heatmap.ByHour {
+		heatmap.ByHour[hour].AverageRevenue = roundMoney(heatmap.ByHour[hour].Revenue / float64(days))
+	}
+
+	var state models.SalesRollupState
+	if err := im.db.Where("user_id = ?", userID).First(&state).Error; err == nil {
+		heatmap.RefreshedAt = state.RefreshedAt
+	}
+
+	c.JSON(200, heatmap)
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -8,12 +9,14 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/OAthooh/BiasharaTrack.git/models"
 	"github.com/OAthooh/BiasharaTrack.git/utils"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type InventoryManagementHandler struct {
@@ -102,6 +105,37 @@ func (im *InventoryManagementHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	// Parse cost price (optional, defaults to zero when the cost is unknown)
+	if costValue := c.Request.FormValue("cost_price"); costValue != "" {
+		cost, err := strconv.ParseFloat(costValue, 64)
+		if err != nil || cost < 0 {
+			utils.ErrorLogger("Invalid cost price format: %v", err)
+			c.JSON(400, gin.H{"error": "Invalid cost price format"})
+			return
+		}
+		product.CostPrice = cost
+		product.AverageCost = cost
+	}
+
+	// Parse tax class (optional, defaults to standard-rated)
+	product.TaxClass = models.TaxStandard
+	if taxClass := strings.ToUpper(c.Request.FormValue("tax_class")); taxClass != "" {
+		if !models.TaxClasses[taxClass] {
+			c.JSON(400, gin.H{"error": "Tax class must be STANDARD, ZERO_RATED or EXEMPT"})
+			return
+		}
+		product.TaxClass = taxClass
+	}
+
+	// Parse negative stock policy (optional, empty inherits the business policy)
+	if policy := strings.ToUpper(c.Request.FormValue("negative_stock_policy")); policy != "" {
+		if !models.StockPolicies[policy] {
+			c.JSON(400, gin.H{"error": "Negative stock policy must be BLOCK, ALLOW_NEGATIVE or BACKORDER"})
+			return
+		}
+		product.NegativeStockPolicy = policy
+	}
+
 	// Parse quantity
 	var quantity int
 	if q, err := strconv.Atoi(c.Request.FormValue("quantity")); err == nil {
@@ -151,6 +185,14 @@ func (im *InventoryManagementHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	// Record the opening price so effective price lookups cover the product's whole life
+	if err := recordPriceChange(tx, userID, product, product.Price, "Initial price"); err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to record initial price: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to create product"})
+		return
+	}
+
 	// Create inventory record
 	inventory := models.Inventory{
 		UserID:            userID,
@@ -218,9 +260,9 @@ func (im *InventoryManagementHandler) UpdateProduct(c *gin.Context) {
 		}
 	}()
 
-	// Update product
+	// Update product, locking the row so concurrent purchases see each other's average cost
 	product := models.Product{}
-	if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&product).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND user_id = ?", id, userID).First(&product).Error; err != nil {
 		tx.Rollback()
 		utils.ErrorLogger("Product not found for user %d: %v", userID, err)
 		c.JSON(404, gin.H{"error": "Product not found"})
@@ -237,32 +279,114 @@ func (im *InventoryManagementHandler) UpdateProduct(c *gin.Context) {
 	if category, ok := input["category"].(string); ok {
 		product.Category = category
 	}
+	oldPrice := product.Price
 	if price, ok := input["price"].(float64); ok {
+		if price <= 0 {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": "Price must be greater than 0"})
+			return
+		}
 		product.Price = price
 	}
+	if costPrice, ok := input["cost_price"].(float64); ok {
+		if costPrice < 0 {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": "Cost price must be non-negative"})
+			return
+		}
+		// A direct cost edit is a correction, so it resets the running average
+		product.CostPrice = costPrice
+		product.AverageCost = costPrice
+	}
 	if barcode, ok := input["barcode"].(string); ok {
 		product.Barcode = barcode
 	}
+	if taxClass, ok := input["tax_class"].(string); ok {
+		taxClass = strings.ToUpper(taxClass)
+		if !models.TaxClasses[taxClass] {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": "Tax class must be STANDARD, ZERO_RATED or EXEMPT"})
+			return
+		}
+		product.TaxClass = taxClass
+	}
+	if policy, ok := input["negative_stock_policy"].(string); ok {
+		policy = strings.ToUpper(policy)
+		if policy != "" && !models.StockPolicies[policy] {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": "Negative stock policy must be BLOCK, ALLOW_NEGATIVE or BACKORDER"})
+			return
+		}
+		product.NegativeStockPolicy = policy
+	}
 	if photoPath, ok := input["photo_path"].(string); ok {
 		product.PhotoPath = photoPath
 	}
 
-	product.UpdatedAt = time.Now()
-
-	if err := tx.Save(&product).Error; err != nil {
-		tx.Rollback()
-		utils.ErrorLogger("Failed to update product for user %d: %v", userID, err)
-		c.JSON(500, gin.H{"error": "Failed to update product"})
-		return
-	}
-
 	// Handle quantity changes
 	if quantityChange, ok := input["quantity_change"].(float64); ok {
+		changeType, err := updateChangeType(input["change_type"], int(quantityChange))
+		if err != nil {
+			tx.Rollback()
+			utils.WarningLogger("Invalid stock change for product %s: %v", id, err)
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if product.IsBundle {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": "Bundle stock is derived from its components. Adjust the components instead"})
+			return
+		}
+
+		unitCost, hasUnitCost := input["unit_cost"].(float64)
+		if hasUnitCost && unitCost < 0 {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": "Unit cost must be non-negative"})
+			return
+		}
+		if !hasUnitCost {
+			unitCost = product.AverageCost
+		}
+
+		// Update inventory atomically; decrements fail rather than going below zero
+		inventory, err := changeStock(tx, userID, product.ID, int(quantityChange))
+		if errors.Is(err, gorm.ErrRecordNotFound) && quantityChange >= 0 {
+			inventory = models.Inventory{
+				ProductID:   product.ID,
+				UserID:      userID,
+				Quantity:    int(quantityChange),
+				LastUpdated: time.Now(),
+			}
+			err = tx.Create(&inventory).Error
+		}
+		if errors.Is(err, errInsufficientStock) || errors.Is(err, gorm.ErrRecordNotFound) {
+			tx.Rollback()
+			utils.WarningLogger("Insufficient stock to apply change %d to product %s", int(quantityChange), id)
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Insufficient stock for product %d", product.ID)})
+			return
+		}
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to update inventory for user %d: %v", userID, err)
+			c.JSON(500, gin.H{"error": "Failed to update inventory"})
+			return
+		}
+
+		// Positive movements bring stock in at unitCost and shift the average
+		if quantityChange > 0 {
+			onHand := inventory.Quantity - int(quantityChange)
+			product.AverageCost = weightedAverageCost(onHand, product.AverageCost, int(quantityChange), unitCost)
+			if hasUnitCost {
+				product.CostPrice = unitCost
+			}
+		}
+
 		stockMovement := models.StockMovement{
 			ProductID:      product.ID,
 			UserID:         userID,
-			ChangeType:     input["change_type"].(string),
+			ChangeType:     changeType,
 			QuantityChange: int(quantityChange),
+			UnitCost:       unitCost,
 			Note:           "Product details updated",
 			CreatedAt:      time.Now(),
 		}
@@ -274,33 +398,37 @@ func (im *InventoryManagementHandler) UpdateProduct(c *gin.Context) {
 			return
 		}
 
-		// Update inventory
-		var inventory models.Inventory
-		if err := tx.Where("product_id = ? AND user_id = ?", product.ID, userID).First(&inventory).Error; err != nil {
-			inventory = models.Inventory{
-				ProductID:   product.ID,
-				UserID:      userID,
-				Quantity:    int(quantityChange),
-				LastUpdated: time.Now(),
-			}
-			if err := tx.Create(&inventory).Error; err != nil {
-				tx.Rollback()
-				utils.ErrorLogger("Failed to create inventory for user %d: %v", userID, err)
-				c.JSON(500, gin.H{"error": "Failed to update inventory"})
-				return
-			}
-		} else {
-			inventory.Quantity += int(quantityChange)
-			inventory.LastUpdated = time.Now()
-			if err := tx.Save(&inventory).Error; err != nil {
+		// Newly received stock goes to open backorders first
+		if quantityChange > 0 {
+			if _, err := fulfilBackorders(tx, userID, product.ID, product.AverageCost); err != nil {
 				tx.Rollback()
-				utils.ErrorLogger("Failed to update inventory for user %d: %v", userID, err)
-				c.JSON(500, gin.H{"error": "Failed to update inventory"})
+				utils.ErrorLogger("Failed to fulfil backorders for product %d: %v", product.ID, err)
+				c.JSON(500, gin.H{"error": "Failed to fulfil backorders"})
 				return
 			}
 		}
 	}
 
+	product.UpdatedAt = time.Now()
+
+	if err := tx.Save(&product).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to update product for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to update product"})
+		return
+	}
+
+	// Keep a history of every price change
+	if product.Price != oldPrice {
+		reason, _ := input["price_change_reason"].(string)
+		if err := recordPriceChange(tx, userID, product, oldPrice, reason); err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to record price change for user %d: %v", userID, err)
+			c.JSON(500, gin.H{"error": "Failed to record price change"})
+			return
+		}
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		utils.ErrorLogger("Failed to commit transaction for user %d: %v", userID, err)
 		c.JSON(500, gin.H{"error": "Failed to update product"})
@@ -340,11 +468,17 @@ func (im *InventoryManagementHandler) DeleteProduct(c *gin.Context) {
 	}
 
 	// Mark the product as inactive
-	if err := im.Db.Model(&models.Product{}).Where("id = ? AND user_id = ?", id, userID).Update("active", false).Error; err != nil {
-		utils.ErrorLogger("Failed to mark product %s as inactive for user %d: %v", id, userID, err)
+	result := im.Db.Model(&models.Product{}).Where("id = ? AND user_id = ?", id, userID).Update("active", false)
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to mark product %s as inactive for user %d: %v", id, userID, result.Error)
 		c.JSON(500, gin.H{"error": "Failed to mark product as inactive"})
 		return
 	}
+	if result.RowsAffected == 0 {
+		utils.WarningLogger("Product %s not found for user %d", id, userID)
+		c.JSON(404, gin.H{"error": "Product not found"})
+		return
+	}
 
 	utils.InfoLogger("Successfully marked product %s as inactive for user %d", id, userID)
 	c.JSON(200, gin.H{"message": "Product marked as inactive successfully"})
@@ -369,9 +503,7 @@ func (im *InventoryManagementHandler) GetProduct(c *gin.Context) {
 		return
 	}
 
-	if err := im.Db.Where("product_id = ? AND user_id = ?", id, userID).First(&inventory).Error; err != nil {
-		inventory.Quantity = 0
-	}
+	inventory.Quantity = productQuantity(im.Db, userID, product)
 
 	response := gin.H{
 		"product":  product,
@@ -382,6 +514,63 @@ func (im *InventoryManagementHandler) GetProduct(c *gin.Context) {
 	c.JSON(200, response)
 }
 
+// productRow is a product read together with its own stock on hand
+type productRow struct {
+	models.Product
+	StockQuantity int
+}
+
+func productListSpec(defaultSort string) listSpec[productRow] {
+	return listSpec[productRow]{
+		id: listField[productRow]{column: "products.id", kind: listNumber, value: func(r productRow) any { return r.ID }},
+		fields: map[string]listField[productRow]{
+			"name":       {column: "products.name", kind: listText, value: func(r productRow) any { return r.Name }},
+			"category":   {column: "products.category", kind: listText, value: func(r productRow) any { return r.Category }},
+			"price":      {column: "products.price", kind: listNumber, value: func(r productRow) any { return r.Price }},
+			"barcode":    {column: "products.barcode", kind: listText},
+			"tax_class":  {column: "products.tax_class", kind: listText},
+			"is_bundle":  {column: "products.is_bundle", kind: listBool},
+			"created_at": {column: "products.created_at", kind: listTime, value: func(r productRow) any { return r.CreatedAt }},
+			"updated_at": {column: "products.updated_at", kind: listTime, value: func(r productRow) any { return r.UpdatedAt }},
+		},
+		defaultSort: defaultSort,
+	}
+}
+
+// findProducts reads a page of the user's active or archived products with
+// their stock, joining inventory and loading bundle components in one go
+func (im *InventoryManagementHandler) findProducts(list *listQuery[productRow], userID uint, active bool) ([]productRow, map[uint][]bundleComponentStock, error) {
+	var rows []productRow
+	query := im.Db.Table("products").
+		Select("products.*, COALESCE(inventory.quantity, 0) as stock_quantity").
+		Joins("LEFT JOIN inventory ON inventory.product_id = products.id AND inventory.user_id = products.user_id").
+		Where("products.user_id = ? AND products.active = ?", userID, active)
+	if err := list.find(query, &rows); err != nil {
+		return nil, nil, err
+	}
+
+	var bundleIDs []uint
+	for _, row := range rows {
+		if row.IsBundle {
+			bundleIDs = append(bundleIDs, row.ID)
+		}
+	}
+	bundles, err := loadBundlesComponents(im.Db, userID, bundleIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rows, bundles, nil
+}
+
+// stockOnHand is a listed product's stock, derived from its components when
+// it is a bundle
+func (row productRow) stockOnHand(bundles map[uint][]bundleComponentStock) int {
+	if row.IsBundle {
+		return bundleAvailability(bundles[row.ID])
+	}
+	return row.StockQuantity
+}
+
 func (im *InventoryManagementHandler) GetAllProducts(c *gin.Context) {
 	userID := c.GetUint("userID")
 
@@ -391,24 +580,24 @@ func (im *InventoryManagementHandler) GetAllProducts(c *gin.Context) {
 		return
 	}
 
-	var products []models.Product
-	var result []gin.H
+	list, err := parseListQuery(c, productListSpec("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := im.Db.Where("user_id = ?", userID).Find(&products).Error; err != nil {
+	var result []gin.H
+	rows, bundles, err := im.findProducts(list, userID, true)
+	if err != nil {
 		utils.ErrorLogger("Failed to fetch products for user %d: %v", userID, err)
 		c.JSON(500, gin.H{"error": "Failed to get products"})
 		return
 	}
 
-	for _, product := range products {
-		var inventory models.Inventory
-		if err := im.Db.Where("product_id = ? AND user_id = ?", product.ID, userID).First(&inventory).Error; err != nil {
-			inventory.Quantity = 0
-		}
-
+	for _, row := range rows {
 		result = append(result, gin.H{
-			"product":  product,
-			"quantity": inventory.Quantity,
+			"product":  row.Product,
+			"quantity": row.stockOnHand(bundles),
 		})
 	}
 
@@ -435,6 +624,28 @@ func isAllowedImageType(file multipart.File) bool {
 	return allowedTypes[contentType]
 }
 
+// lowStockAlertRow is the latest alert for a product with its current stock
+type lowStockAlertRow struct {
+	models.LowStockAlert
+	ProductName     string `json:"product_name"`
+	CurrentQuantity int    `json:"current_quantity"`
+	StockThreshold  int    `json:"stock_threshold"`
+}
+
+var lowStockAlertListSpec = listSpec[lowStockAlertRow]{
+	id: listField[lowStockAlertRow]{column: "low_stock_alerts.id", kind: listNumber, value: func(r lowStockAlertRow) any { return r.ID }},
+	fields: map[string]listField[lowStockAlertRow]{
+		"product_id":       {column: "low_stock_alerts.product_id", kind: listNumber, value: func(r lowStockAlertRow) any { return r.ProductID }},
+		"product_name":     {column: "products.name", kind: listText, value: func(r lowStockAlertRow) any { return r.ProductName }},
+		"category":         {column: "products.category", kind: listText},
+		"resolved":         {column: "low_stock_alerts.resolved", kind: listBool},
+		"current_quantity": {column: "inventory.quantity", kind: listNumber, value: func(r lowStockAlertRow) any { return r.CurrentQuantity }},
+		"stock_threshold":  {column: "inventory.low_stock_threshold", kind: listNumber, value: func(r lowStockAlertRow) any { return r.StockThreshold }},
+		"created_at":       {column: "low_stock_alerts.created_at", kind: listTime, value: func(r lowStockAlertRow) any { return r.CreatedAt }},
+	},
+	defaultSort: "-created_at",
+}
+
 func (im *InventoryManagementHandler) GetLowStockAlerts(c *gin.Context) {
 	userID := c.GetUint("userID")
 	if userID == 0 {
@@ -443,24 +654,24 @@ func (im *InventoryManagementHandler) GetLowStockAlerts(c *gin.Context) {
 		return
 	}
 
-	var alerts []struct {
-		models.LowStockAlert
-		ProductName     string `json:"product_name"`
-		CurrentQuantity int    `json:"current_quantity"`
-		StockThreshold  int    `json:"stock_threshold"`
+	list, err := parseListQuery(c, lowStockAlertListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
 	}
 
+	var alerts []lowStockAlertRow
 	// Using MySQL compatible syntax
-	if err := im.Db.Table("low_stock_alerts").
+	query := im.Db.Table("low_stock_alerts").
 		Select("low_stock_alerts.*, products.name as product_name, inventory.quantity as current_quantity, inventory.low_stock_threshold as stock_threshold").
 		Joins("JOIN products ON low_stock_alerts.product_id = products.id").
 		Joins("JOIN inventory ON products.id = inventory.product_id").
-		Where("low_stock_alerts.user_id = ?", userID).
+		Where("low_stock_alerts.user_id = ? AND products.active = ?", userID, true).
 		Where("low_stock_alerts.id IN (?)",
 			im.Db.Table("low_stock_alerts").
 				Select("MAX(id)").
-				Group("product_id")).
-		Find(&alerts).Error; err != nil {
+				Group("product_id"))
+	if err := list.find(query, &alerts); err != nil {
 		utils.ErrorLogger("Failed to fetch alerts for user %d: %v", userID, err)
 		c.JSON(500, gin.H{"error": "Failed to fetch alerts"})
 		return
@@ -539,7 +750,7 @@ func (im *InventoryManagementHandler) SearchProducts(c *gin.Context) {
 	err := im.Db.Table("products").
 		Select("products.*, inventory.quantity").
 		Joins("left join inventory on inventory.product_id = products.id").
-		Where("products.user_id = ?", userID).
+		Where("products.user_id = ? AND products.active = ?", userID, true).
 		Where("products.name LIKE ? OR products.description LIKE ? OR products.barcode LIKE ?",
 			"%"+query+"%", "%"+query+"%", "%"+query+"%").
 		Find(&products).Error
@@ -549,6 +760,13 @@ func (im *InventoryManagementHandler) SearchProducts(c *gin.Context) {
 		return
 	}
 
+	// Bundle stock is derived from its components
+	for i := range products {
+		if products[i].IsBundle {
+			products[i].Quantity = productQuantity(im.Db, userID, products[i].Product)
+		}
+	}
+
 	c.JSON(200, products)
 }
 
@@ -560,7 +778,7 @@ func (im *InventoryManagementHandler) GetProducts(c *gin.Context) {
 	}
 
 	var products []models.Product
-	if err := im.Db.Where("user_id = ?", userID).Find(&products).Error; err != nil {
+	if err := im.Db.Where("user_id = ? AND active = ?", userID, true).Find(&products).Error; err != nil {
 		c.JSON(500, gin.H{"error": "Failed to fetch products"})
 		return
 	}
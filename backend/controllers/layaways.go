@@ -0,0 +1,801 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errLayawayNotOpen = errors.New("Layaway is no longer open")
+
+type LayawayHandler struct {
+	db *gorm.DB
+}
+
+func NewLayawayHandler(db *gorm.DB) *LayawayHandler {
+	return &LayawayHandler{db: db}
+}
+
+// LayawayLineRequest is a product to put on layaway
+type LayawayLineRequest struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	Quantity  int  `json:"quantity" binding:"required"`
+}
+
+// LayawayPaymentRequest is a deposit taken against a layaway
+type LayawayPaymentRequest struct {
+	Method    string  `json:"method" binding:"required"`
+	Amount    float64 `json:"amount" binding:"required"`
+	Reference string  `json:"reference"`
+}
+
+// LayawayRequest places a layaway with its first deposit
+type LayawayRequest struct {
+	Products      []LayawayLineRequest  `json:"products" binding:"required"`
+	CustomerID    uint                  `json:"customer_id"`
+	CustomerName  string                `json:"customer_name"`
+	CustomerPhone string                `json:"customer_phone"`
+	Deposit       LayawayPaymentRequest `json:"deposit" binding:"required"`
+}
+
+// CancelLayawayRequest cancels a layaway and optionally refunds its deposits
+type CancelLayawayRequest struct {
+	Reason          string `json:"reason"`
+	RefundMethod    string `json:"refund_method"`
+	RefundReference string `json:"refund_reference"`
+}
+
+func generateLayawayNumber() string {
+	suffix := strings.ToUpper(strings.ReplaceAll(utils.GenerateUUID(), "-", "")[:8])
+	return fmt.Sprintf("LAY-%d-%s", time.Now().Unix(), suffix)
+}
+
+// validateLayawayTender checks the method and reference of a deposit or refund
+func validateLayawayTender(method *string, reference string) error {
+	*method = strings.ToUpper(*method)
+	if !models.LayawayPaymentMethods[*method] {
+		return fmt.Errorf("Layaway deposits cannot be paid by %s", *method)
+	}
+	if *method == "MPESA" && reference == "" {
+		return errors.New("M-Pesa payments need the transaction reference")
+	}
+	return nil
+}
+
+// reserveLayawayStock takes a line's stock out of sale for a layaway.
+// Bundles reserve their components.
+func reserveLayawayStock(tx *gorm.DB, layaway models.Layaway, product models.Product, quantity int) error {
+	reservations := []models.LayawayReservation{{ProductID: product.ID, Quantity: quantity}}
+	costs := map[uint]float64{product.ID: product.AverageCost}
+	if product.IsBundle {
+		components, err := loadBundleComponents(tx, layaway.UserID, product.ID)
+		if err != nil {
+			return err
+		}
+		if len(components) == 0 {
+			return fmt.Errorf("Bundle %d has no components", product.ID)
+		}
+		reservations = reservations[:0]
+		for _, component := range components {
+			reservations = append(reservations, models.LayawayReservation{ProductID: component.ComponentID, Quantity: component.Quantity * quantity})
+			costs[component.ComponentID] = component.AverageCost
+		}
+	}
+
+	for _, reservation := range reservations {
+		if _, err := changeStock(tx, layaway.UserID, reservation.ProductID, -reservation.Quantity); err != nil {
+			return fmt.Errorf("product %d: %w", reservation.ProductID, err)
+		}
+		movement := models.StockMovement{
+			UserID:         layaway.UserID,
+			ProductID:      reservation.ProductID,
+			ChangeType:     models.MovementLayaway,
+			QuantityChange: -reservation.Quantity,
+			UnitCost:       costs[reservation.ProductID],
+			Note:           "Reserved for layaway " + layaway.LayawayNumber,
+		}
+		if err := tx.Create(&movement).Error; err != nil {
+			return err
+		}
+		reservation.LayawayID = layaway.ID
+		reservation.UnitCost = costs[reservation.ProductID]
+		if err := tx.Create(&reservation).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseLayawayStock puts a layaway's reserved stock back on sale
+func releaseLayawayStock(tx *gorm.DB, layaway models.Layaway, note string) error {
+	var reservations []models.LayawayReservation
+	if err := tx.Where("layaway_id = ?", layaway.ID).Find(&reservations).Error; err != nil {
+		return err
+	}
+	for _, reservation := range reservations {
+		inventory, err := changeStock(tx, layaway.UserID, reservation.ProductID, reservation.Quantity)
+		if err != nil {
+			return err
+		}
+		// Released units come back at the cost they were reserved at
+		if err := receiveAtCost(tx, layaway.UserID, reservation.ProductID, inventory.Quantity, reservation.Quantity, reservation.UnitCost); err != nil {
+			return err
+		}
+		movement := models.StockMovement{
+			UserID:         layaway.UserID,
+			ProductID:      reservation.ProductID,
+			ChangeType:     models.MovementLayaway,
+			QuantityChange: reservation.Quantity,
+			UnitCost:       reservation.UnitCost,
+			Note:           note,
+		}
+		if err := tx.Create(&movement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeLayaway marks an open layaway as sold on a receipt and hands its
+// reserved stock to the sale
+func completeLayaway(tx *gorm.DB, layaway models.Layaway, receiptID uint) error {
+	result := tx.Model(&models.Layaway{}).
+		Where("id = ? AND status = ?", layaway.ID, models.LayawayOpen).
+		Updates(map[string]interface{}{"status": models.LayawayCompleted, "receipt_id": receiptID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errLayawayNotOpen
+	}
+	return releaseLayawayStock(tx, layaway, "Collected from layaway "+layaway.LayawayNumber)
+}
+
+// cancelLayaway cancels an open layaway and puts its stock back on sale.
+// Deposits are kept until they are refunded.
+func cancelLayaway(tx *gorm.DB, layaway models.Layaway, reason string, at time.Time) error {
+	result := tx.Model(&models.Layaway{}).
+		Where("id = ? AND status = ?", layaway.ID, models.LayawayOpen).
+		Updates(map[string]interface{}{"status": models.LayawayCancelled, "cancel_reason": reason, "cancelled_at": at})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errLayawayNotOpen
+	}
+	return releaseLayawayStock(tx, layaway, "Released from cancelled layaway "+layaway.LayawayNumber)
+}
+
+// ExpireLayaways cancels open layaways past their pay-by date
+func ExpireLayaways(db *gorm.DB, now time.Time) (int, error) {
+	var layaways []models.Layaway
+	if err := db.Where("status = ? AND expires_at <= ?", models.LayawayOpen, now).Find(&layaways).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, layaway := range layaways {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return cancelLayaway(tx, layaway, "Not paid off by "+layaway.ExpiresAt.Format("2006-01-02"), now)
+		})
+		if errors.Is(err, errLayawayNotOpen) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	if expired > 0 {
+		utils.InfoLogger("Cancelled %d expired layaways", expired)
+	}
+	return expired, nil
+}
+
+// completeLayawaySale rings up a paid-off layaway through processSales,
+// paid with its deposits and sold at the prices agreed when it was placed
+func (lh *LayawayHandler) completeLayawaySale(userID, staffID uint, layaway models.Layaway) *syncResponder {
+	saleData := SaleData{
+		CustomerName:  layaway.CustomerName,
+		CustomerPhone: layaway.CustomerPhone,
+		PaymentMethod: models.PaymentLayaway,
+		Payments:      []TenderRequest{{Method: models.PaymentLayaway, Amount: roundMoney(layaway.AmountPaid), Reference: layaway.LayawayNumber}},
+		layaway:       &layaway,
+		staffID:       staffID,
+	}
+	if layaway.CustomerID != nil {
+		saleData.CustomerID = *layaway.CustomerID
+	}
+	for _, line := range layaway.Lines {
+		saleData.Products = append(saleData.Products, SellRequest{
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
+			agreed: &agreedPrice{
+				ListPrice:      line.ListPrice,
+				DiscountAmount: line.DiscountAmount,
+				Source:         models.DiscountSourceLayaway,
+				Description:    "Layaway discount",
+				Total:          line.TotalPrice,
+			},
+		})
+	}
+
+	result := &syncResponder{}
+	processSales(saleData, userID, NewSalesManagementHandler(lh.db), result)
+	if result.status != 200 {
+		utils.WarningLogger("Layaway %s is paid off but could not be completed: %v", layaway.LayawayNumber, result.body["error"])
+	}
+	return result
+}
+
+// findLayaway loads a layaway with its lines, deposits and reserved stock
+func (lh *LayawayHandler) findLayaway(userID uint, id any) (*models.Layaway, error) {
+	var layaway models.Layaway
+	err := lh.db.Preload("Lines").Preload("Payments").Preload("Reservations").
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&layaway).Error
+	return &layaway, err
+}
+
+// loadLayaway loads one of the user's layaways by the :id parameter
+func (lh *LayawayHandler) loadLayaway(c *gin.Context, userID uint) (*models.Layaway, bool) {
+	layaway, err := lh.findLayaway(userID, c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "Layaway not found"})
+		return nil, false
+	}
+	if err != nil {
+		utils.ErrorLogger("Failed to load layaway %s: %v", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Failed to load layaway"})
+		return nil, false
+	}
+	return layaway, true
+}
+
+// CreateLayaway reserves stock for a customer against a first deposit
+func (lh *LayawayHandler) CreateLayaway(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input LayawayRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse layaway request: %v", err)
+		c.JSON(400, gin.H{"error": "Products and a deposit are required"})
+		return
+	}
+	if len(input.Products) == 0 {
+		c.JSON(400, gin.H{"error": "At least one product is required"})
+		return
+	}
+	for _, line := range input.Products {
+		if line.Quantity <= 0 {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Quantity for product %d must be greater than 0", line.ProductID)})
+			return
+		}
+	}
+	if err := validateLayawayTender(&input.Deposit.Method, input.Deposit.Reference); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Deposit.Amount <= 0 {
+		c.JSON(400, gin.H{"error": "Deposit must be greater than zero"})
+		return
+	}
+
+	settings, err := loadBusinessSettings(lh.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load business settings"})
+		return
+	}
+	now := time.Now()
+
+	tx := lh.db.Begin()
+	if tx.Error != nil {
+		utils.ErrorLogger("Failed to start transaction: %v", tx.Error)
+		c.JSON(500, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+
+	session, err := openRegisterSession(tx, userID, actingUser(c), now)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to load register session for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load register session"})
+		return
+	}
+	if session == nil && settings.RequireRegisterSession {
+		tx.Rollback()
+		c.JSON(409, gin.H{"error": "Open a register session before taking deposits", "code": errCodeRegisterClosed})
+		return
+	}
+
+	// Layaways are always for a known customer
+	contact := SaleData{CustomerID: input.CustomerID, CustomerName: input.CustomerName, CustomerPhone: input.CustomerPhone}
+	customer, err := resolveSaleCustomer(tx, userID, &contact)
+	if errors.Is(err, errCustomerNotFound) {
+		tx.Rollback()
+		c.JSON(404, gin.H{"error": "Customer not found"})
+		return
+	}
+	if errors.Is(err, errCustomerPhone) {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to resolve customer for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load customer"})
+		return
+	}
+	if customer == nil {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": "A customer or phone number is required for a layaway"})
+		return
+	}
+
+	layaway := models.Layaway{
+		UserID:        userID,
+		LayawayNumber: generateLayawayNumber(),
+		CustomerID:    &customer.ID,
+		CustomerName:  contact.CustomerName,
+		CustomerPhone: customer.Phone,
+		Status:        models.LayawayOpen,
+		ExpiresAt:     now.AddDate(0, 0, settings.LayawayDays),
+		CreatedAt:     now,
+	}
+	if err := tx.Create(&layaway).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to create layaway for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to create layaway"})
+		return
+	}
+
+	promotions, err := loadActivePromotions(tx, userID, now)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to load promotions for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load promotions"})
+		return
+	}
+
+	// Price each line as processSales will when the layaway is rung up
+	overrides := &overrideAuthoriser{db: tx, userID: userID, staffID: actingUser(c)}
+	for _, request := range input.Products {
+		var product models.Product
+		if err := tx.Where("id = ? AND user_id = ?", request.ProductID, userID).First(&product).Error; err != nil {
+			tx.Rollback()
+			c.JSON(404, gin.H{"error": fmt.Sprintf("Product %d not found", request.ProductID)})
+			return
+		}
+		if !product.Active {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Product %d is archived and cannot be sold", request.ProductID), "code": errCodeProductArchived})
+			return
+		}
+
+		err := reserveLayawayStock(tx, layaway, product, request.Quantity)
+		if errors.Is(err, errInsufficientStock) || errors.Is(err, gorm.ErrRecordNotFound) {
+			tx.Rollback()
+			utils.WarningLogger("Cannot reserve product %d for layaway: %v", product.ID, err)
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Insufficient stock to reserve product %d", product.ID), "code": errCodeInsufficientStock})
+			return
+		}
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to reserve stock for product %d on layaway: %v", product.ID, err)
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to reserve stock for product %d", product.ID)})
+			return
+		}
+
+		line, err := priceLine(tx, userID, product, SellRequest{ProductID: product.ID, Quantity: request.Quantity}, promotions, overrides, now)
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to price product %d: %v", product.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to price products"})
+			return
+		}
+		tax := lineTax(settings, product.TaxClass, line.netAmount())
+
+		layawayLine := models.LayawayLine{
+			LayawayID:      layaway.ID,
+			ProductID:      product.ID,
+			Name:           product.Name,
+			Quantity:       request.Quantity,
+			ListPrice:      line.ListPrice,
+			DiscountAmount: line.discountAmount(),
+			TotalPrice:     tax.Total,
+		}
+		if err := tx.Create(&layawayLine).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to create layaway line: %v", err)
+			c.JSON(500, gin.H{"error": "Failed to create layaway"})
+			return
+		}
+		layaway.TotalAmount = roundMoney(layaway.TotalAmount + tax.Total)
+	}
+
+	minimum := roundMoney(layaway.TotalAmount * settings.LayawayDepositPercent / 100)
+	if input.Deposit.Amount < minimum-0.005 {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": fmt.Sprintf("A deposit of at least %.2f is required", minimum)})
+		return
+	}
+	if input.Deposit.Amount > layaway.TotalAmount+0.005 {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Deposit of %.2f exceeds the %.2f total", input.Deposit.Amount, layaway.TotalAmount)})
+		return
+	}
+
+	deposit := models.LayawayPayment{
+		UserID:    userID,
+		LayawayID: layaway.ID,
+		Method:    input.Deposit.Method,
+		Amount:    roundMoney(input.Deposit.Amount),
+		Reference: input.Deposit.Reference,
+	}
+	if session != nil {
+		deposit.RegisterSessionID = &session.ID
+	}
+	if err := tx.Create(&deposit).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to record deposit on layaway %s: %v", layaway.LayawayNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to record deposit"})
+		return
+	}
+	layaway.AmountPaid = deposit.Amount
+	if err := tx.Model(&layaway).Updates(map[string]interface{}{
+		"total_amount": layaway.TotalAmount,
+		"amount_paid":  layaway.AmountPaid,
+	}).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to update layaway %s: %v", layaway.LayawayNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to create layaway"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorLogger("Failed to commit layaway %s: %v", layaway.LayawayNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to create layaway"})
+		return
+	}
+	utils.InfoLogger("Created layaway %s for user %d: %.2f of %.2f paid", layaway.LayawayNumber, userID, layaway.AmountPaid, layaway.TotalAmount)
+
+	lh.respondWithLayaway(c, userID, layaway.ID, 201)
+}
+
+// AddLayawayPayment takes a further deposit and rings the layaway up as a
+// sale once it is paid off
+func (lh *LayawayHandler) AddLayawayPayment(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input LayawayPaymentRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse layaway payment: %v", err)
+		c.JSON(400, gin.H{"error": "Method and amount are required"})
+		return
+	}
+	if err := validateLayawayTender(&input.Method, input.Reference); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Amount <= 0 {
+		c.JSON(400, gin.H{"error": "Amount must be greater than zero"})
+		return
+	}
+
+	layaway, ok := lh.loadLayaway(c, userID)
+	if !ok {
+		return
+	}
+	settings, err := loadBusinessSettings(lh.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load business settings"})
+		return
+	}
+
+	tx := lh.db.Begin()
+	if tx.Error != nil {
+		utils.ErrorLogger("Failed to start transaction: %v", tx.Error)
+		c.JSON(500, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	session, err := openRegisterSession(tx, userID, actingUser(c), time.Now())
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to load register session for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load register session"})
+		return
+	}
+	if session == nil && settings.RequireRegisterSession {
+		tx.Rollback()
+		c.JSON(409, gin.H{"error": "Open a register session before taking deposits", "code": errCodeRegisterClosed})
+		return
+	}
+
+	// Guard on the balance so two tills cannot overpay the layaway between them
+	amount := roundMoney(input.Amount)
+	result := tx.Model(&models.Layaway{}).
+		Where("id = ? AND status = ? AND amount_paid + ? <= total_amount + 0.005", layaway.ID, models.LayawayOpen, amount).
+		Update("amount_paid", gorm.Expr("amount_paid + ?", amount))
+	if result.Error != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to update layaway %s: %v", layaway.LayawayNumber, result.Error)
+		c.JSON(500, gin.H{"error": "Failed to record payment"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		if layaway.Status != models.LayawayOpen {
+			c.JSON(409, gin.H{"error": errLayawayNotOpen.Error()})
+			return
+		}
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Payment of %.2f exceeds the %.2f balance", amount, roundMoney(layaway.TotalAmount-layaway.AmountPaid))})
+		return
+	}
+
+	payment := models.LayawayPayment{
+		UserID:    userID,
+		LayawayID: layaway.ID,
+		Method:    input.Method,
+		Amount:    amount,
+		Reference: input.Reference,
+	}
+	if session != nil {
+		payment.RegisterSessionID = &session.ID
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to record payment on layaway %s: %v", layaway.LayawayNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to record payment"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorLogger("Failed to commit payment on layaway %s: %v", layaway.LayawayNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to record payment"})
+		return
+	}
+	utils.InfoLogger("Took %.2f by %s on layaway %s", amount, input.Method, layaway.LayawayNumber)
+
+	lh.respondWithLayaway(c, userID, layaway.ID, 201)
+}
+
+// CompleteLayaway retries ringing up a paid-off layaway whose sale failed
+func (lh *LayawayHandler) CompleteLayaway(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	layaway, ok := lh.loadLayaway(c, userID)
+	if !ok {
+		return
+	}
+	if layaway.Status != models.LayawayOpen {
+		c.JSON(409, gin.H{"error": errLayawayNotOpen.Error()})
+		return
+	}
+	if layaway.AmountPaid < layaway.TotalAmount-0.005 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Layaway still has %.2f to pay", roundMoney(layaway.TotalAmount-layaway.AmountPaid))})
+		return
+	}
+
+	result := lh.completeLayawaySale(userID, actingUser(c), *layaway)
+	c.JSON(result.status, result.body)
+}
+
+// respondWithLayaway answers with a layaway, ringing it up as a sale first
+// if it has been paid off
+func (lh *LayawayHandler) respondWithLayaway(c *gin.Context, userID, layawayID uint, code int) {
+	layaway, err := lh.findLayaway(userID, layawayID)
+	if err != nil {
+		utils.ErrorLogger("Failed to reload layaway %d: %v", layawayID, err)
+		c.JSON(500, gin.H{"error": "Failed to load layaway"})
+		return
+	}
+	if layaway.Status != models.LayawayOpen || layaway.AmountPaid < layaway.TotalAmount-0.005 {
+		c.JSON(code, gin.H{"layaway": layaway})
+		return
+	}
+
+	sale := lh.completeLayawaySale(userID, actingUser(c), *layaway)
+	if sale.status == 200 {
+		if layaway, err = lh.findLayaway(userID, layawayID); err != nil {
+			utils.ErrorLogger("Failed to reload layaway %d: %v", layawayID, err)
+			c.JSON(500, gin.H{"error": "Failed to load layaway"})
+			return
+		}
+	}
+	c.JSON(code, gin.H{"layaway": layaway, "sale": sale.body})
+}
+
+// CancelLayaway cancels an open layaway, and refunds the deposits of a
+// cancelled one when a refund method is given
+func (lh *LayawayHandler) CancelLayaway(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input CancelLayawayRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse cancel layaway request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if input.RefundMethod != "" {
+		if err := validateLayawayTender(&input.RefundMethod, input.RefundReference); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	layaway, ok := lh.loadLayaway(c, userID)
+	if !ok {
+		return
+	}
+	if layaway.Status == models.LayawayCompleted {
+		c.JSON(409, gin.H{"error": "Layaway has already been collected; return the sale instead"})
+		return
+	}
+	if layaway.Status != models.LayawayOpen && input.RefundMethod == "" {
+		c.JSON(409, gin.H{"error": "Layaway is already cancelled"})
+		return
+	}
+
+	now := time.Now()
+	tx := lh.db.Begin()
+	if tx.Error != nil {
+		utils.ErrorLogger("Failed to start transaction: %v", tx.Error)
+		c.JSON(500, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	if layaway.Status == models.LayawayOpen {
+		reason := strings.TrimSpace(input.Reason)
+		if reason == "" {
+			reason = "Cancelled by customer"
+		}
+		if err := cancelLayaway(tx, *layaway, reason, now); err != nil {
+			tx.Rollback()
+			if errors.Is(err, errLayawayNotOpen) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
+			}
+			utils.ErrorLogger("Failed to cancel layaway %s: %v", layaway.LayawayNumber, err)
+			c.JSON(500, gin.H{"error": "Failed to cancel layaway"})
+			return
+		}
+	}
+
+	if input.RefundMethod != "" {
+		refund := roundMoney(layaway.AmountPaid - layaway.AmountRefunded)
+		if refund <= 0 {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": "Layaway has no deposits left to refund"})
+			return
+		}
+		result := tx.Model(&models.Layaway{}).
+			Where("id = ? AND amount_refunded = ?", layaway.ID, layaway.AmountRefunded).
+			Update("amount_refunded", layaway.AmountPaid)
+		if result.Error != nil || result.RowsAffected == 0 {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to refund layaway %s: %v", layaway.LayawayNumber, result.Error)
+			c.JSON(409, gin.H{"error": "Layaway deposits were refunded by someone else"})
+			return
+		}
+		session, err := openRegisterSession(tx, userID, actingUser(c), now)
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to load register session for user %d: %v", userID, err)
+			c.JSON(500, gin.H{"error": "Failed to load register session"})
+			return
+		}
+		payment := models.LayawayPayment{
+			UserID:    userID,
+			LayawayID: layaway.ID,
+			Method:    input.RefundMethod,
+			Amount:    -refund,
+			Reference: input.RefundReference,
+		}
+		if session != nil {
+			payment.RegisterSessionID = &session.ID
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to record refund on layaway %s: %v", layaway.LayawayNumber, err)
+			c.JSON(500, gin.H{"error": "Failed to record refund"})
+			return
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorLogger("Failed to commit cancellation of layaway %s: %v", layaway.LayawayNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to cancel layaway"})
+		return
+	}
+	utils.InfoLogger("Cancelled layaway %s for user %d", layaway.LayawayNumber, userID)
+
+	lh.respondWithLayaway(c, userID, layaway.ID, 200)
+}
+
+var layawayListSpec = listSpec[models.Layaway]{
+	id: listField[models.Layaway]{column: "layaways.id", kind: listNumber, value: func(r models.Layaway) any { return r.ID }},
+	fields: map[string]listField[models.Layaway]{
+		"layaway_number": {column: "layaways.layaway_number", kind: listText},
+		"customer_id":    {column: "layaways.customer_id", kind: listNumber},
+		"customer_name":  {column: "layaways.customer_name", kind: listText, value: func(r models.Layaway) any { return r.CustomerName }},
+		"customer_phone": {column: "layaways.customer_phone", kind: listText},
+		"total_amount":   {column: "layaways.total_amount", kind: listNumber, value: func(r models.Layaway) any { return r.TotalAmount }},
+		"amount_paid":    {column: "layaways.amount_paid", kind: listNumber, value: func(r models.Layaway) any { return r.AmountPaid }},
+		"expires_at":     {column: "layaways.expires_at", kind: listTime, value: func(r models.Layaway) any { return r.ExpiresAt }},
+		"created_at":     {column: "layaways.created_at", kind: listTime, value: func(r models.Layaway) any { return r.CreatedAt }},
+	},
+	defaultSort: "-created_at",
+	params:      []string{"status"},
+}
+
+// GetLayaways lists layaways, newest first, optionally by ?status=
+func (lh *LayawayHandler) GetLayaways(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	list, err := parseListQuery(c, layawayListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := lh.db.Model(&models.Layaway{}).Where("user_id = ?", userID)
+	if status := strings.ToUpper(c.Query("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var layaways []models.Layaway
+	if err := list.find(query, &layaways); err != nil {
+		utils.ErrorLogger("Failed to fetch layaways for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch layaways"})
+		return
+	}
+
+	c.JSON(200, layaways)
+}
+
+// GetLayaway returns a layaway with its lines, deposits and reserved stock
+func (lh *LayawayHandler) GetLayaway(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	layaway, ok := lh.loadLayaway(c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(200, layaway)
+}
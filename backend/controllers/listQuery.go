@@ -0,0 +1,422 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Headers list endpoints page with. The body stays a plain JSON array.
+// Paging is opt-in: a list without ?limit= or ?cursor= returns every row.
+const (
+	NextCursorHeader = "X-Next-Cursor"
+	TotalCountHeader = "X-Total-Count"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// Kinds of value a list field holds, which decide how filters and cursors
+// are parsed
+const (
+	listText = iota
+	listNumber
+	listTime
+	listBool
+)
+
+// listField is a column clients may filter a list on. Fields with a value
+// function can also be sorted on; it reads the field back from a row to
+// build the cursor for the next page.
+type listField[T any] struct {
+	column string
+	kind   int
+	value  func(T) any
+}
+
+// listSpec whitelists what a list endpoint can be filtered and sorted on.
+// The id field breaks ties so every sort is total and cursors are stable.
+type listSpec[T any] struct {
+	fields      map[string]listField[T]
+	id          listField[T]
+	defaultSort string
+	preloads    []string
+	// params are other query parameters the handler reads itself
+	params []string
+}
+
+type listFilter struct {
+	column string
+	op     string
+	values []any
+}
+
+type listSort struct {
+	name string
+	desc bool
+}
+
+// listCursor is where a page ended: the sort it was read with and the
+// sort values, then the id, of its last row
+type listCursor struct {
+	Sort   string `json:"s"`
+	Values []any  `json:"v"`
+}
+
+// listQuery is a parsed request for one page of a list. A zero limit means
+// the client did not ask for pages.
+type listQuery[T any] struct {
+	c         *gin.Context
+	spec      listSpec[T]
+	filters   []listFilter
+	sorts     []listSort
+	sortKey   string
+	idDesc    bool
+	after     []any
+	limit     int
+	withTotal bool
+}
+
+var listOperators = map[string]string{
+	"eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<=", "like": "LIKE", "in": "IN",
+}
+
+// parseListQuery reads ?limit=, ?sort=-a,b, ?cursor=, ?total=true and
+// filters of the form ?field=value or ?field.op=value, where op is one of
+// eq, ne, gt, gte, lt, lte, like or in (comma separated). Anything not
+// whitelisted by the spec is rejected.
+func parseListQuery[T any](c *gin.Context, spec listSpec[T]) (*listQuery[T], error) {
+	list := &listQuery[T]{c: c, spec: spec}
+
+	var params map[string][]string
+	if c.Request != nil {
+		params = c.Request.URL.Query()
+	}
+	for key, values := range params {
+		value := values[0]
+		switch key {
+		case "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				return nil, errors.New("limit must be a positive whole number")
+			}
+			list.limit = min(limit, maxListLimit)
+			continue
+		case "total":
+			withTotal, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.New("total must be true or false")
+			}
+			list.withTotal = withTotal
+			continue
+		case "sort", "cursor":
+			continue
+		}
+		if slices.Contains(spec.params, key) {
+			continue
+		}
+
+		name, op, _ := strings.Cut(key, ".")
+		if op == "" {
+			op = "eq"
+		}
+		field, ok := list.field(name)
+		if !ok {
+			return nil, fmt.Errorf("Cannot filter on %q", name)
+		}
+		if _, ok := listOperators[op]; !ok {
+			return nil, fmt.Errorf("Unknown filter operator %q", op)
+		}
+		filters, err := parseListFilter(field, name, op, value)
+		if err != nil {
+			return nil, err
+		}
+		list.filters = append(list.filters, filters...)
+	}
+
+	sort := c.Query("sort")
+	if sort == "" {
+		sort = spec.defaultSort
+	}
+	var keys []string
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		order := listSort{name: strings.TrimPrefix(part, "-"), desc: strings.HasPrefix(part, "-")}
+		field, ok := list.field(order.name)
+		if !ok || field.value == nil {
+			return nil, fmt.Errorf("Cannot sort on %q", order.name)
+		}
+		keys = append(keys, part)
+		if order.name == "id" {
+			// ids are unique, so nothing after them changes the order
+			list.idDesc = order.desc
+			break
+		}
+		list.sorts = append(list.sorts, order)
+		if len(list.sorts) == 1 {
+			list.idDesc = order.desc
+		}
+	}
+	list.sortKey = strings.Join(keys, ",")
+
+	if value := c.Query("cursor"); value != "" {
+		after, err := list.decodeCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		list.after = after
+		if list.limit == 0 {
+			list.limit = defaultListLimit
+		}
+	}
+	return list, nil
+}
+
+func (list *listQuery[T]) field(name string) (listField[T], bool) {
+	if name == "id" {
+		return list.spec.id, true
+	}
+	field, ok := list.spec.fields[name]
+	return field, ok
+}
+
+// parseListFilter turns one filter parameter into conditions. A bare date
+// compared with eq, lte or gt covers the whole day.
+func parseListFilter[T any](field listField[T], name, op, raw string) ([]listFilter, error) {
+	if op == "like" {
+		if field.kind != listText {
+			return nil, fmt.Errorf("%s cannot be filtered with like", name)
+		}
+		return []listFilter{{column: field.column, op: "LIKE", values: []any{"%" + raw + "%"}}}, nil
+	}
+	if op == "in" {
+		var values []any
+		for _, part := range strings.Split(raw, ",") {
+			value, err := parseListValue(field.kind, strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s: %v", name, err)
+			}
+			values = append(values, value)
+		}
+		return []listFilter{{column: field.column, op: "IN", values: []any{values}}}, nil
+	}
+
+	value, err := parseListValue(field.kind, raw)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %v", name, err)
+	}
+	if day, ok := value.(time.Time); ok && len(raw) == len("2006-01-02") {
+		next := day.AddDate(0, 0, 1)
+		switch op {
+		case "eq":
+			return []listFilter{
+				{column: field.column, op: ">=", values: []any{day}},
+				{column: field.column, op: "<", values: []any{next}},
+			}, nil
+		case "lte":
+			return []listFilter{{column: field.column, op: "<", values: []any{next}}}, nil
+		case "gt":
+			return []listFilter{{column: field.column, op: ">=", values: []any{next}}}, nil
+		}
+	}
+	return []listFilter{{column: field.column, op: listOperators[op], values: []any{value}}}, nil
+}
+
+// parseListValue parses a filter value as the field's kind
+func parseListValue(kind int, raw string) (any, error) {
+	switch kind {
+	case listNumber:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.New("expected a number")
+		}
+		return value, nil
+	case listTime:
+		if value, err := time.ParseInLocation("2006-01-02", raw, time.Local); err == nil {
+			return value, nil
+		}
+		value, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, errors.New("expected a date (YYYY-MM-DD) or RFC 3339 time")
+		}
+		return value, nil
+	case listBool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("expected true or false")
+		}
+		return value, nil
+	}
+	return raw, nil
+}
+
+// cursorValue is a sort value as it is written into a cursor
+func cursorValue(value any) any {
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+func (list *listQuery[T]) encodeCursor(row T) string {
+	cursor := listCursor{Sort: list.sortKey}
+	for _, order := range list.sorts {
+		field, _ := list.field(order.name)
+		cursor.Values = append(cursor.Values, cursorValue(field.value(row)))
+	}
+	cursor.Values = append(cursor.Values, cursorValue(list.spec.id.value(row)))
+
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeCursor checks a cursor was issued for the same sort and parses its
+// values back into the kinds of the fields they were read from
+func (list *listQuery[T]) decodeCursor(value string) ([]any, error) {
+	invalid := errors.New("Invalid cursor")
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return nil, invalid
+	}
+	if cursor.Sort != list.sortKey {
+		return nil, errors.New("Cursor was issued for a different sort")
+	}
+	if len(cursor.Values) != len(list.sorts)+1 {
+		return nil, invalid
+	}
+
+	kinds := make([]int, 0, len(cursor.Values))
+	for _, order := range list.sorts {
+		field, _ := list.field(order.name)
+		kinds = append(kinds, field.kind)
+	}
+	kinds = append(kinds, list.spec.id.kind)
+
+	after := make([]any, len(cursor.Values))
+	for i, raw := range cursor.Values {
+		switch kinds[i] {
+		case listTime:
+			text, ok := raw.(string)
+			if !ok {
+				return nil, invalid
+			}
+			t, err := time.Parse(time.RFC3339Nano, text)
+			if err != nil {
+				return nil, invalid
+			}
+			after[i] = t
+		case listNumber:
+			if _, ok := raw.(float64); !ok {
+				return nil, invalid
+			}
+			after[i] = raw
+		case listBool:
+			if _, ok := raw.(bool); !ok {
+				return nil, invalid
+			}
+			after[i] = raw
+		default:
+			if _, ok := raw.(string); !ok {
+				return nil, invalid
+			}
+			after[i] = raw
+		}
+	}
+	return after, nil
+}
+
+// seek limits the query to rows after the cursor in sort order:
+// (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND id > ?)
+func (list *listQuery[T]) seek(query *gorm.DB) *gorm.DB {
+	columns := make([]string, 0, len(list.sorts)+1)
+	descs := make([]bool, 0, len(list.sorts)+1)
+	for _, order := range list.sorts {
+		field, _ := list.field(order.name)
+		columns = append(columns, field.column)
+		descs = append(descs, order.desc)
+	}
+	columns = append(columns, list.spec.id.column)
+	descs = append(descs, list.idDesc)
+
+	var clauses []string
+	var args []any
+	for i := range columns {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, columns[j]+" = ?")
+			args = append(args, list.after[j])
+		}
+		op := ">"
+		if descs[i] {
+			op = "<"
+		}
+		terms = append(terms, columns[i]+" "+op+" ?")
+		args = append(args, list.after[i])
+		clauses = append(clauses, "("+strings.Join(terms, " AND ")+")")
+	}
+	return query.Where(strings.Join(clauses, " OR "), args...)
+}
+
+// find reads one page of rows into rows, or every row when the client did
+// not ask for pages, setting the next cursor and, when asked for, the total
+// count matching the filters as response headers
+func (list *listQuery[T]) find(query *gorm.DB, rows *[]T) error {
+	for _, filter := range list.filters {
+		query = query.Where(filter.column+" "+filter.op+" ?", filter.values...)
+	}
+	if list.withTotal {
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return err
+		}
+		list.c.Header(TotalCountHeader, strconv.FormatInt(total, 10))
+	}
+
+	if list.after != nil {
+		query = list.seek(query)
+	}
+	for _, order := range list.sorts {
+		field, _ := list.field(order.name)
+		query = query.Order(orderBy(field.column, order.desc))
+	}
+	query = query.Order(orderBy(list.spec.id.column, list.idDesc))
+	for _, preload := range list.spec.preloads {
+		query = query.Preload(preload)
+	}
+
+	if list.limit == 0 {
+		return query.Find(rows).Error
+	}
+	if err := query.Limit(list.limit + 1).Find(rows).Error; err != nil {
+		return err
+	}
+	if len(*rows) > list.limit {
+		*rows = (*rows)[:list.limit]
+		list.c.Header(NextCursorHeader, list.encodeCursor((*rows)[list.limit-1]))
+	}
+	return nil
+}
+
+func orderBy(column string, desc bool) string {
+	if desc {
+		return column + " DESC"
+	}
+	return column
+}
@@ -0,0 +1,427 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errLoyaltyDisabled    = errors.New("Loyalty points are not enabled")
+	errPointsNeedCustomer = errors.New("Points can only be redeemed by a known customer")
+	errInsufficientPoints = errors.New("Not enough loyalty points")
+)
+
+// pointsExpiry is when points added at a time expire, or nil if they never do
+func pointsExpiry(settings models.BusinessSettings, at time.Time) *time.Time {
+	if settings.PointsExpiryDays <= 0 {
+		return nil
+	}
+	expires := at.AddDate(0, 0, settings.PointsExpiryDays)
+	return &expires
+}
+
+// pointsBalance is a customer's points after expired points are taken off
+func pointsBalance(db *gorm.DB, customerID uint) (int, error) {
+	var balance int
+	err := db.Model(&models.LoyaltyEntry{}).
+		Select("COALESCE(SUM(points), 0)").
+		Where("customer_id = ?", customerID).
+		Scan(&balance).Error
+	return balance, err
+}
+
+// expirePoints posts an EXPIRE entry for whatever is left of points past
+// their expiry date. A customerID of 0 expires points for every customer.
+func expirePoints(tx *gorm.DB, customerID uint, now time.Time) (int, error) {
+	query := tx.Where("remaining > 0 AND expires_at IS NOT NULL AND expires_at <= ?", now)
+	if customerID != 0 {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	var entries []models.LoyaltyEntry
+	if err := query.Order("id").Find(&entries).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, entry := range entries {
+		// Only expire what another redemption has not used in the meantime
+		result := tx.Model(&models.LoyaltyEntry{}).
+			Where("id = ? AND remaining = ?", entry.ID, entry.Remaining).
+			Update("remaining", 0)
+		if result.Error != nil {
+			return expired, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		expiry := models.LoyaltyEntry{
+			UserID:      entry.UserID,
+			CustomerID:  entry.CustomerID,
+			Type:        models.LoyaltyExpire,
+			Points:      -entry.Remaining,
+			Description: fmt.Sprintf("Points from %s expired", entry.CreatedAt.Format("2006-01-02")),
+		}
+		if err := tx.Create(&expiry).Error; err != nil {
+			return expired, err
+		}
+		expired += entry.Remaining
+	}
+	return expired, nil
+}
+
+// ExpireLoyaltyPoints expires points past their expiry date for every customer
+func ExpireLoyaltyPoints(db *gorm.DB, now time.Time) (int, error) {
+	var expired int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		expired, err = expirePoints(tx, 0, now)
+		return err
+	})
+	if err == nil && expired > 0 {
+		utils.InfoLogger("Expired %d loyalty points", expired)
+	}
+	return expired, err
+}
+
+// consumePoints uses up a customer's points, oldest first
+func consumePoints(tx *gorm.DB, customerID uint, points int, now time.Time) error {
+	var entries []models.LoyaltyEntry
+	if err := tx.Where("customer_id = ? AND remaining > 0 AND (expires_at IS NULL OR expires_at > ?)", customerID, now).
+		Order("created_at, id").
+		Find(&entries).Error; err != nil {
+		return err
+	}
+
+	left := points
+	for _, entry := range entries {
+		if left == 0 {
+			break
+		}
+		// The update only applies while the entry still holds the points, so a
+		// concurrent redemption of the same entry cannot take them twice
+		take := min(left, entry.Remaining)
+		result := tx.Model(&models.LoyaltyEntry{}).
+			Where("id = ? AND remaining >= ?", entry.ID, take).
+			Update("remaining", gorm.Expr("remaining - ?", take))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInsufficientPoints
+		}
+		left -= take
+	}
+	if left > 0 {
+		return errInsufficientPoints
+	}
+	return nil
+}
+
+// redeemPoints takes the points paying amount shillings of a sale
+func redeemPoints(tx *gorm.DB, settings models.BusinessSettings, customer models.Customer, receiptID uint, amount float64, at time.Time) (int, error) {
+	points := int(math.Ceil(amount/settings.PointValue - 1e-9))
+	if _, err := expirePoints(tx, customer.ID, at); err != nil {
+		return 0, err
+	}
+	balance, err := pointsBalance(tx, customer.ID)
+	if err != nil {
+		return 0, err
+	}
+	if balance < points {
+		return 0, fmt.Errorf("%w: %d needed, %d available", errInsufficientPoints, points, balance)
+	}
+	if err := consumePoints(tx, customer.ID, points, at); err != nil {
+		return 0, err
+	}
+
+	entry := models.LoyaltyEntry{
+		UserID:      customer.UserID,
+		CustomerID:  customer.ID,
+		ReceiptID:   &receiptID,
+		Type:        models.LoyaltyRedeem,
+		Points:      -points,
+		Description: fmt.Sprintf("Redeemed for %.2f", amount),
+	}
+	return points, tx.Create(&entry).Error
+}
+
+// loyaltyMultipliers maps lower-case categories to their points multiplier
+func loyaltyMultipliers(db *gorm.DB, userID uint) (map[string]float64, error) {
+	var multipliers []models.LoyaltyMultiplier
+	if err := db.Where("user_id = ?", userID).Find(&multipliers).Error; err != nil {
+		return nil, err
+	}
+	byCategory := make(map[string]float64, len(multipliers))
+	for _, multiplier := range multipliers {
+		byCategory[strings.ToLower(multiplier.Category)] = multiplier.Multiplier
+	}
+	return byCategory, nil
+}
+
+// earnPoints credits the points a sale earns. Each line earns on its net
+// amount times its category multiplier; paidShare leaves out the part of
+// the sale paid with points.
+func earnPoints(tx *gorm.DB, settings models.BusinessSettings, customer models.Customer, receiptID uint, lines []*pricedLine, paidShare float64, at time.Time) (int, error) {
+	multipliers, err := loyaltyMultipliers(tx, customer.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	var base float64
+	for _, line := range lines {
+		multiplier := 1.0
+		if value, ok := multipliers[strings.ToLower(line.Product.Category)]; ok {
+			multiplier = value
+		}
+		base += line.netAmount() * multiplier
+	}
+	points := int(math.Floor(base*settings.PointsPerShilling*paidShare + 1e-9))
+	if points <= 0 {
+		return 0, nil
+	}
+
+	entry := models.LoyaltyEntry{
+		UserID:      customer.UserID,
+		CustomerID:  customer.ID,
+		ReceiptID:   &receiptID,
+		Type:        models.LoyaltyEarn,
+		Points:      points,
+		Remaining:   points,
+		ExpiresAt:   pointsExpiry(settings, at),
+		Description: "Earned on purchase",
+	}
+	return points, tx.Create(&entry).Error
+}
+
+// reverseEarnedPoints takes back the points a receipt earned on the share
+// of it being refunded, as far as the customer still has them
+func reverseEarnedPoints(tx *gorm.DB, receipt models.Receipt, saleReturnID uint, refund float64, at time.Time) (int, error) {
+	if receipt.CustomerID == nil || receipt.PointsEarned == 0 || receipt.TotalAmount <= 0 {
+		return 0, nil
+	}
+
+	var reversed int
+	if err := tx.Model(&models.LoyaltyEntry{}).
+		Select("COALESCE(-SUM(points), 0)").
+		Where("receipt_id = ? AND type = ?", receipt.ID, models.LoyaltyReverse).
+		Scan(&reversed).Error; err != nil {
+		return 0, err
+	}
+	points := int(math.Round(float64(receipt.PointsEarned) * refund / receipt.TotalAmount))
+	points = min(points, receipt.PointsEarned-reversed)
+
+	if _, err := expirePoints(tx, *receipt.CustomerID, at); err != nil {
+		return 0, err
+	}
+	balance, err := pointsBalance(tx, *receipt.CustomerID)
+	if err != nil {
+		return 0, err
+	}
+	points = min(points, balance)
+	if points <= 0 {
+		return 0, nil
+	}
+	if err := consumePoints(tx, *receipt.CustomerID, points, at); err != nil {
+		return 0, err
+	}
+
+	entry := models.LoyaltyEntry{
+		UserID:       receipt.UserID,
+		CustomerID:   *receipt.CustomerID,
+		ReceiptID:    &receipt.ID,
+		SaleReturnID: &saleReturnID,
+		Type:         models.LoyaltyReverse,
+		Points:       -points,
+		Description:  fmt.Sprintf("Returned goods from receipt %s", receipt.ReceiptNumber),
+	}
+	return points, tx.Create(&entry).Error
+}
+
+// refundToPoints gives a refund back to the customer as points
+func refundToPoints(tx *gorm.DB, settings models.BusinessSettings, receipt models.Receipt, saleReturnID uint, refund float64, at time.Time) (int, error) {
+	points := int(math.Round(refund / settings.PointValue))
+	if points <= 0 {
+		return 0, nil
+	}
+	entry := models.LoyaltyEntry{
+		UserID:       receipt.UserID,
+		CustomerID:   *receipt.CustomerID,
+		ReceiptID:    &receipt.ID,
+		SaleReturnID: &saleReturnID,
+		Type:         models.LoyaltyRefund,
+		Points:       points,
+		Remaining:    points,
+		ExpiresAt:    pointsExpiry(settings, at),
+		Description:  fmt.Sprintf("Refund for receipt %s", receipt.ReceiptNumber),
+	}
+	return points, tx.Create(&entry).Error
+}
+
+// GetPointsBalance returns a customer's points, what they are worth and
+// how many expire in the next 30 days
+func (ch *CustomerHandler) GetPointsBalance(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	customer, ok := ch.loadCustomer(c, userID)
+	if !ok {
+		return
+	}
+	settings, err := loadBusinessSettings(ch.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load business settings"})
+		return
+	}
+
+	now := time.Now()
+	if _, err := expirePoints(ch.db, customer.ID, now); err != nil {
+		utils.ErrorLogger("Failed to expire points for customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to load points balance"})
+		return
+	}
+	balance, err := pointsBalance(ch.db, customer.ID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load points balance for customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to load points balance"})
+		return
+	}
+	var expiringSoon int
+	if err := ch.db.Model(&models.LoyaltyEntry{}).
+		Select("COALESCE(SUM(remaining), 0)").
+		Where("customer_id = ? AND remaining > 0 AND expires_at IS NOT NULL AND expires_at <= ?", customer.ID, now.AddDate(0, 0, 30)).
+		Scan(&expiringSoon).Error; err != nil {
+		utils.ErrorLogger("Failed to load expiring points for customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to load points balance"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"customer_id":         customer.ID,
+		"points":              balance,
+		"value":               roundMoney(float64(balance) * settings.PointValue),
+		"expiring_in_30_days": expiringSoon,
+	})
+}
+
+// GetPointsHistory returns a customer's points ledger, newest first
+func (ch *CustomerHandler) GetPointsHistory(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	customer, ok := ch.loadCustomer(c, userID)
+	if !ok {
+		return
+	}
+
+	var entries []models.LoyaltyEntry
+	if err := ch.db.Where("customer_id = ?", customer.ID).Order("created_at DESC, id DESC").Find(&entries).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch points history for customer %d: %v", customer.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch points history"})
+		return
+	}
+
+	c.JSON(200, entries)
+}
+
+// GetLoyaltyMultipliers lists the points multipliers by category
+func (sh *SettingsHandler) GetLoyaltyMultipliers(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var multipliers []models.LoyaltyMultiplier
+	if err := sh.db.Where("user_id = ?", userID).Order("category").Find(&multipliers).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch loyalty multipliers for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch loyalty multipliers"})
+		return
+	}
+
+	c.JSON(200, multipliers)
+}
+
+// SetLoyaltyMultiplier sets how many times the base rate a category earns.
+// A multiplier of 0 stops the category earning points.
+func (sh *SettingsHandler) SetLoyaltyMultiplier(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input struct {
+		Category   string   `json:"category" binding:"required"`
+		Multiplier *float64 `json:"multiplier" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse loyalty multiplier request: %v", err)
+		c.JSON(400, gin.H{"error": "Category and multiplier are required"})
+		return
+	}
+	if *input.Multiplier < 0 {
+		c.JSON(400, gin.H{"error": "Multiplier cannot be negative"})
+		return
+	}
+
+	category := strings.TrimSpace(input.Category)
+	var multiplier models.LoyaltyMultiplier
+	err := sh.db.Where("user_id = ? AND LOWER(category) = ?", userID, strings.ToLower(category)).First(&multiplier).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.ErrorLogger("Failed to load loyalty multiplier for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to save loyalty multiplier"})
+		return
+	}
+	multiplier.UserID = userID
+	multiplier.Category = category
+	multiplier.Multiplier = *input.Multiplier
+	if err := sh.db.Save(&multiplier).Error; err != nil {
+		utils.ErrorLogger("Failed to save loyalty multiplier for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to save loyalty multiplier"})
+		return
+	}
+
+	c.JSON(200, multiplier)
+}
+
+// DeleteLoyaltyMultiplier puts a category back on the base earn rate
+func (sh *SettingsHandler) DeleteLoyaltyMultiplier(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result := sh.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.LoyaltyMultiplier{})
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to delete loyalty multiplier %s: %v", c.Param("id"), result.Error)
+		c.JSON(500, gin.H{"error": "Failed to delete loyalty multiplier"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Loyalty multiplier not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Loyalty multiplier deleted"})
+}
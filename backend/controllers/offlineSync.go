@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Error codes processSales attaches to failures that are conflicts with the
+// current state of the shop rather than a bad request
+const (
+	errCodeInsufficientStock = "INSUFFICIENT_STOCK"
+	errCodeProductArchived   = "PRODUCT_ARCHIVED"
+)
+
+// Outcomes of syncing one offline sale
+const (
+	SyncSynced    = "SYNCED"
+	SyncDuplicate = "DUPLICATE"
+	// SyncConflict means the sale was valid when rung up but cannot be
+	// applied now, e.g. the stock has since been sold
+	SyncConflict = "CONFLICT"
+	// SyncRejected means the sale itself is invalid and retrying will not help
+	SyncRejected = "REJECTED"
+	// SyncFailed is a server error; the till should retry the sale later
+	SyncFailed = "FAILED"
+)
+
+const (
+	maxSyncBatch = 200
+	// Till clocks drift; sales stamped this far ahead of the server are accepted
+	maxSyncClockSkew = 5 * time.Minute
+)
+
+// OfflineSale is a sale captured while the till was offline
+type OfflineSale struct {
+	ClientSaleID string    `json:"client_sale_id" binding:"required"`
+	SoldAt       time.Time `json:"sold_at" binding:"required"`
+	SaleData
+}
+
+// SyncRequest is a batch of offline sales
+type SyncRequest struct {
+	Sales []OfflineSale `json:"sales" binding:"required"`
+}
+
+// SyncResult is what happened to one offline sale
+type SyncResult struct {
+	ClientSaleID  string   `json:"client_sale_id"`
+	Status        string   `json:"status"`
+	ReceiptNumber string   `json:"receipt_number,omitempty"`
+	TotalAmount   float64  `json:"total_amount,omitempty"`
+	Code          string   `json:"code,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+}
+
+// syncResponder records the response processSales gives for one sale
+type syncResponder struct {
+	status int
+	body   gin.H
+}
+
+func (r *syncResponder) JSON(code int, obj any) {
+	r.status = code
+	r.body, _ = obj.(gin.H)
+}
+
+// result turns the recorded response into a sync result
+func (r *syncResponder) result(clientSaleID string) SyncResult {
+	result := SyncResult{ClientSaleID: clientSaleID}
+	if r.status == 200 {
+		result.Status = SyncSynced
+		result.ReceiptNumber, _ = r.body["receiptNumber"].(string)
+		result.TotalAmount, _ = r.body["totalAmount"].(float64)
+		result.Warnings, _ = r.body["warnings"].([]string)
+		return result
+	}
+
+	result.Error, _ = r.body["error"].(string)
+	result.Code, _ = r.body["code"].(string)
+	switch {
+	case r.status == 404 || r.status == 409 || result.Code != "":
+		result.Status = SyncConflict
+	case r.status >= 500:
+		result.Status = SyncFailed
+	default:
+		result.Status = SyncRejected
+	}
+	return result
+}
+
+// syncedReceipt finds the receipt an offline sale was already synced as
+func syncedReceipt(db *gorm.DB, userID uint, clientSaleID string) (*models.Receipt, error) {
+	var receipt models.Receipt
+	err := db.Where("user_id = ? AND client_sale_id = ?", userID, clientSaleID).First(&receipt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// syncOfflineSale applies one offline sale through processSales
+func (im *SalesManagementHandler) syncOfflineSale(userID, staffID uint, sale OfflineSale, now time.Time) SyncResult {
+	clientSaleID := strings.ToLower(strings.TrimSpace(sale.ClientSaleID))
+	result := SyncResult{ClientSaleID: sale.ClientSaleID}
+
+	if _, err := uuid.Parse(clientSaleID); err != nil {
+		result.Status = SyncRejected
+		result.Error = "client_sale_id must be a UUID"
+		return result
+	}
+	if sale.SoldAt.After(now.Add(maxSyncClockSkew)) {
+		result.Status = SyncRejected
+		result.Error = "sold_at is in the future"
+		return result
+	}
+
+	existing, err := syncedReceipt(im.db, userID, clientSaleID)
+	if err != nil {
+		utils.ErrorLogger("Failed to check offline sale %s: %v", clientSaleID, err)
+		result.Status = SyncFailed
+		result.Error = "Failed to check for an earlier sync"
+		return result
+	}
+	if existing != nil {
+		result.Status = SyncDuplicate
+		result.ReceiptNumber = existing.ReceiptNumber
+		result.TotalAmount = existing.TotalAmount
+		return result
+	}
+
+	saleData := sale.SaleData
+	if err := validateSaleData(&saleData); err != nil {
+		result.Status = SyncRejected
+		result.Error = err.Error()
+		return result
+	}
+	saleData.clientSaleID = clientSaleID
+	saleData.soldAt = sale.SoldAt
+	saleData.staffID = staffID
+
+	responder := &syncResponder{}
+	processSales(saleData, userID, im, responder)
+	result = responder.result(sale.ClientSaleID)
+
+	// Another sync of the same sale may have won the race for the receipt
+	if result.Status == SyncFailed {
+		if existing, err := syncedReceipt(im.db, userID, clientSaleID); err == nil && existing != nil {
+			result = SyncResult{ClientSaleID: sale.ClientSaleID, Status: SyncDuplicate, ReceiptNumber: existing.ReceiptNumber, TotalAmount: existing.TotalAmount}
+		}
+	}
+	return result
+}
+
+// SyncOfflineSales applies a batch of sales captured while the till was
+// offline. Sales are applied oldest first, each in its own transaction, so
+// one conflict does not fail the batch. Sales already synced are reported as
+// duplicates with their receipt number.
+func (im *SalesManagementHandler) SyncOfflineSales(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input SyncRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse sync request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+	if len(input.Sales) == 0 {
+		c.JSON(400, gin.H{"error": "At least one sale is required"})
+		return
+	}
+	if len(input.Sales) > maxSyncBatch {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("At most %d sales can be synced at once", maxSyncBatch)})
+		return
+	}
+
+	order := make([]int, len(input.Sales))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return input.Sales[order[i]].SoldAt.Before(input.Sales[order[j]].SoldAt)
+	})
+
+	now := time.Now()
+	results := make([]SyncResult, len(input.Sales))
+	summary := map[string]int{}
+	for _, i := range order {
+		results[i] = im.syncOfflineSale(userID, actingUser(c), input.Sales[i], now)
+		summary[results[i].Status]++
+		if results[i].Status != SyncSynced && results[i].Status != SyncDuplicate {
+			utils.WarningLogger("Offline sale %s for user %d not synced: %s %s", results[i].ClientSaleID, userID, results[i].Status, results[i].Error)
+		}
+	}
+
+	utils.InfoLogger("Synced %d offline sales for user %d: %v", len(input.Sales), userID, summary)
+	c.JSON(200, gin.H{"results": results, "summary": summary})
+}
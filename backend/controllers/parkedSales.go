@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ParkSaleRequest is a basket to put on hold, with a label to find it by
+type ParkSaleRequest struct {
+	Label string `json:"label"`
+	SaleData
+}
+
+// parkedSaleView is a parked sale with the basket as the till sent it
+type parkedSaleView struct {
+	models.ParkedSale
+	Sale SaleData `json:"sale"`
+}
+
+// loadParkedSale loads one of the user's parked sales by the :id parameter
+func (im *SalesManagementHandler) loadParkedSale(c *gin.Context, userID uint) (*parkedSaleView, bool) {
+	var parked models.ParkedSale
+	err := im.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&parked).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "Parked sale not found"})
+		return nil, false
+	}
+	if err != nil {
+		utils.ErrorLogger("Failed to load parked sale %s: %v", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Failed to load parked sale"})
+		return nil, false
+	}
+
+	view := parkedSaleView{ParkedSale: parked}
+	if err := json.Unmarshal([]byte(parked.Sale), &view.Sale); err != nil {
+		utils.ErrorLogger("Parked sale %d is unreadable: %v", parked.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to load parked sale"})
+		return nil, false
+	}
+	return &view, true
+}
+
+// ParkSale puts a basket on hold. No stock is taken and nothing is priced
+// until the sale is resumed and recorded.
+func (im *SalesManagementHandler) ParkSale(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input ParkSaleRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse park sale request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(input.Products) == 0 {
+		c.JSON(400, gin.H{"error": "At least one product is required"})
+		return
+	}
+
+	sale, err := json.Marshal(input.SaleData)
+	if err != nil {
+		utils.ErrorLogger("Failed to encode parked sale: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to park sale"})
+		return
+	}
+	parked := models.ParkedSale{
+		UserID:       userID,
+		Label:        input.Label,
+		CustomerName: input.CustomerName,
+		Lines:        len(input.Products),
+		Sale:         string(sale),
+	}
+	if err := im.db.Create(&parked).Error; err != nil {
+		utils.ErrorLogger("Failed to park sale for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to park sale"})
+		return
+	}
+
+	c.JSON(201, parkedSaleView{ParkedSale: parked, Sale: input.SaleData})
+}
+
+// GetParkedSales lists the baskets on hold, oldest first
+func (im *SalesManagementHandler) GetParkedSales(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var parked []models.ParkedSale
+	if err := im.db.Where("user_id = ?", userID).Order("created_at").Find(&parked).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch parked sales for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch parked sales"})
+		return
+	}
+
+	c.JSON(200, parked)
+}
+
+// GetParkedSale returns a parked basket without taking it off hold
+func (im *SalesManagementHandler) GetParkedSale(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	view, ok := im.loadParkedSale(c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(200, view)
+}
+
+// ResumeParkedSale takes a basket off hold and returns it to the till to
+// be finished and recorded. Only one till can resume it.
+func (im *SalesManagementHandler) ResumeParkedSale(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	view, ok := im.loadParkedSale(c, userID)
+	if !ok {
+		return
+	}
+	result := im.db.Where("id = ? AND user_id = ?", view.ID, userID).Delete(&models.ParkedSale{})
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to resume parked sale %d: %v", view.ID, result.Error)
+		c.JSON(500, gin.H{"error": "Failed to resume parked sale"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": "Parked sale has already been resumed"})
+		return
+	}
+
+	c.JSON(200, view)
+}
+
+// DeleteParkedSale discards a basket on hold
+func (im *SalesManagementHandler) DeleteParkedSale(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result := im.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.ParkedSale{})
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to delete parked sale %s: %v", c.Param("id"), result.Error)
+		c.JSON(500, gin.H{"error": "Failed to delete parked sale"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Parked sale not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Parked sale deleted"})
+}
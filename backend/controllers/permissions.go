@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// actingUser is the login making a request: a staff login, or the owner
+// when the token names no staff
+func actingUser(c *gin.Context) uint {
+	if staffID := c.GetUint("staffID"); staffID != 0 {
+		return staffID
+	}
+	return c.GetUint("userID")
+}
+
+// hasPermission reports whether a login's role grants a permission in a
+// business. The login must be the owner or one of the owner's staff. The
+// role is read from the database so a changed role applies without a new
+// token.
+func hasPermission(db *gorm.DB, userID, staffID uint, permission string) (bool, error) {
+	var user models.User
+	err := db.Select("id", "role").
+		Where("id = ? AND (id = ? OR business_id = ?)", staffID, userID, userID).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return models.RolePermissions[user.Role][permission], nil
+}
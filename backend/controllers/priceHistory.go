@@ -0,0 +1,278 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recordPriceChange writes an applied price change for a product inside tx
+func recordPriceChange(tx *gorm.DB, userID uint, product models.Product, oldPrice float64, reason string) error {
+	now := time.Now()
+	change := models.PriceChange{
+		UserID:      userID,
+		ProductID:   product.ID,
+		OldPrice:    oldPrice,
+		NewPrice:    product.Price,
+		EffectiveAt: now,
+		Status:      models.PriceChangeApplied,
+		Reason:      reason,
+		ChangedBy:   userID,
+		AppliedAt:   &now,
+	}
+	return tx.Create(&change).Error
+}
+
+// effectivePrice returns the selling price of a product at the given time.
+// Products created before price history existed fall back to the current price.
+// Due changes the scheduler has not reached yet are applied first, so the
+// price charged and the product's price never disagree.
+func effectivePrice(db *gorm.DB, userID, productID uint, at time.Time) (float64, error) {
+	var due []models.PriceChange
+	if err := db.Where("user_id = ? AND product_id = ? AND status = ? AND effective_at <= ?",
+		userID, productID, models.PriceChangePending, time.Now()).
+		Order("effective_at ASC, id ASC").
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+	for _, change := range due {
+		if _, err := applyPriceChange(db, change); err != nil {
+			return 0, err
+		}
+	}
+
+	var change models.PriceChange
+	err := db.Where("user_id = ? AND product_id = ? AND status <> ? AND effective_at <= ?",
+		userID, productID, models.PriceChangeCancelled, at).
+		Order("effective_at DESC, id DESC").
+		First(&change).Error
+	if err == nil {
+		return change.NewPrice, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	// Before the first recorded change the price was that change's old price
+	if err := db.Where("user_id = ? AND product_id = ? AND status <> ?",
+		userID, productID, models.PriceChangeCancelled).
+		Order("effective_at ASC, id ASC").
+		First(&change).Error; err == nil {
+		return change.OldPrice, nil
+	}
+
+	var product models.Product
+	if err := db.Where("id = ? AND user_id = ?", productID, userID).First(&product).Error; err != nil {
+		return 0, err
+	}
+	return product.Price, nil
+}
+
+// SchedulePriceChange records a future-dated price change for a product
+func (im *InventoryManagementHandler) SchedulePriceChange(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input struct {
+		Price       float64   `json:"price" binding:"required"`
+		EffectiveAt time.Time `json:"effective_at" binding:"required"`
+		Reason      string    `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse price change request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if input.Price <= 0 {
+		c.JSON(400, gin.H{"error": "Price must be greater than 0"})
+		return
+	}
+	if !input.EffectiveAt.After(time.Now()) {
+		c.JSON(400, gin.H{"error": "Effective date must be in the future. Use update-product for immediate changes"})
+		return
+	}
+
+	var product models.Product
+	if err := im.Db.Where("id = ? AND user_id = ?", id, userID).First(&product).Error; err != nil {
+		utils.WarningLogger("Product not found for user %d: %v", userID, err)
+		c.JSON(404, gin.H{"error": "Product not found"})
+		return
+	}
+
+	change := models.PriceChange{
+		UserID:      userID,
+		ProductID:   product.ID,
+		OldPrice:    product.Price,
+		NewPrice:    input.Price,
+		EffectiveAt: input.EffectiveAt,
+		Status:      models.PriceChangePending,
+		Reason:      input.Reason,
+		ChangedBy:   userID,
+	}
+	if err := im.Db.Create(&change).Error; err != nil {
+		utils.ErrorLogger("Failed to schedule price change for product %s: %v", id, err)
+		c.JSON(500, gin.H{"error": "Failed to schedule price change"})
+		return
+	}
+
+	utils.InfoLogger("Scheduled price change %d for product %s effective %s", change.ID, id, change.EffectiveAt)
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    change,
+	})
+}
+
+// CancelPriceChange cancels a price change that has not been applied yet
+func (im *InventoryManagementHandler) CancelPriceChange(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result := im.Db.Model(&models.PriceChange{}).
+		Where("id = ? AND user_id = ? AND status = ?", id, userID, models.PriceChangePending).
+		Update("status", models.PriceChangeCancelled)
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to cancel price change %s: %v", id, result.Error)
+		c.JSON(500, gin.H{"error": "Failed to cancel price change"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Pending price change not found"})
+		return
+	}
+
+	utils.InfoLogger("Cancelled price change %s for user %d", id, userID)
+	c.JSON(200, gin.H{"message": "Price change cancelled successfully"})
+}
+
+// GetPriceHistory lists applied, pending and cancelled price changes for a product
+func (im *InventoryManagementHandler) GetPriceHistory(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var changes []models.PriceChange
+	if err := im.Db.Where("product_id = ? AND user_id = ?", id, userID).
+		Order("effective_at DESC, id DESC").
+		Find(&changes).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch price history for product %s: %v", id, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+
+	c.JSON(200, changes)
+}
+
+// GetEffectivePrice returns the price that applied to a product at a past timestamp
+func (im *InventoryManagementHandler) GetEffectivePrice(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var product models.Product
+	if err := im.Db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&product).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Product not found"})
+		return
+	}
+
+	at := time.Now()
+	if value := c.Query("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid timestamp. Use RFC3339, e.g. 2024-12-01T08:00:00+03:00"})
+			return
+		}
+		at = parsed
+	}
+
+	price, err := effectivePrice(im.Db, userID, product.ID, at)
+	if err != nil {
+		utils.ErrorLogger("Failed to resolve effective price for product %d: %v", product.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to resolve effective price"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"product_id": product.ID,
+		"at":         at,
+		"price":      price,
+	})
+}
+
+// ApplyDuePriceChanges applies every pending price change that is effective
+// at or before now, oldest first, and returns how many were applied.
+func ApplyDuePriceChanges(db *gorm.DB, now time.Time) (int, error) {
+	var due []models.PriceChange
+	if err := db.Where("status = ? AND effective_at <= ?", models.PriceChangePending, now).
+		Order("effective_at ASC, id ASC").
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, change := range due {
+		ok, err := applyPriceChange(db, change)
+		if err != nil {
+			utils.ErrorLogger("Failed to apply price change %d: %v", change.ID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		applied++
+		utils.InfoLogger("Applied price change %d for product %d", change.ID, change.ProductID)
+	}
+
+	return applied, nil
+}
+
+// applyPriceChange sets a product's price from a pending change and marks it
+// applied. It reports false for a change already applied elsewhere.
+func applyPriceChange(db *gorm.DB, change models.PriceChange) (bool, error) {
+	applied := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Where("id = ? AND user_id = ?", change.ProductID, change.UserID).First(&product).Error; err != nil {
+			return err
+		}
+
+		appliedAt := time.Now()
+		result := tx.Model(&models.PriceChange{}).
+			Where("id = ? AND status = ?", change.ID, models.PriceChangePending).
+			Updates(map[string]interface{}{
+				"status":     models.PriceChangeApplied,
+				"old_price":  product.Price,
+				"applied_at": appliedAt,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		applied = true
+		return tx.Model(&product).Updates(map[string]interface{}{
+			"price":      change.NewPrice,
+			"updated_at": appliedAt,
+		}).Error
+	})
+	return applied && err == nil, err
+}
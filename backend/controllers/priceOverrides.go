@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errOverrideForbidden      = errors.New("You do not have permission to change prices or give discounts")
+	errOverrideReasonRequired = errors.New("A reason is required to change prices or give discounts")
+)
+
+// overrideAuthoriser checks the override permission of the login ringing
+// up a sale once per sale
+type overrideAuthoriser struct {
+	db      *gorm.DB
+	userID  uint
+	staffID uint
+	checked bool
+	allowed bool
+}
+
+// authorise returns an error unless the user may override prices and gave a reason
+func (a *overrideAuthoriser) authorise(reason string) error {
+	if !a.checked {
+		allowed, err := hasPermission(a.db, a.userID, a.staffID, models.PermissionOverridePrice)
+		if err != nil {
+			return err
+		}
+		a.checked, a.allowed = true, allowed
+	}
+	if !a.allowed {
+		return errOverrideForbidden
+	}
+	if strings.TrimSpace(reason) == "" {
+		return errOverrideReasonRequired
+	}
+	return nil
+}
+
+// overrideErrorStatus maps an authorise error to an HTTP status
+func overrideErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errOverrideForbidden):
+		return 403
+	case errors.Is(err, errOverrideReasonRequired):
+		return 400
+	}
+	return 500
+}
+
+var priceOverrideListSpec = listSpec[models.PriceOverride]{
+	id: listField[models.PriceOverride]{column: "price_overrides.id", kind: listNumber, value: func(r models.PriceOverride) any { return r.ID }},
+	fields: map[string]listField[models.PriceOverride]{
+		"receipt_id":     {column: "price_overrides.receipt_id", kind: listNumber, value: func(r models.PriceOverride) any { return r.ReceiptID }},
+		"product_id":     {column: "price_overrides.product_id", kind: listNumber},
+		"kind":           {column: "price_overrides.kind", kind: listText, value: func(r models.PriceOverride) any { return r.Kind }},
+		"charged_amount": {column: "price_overrides.charged_amount", kind: listNumber, value: func(r models.PriceOverride) any { return r.ChargedAmount }},
+		"created_at":     {column: "price_overrides.created_at", kind: listTime, value: func(r models.PriceOverride) any { return r.CreatedAt }},
+	},
+	defaultSort: "-created_at",
+	params:      []string{"reviewed"},
+}
+
+// GetPriceOverrides lists price overrides and cashier discounts for review.
+// ?reviewed=false shows only those the owner has not yet seen.
+func (im *SalesManagementHandler) GetPriceOverrides(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	list, err := parseListQuery(c, priceOverrideListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := im.db.Model(&models.PriceOverride{}).Where("user_id = ?", userID)
+	switch c.Query("reviewed") {
+	case "true":
+		query = query.Where("reviewed = ?", true)
+	case "false":
+		query = query.Where("reviewed = ?", false)
+	}
+
+	var overrides []models.PriceOverride
+	if err := list.find(query, &overrides); err != nil {
+		utils.ErrorLogger("Failed to fetch price overrides for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch price overrides"})
+		return
+	}
+
+	c.JSON(200, overrides)
+}
+
+// ReviewPriceOverride marks a price override as seen by the owner
+func (im *SalesManagementHandler) ReviewPriceOverride(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	staffID := actingUser(c)
+	allowed, err := hasPermission(im.db, userID, staffID, models.PermissionReviewOverrides)
+	if err != nil {
+		utils.ErrorLogger("Failed to check review permission for user %d: %v", staffID, err)
+		c.JSON(500, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if !allowed {
+		c.JSON(403, gin.H{"error": "You do not have permission to review price overrides"})
+		return
+	}
+
+	now := time.Now()
+	result := im.db.Model(&models.PriceOverride{}).
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		Updates(map[string]interface{}{"reviewed": true, "reviewed_at": &now})
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to review price override %s: %v", c.Param("id"), result.Error)
+		c.JSON(500, gin.H{"error": "Failed to review price override"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Price override not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Price override reviewed"})
+}
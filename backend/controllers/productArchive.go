@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetArchivedProducts lists products that have been deleted (marked inactive)
+func (im *InventoryManagementHandler) GetArchivedProducts(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	list, err := parseListQuery(c, productListSpec("-updated_at"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, bundles, err := im.findProducts(list, userID, false)
+	if err != nil {
+		utils.ErrorLogger("Failed to fetch archived products for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to get archived products"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, gin.H{
+			"product":  row.Product,
+			"quantity": row.stockOnHand(bundles),
+		})
+	}
+
+	utils.InfoLogger("Successfully fetched archived products for user %d", userID)
+	c.JSON(200, result)
+}
+
+// RestoreProduct makes an archived product active again
+func (im *InventoryManagementHandler) RestoreProduct(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result := im.Db.Model(&models.Product{}).
+		Where("id = ? AND user_id = ? AND active = ?", id, userID, false).
+		Update("active", true)
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to restore product %s for user %d: %v", id, userID, result.Error)
+		c.JSON(500, gin.H{"error": "Failed to restore product"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Archived product not found"})
+		return
+	}
+
+	utils.InfoLogger("Successfully restored product %s for user %d", id, userID)
+	c.JSON(200, gin.H{"message": "Product restored successfully"})
+}
+
+// HardDeleteProduct permanently removes a product that has never been traded.
+// Products on sales, credits, receipts, quotations, layaways, returns,
+// promotions, price overrides, stock movements or exceptions, sales rollups
+// or in a bundle keep their history and can only be archived. Coupons apply
+// to a whole basket and never name a product.
+func (im *InventoryManagementHandler) HardDeleteProduct(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var product models.Product
+	if err := im.Db.Where("id = ? AND user_id = ?", id, userID).First(&product).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Product not found"})
+		return
+	}
+
+	history := []struct {
+		name  string
+		model interface{}
+		query string
+	}{
+		{"sales", &models.SalesTransaction{}, "product_id = ?"},
+		{"credits", &models.CreditTransaction{}, "product_id = ?"},
+		{"receipt items", &models.Item{}, "product_id = ?"},
+		{"stock movements", &models.StockMovement{}, "product_id = ?"},
+		{"bundles", &models.BundleComponent{}, "component_id = ?"},
+		{"quotations", &models.QuotationItem{}, "product_id = ?"},
+		{"promotions", &models.Promotion{}, "product_id = ?"},
+		{"layaways", &models.LayawayLine{}, "product_id = ?"},
+		{"layaway reservations", &models.LayawayReservation{}, "product_id = ?"},
+		{"returns", &models.SaleReturnItem{}, "product_id = ?"},
+		{"stock exceptions", &models.StockException{}, "product_id = ?"},
+		{"price overrides", &models.PriceOverride{}, "product_id = ?"},
+		{"sales rollups", &models.SalesHourlyRollup{}, "product_id = ?"},
+	}
+	for _, h := range history {
+		var count int64
+		if err := im.Db.Model(h.model).Where(h.query, product.ID).Count(&count).Error; err != nil {
+			utils.ErrorLogger("Failed to check %s history for product %d: %v", h.name, product.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to check product history"})
+			return
+		}
+		if count > 0 {
+			utils.WarningLogger("Refused hard delete of product %d with %d %s", product.ID, count, h.name)
+			c.JSON(409, gin.H{
+				"error": "Product has " + h.name + " history and can only be archived",
+			})
+			return
+		}
+	}
+
+	err := im.Db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.Inventory{},
+			&models.LowStockAlert{},
+			&models.PriceChange{},
+		} {
+			if err := tx.Where("product_id = ? AND user_id = ?", product.ID, userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("bundle_id = ? AND user_id = ?", product.ID, userID).Delete(&models.BundleComponent{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&product).Error
+	})
+	if err != nil {
+		utils.ErrorLogger("Failed to hard delete product %s for user %d: %v", id, userID, err)
+		c.JSON(500, gin.H{"error": "Failed to delete product"})
+		return
+	}
+
+	utils.InfoLogger("Permanently deleted product %s for user %d", id, userID)
+	c.JSON(200, gin.H{"message": "Product deleted permanently"})
+}
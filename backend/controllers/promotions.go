@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PromotionHandler struct {
+	db *gorm.DB
+}
+
+func NewPromotionHandler(db *gorm.DB) *PromotionHandler {
+	return &PromotionHandler{db: db}
+}
+
+// validatePromotion normalises and checks a promotion before it is saved
+func validatePromotion(db *gorm.DB, userID uint, promotion *models.Promotion) error {
+	promotion.Type = strings.ToUpper(promotion.Type)
+	if strings.TrimSpace(promotion.Name) == "" {
+		return errors.New("Promotion name is required")
+	}
+	if !models.PromotionTypes[promotion.Type] {
+		return fmt.Errorf("Unknown promotion type %s", promotion.Type)
+	}
+
+	switch promotion.Type {
+	case models.PromotionPercentOff:
+		if promotion.Value <= 0 || promotion.Value > 100 {
+			return errors.New("Percentage must be between 0 and 100")
+		}
+	case models.PromotionAmountOff, models.PromotionFixedPrice:
+		if promotion.Value <= 0 {
+			return errors.New("Value must be greater than 0")
+		}
+	case models.PromotionBuyXGetY:
+		if promotion.BuyQuantity <= 0 || promotion.FreeQuantity <= 0 {
+			return errors.New("Buy and free quantities must be greater than 0")
+		}
+	}
+
+	if promotion.StartsAt.IsZero() {
+		promotion.StartsAt = time.Now()
+	}
+	if promotion.EndsAt != nil && !promotion.EndsAt.After(promotion.StartsAt) {
+		return errors.New("Promotion must end after it starts")
+	}
+	if (promotion.DailyStart == "") != (promotion.DailyEnd == "") {
+		return errors.New("Daily start and end must be set together")
+	}
+	for _, clock := range []string{promotion.DailyStart, promotion.DailyEnd} {
+		if clock == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", clock); err != nil {
+			return fmt.Errorf("Invalid time %s. Use HH:MM", clock)
+		}
+	}
+
+	if promotion.ProductID != nil {
+		var count int64
+		if err := db.Model(&models.Product{}).Where("id = ? AND user_id = ?", *promotion.ProductID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("Product %d not found", *promotion.ProductID)
+		}
+	}
+	return nil
+}
+
+// CreatePromotion adds an automatic promotion
+func (ph *PromotionHandler) CreatePromotion(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var promotion models.Promotion
+	if err := c.ShouldBindJSON(&promotion); err != nil {
+		utils.ErrorLogger("Failed to parse promotion request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	promotion.ID = 0
+	promotion.UserID = userID
+	promotion.Active = true
+	if err := validatePromotion(ph.db, userID, &promotion); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ph.db.Create(&promotion).Error; err != nil {
+		utils.ErrorLogger("Failed to create promotion for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to create promotion"})
+		return
+	}
+
+	utils.InfoLogger("Created promotion %d for user %d", promotion.ID, userID)
+	c.JSON(201, promotion)
+}
+
+// GetPromotions lists promotions. ?running=true keeps only those applying now.
+func (ph *PromotionHandler) GetPromotions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var promotions []models.Promotion
+	var err error
+	if c.Query("running") == "true" {
+		promotions, err = loadActivePromotions(ph.db, userID, time.Now())
+	} else {
+		err = ph.db.Where("user_id = ?", userID).Order("starts_at DESC").Find(&promotions).Error
+	}
+	if err != nil {
+		utils.ErrorLogger("Failed to fetch promotions for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch promotions"})
+		return
+	}
+
+	c.JSON(200, promotions)
+}
+
+// UpdatePromotion replaces a promotion's terms
+func (ph *PromotionHandler) UpdatePromotion(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var existing models.Promotion
+	if err := ph.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&existing).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	var promotion models.Promotion
+	if err := c.ShouldBindJSON(&promotion); err != nil {
+		utils.ErrorLogger("Failed to parse promotion request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	promotion.ID = existing.ID
+	promotion.UserID = userID
+	promotion.CreatedAt = existing.CreatedAt
+	promotion.Active = existing.Active
+	if err := validatePromotion(ph.db, userID, &promotion); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ph.db.Save(&promotion).Error; err != nil {
+		utils.ErrorLogger("Failed to update promotion %d: %v", promotion.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to update promotion"})
+		return
+	}
+
+	utils.InfoLogger("Updated promotion %d for user %d", promotion.ID, userID)
+	c.JSON(200, promotion)
+}
+
+// EndPromotion stops a promotion. Past sales keep their discounts.
+func (ph *PromotionHandler) EndPromotion(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result := ph.db.Model(&models.Promotion{}).
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		Update("active", false)
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to end promotion %s: %v", c.Param("id"), result.Error)
+		c.JSON(500, gin.H{"error": "Failed to end promotion"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Promotion ended"})
+}
+
+// CreateCoupon adds a coupon code
+func (ph *PromotionHandler) CreateCoupon(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var coupon models.Coupon
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		utils.ErrorLogger("Failed to parse coupon request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	coupon.ID = 0
+	coupon.UserID = userID
+	coupon.TimesUsed = 0
+	coupon.Active = true
+	coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+	coupon.DiscountType = strings.ToUpper(coupon.DiscountType)
+
+	if coupon.Code == "" {
+		c.JSON(400, gin.H{"error": "Coupon code is required"})
+		return
+	}
+	if !models.DiscountTypes[coupon.DiscountType] {
+		c.JSON(400, gin.H{"error": "Discount type must be PERCENT or FIXED"})
+		return
+	}
+	if coupon.Value <= 0 || (coupon.DiscountType == models.DiscountPercent && coupon.Value > 100) {
+		c.JSON(400, gin.H{"error": "Invalid discount value"})
+		return
+	}
+	if coupon.UsageLimit < 0 || coupon.MinSpend < 0 {
+		c.JSON(400, gin.H{"error": "Usage limit and minimum spend cannot be negative"})
+		return
+	}
+
+	var count int64
+	if err := ph.db.Model(&models.Coupon{}).Where("user_id = ? AND code = ?", userID, coupon.Code).Count(&count).Error; err != nil {
+		utils.ErrorLogger("Failed to check coupon code %s: %v", coupon.Code, err)
+		c.JSON(500, gin.H{"error": "Failed to create coupon"})
+		return
+	}
+	if count > 0 {
+		c.JSON(409, gin.H{"error": fmt.Sprintf("Coupon %s already exists", coupon.Code)})
+		return
+	}
+
+	if err := ph.db.Create(&coupon).Error; err != nil {
+		utils.ErrorLogger("Failed to create coupon for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to create coupon"})
+		return
+	}
+
+	utils.InfoLogger("Created coupon %s for user %d", coupon.Code, userID)
+	c.JSON(201, coupon)
+}
+
+var couponListSpec = listSpec[models.Coupon]{
+	id: listField[models.Coupon]{column: "coupons.id", kind: listNumber, value: func(r models.Coupon) any { return r.ID }},
+	fields: map[string]listField[models.Coupon]{
+		"code":       {column: "coupons.code", kind: listText, value: func(r models.Coupon) any { return r.Code }},
+		"active":     {column: "coupons.active", kind: listBool},
+		"times_used": {column: "coupons.times_used", kind: listNumber, value: func(r models.Coupon) any { return r.TimesUsed }},
+		"created_at": {column: "coupons.created_at", kind: listTime, value: func(r models.Coupon) any { return r.CreatedAt }},
+	},
+	defaultSort: "-created_at",
+}
+
+// GetCoupons lists coupon codes with their usage
+func (ph *PromotionHandler) GetCoupons(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	list, err := parseListQuery(c, couponListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var coupons []models.Coupon
+	if err := list.find(ph.db.Model(&models.Coupon{}).Where("user_id = ?", userID), &coupons); err != nil {
+		utils.ErrorLogger("Failed to fetch coupons for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch coupons"})
+		return
+	}
+
+	c.JSON(200, coupons)
+}
+
+// DisableCoupon stops a coupon code being accepted
+func (ph *PromotionHandler) DisableCoupon(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result := ph.db.Model(&models.Coupon{}).
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		Update("active", false)
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to disable coupon %s: %v", c.Param("id"), result.Error)
+		c.JSON(500, gin.H{"error": "Failed to disable coupon"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Coupon disabled"})
+}
+
+// discountLine totals the discounts given from one source
+type discountLine struct {
+	Source      string  `json:"source"`
+	Description string  `json:"description"`
+	Count       int     `json:"count"`
+	Amount      float64 `json:"amount"`
+}
+
+// GetDiscountReport shows how much was given away over a date range: list
+// against net sales, and discounts by promotion, coupon and cashier discount.
+func (ph *PromotionHandler) GetDiscountReport(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	start, end, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid date range. Use YYYY-MM-DD"})
+		return
+	}
+
+	var totals struct {
+		ListAmount     float64
+		DiscountAmount float64
+		NetAmount      float64
+	}
+	if err := ph.db.Model(&models.SalesTransaction{}).
+		Select("COALESCE(SUM(list_price * quantity), 0) as list_amount, COALESCE(SUM(discount_amount), 0) as discount_amount, COALESCE(SUM(net_amount), 0) as net_amount").
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, start, end).
+		Scan(&totals).Error; err != nil {
+		utils.ErrorLogger("Failed to total discounts for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch discount report"})
+		return
+	}
+
+	var lines []discountLine
+	if err := ph.db.Model(&models.SaleDiscount{}).
+		Select("source, description, COUNT(DISTINCT receipt_id) as count, COALESCE(SUM(amount), 0) as amount").
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, start, end).
+		Group("source, description").
+		Scan(&lines).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch discounts for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch discount report"})
+		return
+	}
+	for i := range lines {
+		lines[i].Amount = roundMoney(lines[i].Amount)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Amount > lines[j].Amount })
+
+	discountRate := 0.0
+	if totals.ListAmount > 0 {
+		discountRate = roundMoney(totals.DiscountAmount / totals.ListAmount * 100)
+	}
+
+	c.JSON(200, gin.H{
+		"startDate":      start.Format("2006-01-02"),
+		"endDate":        end.AddDate(0, 0, -1).Format("2006-01-02"),
+		"listAmount":     roundMoney(totals.ListAmount),
+		"discountAmount": roundMoney(totals.DiscountAmount),
+		"netAmount":      roundMoney(totals.NetAmount),
+		"discountRate":   discountRate,
+		"bySource":       lines,
+	})
+}
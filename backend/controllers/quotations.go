@@ -0,0 +1,529 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errQuotationNotOpen = errors.New("Quotation is no longer open")
+
+type QuotationHandler struct {
+	db *gorm.DB
+}
+
+func NewQuotationHandler(db *gorm.DB) *QuotationHandler {
+	return &QuotationHandler{db: db}
+}
+
+// QuotationRequest is a quote for products, priced like a sale
+type QuotationRequest struct {
+	Products      []SellRequest `json:"products" binding:"required"`
+	CustomerID    uint          `json:"customer_id"`
+	CustomerName  string        `json:"customer_name"`
+	CustomerPhone string        `json:"customer_phone"`
+	// ValidDays is how long the quote stands, DefaultQuotationDays if unset
+	ValidDays int    `json:"valid_days"`
+	Notes     string `json:"notes"`
+}
+
+// ConvertQuotationRequest is how the customer pays when a quote is taken
+// up. Reprice sells at today's prices instead of the quoted ones.
+type ConvertQuotationRequest struct {
+	PaymentMethod   string          `json:"payment_method"`
+	AmountPaid      float64         `json:"amount_paid"`
+	ReferenceNumber string          `json:"reference_number"`
+	Payments        []TenderRequest `json:"payments"`
+	Reprice         bool            `json:"reprice"`
+}
+
+// QuotationConversion is how many quotes became sales over a period
+type QuotationConversion struct {
+	From             time.Time        `json:"from"`
+	To               time.Time        `json:"to"`
+	Quotations       int64            `json:"quotations"`
+	Converted        int64            `json:"converted"`
+	ConversionRate   float64          `json:"conversion_rate"`
+	QuotedValue      float64          `json:"quoted_value"`
+	ConvertedValue   float64          `json:"converted_value"`
+	ValueRate        float64          `json:"value_rate"`
+	AvgDaysToConvert float64          `json:"avg_days_to_convert"`
+	ByStatus         map[string]int64 `json:"by_status"`
+}
+
+func generateQuotationNumber() string {
+	suffix := strings.ToUpper(strings.ReplaceAll(utils.GenerateUUID(), "-", "")[:8])
+	return fmt.Sprintf("QT-%d-%s", time.Now().Unix(), suffix)
+}
+
+// expireQuotations marks open quotes past their validity date as expired
+func expireQuotations(db *gorm.DB, userID uint, now time.Time) error {
+	return db.Model(&models.Quotation{}).
+		Where("user_id = ? AND status = ? AND valid_until < ?", userID, models.QuotationOpen, now).
+		Update("status", models.QuotationExpired).Error
+}
+
+// convertQuotation marks an open quote as taken up on a receipt
+func convertQuotation(tx *gorm.DB, quotation models.Quotation, receiptID uint, at time.Time) error {
+	result := tx.Model(&models.Quotation{}).
+		Where("id = ? AND status = ? AND valid_until >= ?", quotation.ID, models.QuotationOpen, at).
+		Updates(map[string]interface{}{"status": models.QuotationConverted, "receipt_id": receiptID, "converted_at": at})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errQuotationNotOpen
+	}
+	return nil
+}
+
+// loadQuotation loads one of the user's quotations by the :id parameter
+func (qh *QuotationHandler) loadQuotation(c *gin.Context, userID uint) (*models.Quotation, bool) {
+	if err := expireQuotations(qh.db, userID, time.Now()); err != nil {
+		utils.ErrorLogger("Failed to expire quotations for user %d: %v", userID, err)
+	}
+
+	var quotation models.Quotation
+	err := qh.db.Preload("Items").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&quotation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "Quotation not found"})
+		return nil, false
+	}
+	if err != nil {
+		utils.ErrorLogger("Failed to load quotation %s: %v", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Failed to load quotation"})
+		return nil, false
+	}
+	return &quotation, true
+}
+
+// CreateQuotation prices products for a customer without taking stock
+func (qh *QuotationHandler) CreateQuotation(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input QuotationRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse quotation request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(input.Products) == 0 {
+		c.JSON(400, gin.H{"error": "At least one product is required"})
+		return
+	}
+	for _, product := range input.Products {
+		if product.Quantity <= 0 {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Quantity for product %d must be greater than 0", product.ProductID)})
+			return
+		}
+	}
+	if input.ValidDays < 0 {
+		c.JSON(400, gin.H{"error": "Validity cannot be negative"})
+		return
+	}
+	if input.ValidDays == 0 {
+		input.ValidDays = models.DefaultQuotationDays
+	}
+
+	settings, err := loadBusinessSettings(qh.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load business settings"})
+		return
+	}
+	now := time.Now()
+
+	tx := qh.db.Begin()
+	if tx.Error != nil {
+		utils.ErrorLogger("Failed to start transaction: %v", tx.Error)
+		c.JSON(500, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+
+	quotation := models.Quotation{
+		UserID:          userID,
+		QuotationNumber: generateQuotationNumber(),
+		CustomerName:    input.CustomerName,
+		CustomerPhone:   input.CustomerPhone,
+		Date:            now,
+		ValidUntil:      now.AddDate(0, 0, input.ValidDays),
+		Status:          models.QuotationOpen,
+		TaxPricing:      settings.TaxPricing,
+		Notes:           input.Notes,
+	}
+	contact := SaleData{CustomerID: input.CustomerID, CustomerName: input.CustomerName, CustomerPhone: input.CustomerPhone}
+	customer, err := resolveSaleCustomer(tx, userID, &contact)
+	if errors.Is(err, errCustomerNotFound) {
+		tx.Rollback()
+		c.JSON(404, gin.H{"error": "Customer not found"})
+		return
+	}
+	if errors.Is(err, errCustomerPhone) {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to resolve customer for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load customer"})
+		return
+	}
+	if customer != nil {
+		quotation.CustomerID = &customer.ID
+		quotation.CustomerName = contact.CustomerName
+		quotation.CustomerPhone = customer.Phone
+	}
+
+	if err := tx.Create(&quotation).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to create quotation: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to create quotation"})
+		return
+	}
+
+	promotions, err := loadActivePromotions(tx, userID, now)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to load promotions for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load promotions"})
+		return
+	}
+
+	overrides := &overrideAuthoriser{db: tx, userID: userID, staffID: actingUser(c)}
+	for _, request := range input.Products {
+		var product models.Product
+		if err := tx.Where("id = ? AND user_id = ?", request.ProductID, userID).First(&product).Error; err != nil {
+			tx.Rollback()
+			c.JSON(404, gin.H{"error": fmt.Sprintf("Product %d not found", request.ProductID)})
+			return
+		}
+		if !product.Active {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Product %d is archived and cannot be sold", request.ProductID), "code": errCodeProductArchived})
+			return
+		}
+
+		line, err := priceLine(tx, userID, product, request, promotions, overrides, now)
+		if err != nil {
+			tx.Rollback()
+			status := lineErrorStatus(err)
+			if status == 500 {
+				utils.ErrorLogger("Failed to price product %d: %v", product.ID, err)
+				c.JSON(500, gin.H{"error": "Failed to price products"})
+				return
+			}
+			utils.WarningLogger("User %d quoted price on product %d refused: %v", userID, product.ID, err)
+			c.JSON(status, gin.H{"error": fmt.Sprintf("Product %d: %v", request.ProductID, err)})
+			return
+		}
+		net := line.netAmount()
+		tax := lineTax(settings, product.TaxClass, net)
+
+		item := models.QuotationItem{
+			QuotationID:    quotation.ID,
+			ProductID:      product.ID,
+			Name:           product.Name,
+			Quantity:       request.Quantity,
+			UnitPrice:      tax.Total / float64(request.Quantity),
+			TotalPrice:     tax.Total,
+			ListPrice:      line.ListPrice,
+			DiscountAmount: line.discountAmount(),
+			NetAmount:      net,
+			TaxClass:       tax.Class,
+			TaxRate:        tax.Rate,
+			TaxableAmount:  tax.Taxable,
+			TaxAmount:      tax.Tax,
+			KeyedAmount:    request.Amount,
+			DiscountType:   strings.ToUpper(request.DiscountType),
+			DiscountValue:  request.DiscountValue,
+			OverrideReason: request.OverrideReason,
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to create quotation item: %v", err)
+			c.JSON(500, gin.H{"error": "Failed to create quotation"})
+			return
+		}
+		quotation.Items = append(quotation.Items, item)
+		quotation.TotalAmount = roundMoney(quotation.TotalAmount + item.TotalPrice)
+		quotation.DiscountAmount = roundMoney(quotation.DiscountAmount + item.DiscountAmount)
+		quotation.TaxAmount = roundMoney(quotation.TaxAmount + item.TaxAmount)
+	}
+
+	if err := tx.Model(&quotation).Updates(map[string]interface{}{
+		"total_amount":    quotation.TotalAmount,
+		"discount_amount": quotation.DiscountAmount,
+		"tax_amount":      quotation.TaxAmount,
+	}).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to update quotation %s totals: %v", quotation.QuotationNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to create quotation"})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorLogger("Failed to commit quotation %s: %v", quotation.QuotationNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to create quotation"})
+		return
+	}
+
+	utils.InfoLogger("Created quotation %s for user %d: %.2f", quotation.QuotationNumber, userID, quotation.TotalAmount)
+	c.JSON(201, quotation)
+}
+
+var quotationListSpec = listSpec[models.Quotation]{
+	id: listField[models.Quotation]{column: "quotations.id", kind: listNumber, value: func(r models.Quotation) any { return r.ID }},
+	fields: map[string]listField[models.Quotation]{
+		"quotation_number": {column: "quotations.quotation_number", kind: listText},
+		"customer_id":      {column: "quotations.customer_id", kind: listNumber},
+		"customer_name":    {column: "quotations.customer_name", kind: listText, value: func(r models.Quotation) any { return r.CustomerName }},
+		"total_amount":     {column: "quotations.total_amount", kind: listNumber, value: func(r models.Quotation) any { return r.TotalAmount }},
+		"date":             {column: "quotations.date", kind: listTime, value: func(r models.Quotation) any { return r.Date }},
+		"valid_until":      {column: "quotations.valid_until", kind: listTime, value: func(r models.Quotation) any { return r.ValidUntil }},
+	},
+	defaultSort: "-date",
+	preloads:    []string{"Items"},
+	params:      []string{"status"},
+}
+
+// GetQuotations lists quotations, newest first, optionally by ?status=
+func (qh *QuotationHandler) GetQuotations(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	list, err := parseListQuery(c, quotationListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := expireQuotations(qh.db, userID, time.Now()); err != nil {
+		utils.ErrorLogger("Failed to expire quotations for user %d: %v", userID, err)
+	}
+	query := qh.db.Model(&models.Quotation{}).Where("user_id = ?", userID)
+	if status := strings.ToUpper(c.Query("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var quotations []models.Quotation
+	if err := list.find(query, &quotations); err != nil {
+		utils.ErrorLogger("Failed to fetch quotations for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch quotations"})
+		return
+	}
+
+	c.JSON(200, quotations)
+}
+
+// GetQuotation returns a quotation laid out like a receipt
+func (qh *QuotationHandler) GetQuotation(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	quotation, ok := qh.loadQuotation(c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(200, quotation)
+}
+
+// DeclineQuotation records that the customer turned a quote down
+func (qh *QuotationHandler) DeclineQuotation(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	quotation, ok := qh.loadQuotation(c, userID)
+	if !ok {
+		return
+	}
+	result := qh.db.Model(&models.Quotation{}).
+		Where("id = ? AND status = ?", quotation.ID, models.QuotationOpen).
+		Update("status", models.QuotationDeclined)
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to decline quotation %s: %v", quotation.QuotationNumber, result.Error)
+		c.JSON(500, gin.H{"error": "Failed to decline quotation"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": errQuotationNotOpen.Error()})
+		return
+	}
+
+	quotation.Status = models.QuotationDeclined
+	c.JSON(200, quotation)
+}
+
+// ConvertQuotation sells a quotation in one call. The sale goes through
+// processSales, so stock is re-checked, but lines are sold at the quoted
+// prices and discounts, which were authorised when the quotation was raised.
+// Reprice sells at today's prices instead.
+func (qh *QuotationHandler) ConvertQuotation(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input ConvertQuotationRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse convert quotation request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	quotation, ok := qh.loadQuotation(c, userID)
+	if !ok {
+		return
+	}
+	if quotation.Status != models.QuotationOpen {
+		c.JSON(409, gin.H{"error": fmt.Sprintf("Quotation %s is %s", quotation.QuotationNumber, strings.ToLower(quotation.Status))})
+		return
+	}
+
+	saleData := SaleData{
+		CustomerName:    quotation.CustomerName,
+		CustomerPhone:   quotation.CustomerPhone,
+		PaymentMethod:   input.PaymentMethod,
+		AmountPaid:      input.AmountPaid,
+		ReferenceNumber: input.ReferenceNumber,
+		Payments:        input.Payments,
+		quotation:       quotation,
+		staffID:         actingUser(c),
+	}
+	if quotation.CustomerID != nil {
+		saleData.CustomerID = *quotation.CustomerID
+	}
+	for _, item := range quotation.Items {
+		request := SellRequest{ProductID: item.ProductID, Quantity: item.Quantity}
+		if input.Reprice {
+			request.DiscountType = item.DiscountType
+			request.DiscountValue = item.DiscountValue
+			request.OverrideReason = item.OverrideReason
+		} else {
+			request.agreed = &agreedPrice{
+				ListPrice:      item.ListPrice,
+				DiscountAmount: item.DiscountAmount,
+				Source:         models.DiscountSourceQuotation,
+				Description:    "Quoted discount",
+			}
+		}
+		saleData.Products = append(saleData.Products, request)
+	}
+
+	if err := validateSaleData(&saleData); err != nil {
+		utils.WarningLogger("Invalid conversion of quotation %s: %v", quotation.QuotationNumber, err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	utils.InfoLogger("Converting quotation %s for user %d", quotation.QuotationNumber, userID)
+	processSales(saleData, userID, NewSalesManagementHandler(qh.db), c)
+}
+
+// GetQuotationConversion reports how many quotations raised between ?from=
+// and ?to= (YYYY-MM-DD, default the last 30 days) became sales
+func (qh *QuotationHandler) GetQuotationConversion(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	now := time.Now()
+	to := now
+	from := now.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+			return
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		c.JSON(400, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	if err := expireQuotations(qh.db, userID, now); err != nil {
+		utils.ErrorLogger("Failed to expire quotations for user %d: %v", userID, err)
+	}
+	var quotations []models.Quotation
+	if err := qh.db.Where("user_id = ? AND date >= ? AND date < ?", userID, from, to).Find(&quotations).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch quotations for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch quotations"})
+		return
+	}
+
+	report := QuotationConversion{From: from, To: to, ByStatus: map[string]int64{}}
+	var receiptIDs []uint
+	var daysToConvert float64
+	for _, quotation := range quotations {
+		report.Quotations++
+		report.ByStatus[quotation.Status]++
+		report.QuotedValue += quotation.TotalAmount
+		if quotation.Status == models.QuotationConverted && quotation.ReceiptID != nil {
+			report.Converted++
+			receiptIDs = append(receiptIDs, *quotation.ReceiptID)
+			if quotation.ConvertedAt != nil {
+				daysToConvert += quotation.ConvertedAt.Sub(quotation.Date).Hours() / 24
+			}
+		}
+	}
+	if len(receiptIDs) > 0 {
+		if err := qh.db.Model(&models.Receipt{}).
+			Select("COALESCE(SUM(total_amount), 0)").
+			Where("id IN ?", receiptIDs).
+			Scan(&report.ConvertedValue).Error; err != nil {
+			utils.ErrorLogger("Failed to total converted quotations for user %d: %v", userID, err)
+			c.JSON(500, gin.H{"error": "Failed to fetch quotation conversion"})
+			return
+		}
+	}
+
+	report.QuotedValue = roundMoney(report.QuotedValue)
+	report.ConvertedValue = roundMoney(report.ConvertedValue)
+	if report.Quotations > 0 {
+		report.ConversionRate = roundMoney(float64(report.Converted) / float64(report.Quotations) * 100)
+	}
+	if report.QuotedValue > 0 {
+		report.ValueRate = roundMoney(report.ConvertedValue / report.QuotedValue * 100)
+	}
+	if report.Converted > 0 {
+		report.AvgDaysToConvert = roundMoney(daysToConvert / float64(report.Converted))
+	}
+
+	c.JSON(200, report)
+}
@@ -26,7 +26,7 @@ func (rh *ReceiptHandler) GetReceipt(c *gin.Context) {
 	}
 
 	var receipt models.Receipt
-	if err := rh.db.Preload("Items").Where("receipt_number = ? AND user_id = ?", receiptNumber, userID).First(&receipt).Error; err != nil {
+	if err := rh.db.Preload("Items").Preload("Payments").Where("receipt_number = ? AND user_id = ?", receiptNumber, userID).First(&receipt).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorLogger("Receipt not found for user: %d, receipt: %s", userID, receiptNumber)
 			c.JSON(404, gin.H{"error": "Receipt not found"})
@@ -41,12 +41,34 @@ func (rh *ReceiptHandler) GetReceipt(c *gin.Context) {
 	c.JSON(200, receipt)
 }
 
+var receiptListSpec = listSpec[models.Receipt]{
+	id: listField[models.Receipt]{column: "receipts.id", kind: listNumber, value: func(r models.Receipt) any { return r.ID }},
+	fields: map[string]listField[models.Receipt]{
+		"receipt_number": {column: "receipts.receipt_number", kind: listText, value: func(r models.Receipt) any { return r.ReceiptNumber }},
+		"customer_id":    {column: "receipts.customer_id", kind: listNumber},
+		"customer_name":  {column: "receipts.customer_name", kind: listText, value: func(r models.Receipt) any { return r.CustomerName }},
+		"payment_method": {column: "receipts.payment_method", kind: listText, value: func(r models.Receipt) any { return r.PaymentMethod }},
+		"status":         {column: "receipts.status", kind: listText, value: func(r models.Receipt) any { return r.Status }},
+		"total_amount":   {column: "receipts.total_amount", kind: listNumber, value: func(r models.Receipt) any { return r.TotalAmount }},
+		"date":           {column: "receipts.date", kind: listTime, value: func(r models.Receipt) any { return r.Date }},
+		"created_at":     {column: "receipts.created_at", kind: listTime, value: func(r models.Receipt) any { return r.CreatedAt }},
+	},
+	defaultSort: "-created_at",
+	preloads:    []string{"Items", "Payments"},
+	params:      []string{"startDate", "endDate"},
+}
+
 // GetAllReceipts retrieves all receipts for a specific user with optional date range filtering
 func (rh *ReceiptHandler) GetAllReceipts(c *gin.Context) {
 	userID := c.GetUint("userID")
+	list, err := parseListQuery(c, receiptListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
 	var receipts []models.Receipt
-	
-	query := rh.db.Preload("Items").Where("user_id = ?", userID).Order("created_at desc")
+	query := rh.db.Model(&models.Receipt{}).Where("user_id = ?", userID)
 
 	// Get date range filters from query params if they exist
 	startDate := c.Query("startDate")
@@ -55,7 +77,7 @@ func (rh *ReceiptHandler) GetAllReceipts(c *gin.Context) {
 		query = query.Where("date BETWEEN ? AND ?", startDate, endDate)
 	}
 
-	if err := query.Find(&receipts).Error; err != nil {
+	if err := list.find(query, &receipts); err != nil {
 		utils.ErrorLogger("Failed to fetch receipts for user: %d, error: %v", userID, err)
 		c.JSON(500, gin.H{"error": "Failed to fetch receipts"})
 		return
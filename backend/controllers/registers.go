@@ -0,0 +1,457 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const errCodeRegisterClosed = "REGISTER_CLOSED"
+
+type RegisterHandler struct {
+	db *gorm.DB
+}
+
+func NewRegisterHandler(db *gorm.DB) *RegisterHandler {
+	return &RegisterHandler{db: db}
+}
+
+// openRegisterSession returns the cashier's register session that was open
+// at a time and is still open, or nil when there is none. Sessions opened
+// before staff logins were recorded belong to the owner.
+func openRegisterSession(db *gorm.DB, userID, cashierID uint, at time.Time) (*models.RegisterSession, error) {
+	cashiers := []uint{cashierID}
+	if cashierID == userID {
+		cashiers = append(cashiers, 0)
+	}
+	var session models.RegisterSession
+	err := db.Where("user_id = ? AND opened_by IN ? AND status = ? AND opened_at <= ?", userID, cashiers, models.RegisterOpen, at).
+		Order("opened_at DESC").
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// loadRegisterSession loads one of the user's sessions by the :id parameter
+func (rh *RegisterHandler) loadRegisterSession(c *gin.Context, userID uint) (*models.RegisterSession, bool) {
+	var session models.RegisterSession
+	err := rh.db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "Register session not found"})
+		return nil, false
+	}
+	if err != nil {
+		utils.ErrorLogger("Failed to load register session %s: %v", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Failed to load register session"})
+		return nil, false
+	}
+	return &session, true
+}
+
+// ZReport reconciles a register session's drawer
+type ZReport struct {
+	SessionID    uint          `json:"session_id"`
+	Register     string        `json:"register"`
+	CashierID    uint          `json:"cashier_id"`
+	Status       string        `json:"status"`
+	OpenedAt     time.Time     `json:"opened_at"`
+	ClosedAt     *time.Time    `json:"closed_at,omitempty"`
+	Receipts     int64         `json:"receipts"`
+	TotalSales   float64       `json:"total_sales"`
+	OpeningFloat float64       `json:"opening_float"`
+	CashSales    float64       `json:"cash_sales"`
+	CashRefunds  float64       `json:"cash_refunds"`
+	CashDrops    float64       `json:"cash_drops"`
+	PayOuts      float64       `json:"pay_outs"`
+	ExpectedCash float64       `json:"expected_cash"`
+	CountedCash  *float64      `json:"counted_cash,omitempty"`
+	OverShort    float64       `json:"over_short"`
+	Tenders      []tenderTotal `json:"tenders"`
+}
+
+// buildZReport works out what should be in a session's drawer: the float
+// plus cash sales, less cash refunds, drops and pay-outs
+func buildZReport(db *gorm.DB, session models.RegisterSession) (ZReport, error) {
+	report := ZReport{
+		SessionID:    session.ID,
+		Register:     session.Register,
+		CashierID:    session.OpenedBy,
+		Status:       session.Status,
+		OpenedAt:     session.OpenedAt,
+		ClosedAt:     session.ClosedAt,
+		OpeningFloat: session.OpeningFloat,
+		CountedCash:  session.CountedCash,
+	}
+	// Sessions opened before staff logins were recorded belong to the owner
+	if report.CashierID == 0 {
+		report.CashierID = session.UserID
+	}
+
+	var sales struct {
+		Receipts int64
+		Total    float64
+	}
+	if err := db.Model(&models.Receipt{}).
+		Select("COUNT(*) as receipts, COALESCE(SUM(total_amount), 0) as total").
+		Where("register_session_id = ?", session.ID).
+		Scan(&sales).Error; err != nil {
+		return report, err
+	}
+	report.Receipts = sales.Receipts
+	report.TotalSales = roundMoney(sales.Total)
+
+	tenders, err := sumTenders(db, sessionTenders(session.ID))
+	if err != nil {
+		return report, err
+	}
+	for _, total := range tenders {
+		if total.Method == "CASH" {
+			report.CashSales = total.Amount
+			report.CashRefunds = total.Refunds
+		}
+	}
+	report.Tenders = tenders
+	sort.Slice(report.Tenders, func(i, j int) bool { return report.Tenders[i].Method < report.Tenders[j].Method })
+
+	var movements []struct {
+		Type   string
+		Amount float64
+	}
+	if err := db.Model(&models.RegisterMovement{}).
+		Select("type, COALESCE(SUM(amount), 0) as amount").
+		Where("session_id = ?", session.ID).
+		Group("type").
+		Scan(&movements).Error; err != nil {
+		return report, err
+	}
+	for _, movement := range movements {
+		switch movement.Type {
+		case models.CashDrop:
+			report.CashDrops = roundMoney(movement.Amount)
+		case models.CashPayOut:
+			report.PayOuts = roundMoney(movement.Amount)
+		}
+	}
+
+	report.ExpectedCash = roundMoney(report.OpeningFloat + report.CashSales - report.CashRefunds - report.CashDrops - report.PayOuts)
+	if report.CountedCash != nil {
+		report.OverShort = roundMoney(*report.CountedCash - report.ExpectedCash)
+	}
+	return report, nil
+}
+
+// OpenSession starts a shift on a register with an opening float
+func (rh *RegisterHandler) OpenSession(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input struct {
+		Register     string  `json:"register"`
+		OpeningFloat float64 `json:"opening_float"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse open register request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if input.OpeningFloat < 0 {
+		c.JSON(400, gin.H{"error": "Opening float cannot be negative"})
+		return
+	}
+	register := strings.TrimSpace(input.Register)
+	if register == "" {
+		register = "Main"
+	}
+
+	// A cashier works one register at a time and a register has one
+	// cashier at a time
+	cashierID := actingUser(c)
+	open, err := openRegisterSession(rh.db, userID, cashierID, time.Now())
+	if err != nil {
+		utils.ErrorLogger("Failed to check open register sessions for user %d: %v", cashierID, err)
+		c.JSON(500, gin.H{"error": "Failed to open register"})
+		return
+	}
+	if open != nil {
+		c.JSON(409, gin.H{"error": fmt.Sprintf("Register session %d on %s is still open. Close it first", open.ID, open.Register)})
+		return
+	}
+	var inUse models.RegisterSession
+	err = rh.db.Where("user_id = ? AND register = ? AND status = ?", userID, register, models.RegisterOpen).First(&inUse).Error
+	if err == nil {
+		c.JSON(409, gin.H{"error": fmt.Sprintf("Register %s is in use by register session %d", register, inUse.ID)})
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.ErrorLogger("Failed to check register %s for user %d: %v", register, userID, err)
+		c.JSON(500, gin.H{"error": "Failed to open register"})
+		return
+	}
+
+	session := models.RegisterSession{
+		UserID:       userID,
+		Register:     register,
+		Status:       models.RegisterOpen,
+		OpeningFloat: roundMoney(input.OpeningFloat),
+		OpenedAt:     time.Now(),
+		OpenedBy:     cashierID,
+	}
+	if err := rh.db.Create(&session).Error; err != nil {
+		utils.ErrorLogger("Failed to open register for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to open register"})
+		return
+	}
+
+	utils.InfoLogger("User %d opened register %s with float %.2f", userID, register, session.OpeningFloat)
+	c.JSON(201, session)
+}
+
+// GetCurrentSession returns the open session with its running Z report
+func (rh *RegisterHandler) GetCurrentSession(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	session, err := openRegisterSession(rh.db, userID, actingUser(c), time.Now())
+	if err != nil {
+		utils.ErrorLogger("Failed to load open register session for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load register session"})
+		return
+	}
+	if session == nil {
+		c.JSON(404, gin.H{"error": "No register session is open"})
+		return
+	}
+
+	report, err := buildZReport(rh.db, *session)
+	if err != nil {
+		utils.ErrorLogger("Failed to build report for register session %d: %v", session.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to load register session"})
+		return
+	}
+	c.JSON(200, report)
+}
+
+// RecordCashDrop records cash moved from the drawer to the safe
+func (rh *RegisterHandler) RecordCashDrop(c *gin.Context) {
+	rh.recordMovement(c, models.CashDrop)
+}
+
+// RecordPayOut records cash paid out of the drawer
+func (rh *RegisterHandler) RecordPayOut(c *gin.Context) {
+	rh.recordMovement(c, models.CashPayOut)
+}
+
+func (rh *RegisterHandler) recordMovement(c *gin.Context, movementType string) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input struct {
+		Amount float64 `json:"amount" binding:"required"`
+		Reason string  `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse register movement request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if input.Amount <= 0 {
+		c.JSON(400, gin.H{"error": "Amount must be greater than 0"})
+		return
+	}
+	if movementType == models.CashPayOut && strings.TrimSpace(input.Reason) == "" {
+		c.JSON(400, gin.H{"error": "A reason is required for pay-outs"})
+		return
+	}
+
+	session, ok := rh.loadRegisterSession(c, userID)
+	if !ok {
+		return
+	}
+	if session.Status != models.RegisterOpen {
+		c.JSON(409, gin.H{"error": "Register session is closed"})
+		return
+	}
+
+	report, err := buildZReport(rh.db, *session)
+	if err != nil {
+		utils.ErrorLogger("Failed to build report for register session %d: %v", session.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to record cash movement"})
+		return
+	}
+	if input.Amount > report.ExpectedCash+0.005 {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Only %.2f cash should be in the drawer", report.ExpectedCash)})
+		return
+	}
+
+	movement := models.RegisterMovement{
+		UserID:    userID,
+		SessionID: session.ID,
+		Type:      movementType,
+		Amount:    roundMoney(input.Amount),
+		Reason:    input.Reason,
+	}
+	if err := rh.db.Create(&movement).Error; err != nil {
+		utils.ErrorLogger("Failed to record %s for register session %d: %v", movementType, session.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to record cash movement"})
+		return
+	}
+
+	utils.InfoLogger("User %d recorded %s of %.2f on register session %d", userID, movementType, movement.Amount, session.ID)
+	c.JSON(201, movement)
+}
+
+// CloseSession ends a shift with the cash counted in the drawer and returns the Z report
+func (rh *RegisterHandler) CloseSession(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input struct {
+		CountedCash *float64 `json:"counted_cash" binding:"required"`
+		Note        string   `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse close register request: %v", err)
+		c.JSON(400, gin.H{"error": "Counted cash is required"})
+		return
+	}
+	if *input.CountedCash < 0 {
+		c.JSON(400, gin.H{"error": "Counted cash cannot be negative"})
+		return
+	}
+
+	session, ok := rh.loadRegisterSession(c, userID)
+	if !ok {
+		return
+	}
+	if session.Status != models.RegisterOpen {
+		c.JSON(409, gin.H{"error": "Register session is already closed"})
+		return
+	}
+
+	counted := roundMoney(*input.CountedCash)
+	now := time.Now()
+	session.Status = models.RegisterClosed
+	session.ClosedAt = &now
+	session.CountedCash = &counted
+	session.ClosingNote = input.Note
+
+	report, err := buildZReport(rh.db, *session)
+	if err != nil {
+		utils.ErrorLogger("Failed to build report for register session %d: %v", session.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to close register"})
+		return
+	}
+	session.ExpectedCash = report.ExpectedCash
+	session.OverShort = report.OverShort
+
+	// Only close a session that is still open, in case two tills race
+	result := rh.db.Model(&models.RegisterSession{}).
+		Where("id = ? AND status = ?", session.ID, models.RegisterOpen).
+		Updates(map[string]interface{}{
+			"status":        session.Status,
+			"closed_at":     session.ClosedAt,
+			"counted_cash":  session.CountedCash,
+			"expected_cash": session.ExpectedCash,
+			"over_short":    session.OverShort,
+			"closing_note":  session.ClosingNote,
+		})
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to close register session %d: %v", session.ID, result.Error)
+		c.JSON(500, gin.H{"error": "Failed to close register"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(409, gin.H{"error": "Register session is already closed"})
+		return
+	}
+
+	if report.OverShort != 0 {
+		utils.WarningLogger("Register session %d closed %.2f over/short (expected %.2f, counted %.2f)", session.ID, report.OverShort, report.ExpectedCash, counted)
+	}
+	c.JSON(200, report)
+}
+
+var registerSessionListSpec = listSpec[models.RegisterSession]{
+	id: listField[models.RegisterSession]{column: "register_sessions.id", kind: listNumber, value: func(r models.RegisterSession) any { return r.ID }},
+	fields: map[string]listField[models.RegisterSession]{
+		"register":   {column: "register_sessions.register", kind: listText, value: func(r models.RegisterSession) any { return r.Register }},
+		"status":     {column: "register_sessions.status", kind: listText, value: func(r models.RegisterSession) any { return r.Status }},
+		"over_short": {column: "register_sessions.over_short", kind: listNumber, value: func(r models.RegisterSession) any { return r.OverShort }},
+		"opened_at":  {column: "register_sessions.opened_at", kind: listTime, value: func(r models.RegisterSession) any { return r.OpenedAt }},
+	},
+	defaultSort: "-opened_at",
+}
+
+// GetSessions lists the user's register sessions, newest first
+func (rh *RegisterHandler) GetSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	list, err := parseListQuery(c, registerSessionListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sessions []models.RegisterSession
+	if err := list.find(rh.db.Model(&models.RegisterSession{}).Where("user_id = ?", userID), &sessions); err != nil {
+		utils.ErrorLogger("Failed to fetch register sessions for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch register sessions"})
+		return
+	}
+	c.JSON(200, sessions)
+}
+
+// GetZReport returns the Z report of a register session
+func (rh *RegisterHandler) GetZReport(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	session, ok := rh.loadRegisterSession(c, userID)
+	if !ok {
+		return
+	}
+	report, err := buildZReport(rh.db, *session)
+	if err != nil {
+		utils.ErrorLogger("Failed to build report for register session %d: %v", session.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to build Z report"})
+		return
+	}
+	c.JSON(200, report)
+}
@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// rfmLookbackDays is how far back sales count towards a customer's scores
+const rfmLookbackDays = 365
+
+// rfmSegments lists the segments best first, the order they are reported in
+var rfmSegments = []string{
+	models.SegmentChampions,
+	models.SegmentLoyal,
+	models.SegmentPotentialLoyalist,
+	models.SegmentNew,
+	models.SegmentPromising,
+	models.SegmentNeedAttention,
+	models.SegmentAtRisk,
+	models.SegmentCantLose,
+	models.SegmentHibernating,
+	models.SegmentLost,
+}
+
+// rfmSegment places a customer by their scores. Recency and frequency
+// decide most segments; monetary separates champions and customers the
+// business cannot afford to lose.
+func rfmSegment(recency, frequency, monetary int) string {
+	switch {
+	case recency >= 4 && frequency >= 4 && monetary >= 4:
+		return models.SegmentChampions
+	case recency == 1 && frequency >= 4 && monetary >= 4:
+		return models.SegmentCantLose
+	case recency <= 2 && frequency >= 3:
+		return models.SegmentAtRisk
+	case recency >= 3 && frequency >= 4:
+		return models.SegmentLoyal
+	case recency >= 4 && frequency >= 2:
+		return models.SegmentPotentialLoyalist
+	case recency == 5:
+		return models.SegmentNew
+	case recency == 4:
+		return models.SegmentPromising
+	case recency == 3:
+		return models.SegmentNeedAttention
+	case recency == 2:
+		return models.SegmentHibernating
+	}
+	return models.SegmentLost
+}
+
+// quintileScores scores each value from 1 to 5 by where it ranks among the
+// others, higher values scoring higher. Tied values share the score of the
+// middle of their run, so a lone customer or a field of equals scores 3.
+func quintileScores(values []float64) []int {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return values[order[a]] < values[order[b]] })
+
+	scores := make([]int, len(values))
+	for first := 0; first < len(order); {
+		last := first
+		for last+1 < len(order) && values[order[last+1]] == values[order[first]] {
+			last++
+		}
+		middle := (float64(first+last)/2 + 0.5) / float64(len(values))
+		score := min(int(middle*5)+1, 5)
+		for _, i := range order[first : last+1] {
+			scores[i] = score
+		}
+		first = last + 1
+	}
+	return scores
+}
+
+// rfmLine is a sales transaction as RFM reads it
+type rfmLine struct {
+	ReceiptID     uint
+	SaleReturnID  uint
+	CustomerName  string
+	CustomerPhone string
+	TotalAmount   float64
+	CreatedAt     time.Time
+}
+
+// computeCustomerRFM rescores every customer of a business from their sales
+// over the lookback window and replaces the saved scores. Frequency counts
+// receipts; monetary is net of returns, which are matched to the customer
+// through the receipt they were returned against.
+func computeCustomerRFM(db *gorm.DB, userID uint, now time.Time) (int, error) {
+	rows, err := db.Model(&models.SalesTransaction{}).
+		Select("receipt_id, sale_return_id, customer_name, customer_phone, total_amount, created_at").
+		Where("user_id = ? AND created_at >= ? AND created_at <= ?", userID, now.AddDate(0, 0, -rfmLookbackDays), now).
+		Order("created_at, id").
+		Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	customers := make(map[string]*models.CustomerRFM)
+	receipts := make(map[string]map[uint]bool)
+	receiptPhones := make(map[uint]string)
+	for rows.Next() {
+		var line rfmLine
+		if err := db.ScanRows(rows, &line); err != nil {
+			return 0, err
+		}
+		if line.SaleReturnID != 0 {
+			if phone, ok := receiptPhones[line.ReceiptID]; ok && line.ReceiptID != 0 {
+				customers[phone].Monetary += line.TotalAmount
+			}
+			continue
+		}
+		if strings.TrimSpace(line.CustomerPhone) == "" {
+			continue
+		}
+		phone, err := utils.NormalisePhone(line.CustomerPhone)
+		if err != nil {
+			phone = strings.TrimSpace(line.CustomerPhone)
+		}
+		customer, ok := customers[phone]
+		if !ok {
+			customer = &models.CustomerRFM{UserID: userID, CustomerPhone: phone}
+			customers[phone] = customer
+			receipts[phone] = make(map[uint]bool)
+		}
+		if name := strings.TrimSpace(line.CustomerName); name != "" {
+			customer.CustomerName = name
+		}
+		if line.CreatedAt.After(customer.LastPurchaseAt) {
+			customer.LastPurchaseAt = line.CreatedAt
+		}
+		customer.Monetary += line.TotalAmount
+		if line.ReceiptID == 0 {
+			customer.Frequency++
+		} else if !receipts[phone][line.ReceiptID] {
+			receipts[phone][line.ReceiptID] = true
+			customer.Frequency++
+			receiptPhones[line.ReceiptID] = phone
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	scored := make([]models.CustomerRFM, 0, len(customers))
+	for _, customer := range customers {
+		customer.RecencyDays = int(now.Sub(customer.LastPurchaseAt).Hours() / 24)
+		customer.Monetary = roundMoney(customer.Monetary)
+		customer.ComputedAt = now
+		scored = append(scored, *customer)
+	}
+	sort.Slice(scored, func(i, j int) bool { return scored[i].CustomerPhone < scored[j].CustomerPhone })
+
+	recency := make([]float64, len(scored))
+	frequency := make([]float64, len(scored))
+	monetary := make([]float64, len(scored))
+	for i, customer := range scored {
+		recency[i] = -float64(customer.RecencyDays)
+		frequency[i] = float64(customer.Frequency)
+		monetary[i] = customer.Monetary
+	}
+	recencyScores, frequencyScores, monetaryScores := quintileScores(recency), quintileScores(frequency), quintileScores(monetary)
+	for i := range scored {
+		scored[i].RecencyScore = recencyScores[i]
+		scored[i].FrequencyScore = frequencyScores[i]
+		scored[i].MonetaryScore = monetaryScores[i]
+		scored[i].Segment = rfmSegment(recencyScores[i], frequencyScores[i], monetaryScores[i])
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.CustomerRFM{}).Error; err != nil {
+			return err
+		}
+		if len(scored) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&scored, 200).Error
+	})
+	return len(scored), err
+}
+
+// ComputeRFMSegments rescores the customers of every business with sales
+// to known customers, or with scores from before that have since aged out
+func ComputeRFMSegments(db *gorm.DB, now time.Time) (int, error) {
+	var userIDs []uint
+	if err := db.Model(&models.SalesTransaction{}).
+		Where("customer_phone <> '' AND created_at >= ?", now.AddDate(0, 0, -rfmLookbackDays)).
+		Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	var scoredUserIDs []uint
+	if err := db.Model(&models.CustomerRFM{}).Distinct().Pluck("user_id", &scoredUserIDs).Error; err != nil {
+		return 0, err
+	}
+	for _, userID := range scoredUserIDs {
+		if !slices.Contains(userIDs, userID) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	total := 0
+	for _, userID := range userIDs {
+		scored, err := computeCustomerRFM(db, userID, now)
+		if err != nil {
+			return total, err
+		}
+		total += scored
+	}
+	if total > 0 {
+		utils.InfoLogger("Scored %d customers for RFM segments across %d businesses", total, len(userIDs))
+	}
+	return total, nil
+}
+
+// SegmentSummary is how many customers are in a segment and what they spent
+type SegmentSummary struct {
+	Segment   string  `json:"segment"`
+	Customers int     `json:"customers"`
+	Monetary  float64 `json:"monetary"`
+	// Share is the segment's percentage of customers
+	Share float64 `json:"share"`
+}
+
+// CustomerSegments is the count of customers in every segment
+type CustomerSegments struct {
+	ComputedAt   *time.Time       `json:"computed_at"`
+	LookbackDays int              `json:"lookback_days"`
+	Customers    int              `json:"customers"`
+	Segments     []SegmentSummary `json:"segments"`
+}
+
+// GetCustomerSegments reports how many customers fall in each segment. A
+// business whose customers have not been scored yet is scored first.
+func (ch *CustomerHandler) GetCustomerSegments(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var latest models.CustomerRFM
+	err := ch.db.Where("user_id = ?", userID).Order("computed_at DESC").First(&latest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_, err = computeCustomerRFM(ch.db, userID, time.Now())
+		if err == nil {
+			err = ch.db.Where("user_id = ?", userID).Order("computed_at DESC").First(&latest).Error
+		}
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.ErrorLogger("Failed to score customers for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch customer segments"})
+		return
+	}
+
+	var counts []struct {
+		Segment   string
+		Customers int
+		Monetary  float64
+	}
+	if err := ch.db.Model(&models.CustomerRFM{}).
+		Select("segment, COUNT(*) as customers, SUM(monetary) as monetary").
+		Where("user_id = ?", userID).
+		Group("segment").
+		Scan(&counts).Error; err != nil {
+		utils.ErrorLogger("Failed to count customer segments for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch customer segments"})
+		return
+	}
+
+	report := CustomerSegments{LookbackDays: rfmLookbackDays, Segments: make([]SegmentSummary, 0, len(rfmSegments))}
+	if latest.ID != 0 {
+		report.ComputedAt = &latest.ComputedAt
+	}
+	bySegment := make(map[string]SegmentSummary)
+	for _, count := range counts {
+		bySegment[count.Segment] = SegmentSummary{Segment: count.Segment, Customers: count.Customers, Monetary: roundMoney(count.Monetary)}
+		report.Customers += count.Customers
+	}
+	for _, segment := range rfmSegments {
+		summary, ok := bySegment[segment]
+		if !ok {
+			summary = SegmentSummary{Segment: segment}
+		}
+		if report.Customers > 0 {
+			summary.Share = roundMoney(float64(summary.Customers) * 100 / float64(report.Customers))
+		}
+		report.Segments = append(report.Segments, summary)
+	}
+
+	c.JSON(200, report)
+}
+
+var customerRFMListSpec = listSpec[models.CustomerRFM]{
+	id: listField[models.CustomerRFM]{column: "id", kind: listNumber, value: func(r models.CustomerRFM) any { return r.ID }},
+	fields: map[string]listField[models.CustomerRFM]{
+		"customer_name":    {column: "customer_name", kind: listText, value: func(r models.CustomerRFM) any { return r.CustomerName }},
+		"customer_phone":   {column: "customer_phone", kind: listText, value: func(r models.CustomerRFM) any { return r.CustomerPhone }},
+		"last_purchase_at": {column: "last_purchase_at", kind: listTime, value: func(r models.CustomerRFM) any { return r.LastPurchaseAt }},
+		"recency_days":     {column: "recency_days", kind: listNumber, value: func(r models.CustomerRFM) any { return r.RecencyDays }},
+		"frequency":        {column: "frequency", kind: listNumber, value: func(r models.CustomerRFM) any { return r.Frequency }},
+		"monetary":         {column: "monetary", kind: listNumber, value: func(r models.CustomerRFM) any { return r.Monetary }},
+		"recency_score":    {column: "recency_score", kind: listNumber},
+		"frequency_score":  {column: "frequency_score", kind: listNumber},
+		"monetary_score":   {column: "monetary_score", kind: listNumber},
+	},
+	defaultSort: "-monetary",
+}
+
+// GetSegmentCustomers lists the customers in a segment, biggest spenders
+// first unless sorted otherwise
+func (ch *CustomerHandler) GetSegmentCustomers(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+	segment := c.Param("segment")
+	if !slices.Contains(rfmSegments, segment) {
+		c.JSON(404, gin.H{"error": "Segment not found"})
+		return
+	}
+
+	list, err := parseListQuery(c, customerRFMListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	members := []models.CustomerRFM{}
+	if err := list.find(ch.db.Model(&models.CustomerRFM{}).Where("user_id = ? AND segment = ?", userID, segment), &members); err != nil {
+		utils.ErrorLogger("Failed to fetch %s customers for user %d: %v", segment, userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch segment customers"})
+		return
+	}
+
+	c.JSON(200, members)
+}
+
+// RecomputeCustomerSegments rescores a business's customers now rather than
+// waiting for the nightly run
+func (ch *CustomerHandler) RecomputeCustomerSegments(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	scored, err := computeCustomerRFM(ch.db, userID, time.Now())
+	if err != nil {
+		utils.ErrorLogger("Failed to score customers for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to recompute customer segments"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Customer segments recomputed", "customers": scored})
+}
@@ -0,0 +1,706 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReturnLine is a quantity of one receipt line being given back
+type ReturnLine struct {
+	ItemID   uint `json:"item_id" binding:"required"`
+	Quantity int  `json:"quantity" binding:"required"`
+	// Restock puts the units back on the shelf. Defaults to true; send false
+	// for returned goods that cannot be sold again.
+	Restock *bool `json:"restock"`
+}
+
+// ReturnRequest is the body of a void or return. A void ignores Items and
+// gives back everything still on the receipt.
+type ReturnRequest struct {
+	Items           []ReturnLine `json:"items"`
+	Reason          string       `json:"reason"`
+	RefundMethod    string       `json:"refund_method"`
+	RefundReference string       `json:"refund_reference"`
+}
+
+// returnedLine is a validated receipt line and the quantity being reversed
+type returnedLine struct {
+	Item     models.Item
+	Quantity int
+	Restock  bool
+}
+
+// VoidSale reverses every line still on a receipt. Voids need a reason and
+// the VOID_SALE permission.
+func (im *SalesManagementHandler) VoidSale(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input ReturnRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse void request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if strings.TrimSpace(input.Reason) == "" {
+		c.JSON(400, gin.H{"error": "A reason is required to void a sale"})
+		return
+	}
+
+	staffID := actingUser(c)
+	allowed, err := hasPermission(im.db, userID, staffID, models.PermissionVoidSale)
+	if err != nil {
+		utils.ErrorLogger("Failed to check void permission for user %d: %v", staffID, err)
+		c.JSON(500, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if !allowed {
+		utils.WarningLogger("User %d attempted to void receipt %s without permission", staffID, c.Param("receiptNumber"))
+		c.JSON(403, gin.H{"error": "You do not have permission to void sales"})
+		return
+	}
+
+	reverseSale(im, c, userID, models.SaleReturnVoid, input)
+}
+
+// ReturnSale reverses some units of some lines on a receipt
+func (im *SalesManagementHandler) ReturnSale(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input ReturnRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse return request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(input.Items) == 0 {
+		c.JSON(400, gin.H{"error": "At least one item is required"})
+		return
+	}
+
+	reverseSale(im, c, userID, models.SaleReturnReturn, input)
+}
+
+// reverseSale restores stock, posts negative sales transactions, reverses
+// credit and records the refund for a void or return of a receipt.
+func reverseSale(im *SalesManagementHandler, c *gin.Context, userID uint, returnType string, input ReturnRequest) {
+	receiptNumber := c.Param("receiptNumber")
+
+	tx := im.db.Begin()
+	if tx.Error != nil {
+		utils.ErrorLogger("Failed to start transaction: %v", tx.Error)
+		c.JSON(500, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the receipt so two returns against it cannot both give back the same units
+	var receipt models.Receipt
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Items").
+		Preload("Payments").
+		Where("receipt_number = ? AND user_id = ?", receiptNumber, userID).
+		First(&receipt).Error; err != nil {
+		tx.Rollback()
+		c.JSON(404, gin.H{"error": "Receipt not found"})
+		return
+	}
+	if receipt.Status == models.ReceiptVoided || receipt.Status == models.ReceiptReturned {
+		tx.Rollback()
+		c.JSON(409, gin.H{"error": fmt.Sprintf("Receipt %s has already been %s", receipt.ReceiptNumber, strings.ToLower(receipt.Status))})
+		return
+	}
+
+	// Refunds go back the way the customer paid unless told otherwise.
+	// Split payments refund to credit first, then the other tender, and
+	// any part paid with points goes back as points.
+	onCredit := strings.ToUpper(receipt.PaymentMethod) == "CREDIT"
+	for _, payment := range receipt.Payments {
+		if payment.Method == "CREDIT" {
+			onCredit = true
+		}
+	}
+	refundMethod := strings.ToUpper(input.RefundMethod)
+	if refundMethod == "" {
+		refundMethod = strings.ToUpper(receipt.PaymentMethod)
+		if refundMethod == models.PaymentSplit {
+			refundMethod = "CASH"
+			if onCredit {
+				refundMethod = "CREDIT"
+			}
+		}
+	}
+	if !models.RefundMethods[refundMethod] {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Unknown refund method %s", refundMethod)})
+		return
+	}
+	if refundMethod == "MPESA" && input.RefundReference == "" {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": "The M-Pesa transaction code is required for M-Pesa refunds"})
+		return
+	}
+	if refundMethod == "CREDIT" && !onCredit {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": "Only credit sales can be refunded to credit"})
+		return
+	}
+	if refundMethod == "POINTS" && receipt.CustomerID == nil {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": "Only sales to a known customer can be refunded as points"})
+		return
+	}
+
+	lines, err := returnedLines(receipt, returnType, input.Items)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if len(lines) == 0 {
+		tx.Rollback()
+		c.JSON(409, gin.H{"error": fmt.Sprintf("Receipt %s has nothing left to return", receipt.ReceiptNumber)})
+		return
+	}
+
+	session, err := openRegisterSession(tx, userID, actingUser(c), time.Now())
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to load register session for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load register session"})
+		return
+	}
+
+	// The reversing rows carry the sale's customer so customer reports net them out
+	var sold models.SalesTransaction
+	if err := tx.Select("customer_phone").Where("receipt_id = ? AND quantity > 0", receipt.ID).
+		First(&sold).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to load sales for receipt %s: %v", receipt.ReceiptNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to record return"})
+		return
+	}
+
+	// A credit refund only takes off what is still owed; the rest is paid
+	// back by the receipt's other tender
+	refunds := map[string]float64{}
+	otherMethod := otherRefundMethod(receipt, input.RefundReference)
+	// With no method given, the part of a split receipt paid with points
+	// goes back as points
+	var pointsShare float64
+	if input.RefundMethod == "" && refundMethod != "POINTS" {
+		pointsShare = pointsPaidShare(receipt)
+	}
+
+	saleReturn := models.SaleReturn{
+		UserID:          userID,
+		ReceiptID:       receipt.ID,
+		Type:            returnType,
+		Reason:          input.Reason,
+		RefundMethod:    refundMethod,
+		RefundReference: input.RefundReference,
+		ProcessedBy:     actingUser(c),
+	}
+	if session != nil {
+		saleReturn.RegisterSessionID = &session.ID
+	}
+	if err := tx.Create(&saleReturn).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to create sale return for receipt %s: %v", receipt.ReceiptNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to record return"})
+		return
+	}
+
+	label := "Return"
+	if returnType == models.SaleReturnVoid {
+		label = "Void"
+	}
+	note := strings.TrimSpace(fmt.Sprintf("%s of receipt %s. %s", label, receipt.ReceiptNumber, input.Reason))
+	for _, line := range lines {
+		item := line.Item
+		refund := roundMoney(item.TotalPrice * float64(line.Quantity) / float64(item.Quantity))
+		cost := roundMoney(item.UnitCost * float64(line.Quantity))
+		discount := roundMoney(item.DiscountAmount * float64(line.Quantity) / float64(item.Quantity))
+		tax := roundMoney(item.TaxAmount * float64(line.Quantity) / float64(item.Quantity))
+
+		// Work out which stock comes back: the product itself, or each component of a bundle
+		var product models.Product
+		if err := tx.Where("id = ? AND user_id = ?", item.ProductID, userID).First(&product).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Product %d on receipt %s not found: %v", item.ProductID, receipt.ReceiptNumber, err)
+			c.JSON(404, gin.H{"error": fmt.Sprintf("Product %d not found", item.ProductID)})
+			return
+		}
+		stockLines := []saleStockLine{{ProductID: product.ID, Quantity: line.Quantity, UnitCost: item.UnitCost}}
+		if product.IsBundle {
+			stockLines, err = soldBundleComponents(tx, userID, receipt, product.ID, line.Quantity)
+			if err != nil {
+				tx.Rollback()
+				utils.ErrorLogger("Failed to load bundle components for product %d: %v", product.ID, err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to load bundle components for product %d", product.ID)})
+				return
+			}
+		}
+
+		for _, stockLine := range stockLines {
+			// Units still on backorder were never handed over, so they only cancel the backorder
+			handedOver, err := cancelBackorders(tx, userID, receipt.ID, stockLine.ProductID, stockLine.Quantity)
+			if err != nil {
+				tx.Rollback()
+				utils.ErrorLogger("Failed to cancel backorders for product %d: %v", stockLine.ProductID, err)
+				c.JSON(500, gin.H{"error": "Failed to cancel backorders"})
+				return
+			}
+			if !line.Restock || handedOver == 0 {
+				continue
+			}
+
+			inventory, err := changeStock(tx, userID, stockLine.ProductID, handedOver)
+			if err != nil {
+				tx.Rollback()
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					c.JSON(404, gin.H{"error": fmt.Sprintf("Product %d not found in inventory", stockLine.ProductID)})
+					return
+				}
+				utils.ErrorLogger("Failed to restore inventory for product %d: %v", stockLine.ProductID, err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to restore inventory for product %d", stockLine.ProductID)})
+				return
+			}
+			// Returned units come back at the cost they left at
+			if err := receiveAtCost(tx, userID, stockLine.ProductID, inventory.Quantity, handedOver, stockLine.UnitCost); err != nil {
+				tx.Rollback()
+				utils.ErrorLogger("Failed to update average cost for product %d: %v", stockLine.ProductID, err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to restore inventory for product %d", stockLine.ProductID)})
+				return
+			}
+
+			movement := models.StockMovement{
+				UserID:         userID,
+				ProductID:      stockLine.ProductID,
+				ChangeType:     models.MovementCustomerReturn,
+				QuantityChange: handedOver,
+				UnitCost:       stockLine.UnitCost,
+				Note:           note,
+				CreatedAt:      time.Now(),
+			}
+			if err := tx.Create(&movement).Error; err != nil {
+				tx.Rollback()
+				utils.ErrorLogger("Failed to create stock movement for product %d: %v", stockLine.ProductID, err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to record stock movement for product %d", stockLine.ProductID)})
+				return
+			}
+		}
+
+		if err := tx.Model(&item).Update("returned_quantity", item.ReturnedQuantity+line.Quantity).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to update receipt item %d: %v", item.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to update receipt item"})
+			return
+		}
+
+		returnItem := models.SaleReturnItem{
+			SaleReturnID: saleReturn.ID,
+			ItemID:       item.ID,
+			ProductID:    item.ProductID,
+			Quantity:     line.Quantity,
+			RefundAmount: refund,
+			UnitCost:     item.UnitCost,
+			Restocked:    line.Restock,
+		}
+		if err := tx.Create(&returnItem).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to create sale return item for item %d: %v", item.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to record return"})
+			return
+		}
+		saleReturn.Items = append(saleReturn.Items, returnItem)
+
+		// Post the reversal as a negative sale so revenue and margin reports net it out
+		salesTransaction := models.SalesTransaction{
+			UserID:          userID,
+			CashierID:       saleReturn.ProcessedBy,
+			ProductID:       item.ProductID,
+			ReceiptID:       receipt.ID,
+			SaleReturnID:    saleReturn.ID,
+			Quantity:        -line.Quantity,
+			TotalAmount:     -refund,
+			ListPrice:       item.ListPrice,
+			DiscountAmount:  -discount,
+			NetAmount:       -roundMoney(item.NetAmount * float64(line.Quantity) / float64(item.Quantity)),
+			TaxClass:        item.TaxClass,
+			TaxRate:         item.TaxRate,
+			TaxableAmount:   -roundMoney(refund - tax),
+			TaxAmount:       -tax,
+			UnitCost:        item.UnitCost,
+			TotalCost:       -cost,
+			PaymentMethod:   strings.ToUpper(receipt.PaymentMethod),
+			CustomerID:      receipt.CustomerID,
+			CustomerName:    receipt.CustomerName,
+			CustomerPhone:   sold.CustomerPhone,
+			ReferenceNumber: input.RefundReference,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+		}
+		if err := tx.Create(&salesTransaction).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to create reversing sales transaction for product %d: %v", item.ProductID, err)
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to record sales transaction for product %d", item.ProductID)})
+			return
+		}
+
+		toPoints := roundMoney(refund * pointsShare)
+		refunds["POINTS"] += toPoints
+		if refundMethod == "CREDIT" {
+			reversed, err := reverseCredit(tx, userID, receipt.ID, item.ProductID, line.Quantity, refund-toPoints)
+			if err != nil {
+				tx.Rollback()
+				utils.ErrorLogger("Failed to reverse credit for product %d on receipt %s: %v", item.ProductID, receipt.ReceiptNumber, err)
+				c.JSON(500, gin.H{"error": "Failed to reverse credit"})
+				return
+			}
+			saleReturn.CreditReversed = roundMoney(saleReturn.CreditReversed + reversed)
+			refunds["CREDIT"] += reversed
+			refunds[otherMethod] += refund - toPoints - reversed
+		} else {
+			refunds[refundMethod] += refund - toPoints
+		}
+		saleReturn.RefundAmount = roundMoney(saleReturn.RefundAmount + refund)
+	}
+
+	for _, method := range []string{"CREDIT", "CASH", "MPESA", "POINTS"} {
+		amount := roundMoney(refunds[method])
+		if amount < 0.005 {
+			continue
+		}
+		refund := models.SaleReturnRefund{UserID: userID, SaleReturnID: saleReturn.ID, Method: method, Amount: amount}
+		if method == "MPESA" {
+			refund.Reference = input.RefundReference
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to record %s refund for receipt %s: %v", method, receipt.ReceiptNumber, err)
+			c.JSON(500, gin.H{"error": "Failed to record return"})
+			return
+		}
+		saleReturn.Refunds = append(saleReturn.Refunds, refund)
+	}
+	if len(saleReturn.Refunds) > 1 {
+		saleReturn.RefundMethod = models.PaymentSplit
+	}
+
+	// Take back the points earned on the returned goods, then pay any points refund
+	reversedPoints, err := reverseEarnedPoints(tx, receipt, saleReturn.ID, saleReturn.RefundAmount, time.Now())
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to reverse points for receipt %s: %v", receipt.ReceiptNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to reverse loyalty points"})
+		return
+	}
+	saleReturn.PointsReversed = reversedPoints
+	if pointsRefund := roundMoney(refunds["POINTS"]); pointsRefund >= 0.005 {
+		settings, err := loadBusinessSettings(tx, userID)
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+			c.JSON(500, gin.H{"error": "Failed to load business settings"})
+			return
+		}
+		refunded, err := refundToPoints(tx, settings, receipt, saleReturn.ID, pointsRefund, time.Now())
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to refund points for receipt %s: %v", receipt.ReceiptNumber, err)
+			c.JSON(500, gin.H{"error": "Failed to refund loyalty points"})
+			return
+		}
+		saleReturn.PointsRefunded = refunded
+	}
+
+	if err := tx.Model(&saleReturn).Updates(map[string]interface{}{
+		"refund_method":   saleReturn.RefundMethod,
+		"refund_amount":   saleReturn.RefundAmount,
+		"credit_reversed": saleReturn.CreditReversed,
+		"points_reversed": saleReturn.PointsReversed,
+		"points_refunded": saleReturn.PointsRefunded,
+	}).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to update sale return %d: %v", saleReturn.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to record return"})
+		return
+	}
+
+	status := receiptStatusAfterReturn(receipt, returnType, lines)
+	if err := tx.Model(&receipt).Update("status", status).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to update receipt %s status: %v", receipt.ReceiptNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to update receipt"})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorLogger("Failed to commit %s of receipt %s: %v", returnType, receipt.ReceiptNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to complete return"})
+		return
+	}
+
+	utils.InfoLogger("Recorded %s of receipt %s for user %d: refund %.2f by %s", returnType, receipt.ReceiptNumber, userID, saleReturn.RefundAmount, saleReturn.RefundMethod)
+	c.JSON(200, gin.H{
+		"message":       "Return recorded successfully",
+		"receiptStatus": status,
+		"return":        saleReturn,
+	})
+}
+
+// returnedLines validates the lines of a return against a receipt. A void
+// takes every unit not yet returned.
+func returnedLines(receipt models.Receipt, returnType string, requested []ReturnLine) ([]returnedLine, error) {
+	var lines []returnedLine
+	if returnType == models.SaleReturnVoid {
+		for _, item := range receipt.Items {
+			if remaining := item.Quantity - item.ReturnedQuantity; remaining > 0 {
+				lines = append(lines, returnedLine{Item: item, Quantity: remaining, Restock: true})
+			}
+		}
+		return lines, nil
+	}
+
+	items := make(map[uint]models.Item, len(receipt.Items))
+	for _, item := range receipt.Items {
+		items[item.ID] = item
+	}
+	seen := make(map[uint]bool, len(requested))
+	for _, request := range requested {
+		item, ok := items[request.ItemID]
+		if !ok {
+			return nil, fmt.Errorf("Item %d is not on receipt %s", request.ItemID, receipt.ReceiptNumber)
+		}
+		if seen[request.ItemID] {
+			return nil, fmt.Errorf("Item %d is listed more than once", request.ItemID)
+		}
+		seen[request.ItemID] = true
+		if request.Quantity <= 0 {
+			return nil, fmt.Errorf("Quantity for item %d must be greater than 0", request.ItemID)
+		}
+		if remaining := item.Quantity - item.ReturnedQuantity; request.Quantity > remaining {
+			return nil, fmt.Errorf("Cannot return %d of item %d, only %d left on the receipt", request.Quantity, request.ItemID, remaining)
+		}
+		restock := request.Restock == nil || *request.Restock
+		lines = append(lines, returnedLine{Item: item, Quantity: request.Quantity, Restock: restock})
+	}
+	return lines, nil
+}
+
+// soldBundleComponents works out the component stock quantity bundles on a
+// receipt gave back, from the sale movements and backorders recorded when
+// the bundle was sold, so a return restores what the sale took even if the
+// bundle has changed since. Bundles sold before these were recorded, or rung
+// up from a layaway, fall back to the bundle's current components.
+func soldBundleComponents(tx *gorm.DB, userID uint, receipt models.Receipt, bundleID uint, quantity int) ([]saleStockLine, error) {
+	sold := 0
+	for _, item := range receipt.Items {
+		if item.ProductID == bundleID {
+			sold += item.Quantity
+		}
+	}
+
+	var taken []struct {
+		ProductID uint
+		Quantity  int
+		Cost      float64
+	}
+	if err := tx.Model(&models.StockMovement{}).
+		Select("product_id, SUM(-quantity_change) as quantity, SUM(-quantity_change * unit_cost) as cost").
+		Where("user_id = ? AND receipt_id = ? AND bundle_id = ? AND change_type = ?", userID, receipt.ID, bundleID, models.MovementSale).
+		Group("product_id").
+		Order("product_id").
+		Scan(&taken).Error; err != nil {
+		return nil, err
+	}
+	var short []struct {
+		ProductID uint
+		Quantity  int
+	}
+	if err := tx.Model(&models.StockException{}).
+		Select("product_id, SUM(quantity_short) as quantity").
+		Where("user_id = ? AND receipt_id = ? AND bundle_id = ? AND type = ?", userID, receipt.ID, bundleID, models.StockExceptionBackorder).
+		Group("product_id").
+		Order("product_id").
+		Scan(&short).Error; err != nil {
+		return nil, err
+	}
+
+	if sold == 0 || len(taken)+len(short) == 0 {
+		components, err := loadBundleComponents(tx, userID, bundleID)
+		if err != nil {
+			return nil, err
+		}
+		lines := make([]saleStockLine, 0, len(components))
+		for _, component := range components {
+			lines = append(lines, saleStockLine{
+				ProductID: component.ComponentID,
+				Quantity:  component.Quantity * quantity,
+				UnitCost:  component.AverageCost,
+			})
+		}
+		return lines, nil
+	}
+
+	var lines []saleStockLine
+	index := map[uint]int{}
+	for _, component := range taken {
+		index[component.ProductID] = len(lines)
+		lines = append(lines, saleStockLine{ProductID: component.ProductID, Quantity: component.Quantity})
+		if component.Quantity > 0 {
+			lines[len(lines)-1].UnitCost = roundMoney(component.Cost / float64(component.Quantity))
+		}
+	}
+	// Units backordered were sold too, even though no stock has moved for them yet
+	for _, component := range short {
+		i, ok := index[component.ProductID]
+		if !ok {
+			var product models.Product
+			if err := tx.Select("id", "average_cost").Where("id = ? AND user_id = ?", component.ProductID, userID).First(&product).Error; err != nil {
+				return nil, err
+			}
+			i = len(lines)
+			lines = append(lines, saleStockLine{ProductID: component.ProductID, UnitCost: product.AverageCost})
+		}
+		lines[i].Quantity += component.Quantity
+	}
+	for i := range lines {
+		lines[i].Quantity = lines[i].Quantity / sold * quantity
+	}
+	return lines, nil
+}
+
+// receiptStatusAfterReturn works out whether anything is left on a receipt
+func receiptStatusAfterReturn(receipt models.Receipt, returnType string, lines []returnedLine) string {
+	if returnType == models.SaleReturnVoid {
+		return models.ReceiptVoided
+	}
+	returned := make(map[uint]int, len(lines))
+	for _, line := range lines {
+		returned[line.Item.ID] = line.Quantity
+	}
+	for _, item := range receipt.Items {
+		if item.ReturnedQuantity+returned[item.ID] < item.Quantity {
+			return models.ReceiptPartiallyReturned
+		}
+	}
+	return models.ReceiptReturned
+}
+
+// otherRefundMethod is how the part of a credit refund the customer has
+// already paid goes back: the receipt's M-Pesa tender when a transaction code
+// is given for it, otherwise cash
+func otherRefundMethod(receipt models.Receipt, reference string) string {
+	for _, payment := range receipt.Payments {
+		if payment.Method == "MPESA" && reference != "" {
+			return "MPESA"
+		}
+	}
+	return "CASH"
+}
+
+// pointsPaidShare is the fraction of a receipt the customer paid with points
+func pointsPaidShare(receipt models.Receipt) float64 {
+	if receipt.CustomerID == nil || receipt.TotalAmount <= 0 {
+		return 0
+	}
+	var paid float64
+	for _, payment := range receipt.Payments {
+		if payment.Method == "POINTS" {
+			paid += payment.Amount
+		}
+	}
+	return min(paid/receipt.TotalAmount, 1)
+}
+
+// reverseCredit takes a returned line off the customer's credit for a
+// receipt and returns the amount no longer owed, which is at most the
+// balance still due. Credits recorded before receipts were linked cannot be
+// found and reverse nothing; credits recorded per product before split
+// tenders are matched on the product.
+func reverseCredit(tx *gorm.DB, userID, receiptID, productID uint, quantity int, amount float64) (float64, error) {
+	var credit models.CreditTransaction
+	err := tx.Where("user_id = ? AND receipt_id = ? AND (product_id IS NULL OR product_id = ?) AND status <> ?",
+		userID, receiptID, productID, models.CreditReversed).
+		First(&credit).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.WarningLogger("No credit transaction linked to receipt %d for product %d", receiptID, productID)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if amount > credit.BalanceDue {
+		amount = credit.BalanceDue
+	}
+	updates := map[string]interface{}{
+		"quantity":      credit.Quantity - quantity,
+		"credit_amount": roundMoney(credit.CreditAmount - amount),
+		"balance_due":   roundMoney(credit.BalanceDue - amount),
+	}
+	if credit.Quantity-quantity <= 0 || credit.CreditAmount-amount < 0.005 {
+		updates["status"] = models.CreditReversed
+	} else if credit.BalanceDue-amount < 0.005 {
+		updates["status"] = models.CreditPaid
+	}
+	if err := tx.Model(&credit).Updates(updates).Error; err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+// GetSaleReturns lists the voids and returns made against a receipt
+func (im *SalesManagementHandler) GetSaleReturns(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var receipt models.Receipt
+	if err := im.db.Where("receipt_number = ? AND user_id = ?", c.Param("receiptNumber"), userID).First(&receipt).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Receipt not found"})
+		return
+	}
+
+	var returns []models.SaleReturn
+	if err := im.db.Preload("Items").Preload("Refunds").
+		Where("receipt_id = ? AND user_id = ?", receipt.ID, userID).
+		Order("created_at").
+		Find(&returns).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch returns for receipt %s: %v", receipt.ReceiptNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch returns"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"receiptNumber": receipt.ReceiptNumber,
+		"status":        receipt.Status,
+		"returns":       returns,
+	})
+}
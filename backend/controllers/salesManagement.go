@@ -1,8 +1,9 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,26 +23,109 @@ func NewSalesManagementHandler(db *gorm.DB) *SalesManagementHandler {
 
 // Define the structure for a single sell request
 type SellRequest struct {
-	ProductID uint    `json:"product_id" binding:"required"`
-	Quantity  int     `json:"quantity" binding:"required"`
-	Note      string  `json:"note"`
-	Amount    float64 `json:"amount"`
+	ProductID uint   `json:"product_id" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required"`
+	Note      string `json:"note"`
+	// Amount is the undiscounted line total the till shows. Lines are priced
+	// from the product's effective price; an Amount that differs is a price
+	// override and, like a line discount, needs permission and OverrideReason.
+	Amount         float64 `json:"amount"`
+	DiscountType   string  `json:"discount_type"`
+	DiscountValue  float64 `json:"discount_value"`
+	OverrideReason string  `json:"override_reason"`
+	// agreed is the price a quotation or layaway fixed before the sale
+	agreed *agreedPrice
+}
+
+// agreedPrice is a line price fixed before the sale and honoured as it was
+// agreed, whatever the price list and promotions say now
+type agreedPrice struct {
+	ListPrice      float64
+	DiscountAmount float64
+	Source         string
+	Description    string
+	// Total is the amount the customer was promised, tax included. Zero
+	// works the tax out at the sale instead.
+	Total float64
 }
 
 // Define the structure for the sale data from the front end
 type SaleData struct {
-	Products         []SellRequest `json:"products" binding:"required"`
-	PaymentMethod    string        `json:"payment_method"`
-	CustomerName     string        `json:"customer_name"`
-	CustomerPhone    string        `json:"customer_phone"`
-	ReferenceNumber  string        `json:"reference_number"`
-	AmountPaid       float64       `json:"amount_paid"`
-	RemainingBalance float64       `json:"remaining_balance"`
+	Products      []SellRequest `json:"products" binding:"required"`
+	PaymentMethod string        `json:"payment_method"`
+	// CustomerID links the sale to a saved customer; otherwise the
+	// customer is found or created from CustomerPhone
+	CustomerID       uint    `json:"customer_id"`
+	CustomerName     string  `json:"customer_name"`
+	CustomerPhone    string  `json:"customer_phone"`
+	ReferenceNumber  string  `json:"reference_number"`
+	AmountPaid       float64 `json:"amount_paid"`
+	RemainingBalance float64 `json:"remaining_balance"`
+	// Payments lists the tenders. Without it PaymentMethod, AmountPaid and
+	// ReferenceNumber describe a single tender.
+	Payments []TenderRequest `json:"payments"`
+	// Basket discount applied after line discounts and promotions
+	DiscountType   string  `json:"discount_type"`
+	DiscountValue  float64 `json:"discount_value"`
+	CouponCode     string  `json:"coupon_code"`
+	OverrideReason string  `json:"override_reason"`
+	// clientSaleID and soldAt are set for sales captured offline and synced later
+	clientSaleID string
+	soldAt       time.Time
+	// layaway is set when a paid-off layaway is rung up; its reserved stock
+	// is released to the sale
+	layaway *models.Layaway
+	// quotation is set when a quotation is converted into the sale
+	quotation *models.Quotation
+	// staffID is the login ringing up the sale; zero means the owner
+	staffID uint
+}
+
+// saleStockLine is a quantity of one product's stock depleted by a sale
+type saleStockLine struct {
+	ProductID uint
+	Quantity  int
+	UnitCost  float64
+	Policy    string
+	Note      string
+	// BundleID is the bundle a component is sold in
+	BundleID *uint
 }
 
+// generateReceiptNumber returns a receipt number that stays unique when
+// several tills record sales in the same second
 func generateReceiptNumber() string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("RCP-%d%d", time.Now().Unix(), rand.Intn(1000))
+	suffix := strings.ToUpper(strings.ReplaceAll(utils.GenerateUUID(), "-", "")[:8])
+	return fmt.Sprintf("RCP-%d-%s", time.Now().Unix(), suffix)
+}
+
+// validateSaleData checks a sale before any stock is taken and normalises
+// its payment into a list of tenders
+func validateSaleData(saleData *SaleData) error {
+	if len(saleData.Products) == 0 {
+		return errors.New("At least one product is required")
+	}
+	for _, product := range saleData.Products {
+		if product.Quantity <= 0 {
+			return fmt.Errorf("Quantity for product %d must be greater than 0", product.ProductID)
+		}
+	}
+
+	if len(saleData.Payments) == 0 && saleData.PaymentMethod == "" {
+		return errors.New("Payment method is required")
+	}
+	tenders := saleTenders(*saleData)
+	if err := validateTenders(tenders); err != nil {
+		return err
+	}
+	saleData.Payments = tenders
+	saleData.PaymentMethod = salePaymentMethod(tenders)
+
+	// Credit sales need to know who owes the money
+	if tendersHaveCredit(tenders) && saleData.CustomerID == 0 && (saleData.CustomerName == "" || saleData.CustomerPhone == "") {
+		return errors.New("Name and phone number are required for credit sales")
+	}
+	return nil
 }
 
 func (im *SalesManagementHandler) SellProducts(c *gin.Context) {
@@ -63,29 +147,12 @@ func (im *SalesManagementHandler) SellProducts(c *gin.Context) {
 		return
 	}
 
-	// Validate the products array is not empty
-	if len(saleData.Products) == 0 {
-		utils.ErrorLogger("Empty products array received")
-		c.JSON(400, gin.H{"error": "At least one product is required"})
+	if err := validateSaleData(&saleData); err != nil {
+		utils.WarningLogger("Invalid sale request: %v", err)
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate payment method and sale type
-	if saleData.PaymentMethod == "" {
-		utils.ErrorLogger("Incomplete sale request in payment method or sale type")
-		c.JSON(400, gin.H{"error": "Payment method is required"})
-		return
-	}
-
-	// Validate credit sale requirements
-	if strings.ToUpper(saleData.PaymentMethod) == "CREDIT" {
-		if saleData.CustomerName == "" || saleData.CustomerPhone == "" {
-			utils.WarningLogger("Incomplete credit sale request for product %d", saleData.Products[0].ProductID)
-			c.JSON(400, gin.H{"error": fmt.Sprintf("Name and phone number are required for credit sales for product %d", saleData.Products[0].ProductID)})
-			return
-		}
-	}
-
 	// Get user ID from context (assuming it's set during authentication)
 	userID := c.GetUint("userID")
 	if userID == 0 {
@@ -94,12 +161,27 @@ func (im *SalesManagementHandler) SellProducts(c *gin.Context) {
 		return
 	}
 
-	utils.InfoLogger("Processing sale for user %d with payment method %s", userID, saleData.PaymentMethod)
+	utils.InfoLogger("Processing sale for user %d with payment method %s", userID, salePaymentMethod(saleData.Payments))
 
+	saleData.staffID = actingUser(c)
 	processSales(saleData, userID, im, c)
 }
 
-func processSales(saleData SaleData, userID uint, im *SalesManagementHandler, c *gin.Context) {
+// saleResponder receives the outcome of processSales. A *gin.Context answers
+// the till directly; offline sync collects one result per sale.
+type saleResponder interface {
+	JSON(code int, obj any)
+}
+
+func processSales(saleData SaleData, userID uint, im *SalesManagementHandler, c saleResponder) {
+	settings, err := loadBusinessSettings(im.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to load business settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load business settings"})
+		return
+	}
+	var warnings []string
+
 	// Start transaction
 	tx := im.db.Begin()
 	if tx.Error != nil {
@@ -113,17 +195,80 @@ func processSales(saleData SaleData, userID uint, im *SalesManagementHandler, c
 		}
 	}()
 
+	// Offline sales are priced and dated as at the time they were rung up
+	saleTime := time.Now()
+	if !saleData.soldAt.IsZero() {
+		saleTime = saleData.soldAt
+	}
+
+	staffID := saleData.staffID
+	if staffID == 0 {
+		staffID = userID
+	}
+
 	// Create receipt
 	receipt := models.Receipt{
 		UserID:        userID,
+		CashierID:     staffID,
 		ReceiptNumber: generateReceiptNumber(),
 		CustomerName:  saleData.CustomerName,
-		Date:          time.Now(),
+		Date:          saleTime,
 		PaymentMethod: saleData.PaymentMethod,
 		TotalAmount:   0, // Will be updated as we process items
-		CreatedAt:     time.Now(),
+		Status:        models.ReceiptCompleted,
+		TaxPricing:    settings.TaxPricing,
+		CreatedAt:     saleTime,
 		UpdatedAt:     time.Now(),
 	}
+	if saleData.clientSaleID != "" {
+		syncedAt := time.Now()
+		receipt.ClientSaleID = &saleData.clientSaleID
+		receipt.SyncedAt = &syncedAt
+	}
+
+	// Tie the sale to the cashier's open register session
+	session, err := openRegisterSession(tx, userID, staffID, saleTime)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to load register session for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load register session"})
+		return
+	}
+	if session == nil && settings.RequireRegisterSession {
+		tx.Rollback()
+		c.JSON(409, gin.H{"error": "Open a register session before recording sales", "code": errCodeRegisterClosed})
+		return
+	}
+	if session != nil {
+		receipt.RegisterSessionID = &session.ID
+	}
+
+	customer, err := resolveSaleCustomer(tx, userID, &saleData)
+	if errors.Is(err, errCustomerNotFound) {
+		tx.Rollback()
+		c.JSON(404, gin.H{"error": "Customer not found"})
+		return
+	}
+	// A phone number that cannot be read does not stop the sale. It is kept
+	// as typed and the sale is not linked to a customer.
+	if errors.Is(err, errCustomerPhone) {
+		utils.WarningLogger("Sale for user %d not linked to a customer: %v", userID, err)
+		warnings = append(warnings, fmt.Sprintf("Customer phone %s was not recognised, so the sale is not linked to a customer", saleData.CustomerPhone))
+		receipt.CustomerName = saleData.CustomerName
+		customer, err = nil, nil
+	}
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to resolve customer for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load customer"})
+		return
+	}
+	var customerID *uint
+	if customer != nil {
+		customerID = &customer.ID
+		receipt.CustomerID = customerID
+		receipt.CustomerName = saleData.CustomerName
+	}
 
 	if err := tx.Create(&receipt).Error; err != nil {
 		tx.Rollback()
@@ -132,112 +277,345 @@ func processSales(saleData SaleData, userID uint, im *SalesManagementHandler, c
 		return
 	}
 
-	for _, sellRequest := range saleData.Products {
-		// Get current inventory and product
-		var inventory models.Inventory
-		var product models.Product
-		if err := tx.Where("product_id = ? AND user_id = ?", sellRequest.ProductID, userID).First(&inventory).Error; err != nil {
+	if saleData.layaway != nil {
+		err := completeLayaway(tx, *saleData.layaway, receipt.ID)
+		if errors.Is(err, errLayawayNotOpen) {
+			tx.Rollback()
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to release layaway %s: %v", saleData.layaway.LayawayNumber, err)
+			c.JSON(500, gin.H{"error": "Failed to release layaway stock"})
+			return
+		}
+	}
+	if saleData.quotation != nil {
+		err := convertQuotation(tx, *saleData.quotation, receipt.ID, saleTime)
+		if errors.Is(err, errQuotationNotOpen) {
 			tx.Rollback()
-			utils.ErrorLogger("Product not found in inventory: product_id= %d %v", sellRequest.ProductID, err)
-			c.JSON(404, gin.H{"error": fmt.Sprintf("Product %d not found in inventory", sellRequest.ProductID)})
+			c.JSON(409, gin.H{"error": err.Error()})
 			return
 		}
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to convert quotation %s: %v", saleData.quotation.QuotationNumber, err)
+			c.JSON(500, gin.H{"error": "Failed to convert quotation"})
+			return
+		}
+	}
 
+	promotions, err := loadActivePromotions(tx, userID, saleTime)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to load promotions for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to load promotions"})
+		return
+	}
+
+	overrides := &overrideAuthoriser{db: tx, userID: userID, staffID: staffID}
+	var lines []*pricedLine
+	for _, sellRequest := range saleData.Products {
+		// Get the product being sold
+		var product models.Product
 		if err := tx.Where("id = ? AND user_id = ?", sellRequest.ProductID, userID).First(&product).Error; err != nil {
 			tx.Rollback()
 			utils.ErrorLogger("Product not found: product_id= %d %v", sellRequest.ProductID, err)
 			c.JSON(404, gin.H{"error": fmt.Sprintf("Product %d not found", sellRequest.ProductID)})
 			return
 		}
-
-		// Check if we have enough stock
-		if inventory.Quantity < sellRequest.Quantity {
+		if !product.Active {
 			tx.Rollback()
-			utils.WarningLogger("Insufficient stock for product %d. Requested: %d, Available: %d",
-				sellRequest.ProductID, sellRequest.Quantity, inventory.Quantity)
-			c.JSON(400, gin.H{"error": fmt.Sprintf("Insufficient stock for product %d", sellRequest.ProductID)})
+			utils.WarningLogger("Attempt to sell archived product %d", sellRequest.ProductID)
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Product %d is archived and cannot be sold", sellRequest.ProductID), "code": errCodeProductArchived})
 			return
 		}
 
-		// Create receipt item
-		item := models.Item{
-			ReceiptID:  receipt.ID,
-			ProductID:  sellRequest.ProductID,
-			Name:       product.Name,
-			Quantity:   sellRequest.Quantity,
-			UnitPrice:  sellRequest.Amount / float64(sellRequest.Quantity),
-			TotalPrice: sellRequest.Amount,
+		// Work out which stock the sale depletes: the product itself, or each component of a bundle
+		stockLines := []saleStockLine{{ProductID: product.ID, Quantity: sellRequest.Quantity, UnitCost: product.AverageCost, Policy: product.NegativeStockPolicy, Note: sellRequest.Note}}
+		unitCost := product.AverageCost
+		if product.IsBundle {
+			components, err := loadBundleComponents(tx, userID, product.ID)
+			if err != nil {
+				tx.Rollback()
+				utils.ErrorLogger("Failed to load bundle components for product %d: %v", product.ID, err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to load bundle components for product %d", product.ID)})
+				return
+			}
+			if len(components) == 0 {
+				tx.Rollback()
+				utils.WarningLogger("Bundle %d has no components", product.ID)
+				c.JSON(400, gin.H{"error": fmt.Sprintf("Bundle %d has no components", product.ID)})
+				return
+			}
+
+			bundleID := product.ID
+			stockLines = stockLines[:0]
+			for _, component := range components {
+				stockLines = append(stockLines, saleStockLine{
+					ProductID: component.ComponentID,
+					Quantity:  component.Quantity * sellRequest.Quantity,
+					UnitCost:  component.AverageCost,
+					Policy:    component.NegativeStockPolicy,
+					Note:      strings.TrimSpace(fmt.Sprintf("Sold in bundle %s. %s", product.Name, sellRequest.Note)),
+					BundleID:  &bundleID,
+				})
+			}
+			unitCost = bundleUnitCost(components)
 		}
 
-		if err := tx.Create(&item).Error; err != nil {
+		stockException := ""
+		for _, line := range stockLines {
+			// Decrement stock atomically so concurrent sales cannot oversell
+			take, err := takeStockForSale(tx, userID, line.ProductID, line.Quantity, effectiveStockPolicy(line.Policy, settings))
+			inventory := take.Inventory
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				tx.Rollback()
+				utils.ErrorLogger("Product not found in inventory: product_id= %d %v", line.ProductID, err)
+				c.JSON(404, gin.H{"error": fmt.Sprintf("Product %d not found in inventory", line.ProductID)})
+				return
+			}
+			if errors.Is(err, errInsufficientStock) {
+				tx.Rollback()
+				utils.WarningLogger("Insufficient stock for product %d. Requested: %d, Available: %d",
+					line.ProductID, line.Quantity, inventory.Quantity)
+				c.JSON(400, gin.H{"error": fmt.Sprintf("Insufficient stock for product %d", line.ProductID), "code": errCodeInsufficientStock})
+				return
+			}
+			if err != nil {
+				tx.Rollback()
+				utils.ErrorLogger("Failed to update inventory for product %d: %v", line.ProductID, err)
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to update inventory for product %d", line.ProductID)})
+				return
+			}
+
+			// Flag sales made without enough stock so the count can be fixed later
+			if take.Exception != nil {
+				take.Exception.ReceiptID = receipt.ID
+				take.Exception.BundleID = line.BundleID
+				take.Exception.Note = line.Note
+				if err := tx.Create(take.Exception).Error; err != nil {
+					tx.Rollback()
+					utils.ErrorLogger("Failed to record stock exception for product %d: %v", line.ProductID, err)
+					c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to record stock exception for product %d", line.ProductID)})
+					return
+				}
+				stockException = take.Exception.Type
+				warnings = append(warnings, stockExceptionWarning(*take.Exception))
+				utils.WarningLogger("Stock exception %s for product %d on receipt %s", take.Exception.Type, line.ProductID, receipt.ReceiptNumber)
+			}
+
+			// Record stock movement
+			if take.Taken > 0 {
+				stockMovement := models.StockMovement{
+					UserID:         userID,
+					ProductID:      line.ProductID,
+					ChangeType:     models.MovementSale,
+					QuantityChange: -take.Taken,
+					UnitCost:       line.UnitCost,
+					Note:           line.Note,
+					ReceiptID:      receipt.ID,
+					BundleID:       line.BundleID,
+					CreatedAt:      saleTime,
+				}
+
+				if err := tx.Create(&stockMovement).Error; err != nil {
+					tx.Rollback()
+					utils.ErrorLogger("Failed to create stock movement for product %d: %v", line.ProductID, err)
+					c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to record stock movement for product %d", line.ProductID)})
+					return
+				}
+			}
+
+			// Check for low stock alert
+			if inventory.Quantity <= inventory.LowStockThreshold {
+				alert := models.LowStockAlert{
+					UserID:       userID,
+					ProductID:    line.ProductID,
+					AlertMessage: fmt.Sprintf("Product stock is low. Current quantity: %d", inventory.Quantity),
+					Resolved:     false,
+					CreatedAt:    time.Now(),
+				}
+
+				if err := tx.Create(&alert).Error; err != nil {
+					utils.ErrorLogger("Failed to create low stock alert for product %d: %v", line.ProductID, err)
+				}
+			}
+
+			utils.InfoLogger("Checking low stock alert for product %d: current quantity %d, threshold %d", line.ProductID, inventory.Quantity, inventory.LowStockThreshold)
+		}
+
+		line, err := priceLine(tx, userID, product, sellRequest, promotions, overrides, saleTime)
+		if err != nil {
 			tx.Rollback()
-			utils.ErrorLogger("Failed to create receipt item: %v", err)
-			c.JSON(500, gin.H{"error": "Failed to create receipt item"})
+			status := lineErrorStatus(err)
+			if status == 500 {
+				utils.ErrorLogger("Failed to price product %d: %v", product.ID, err)
+				c.JSON(500, gin.H{"error": "Failed to price products"})
+				return
+			}
+			utils.WarningLogger("User %d pricing of product %d refused: %v", userID, product.ID, err)
+			c.JSON(status, gin.H{"error": fmt.Sprintf("Product %d: %v", sellRequest.ProductID, err)})
 			return
 		}
+		line.UnitCost = unitCost
+		line.StockException = stockException
+		lines = append(lines, line)
+	}
 
-		// Update receipt total
-		receipt.TotalAmount += item.TotalPrice
-
-		// Update inventory
-		inventory.Quantity -= sellRequest.Quantity
-		inventory.LastUpdated = time.Now()
-		if err := tx.Save(&inventory).Error; err != nil {
+	// Basket discount, then coupon, spread over the lines
+	var basket float64
+	for _, line := range lines {
+		basket += line.netAmount()
+	}
+	discount, err := manualDiscount(saleData.DiscountType, saleData.DiscountValue, roundMoney(basket))
+	if err != nil {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var basketOverride *models.PriceOverride
+	if discount > 0 {
+		if err := overrides.authorise(saleData.OverrideReason); err != nil {
 			tx.Rollback()
-			utils.ErrorLogger("Failed to update inventory for product %d: %v", sellRequest.ProductID, err)
-			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to update inventory for product %d", sellRequest.ProductID)})
+			utils.WarningLogger("User %d basket discount refused: %v", userID, err)
+			c.JSON(overrideErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
+		basketOverride = &models.PriceOverride{
+			Kind:          models.OverrideBasketDiscount,
+			ListAmount:    roundMoney(basket),
+			ChargedAmount: roundMoney(basket - discount),
+			Reason:        saleData.OverrideReason,
+		}
+		allocateDiscount(lines, appliedDiscount{Source: models.DiscountSourceBasket, Description: "Basket discount", Amount: discount})
+		basket -= discount
+	}
+	if saleData.CouponCode != "" {
+		coupon, discount, err := redeemCoupon(tx, userID, saleData.CouponCode, roundMoney(basket), saleTime)
+		if errors.Is(err, errCouponExhausted) {
+			tx.Rollback()
+			c.JSON(409, gin.H{"error": fmt.Sprintf("Coupon %s has been used up", coupon.Code)})
+			return
+		}
+		if errors.Is(err, errCouponInvalid) {
+			tx.Rollback()
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to redeem coupon %s: %v", saleData.CouponCode, err)
+			c.JSON(500, gin.H{"error": "Failed to redeem coupon"})
+			return
+		}
+		allocateDiscount(lines, appliedDiscount{Source: models.DiscountSourceCoupon, Description: "Coupon " + coupon.Code, CouponID: &coupon.ID, Amount: discount})
+		receipt.CouponCode = coupon.Code
+	}
+
+	for _, line := range lines {
+		sellRequest := line.Request
+		net := line.netAmount()
+		tax := lineTax(settings, line.Product.TaxClass, net)
+		if line.Request.agreed != nil && line.Request.agreed.Total > 0 {
+			tax = agreedLineTax(settings, line.Product.TaxClass, line.Request.agreed.Total)
+		}
 
-		// Record stock movement
-		stockMovement := models.StockMovement{
-			UserID:         userID,
+		// Create receipt item
+		item := models.Item{
+			ReceiptID:      receipt.ID,
 			ProductID:      sellRequest.ProductID,
-			ChangeType:     saleData.PaymentMethod,
-			QuantityChange: -sellRequest.Quantity,
-			Note:           sellRequest.Note,
-			CreatedAt:      time.Now(),
+			Name:           line.Product.Name,
+			Quantity:       sellRequest.Quantity,
+			UnitPrice:      tax.Total / float64(sellRequest.Quantity),
+			TotalPrice:     tax.Total,
+			ListPrice:      line.ListPrice,
+			DiscountAmount: line.discountAmount(),
+			NetAmount:      net,
+			TaxClass:       tax.Class,
+			TaxRate:        tax.Rate,
+			TaxableAmount:  tax.Taxable,
+			TaxAmount:      tax.Tax,
+			UnitCost:       line.UnitCost,
+			TotalCost:      roundMoney(line.UnitCost * float64(sellRequest.Quantity)),
 		}
 
-		if err := tx.Create(&stockMovement).Error; err != nil {
+		if err := tx.Create(&item).Error; err != nil {
 			tx.Rollback()
-			utils.ErrorLogger("Failed to create stock movement for product %d: %v", sellRequest.ProductID, err)
-			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to record stock movement for product %d", sellRequest.ProductID)})
+			utils.ErrorLogger("Failed to create receipt item: %v", err)
+			c.JSON(500, gin.H{"error": "Failed to create receipt item"})
 			return
 		}
 
-		// Handle credit sale
-		if strings.ToUpper(saleData.PaymentMethod) == "CREDIT" {
-			creditTx := models.CreditTransaction{
-				UserID:       userID,
-				ProductID:    sellRequest.ProductID,
-				Name:         saleData.CustomerName,
-				PhoneNumber:  saleData.CustomerPhone,
-				Quantity:     sellRequest.Quantity,
-				CreditAmount: sellRequest.Amount,
-				BalanceDue:   saleData.RemainingBalance,
-				Status:       "PENDING",
+		// Record what was given away and why
+		for _, discount := range line.Discounts {
+			if discount.Amount == 0 {
+				continue
 			}
+			saleDiscount := models.SaleDiscount{
+				UserID:      userID,
+				ReceiptID:   receipt.ID,
+				ItemID:      item.ID,
+				Source:      discount.Source,
+				PromotionID: discount.PromotionID,
+				CouponID:    discount.CouponID,
+				Description: discount.Description,
+				Amount:      discount.Amount,
+			}
+			if err := tx.Create(&saleDiscount).Error; err != nil {
+				tx.Rollback()
+				utils.ErrorLogger("Failed to record discount for product %d: %v", sellRequest.ProductID, err)
+				c.JSON(500, gin.H{"error": "Failed to record discount"})
+				return
+			}
+		}
 
-			if err := tx.Create(&creditTx).Error; err != nil {
+		// Log price overrides and cashier discounts for the owner
+		for _, override := range line.Overrides {
+			override.UserID = userID
+			override.ReceiptID = receipt.ID
+			override.ItemID = item.ID
+			override.ProductID = &line.Product.ID
+			if err := tx.Create(&override).Error; err != nil {
 				tx.Rollback()
-				utils.ErrorLogger("Failed to create credit transaction for product %d: %v", sellRequest.ProductID, err)
-				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to record credit transaction for product %d", sellRequest.ProductID)})
+				utils.ErrorLogger("Failed to record price override for product %d: %v", sellRequest.ProductID, err)
+				c.JSON(500, gin.H{"error": "Failed to record price override"})
 				return
 			}
+			utils.WarningLogger("Price override on receipt %s by user %d: %s %s %.2f -> %.2f (%s)",
+				receipt.ReceiptNumber, userID, override.Kind, line.Product.Name, override.ListAmount, override.ChargedAmount, override.Reason)
 		}
 
+		// Update receipt totals
+		receipt.TotalAmount = roundMoney(receipt.TotalAmount + item.TotalPrice)
+		receipt.DiscountAmount = roundMoney(receipt.DiscountAmount + item.DiscountAmount)
+		receipt.TaxAmount = roundMoney(receipt.TaxAmount + item.TaxAmount)
+
 		// Record sales transaction
 		salesTransaction := models.SalesTransaction{
 			UserID:          userID,
+			CashierID:       staffID,
 			ProductID:       sellRequest.ProductID,
+			ReceiptID:       receipt.ID,
 			Quantity:        sellRequest.Quantity,
-			TotalAmount:     sellRequest.Amount,
+			TotalAmount:     item.TotalPrice,
+			ListPrice:       item.ListPrice,
+			DiscountAmount:  item.DiscountAmount,
+			NetAmount:       net,
+			TaxClass:        item.TaxClass,
+			TaxRate:         item.TaxRate,
+			TaxableAmount:   item.TaxableAmount,
+			TaxAmount:       item.TaxAmount,
+			UnitCost:        item.UnitCost,
+			TotalCost:       item.TotalCost,
 			PaymentMethod:   saleData.PaymentMethod,
+			CustomerID:      customerID,
 			CustomerName:    saleData.CustomerName,
 			CustomerPhone:   saleData.CustomerPhone,
 			ReferenceNumber: saleData.ReferenceNumber,
-			CreatedAt:       time.Now(),
+			StockException:  line.StockException,
+			CreatedAt:       saleTime,
 			UpdatedAt:       time.Now(),
 		}
 
@@ -247,23 +625,105 @@ func processSales(saleData SaleData, userID uint, im *SalesManagementHandler, c
 			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to record sales transaction for product %d", sellRequest.ProductID)})
 			return
 		}
+	}
+	if basketOverride != nil {
+		basketOverride.UserID = userID
+		basketOverride.ReceiptID = receipt.ID
+		if err := tx.Create(basketOverride).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to record basket discount override: %v", err)
+			c.JSON(500, gin.H{"error": "Failed to record price override"})
+			return
+		}
+		utils.WarningLogger("Basket discount on receipt %s by user %d: %.2f -> %.2f (%s)",
+			receipt.ReceiptNumber, userID, basketOverride.ListAmount, basketOverride.ChargedAmount, basketOverride.Reason)
+	}
 
-		// Check for low stock alert
-		if inventory.Quantity <= inventory.LowStockThreshold {
-			alert := models.LowStockAlert{
-				UserID:       userID,
-				ProductID:    sellRequest.ProductID,
-				AlertMessage: fmt.Sprintf("Product stock is low. Current quantity: %d", inventory.Quantity),
-				Resolved:     false,
-				CreatedAt:    time.Now(),
-			}
+	// Apply the tenders to the total; whatever they leave unpaid goes on credit
+	payments, change, credit, err := settleTenders(saleData.Payments, receipt.TotalAmount)
+	if err != nil {
+		tx.Rollback()
+		utils.WarningLogger("Tenders do not settle receipt %s: %v", receipt.ReceiptNumber, err)
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range payments {
+		payments[i].UserID = userID
+		payments[i].ReceiptID = receipt.ID
+		payments[i].CreatedAt = saleTime
+	}
+	if err := tx.Create(&payments).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to record payments for receipt %s: %v", receipt.ReceiptNumber, err)
+		c.JSON(500, gin.H{"error": "Failed to record payments"})
+		return
+	}
+	receipt.ChangeGiven = change
 
-			if err := tx.Create(&alert).Error; err != nil {
-				utils.ErrorLogger("Failed to create low stock alert for product %d: %v", sellRequest.ProductID, err)
+	// Points tendered come off the customer's balance; the rest of the sale earns points
+	var pointsPaid float64
+	for _, payment := range payments {
+		if payment.Method == "POINTS" {
+			pointsPaid += payment.Amount
+		}
+	}
+	if pointsPaid > 0 {
+		if !settings.LoyaltyEnabled || customer == nil {
+			tx.Rollback()
+			err := errLoyaltyDisabled
+			if customer == nil {
+				err = errPointsNeedCustomer
+			}
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		redeemed, err := redeemPoints(tx, settings, *customer, receipt.ID, pointsPaid, saleTime)
+		if err != nil {
+			tx.Rollback()
+			if errors.Is(err, errInsufficientPoints) {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
 			}
+			utils.ErrorLogger("Failed to redeem points for receipt %s: %v", receipt.ReceiptNumber, err)
+			c.JSON(500, gin.H{"error": "Failed to redeem points"})
+			return
+		}
+		receipt.PointsRedeemed = redeemed
+	}
+	if settings.LoyaltyEnabled && customer != nil && receipt.TotalAmount > 0 {
+		earned, err := earnPoints(tx, settings, *customer, receipt.ID, lines, 1-pointsPaid/receipt.TotalAmount, saleTime)
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to credit points for receipt %s: %v", receipt.ReceiptNumber, err)
+			c.JSON(500, gin.H{"error": "Failed to credit loyalty points"})
+			return
+		}
+		receipt.PointsEarned = earned
+	}
+
+	if credit > 0 {
+		units := 0
+		for _, line := range lines {
+			units += line.Request.Quantity
+		}
+		creditTx := models.CreditTransaction{
+			UserID:       userID,
+			ReceiptID:    receipt.ID,
+			CustomerID:   customerID,
+			Name:         saleData.CustomerName,
+			PhoneNumber:  saleData.CustomerPhone,
+			Quantity:     units,
+			CreditAmount: credit,
+			BalanceDue:   credit,
+			Status:       models.CreditPending,
 		}
 
-		utils.InfoLogger("Checking low stock alert for product %d: current quantity %d, threshold %d", sellRequest.ProductID, inventory.Quantity, inventory.LowStockThreshold)
+		if err := tx.Create(&creditTx).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to create credit transaction for receipt %s: %v", receipt.ReceiptNumber, err)
+			c.JSON(500, gin.H{"error": "Failed to record credit transaction"})
+			return
+		}
 	}
 
 	// Update receipt with final total
@@ -281,9 +741,47 @@ func processSales(saleData SaleData, userID uint, im *SalesManagementHandler, c
 	}
 
 	utils.InfoLogger("Successfully processed sales")
-	c.JSON(200, gin.H{
-		"message": "Sales recorded successfully",
-	})
+	response := gin.H{
+		"message":       "Sales recorded successfully",
+		"receiptNumber": receipt.ReceiptNumber,
+		"totalAmount":   receipt.TotalAmount,
+		"payments":      payments,
+		"change":        change,
+	}
+	if receipt.PointsEarned > 0 || receipt.PointsRedeemed > 0 {
+		response["pointsEarned"] = receipt.PointsEarned
+		response["pointsRedeemed"] = receipt.PointsRedeemed
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(200, response)
+}
+
+// salesHistoryRow is a sales transaction with the name of the product sold
+type salesHistoryRow struct {
+	models.SalesTransaction
+	ProductName string `json:"product_name"`
+}
+
+var salesHistoryListSpec = listSpec[salesHistoryRow]{
+	id: listField[salesHistoryRow]{column: "sales_transactions.id", kind: listNumber, value: func(r salesHistoryRow) any { return r.ID }},
+	fields: map[string]listField[salesHistoryRow]{
+		"product_id":      {column: "sales_transactions.product_id", kind: listNumber, value: func(r salesHistoryRow) any { return r.ProductID }},
+		"product_name":    {column: "products.name", kind: listText, value: func(r salesHistoryRow) any { return r.ProductName }},
+		"category":        {column: "products.category", kind: listText},
+		"receipt_id":      {column: "sales_transactions.receipt_id", kind: listNumber, value: func(r salesHistoryRow) any { return r.ReceiptID }},
+		"quantity":        {column: "sales_transactions.quantity", kind: listNumber, value: func(r salesHistoryRow) any { return r.Quantity }},
+		"total_amount":    {column: "sales_transactions.total_amount", kind: listNumber, value: func(r salesHistoryRow) any { return r.TotalAmount }},
+		"net_amount":      {column: "sales_transactions.net_amount", kind: listNumber, value: func(r salesHistoryRow) any { return r.NetAmount }},
+		"payment_method":  {column: "sales_transactions.payment_method", kind: listText, value: func(r salesHistoryRow) any { return r.PaymentMethod }},
+		"customer_id":     {column: "sales_transactions.customer_id", kind: listNumber},
+		"customer_name":   {column: "sales_transactions.customer_name", kind: listText},
+		"customer_phone":  {column: "sales_transactions.customer_phone", kind: listText},
+		"stock_exception": {column: "sales_transactions.stock_exception", kind: listText},
+		"created_at":      {column: "sales_transactions.created_at", kind: listTime, value: func(r salesHistoryRow) any { return r.CreatedAt }},
+	},
+	defaultSort: "-created_at",
 }
 
 // Fetch sales history
@@ -295,16 +793,18 @@ func (im *SalesManagementHandler) FetchSalesHistory(c *gin.Context) {
 		return
 	}
 
-	var salesTransactions []struct {
-		models.SalesTransaction
-		ProductName string `json:"product_name"`
+	list, err := parseListQuery(c, salesHistoryListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
 	}
 
-	if err := im.db.Table("sales_transactions").
+	var salesTransactions []salesHistoryRow
+	query := im.db.Table("sales_transactions").
 		Select("sales_transactions.*, products.name as product_name").
 		Joins("JOIN products ON sales_transactions.product_id = products.id").
-		Where("sales_transactions.user_id = ?", userID).
-		Find(&salesTransactions).Error; err != nil {
+		Where("sales_transactions.user_id = ?", userID)
+	if err := list.find(query, &salesTransactions); err != nil {
 		utils.ErrorLogger("Failed to fetch sales history: %v", err)
 		c.JSON(500, gin.H{"error": "Failed to fetch sales history"})
 		return
@@ -328,34 +828,23 @@ func (im *SalesManagementHandler) FetchSalesMetrics(c *gin.Context) {
 	startOfWeek := now.AddDate(0, 0, -int(now.Weekday()))
 	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
 
-	// Get daily revenue
-	var dailyRevenue float64
-	if err := im.db.Model(&models.SalesTransaction{}).
-		Where("user_id = ? AND created_at >= ?", userID, startOfDay).
-		Select("COALESCE(SUM(total_amount), 0)").
-		Scan(&dailyRevenue).Error; err != nil {
+	// Get daily, weekly and monthly revenue together with cost of goods sold
+	daily, err := im.periodTotals(userID, startOfDay)
+	if err != nil {
 		utils.ErrorLogger("Failed to fetch daily revenue: %v", err)
 		c.JSON(500, gin.H{"error": "Failed to fetch sales metrics"})
 		return
 	}
 
-	// Get weekly revenue
-	var weeklyRevenue float64
-	if err := im.db.Model(&models.SalesTransaction{}).
-		Where("user_id = ? AND created_at >= ?", userID, startOfWeek).
-		Select("COALESCE(SUM(total_amount), 0)").
-		Scan(&weeklyRevenue).Error; err != nil {
+	weekly, err := im.periodTotals(userID, startOfWeek)
+	if err != nil {
 		utils.ErrorLogger("Failed to fetch weekly revenue: %v", err)
 		c.JSON(500, gin.H{"error": "Failed to fetch sales metrics"})
 		return
 	}
 
-	// Get monthly revenue
-	var monthlyRevenue float64
-	if err := im.db.Model(&models.SalesTransaction{}).
-		Where("user_id = ? AND created_at >= ?", userID, startOfMonth).
-		Select("COALESCE(SUM(total_amount), 0)").
-		Scan(&monthlyRevenue).Error; err != nil {
+	monthly, err := im.periodTotals(userID, startOfMonth)
+	if err != nil {
 		utils.ErrorLogger("Failed to fetch monthly revenue: %v", err)
 		c.JSON(500, gin.H{"error": "Failed to fetch sales metrics"})
 		return
@@ -370,16 +859,24 @@ func (im *SalesManagementHandler) FetchSalesMetrics(c *gin.Context) {
 	if err := im.db.Model(&models.SalesTransaction{}).
 		Where("user_id = ? AND created_at >= ?", userID, startOfMonth).
 		Select(`
-			COALESCE(SUM(CASE WHEN payment_method = 'cash' THEN total_amount ELSE 0 END), 0) as cash,
-			COALESCE(SUM(CASE WHEN payment_method = 'mpesa' THEN total_amount ELSE 0 END), 0) as mpesa,
-			COALESCE(SUM(CASE WHEN payment_method = 'credit' THEN total_amount ELSE 0 END), 0) as credit
-		`).
+			COALESCE(SUM(CASE WHEN payment_method = ? THEN total_amount ELSE 0 END), 0) as cash,
+			COALESCE(SUM(CASE WHEN payment_method = ? THEN total_amount ELSE 0 END), 0) as mpesa,
+			COALESCE(SUM(CASE WHEN payment_method = ? THEN total_amount ELSE 0 END), 0) as credit
+		`, "CASH", "MPESA", "CREDIT").
 		Scan(&paymentBreakdown).Error; err != nil {
 		utils.ErrorLogger("Failed to fetch payment breakdown: %v", err)
 		c.JSON(500, gin.H{"error": "Failed to fetch sales metrics"})
 		return
 	}
 
+	// Get takings by tender for current month, net of refunds
+	tenders, err := tenderTotals(im.db, userID, startOfMonth)
+	if err != nil {
+		utils.ErrorLogger("Failed to fetch tender breakdown: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to fetch sales metrics"})
+		return
+	}
+
 	// Get top products for current month
 	type TopProduct struct {
 		ProductName string  `json:"product_name"`
@@ -402,10 +899,124 @@ func (im *SalesManagementHandler) FetchSalesMetrics(c *gin.Context) {
 
 	utils.InfoLogger("Successfully fetched sales metrics")
 	c.JSON(200, gin.H{
-		"dailyRevenue":           dailyRevenue,
-		"weeklyRevenue":          weeklyRevenue,
-		"monthlyRevenue":         monthlyRevenue,
+		"dailyRevenue":           daily.Revenue,
+		"weeklyRevenue":          weekly.Revenue,
+		"monthlyRevenue":         monthly.Revenue,
+		"monthlyNetRevenue":      monthly.NetRevenue,
+		"dailyGrossProfit":       roundMoney(daily.NetRevenue - daily.Cost),
+		"weeklyGrossProfit":      roundMoney(weekly.NetRevenue - weekly.Cost),
+		"monthlyGrossProfit":     roundMoney(monthly.NetRevenue - monthly.Cost),
+		"monthlyCost":            monthly.Cost,
+		"monthlyGrossMargin":     grossMarginPercent(monthly.NetRevenue, monthly.Cost),
 		"topProducts":            topProducts,
 		"paymentMethodBreakdown": paymentBreakdown,
+		"tenderBreakdown":        tenders,
 	})
 }
+
+// salesTotals holds revenue and cost of goods sold over a period. Tax
+// collected is not the business's money, so profit is taken on NetRevenue.
+type salesTotals struct {
+	Revenue    float64
+	NetRevenue float64
+	Cost       float64
+}
+
+// periodTotals sums revenue and cost of goods sold for sales made since the given time
+func (im *SalesManagementHandler) periodTotals(userID uint, since time.Time) (salesTotals, error) {
+	var totals salesTotals
+	err := im.db.Model(&models.SalesTransaction{}).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Select("COALESCE(SUM(total_amount), 0) as revenue, COALESCE(SUM(total_amount - tax_amount), 0) as net_revenue, COALESCE(SUM(total_cost), 0) as cost").
+		Scan(&totals).Error
+	return totals, err
+}
+
+// ProductProfitability reports revenue, cost and gross margin per product.
+// Profit and margin are taken on NetRevenue, the revenue less tax.
+type ProductProfitability struct {
+	ProductID    uint    `json:"product_id"`
+	ProductName  string  `json:"product_name"`
+	Category     string  `json:"category"`
+	QuantitySold int     `json:"quantity_sold"`
+	Revenue      float64 `json:"revenue"`
+	NetRevenue   float64 `json:"net_revenue"`
+	Cost         float64 `json:"cost"`
+	GrossProfit  float64 `json:"gross_profit"`
+	GrossMargin  float64 `json:"gross_margin"`
+}
+
+// FetchProductProfitability returns gross profit per product for a date range
+func (im *SalesManagementHandler) FetchProductProfitability(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	start, end, err := parseDateRange(c)
+	if err != nil {
+		utils.WarningLogger("Invalid profitability date range for user %d: %v", userID, err)
+		c.JSON(400, gin.H{"error": "Invalid date range. Use YYYY-MM-DD"})
+		return
+	}
+
+	var report []ProductProfitability
+	if err := im.db.Table("sales_transactions").
+		Select(`products.id as product_id, products.name as product_name, products.category as category,
+			SUM(sales_transactions.quantity) as quantity_sold,
+			SUM(sales_transactions.total_amount) as revenue,
+			SUM(sales_transactions.total_amount - sales_transactions.tax_amount) as net_revenue,
+			SUM(sales_transactions.total_cost) as cost`).
+		Joins("JOIN products ON sales_transactions.product_id = products.id").
+		Where("sales_transactions.user_id = ? AND sales_transactions.created_at >= ? AND sales_transactions.created_at < ?", userID, start, end).
+		Group("products.id, products.name, products.category").
+		Scan(&report).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch product profitability: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to fetch product profitability"})
+		return
+	}
+
+	for i := range report {
+		report[i].GrossProfit = roundMoney(report[i].NetRevenue - report[i].Cost)
+		report[i].GrossMargin = grossMarginPercent(report[i].NetRevenue, report[i].Cost)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].GrossProfit > report[j].GrossProfit
+	})
+
+	utils.InfoLogger("Successfully fetched product profitability for user %d", userID)
+	c.JSON(200, gin.H{
+		"startDate": start.Format("2006-01-02"),
+		"endDate":   end.AddDate(0, 0, -1).Format("2006-01-02"),
+		"products":  report,
+	})
+}
+
+// parseDateRange reads startDate and endDate (YYYY-MM-DD) query params.
+// It defaults to the current month and returns an exclusive end bound.
+func parseDateRange(c *gin.Context) (time.Time, time.Time, error) {
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+
+	if value := c.Query("startDate"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, now.Location())
+		if err != nil {
+			return start, end, err
+		}
+		start = parsed
+	}
+	if value := c.Query("endDate"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, now.Location())
+		if err != nil {
+			return start, end, err
+		}
+		end = parsed.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return start, end, fmt.Errorf("endDate must not be before startDate")
+	}
+	return start, end, nil
+}
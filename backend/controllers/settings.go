@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SettingsHandler struct {
+	db *gorm.DB
+}
+
+func NewSettingsHandler(db *gorm.DB) *SettingsHandler {
+	return &SettingsHandler{db: db}
+}
+
+// loadBusinessSettings returns a business's saved settings, or the defaults
+// when it has not saved any yet
+func loadBusinessSettings(db *gorm.DB, userID uint) (models.BusinessSettings, error) {
+	var settings models.BusinessSettings
+	err := db.Where("user_id = ?", userID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DefaultBusinessSettings(userID), nil
+	}
+	return settings, err
+}
+
+// GetSettings returns the business settings for the authenticated user
+func (sh *SettingsHandler) GetSettings(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	settings, err := loadBusinessSettings(sh.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to fetch settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+
+	c.JSON(200, settings)
+}
+
+// UpdateSettings saves the fields present in the request body
+func (sh *SettingsHandler) UpdateSettings(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input map[string]interface{}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse settings request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	settings, err := loadBusinessSettings(sh.db, userID)
+	if err != nil {
+		utils.ErrorLogger("Failed to fetch settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+
+	if policy, ok := input["negative_stock_policy"].(string); ok {
+		policy = strings.ToUpper(policy)
+		if !models.StockPolicies[policy] {
+			c.JSON(400, gin.H{"error": "Negative stock policy must be BLOCK, ALLOW_NEGATIVE or BACKORDER"})
+			return
+		}
+		settings.NegativeStockPolicy = policy
+	}
+	if registered, ok := input["vat_registered"].(bool); ok {
+		settings.VATRegistered = registered
+	}
+	if rate, ok := input["vat_rate"].(float64); ok {
+		if rate < 0 || rate > 100 {
+			c.JSON(400, gin.H{"error": "VAT rate must be between 0 and 100"})
+			return
+		}
+		settings.VATRate = rate
+	}
+	if require, ok := input["require_register_session"].(bool); ok {
+		settings.RequireRegisterSession = require
+	}
+	if enabled, ok := input["loyalty_enabled"].(bool); ok {
+		settings.LoyaltyEnabled = enabled
+	}
+	if rate, ok := input["points_per_shilling"].(float64); ok {
+		if rate < 0 {
+			c.JSON(400, gin.H{"error": "Points per shilling cannot be negative"})
+			return
+		}
+		settings.PointsPerShilling = rate
+	}
+	if value, ok := input["point_value"].(float64); ok {
+		if value <= 0 {
+			c.JSON(400, gin.H{"error": "Point value must be greater than zero"})
+			return
+		}
+		settings.PointValue = value
+	}
+	if days, ok := input["points_expiry_days"].(float64); ok {
+		if days < 0 || days != float64(int(days)) {
+			c.JSON(400, gin.H{"error": "Points expiry must be a whole number of days, or 0 for never"})
+			return
+		}
+		settings.PointsExpiryDays = int(days)
+	}
+	if percent, ok := input["layaway_deposit_percent"].(float64); ok {
+		if percent < 0 || percent > 100 {
+			c.JSON(400, gin.H{"error": "Layaway deposit must be between 0 and 100 percent"})
+			return
+		}
+		settings.LayawayDepositPercent = percent
+	}
+	if days, ok := input["layaway_days"].(float64); ok {
+		if days < 1 || days != float64(int(days)) {
+			c.JSON(400, gin.H{"error": "Layaway days must be a whole number of at least 1"})
+			return
+		}
+		settings.LayawayDays = int(days)
+	}
+	if timezone, ok := input["timezone"].(string); ok {
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+			c.JSON(400, gin.H{"error": "Timezone must be an IANA zone such as Africa/Nairobi"})
+			return
+		}
+		settings.Timezone = timezone
+	}
+	if pricing, ok := input["tax_pricing"].(string); ok {
+		pricing = strings.ToUpper(pricing)
+		if !models.TaxPricingModes[pricing] {
+			c.JSON(400, gin.H{"error": "Tax pricing must be INCLUSIVE or EXCLUSIVE"})
+			return
+		}
+		settings.TaxPricing = pricing
+	}
+
+	// Inserts replace zeros with the column defaults, so a first save
+	// creates the default row and then saves over it
+	if settings.ID == 0 {
+		saved := models.DefaultBusinessSettings(userID)
+		if err := sh.db.Create(&saved).Error; err != nil {
+			utils.ErrorLogger("Failed to create settings for user %d: %v", userID, err)
+			c.JSON(500, gin.H{"error": "Failed to save settings"})
+			return
+		}
+		settings.ID, settings.CreatedAt = saved.ID, saved.CreatedAt
+	}
+	if err := sh.db.Save(&settings).Error; err != nil {
+		utils.ErrorLogger("Failed to save settings for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to save settings"})
+		return
+	}
+
+	utils.InfoLogger("Updated settings for user %d", userID)
+	c.JSON(200, settings)
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type StaffHandler struct {
+	db *gorm.DB
+}
+
+func NewStaffHandler(db *gorm.DB) *StaffHandler {
+	return &StaffHandler{db: db}
+}
+
+// StaffRequest creates a staff login for the business
+type StaffRequest struct {
+	FullName string `json:"full_name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// staffRole checks a role can be given to staff. There is one owner, the
+// business itself.
+func staffRole(role string) (string, bool) {
+	role = strings.ToUpper(strings.TrimSpace(role))
+	return role, role == models.RoleManager || role == models.RoleCashier
+}
+
+// staffView is a staff login without its password
+func staffView(user models.User) gin.H {
+	return gin.H{
+		"id":        user.ID,
+		"full_name": user.FullName,
+		"email":     user.Email,
+		"role":      user.Role,
+		"createdAt": user.CreatedAt,
+	}
+}
+
+// canManageStaff answers the request itself unless the login may manage staff
+func (sh *StaffHandler) canManageStaff(c *gin.Context, userID uint) bool {
+	staffID := actingUser(c)
+	allowed, err := hasPermission(sh.db, userID, staffID, models.PermissionManageStaff)
+	if err != nil {
+		utils.ErrorLogger("Failed to check staff permission for user %d: %v", staffID, err)
+		c.JSON(500, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !allowed {
+		utils.WarningLogger("User %d attempted to manage staff without permission", staffID)
+		c.JSON(403, gin.H{"error": "Only the owner can manage staff"})
+		return false
+	}
+	return true
+}
+
+// CreateStaff adds a login for a manager or cashier of the business
+func (sh *StaffHandler) CreateStaff(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if !sh.canManageStaff(c, userID) {
+		return
+	}
+
+	var input StaffRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse staff request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	input.FullName = strings.TrimSpace(input.FullName)
+	input.Email = strings.TrimSpace(input.Email)
+	if input.FullName == "" || input.Email == "" || input.Password == "" {
+		c.JSON(400, gin.H{"error": "Full name, email and password are required"})
+		return
+	}
+	role, ok := staffRole(input.Role)
+	if !ok {
+		c.JSON(400, gin.H{"error": "Role must be MANAGER or CASHIER"})
+		return
+	}
+
+	var owner models.User
+	if err := sh.db.Where("id = ?", userID).First(&owner).Error; err != nil {
+		utils.ErrorLogger("Failed to load business %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to create staff login"})
+		return
+	}
+	var existing int64
+	if err := sh.db.Model(&models.User{}).Where("email = ?", input.Email).Count(&existing).Error; err != nil {
+		utils.ErrorLogger("Failed to check email %s: %v", input.Email, err)
+		c.JSON(500, gin.H{"error": "Failed to create staff login"})
+		return
+	}
+	if existing > 0 {
+		c.JSON(409, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		utils.ErrorLogger("Error hashing staff password: %v", err)
+		c.JSON(500, gin.H{"error": "Error hashing password"})
+		return
+	}
+	staff := models.User{
+		FullName:     input.FullName,
+		Email:        input.Email,
+		Password:     string(hashedPassword),
+		BusinessName: owner.BusinessName,
+		Telephone:    owner.Telephone,
+		Location:     owner.Location,
+		Role:         role,
+		BusinessID:   &userID,
+	}
+	if err := sh.db.Create(&staff).Error; err != nil {
+		utils.ErrorLogger("Failed to create staff login for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to create staff login"})
+		return
+	}
+
+	utils.InfoLogger("User %d added %s %s", userID, role, staff.Email)
+	c.JSON(201, staffView(staff))
+}
+
+// GetStaff lists the business's staff logins
+func (sh *StaffHandler) GetStaff(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if !sh.canManageStaff(c, userID) {
+		return
+	}
+
+	var staff []models.User
+	if err := sh.db.Where("business_id = ?", userID).Order("full_name").Find(&staff).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch staff for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch staff"})
+		return
+	}
+	views := make([]gin.H, 0, len(staff))
+	for _, user := range staff {
+		views = append(views, staffView(user))
+	}
+
+	c.JSON(200, views)
+}
+
+// UpdateStaffRole changes what a staff login may do. It applies to the
+// login's next request.
+func (sh *StaffHandler) UpdateStaffRole(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if !sh.canManageStaff(c, userID) {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse staff role: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+	role, ok := staffRole(input.Role)
+	if !ok {
+		c.JSON(400, gin.H{"error": "Role must be MANAGER or CASHIER"})
+		return
+	}
+
+	var staff models.User
+	err := sh.db.Where("id = ? AND business_id = ?", c.Param("id"), userID).First(&staff).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "Staff login not found"})
+		return
+	}
+	if err != nil {
+		utils.ErrorLogger("Failed to load staff %s: %v", c.Param("id"), err)
+		c.JSON(500, gin.H{"error": "Failed to update staff role"})
+		return
+	}
+	if err := sh.db.Model(&staff).Update("role", role).Error; err != nil {
+		utils.ErrorLogger("Failed to update role of staff %d: %v", staff.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to update staff role"})
+		return
+	}
+	staff.Role = role
+
+	utils.InfoLogger("User %d made staff %d a %s", userID, staff.ID, role)
+	c.JSON(200, staffView(staff))
+}
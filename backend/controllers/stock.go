@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"gorm.io/gorm"
+)
+
+// errInsufficientStock is returned when a decrement would take stock below zero
+var errInsufficientStock = errors.New("insufficient stock")
+
+// changeStock adds delta (negative to remove) to a product's inventory inside tx.
+// The change is a single conditional UPDATE, so concurrent decrements can never
+// take stock below zero: the losing till sees errInsufficientStock instead of
+// overwriting the winner's row. It returns the inventory row after the change,
+// or gorm.ErrRecordNotFound when the product has no inventory record.
+func changeStock(tx *gorm.DB, userID, productID uint, delta int) (models.Inventory, error) {
+	return updateStock(tx, userID, productID, delta, true)
+}
+
+// forceChangeStock applies delta without the stock guard, letting stock go
+// negative. It is only used when the negative stock policy allows it.
+func forceChangeStock(tx *gorm.DB, userID, productID uint, delta int) (models.Inventory, error) {
+	return updateStock(tx, userID, productID, delta, false)
+}
+
+func updateStock(tx *gorm.DB, userID, productID uint, delta int, guard bool) (models.Inventory, error) {
+	var inventory models.Inventory
+
+	query := tx.Model(&models.Inventory{}).Where("product_id = ? AND user_id = ?", productID, userID)
+	if guard && delta < 0 {
+		query = query.Where("quantity >= ?", -delta)
+	}
+	result := query.Updates(map[string]interface{}{
+		"quantity":     gorm.Expr("quantity + ?", delta),
+		"last_updated": time.Now(),
+	})
+	if result.Error != nil {
+		return inventory, result.Error
+	}
+
+	if err := tx.Where("product_id = ? AND user_id = ?", productID, userID).First(&inventory).Error; err != nil {
+		return inventory, err
+	}
+	if result.RowsAffected == 0 {
+		return inventory, errInsufficientStock
+	}
+	return inventory, nil
+}
@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// updateChangeType validates the change_type sent with a product update.
+// Product updates may only receive purchases or plain adjustments; write-offs
+// go through the stock adjustment endpoint so they carry a reason code.
+func updateChangeType(value interface{}, quantityChange int) (string, error) {
+	changeType, _ := value.(string)
+	changeType = strings.ToUpper(strings.TrimSpace(changeType))
+	if changeType == "" {
+		if quantityChange > 0 {
+			return models.MovementPurchase, nil
+		}
+		return models.MovementAdjustment, nil
+	}
+
+	switch changeType {
+	case models.MovementPurchase:
+		if quantityChange <= 0 {
+			return "", errors.New("Purchases must increase stock")
+		}
+		return changeType, nil
+	case models.MovementAdjustment:
+		return changeType, nil
+	}
+	if models.MovementTypes[changeType] {
+		return "", fmt.Errorf("Change type %s cannot be set on a product update", changeType)
+	}
+	return "", fmt.Errorf("Unknown change type %s", changeType)
+}
+
+// GetStockReasons returns the reason codes accepted by the stock adjustment endpoint
+func (im *InventoryManagementHandler) GetStockReasons(c *gin.Context) {
+	reasons := make([]models.StockReason, 0, len(models.StockReasons))
+	for _, reason := range models.StockReasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool { return reasons[i].Code < reasons[j].Code })
+	c.JSON(200, reasons)
+}
+
+// AdjustStock writes stock off (or back on) with a reason code
+func (im *InventoryManagementHandler) AdjustStock(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input struct {
+		ReasonCode string `json:"reason_code" binding:"required"`
+		Quantity   int    `json:"quantity" binding:"required"`
+		Note       string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ErrorLogger("Failed to parse stock adjustment request: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	reason, ok := models.StockReasons[strings.ToUpper(input.ReasonCode)]
+	if !ok {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Unknown reason code %s", input.ReasonCode)})
+		return
+	}
+	if input.Quantity <= 0 {
+		c.JSON(400, gin.H{"error": "Quantity must be greater than 0"})
+		return
+	}
+
+	tx := im.Db.Begin()
+	if tx.Error != nil {
+		utils.ErrorLogger("Failed to start transaction: %v", tx.Error)
+		c.JSON(500, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var product models.Product
+	if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&product).Error; err != nil {
+		tx.Rollback()
+		c.JSON(404, gin.H{"error": "Product not found"})
+		return
+	}
+	if product.IsBundle {
+		tx.Rollback()
+		c.JSON(400, gin.H{"error": "Bundle stock is derived from its components. Adjust the components instead"})
+		return
+	}
+
+	delta := reason.Direction * input.Quantity
+	inventory, err := changeStock(tx, userID, product.ID, delta)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		c.JSON(404, gin.H{"error": "Product not found in inventory"})
+		return
+	}
+	if errors.Is(err, errInsufficientStock) {
+		tx.Rollback()
+		utils.WarningLogger("Write-off of %d exceeds stock %d for product %d", input.Quantity, inventory.Quantity, product.ID)
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Cannot remove %d units, only %d in stock", input.Quantity, inventory.Quantity)})
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to update inventory for product %d: %v", product.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to update inventory"})
+		return
+	}
+
+	// Adjustments move stock at the average cost. Found stock has no purchase
+	// price of its own, so valuing it at the average leaves the average as is.
+	movement := models.StockMovement{
+		UserID:         userID,
+		ProductID:      product.ID,
+		ChangeType:     reason.ChangeType,
+		ReasonCode:     reason.Code,
+		QuantityChange: delta,
+		UnitCost:       product.AverageCost,
+		Note:           input.Note,
+		CreatedAt:      time.Now(),
+	}
+	if err := tx.Create(&movement).Error; err != nil {
+		tx.Rollback()
+		utils.ErrorLogger("Failed to create stock movement for product %d: %v", product.ID, err)
+		c.JSON(500, gin.H{"error": "Failed to record stock movement"})
+		return
+	}
+
+	// Stock found again goes to open backorders first
+	if delta > 0 {
+		if _, err := fulfilBackorders(tx, userID, product.ID, product.AverageCost); err != nil {
+			tx.Rollback()
+			utils.ErrorLogger("Failed to fulfil backorders for product %d: %v", product.ID, err)
+			c.JSON(500, gin.H{"error": "Failed to fulfil backorders"})
+			return
+		}
+		if err := tx.Where("product_id = ? AND user_id = ?", product.ID, userID).First(&inventory).Error; err != nil {
+			tx.Rollback()
+			c.JSON(500, gin.H{"error": "Failed to update inventory"})
+			return
+		}
+	}
+
+	if inventory.Quantity <= inventory.LowStockThreshold {
+		alert := models.LowStockAlert{
+			UserID:    userID,
+			ProductID: product.ID,
+			AlertMessage: fmt.Sprintf("Low stock alert for %s: Current quantity (%d) is at or below threshold (%d)",
+				product.Name, inventory.Quantity, inventory.LowStockThreshold),
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(&alert).Error; err != nil {
+			utils.ErrorLogger("Failed to create low stock alert for product %d: %v", product.ID, err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		utils.ErrorLogger("Failed to commit stock adjustment: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to adjust stock"})
+		return
+	}
+
+	utils.InfoLogger("Adjusted stock of product %d by %d (%s) for user %d", product.ID, delta, reason.Code, userID)
+	c.JSON(200, gin.H{
+		"success":  true,
+		"movement": movement,
+		"quantity": inventory.Quantity,
+	})
+}
+
+// shrinkageLine aggregates reason-coded stock movements
+type shrinkageLine struct {
+	ReasonCode string  `json:"reason_code"`
+	Label      string  `json:"label"`
+	Movements  int     `json:"movements"`
+	Quantity   int     `json:"quantity"`
+	Value      float64 `json:"value"`
+}
+
+// GetShrinkageReport totals write-offs by reason and by month, valued at cost.
+// Losses are positive; stock found again is negative and reduces shrinkage.
+func (im *InventoryManagementHandler) GetShrinkageReport(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	start, end, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid date range. Use YYYY-MM-DD"})
+		return
+	}
+
+	var movements []models.StockMovement
+	if err := im.Db.Where("user_id = ? AND reason_code <> '' AND created_at >= ? AND created_at < ?", userID, start, end).
+		Order("created_at").
+		Find(&movements).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch stock adjustments for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch shrinkage report"})
+		return
+	}
+
+	byReason := make(map[string]*shrinkageLine)
+	byPeriod := make(map[string]map[string]*shrinkageLine)
+	var totalQuantity int
+	var totalValue float64
+	for _, movement := range movements {
+		reason, ok := models.StockReasons[movement.ReasonCode]
+		if !ok {
+			continue
+		}
+		lost := -movement.QuantityChange
+		value := roundMoney(float64(lost) * movement.UnitCost)
+
+		period := movement.CreatedAt.Format("2006-01")
+		if byPeriod[period] == nil {
+			byPeriod[period] = make(map[string]*shrinkageLine)
+		}
+		for _, bucket := range []map[string]*shrinkageLine{byReason, byPeriod[period]} {
+			line := bucket[reason.Code]
+			if line == nil {
+				line = &shrinkageLine{ReasonCode: reason.Code, Label: reason.Label}
+				bucket[reason.Code] = line
+			}
+			line.Movements++
+			line.Quantity += lost
+			line.Value = roundMoney(line.Value + value)
+		}
+
+		if reason.Shrinkage {
+			totalQuantity += lost
+			totalValue = roundMoney(totalValue + value)
+		}
+	}
+
+	periods := make([]gin.H, 0, len(byPeriod))
+	for period, lines := range byPeriod {
+		periods = append(periods, gin.H{"period": period, "reasons": sortedShrinkageLines(lines)})
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i]["period"].(string) < periods[j]["period"].(string)
+	})
+
+	c.JSON(200, gin.H{
+		"startDate":         start.Format("2006-01-02"),
+		"endDate":           end.AddDate(0, 0, -1).Format("2006-01-02"),
+		"byReason":          sortedShrinkageLines(byReason),
+		"byPeriod":          periods,
+		"shrinkageQuantity": totalQuantity,
+		"shrinkageValue":    totalValue,
+	})
+}
+
+func sortedShrinkageLines(lines map[string]*shrinkageLine) []shrinkageLine {
+	result := make([]shrinkageLine, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, *line)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Value > result[j].Value })
+	return result
+}
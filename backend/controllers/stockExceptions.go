@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// stockTake is the outcome of removing stock for a sale under a stock policy
+type stockTake struct {
+	Inventory models.Inventory
+	Taken     int
+	Exception *models.StockException
+}
+
+// effectiveStockPolicy returns the product's own policy or the business default
+func effectiveStockPolicy(productPolicy string, settings models.BusinessSettings) string {
+	if models.StockPolicies[productPolicy] {
+		return productPolicy
+	}
+	if models.StockPolicies[settings.NegativeStockPolicy] {
+		return settings.NegativeStockPolicy
+	}
+	return models.StockPolicyBlock
+}
+
+// takeStockForSale removes quantity units of a product for a sale. When stock
+// runs short, BLOCK fails with errInsufficientStock, ALLOW_NEGATIVE takes
+// stock below zero and BACKORDER takes what is there and backorders the rest.
+// Both of the latter return an exception to be recorded against the receipt.
+func takeStockForSale(tx *gorm.DB, userID, productID uint, quantity int, policy string) (stockTake, error) {
+	inventory, err := changeStock(tx, userID, productID, -quantity)
+	if err == nil {
+		return stockTake{Inventory: inventory, Taken: quantity}, nil
+	}
+	if !errors.Is(err, errInsufficientStock) || policy == models.StockPolicyBlock {
+		return stockTake{Inventory: inventory}, err
+	}
+
+	if policy == models.StockPolicyAllowNegative {
+		onHand := inventory.Quantity
+		inventory, err = forceChangeStock(tx, userID, productID, -quantity)
+		if err != nil {
+			return stockTake{Inventory: inventory}, err
+		}
+		if onHand < 0 {
+			onHand = 0
+		}
+		return stockTake{
+			Inventory: inventory,
+			Taken:     quantity,
+			Exception: &models.StockException{
+				UserID:            userID,
+				ProductID:         productID,
+				Type:              models.StockExceptionNegative,
+				QuantityRequested: quantity,
+				QuantityShort:     quantity - onHand,
+				StockAfter:        inventory.Quantity,
+				Status:            models.StockExceptionOpen,
+			},
+		}, nil
+	}
+
+	// Backorder: take whatever is on hand, retrying if another till got there first
+	taken := 0
+	for attempt := 0; attempt < 3; attempt++ {
+		available := inventory.Quantity
+		if available > quantity {
+			available = quantity
+		}
+		if available <= 0 {
+			break
+		}
+		inventory, err = changeStock(tx, userID, productID, -available)
+		if err == nil {
+			taken = available
+			break
+		}
+		if !errors.Is(err, errInsufficientStock) {
+			return stockTake{Inventory: inventory}, err
+		}
+	}
+
+	short := quantity - taken
+	return stockTake{
+		Inventory: inventory,
+		Taken:     taken,
+		Exception: &models.StockException{
+			UserID:              userID,
+			ProductID:           productID,
+			Type:                models.StockExceptionBackorder,
+			QuantityRequested:   quantity,
+			QuantityShort:       short,
+			QuantityOutstanding: short,
+			StockAfter:          inventory.Quantity,
+			Status:              models.StockExceptionOpen,
+		},
+	}, nil
+}
+
+// stockExceptionWarning describes an exception for the cashier
+func stockExceptionWarning(exception models.StockException) string {
+	if exception.Type == models.StockExceptionBackorder {
+		return fmt.Sprintf("Product %d: %d units backordered", exception.ProductID, exception.QuantityShort)
+	}
+	return fmt.Sprintf("Product %d: sold %d units more than in stock, stock is now %d", exception.ProductID, exception.QuantityShort, exception.StockAfter)
+}
+
+// fulfilBackorders hands newly received stock to open backorders for a
+// product, oldest first, and returns the number of units fulfilled.
+func fulfilBackorders(tx *gorm.DB, userID, productID uint, unitCost float64) (int, error) {
+	var backorders []models.StockException
+	if err := tx.Where("user_id = ? AND product_id = ? AND type = ? AND status = ?",
+		userID, productID, models.StockExceptionBackorder, models.StockExceptionOpen).
+		Order("created_at ASC, id ASC").
+		Find(&backorders).Error; err != nil {
+		return 0, err
+	}
+
+	fulfilled := 0
+	for _, backorder := range backorders {
+		var inventory models.Inventory
+		if err := tx.Where("product_id = ? AND user_id = ?", productID, userID).First(&inventory).Error; err != nil {
+			return fulfilled, err
+		}
+		take := backorder.QuantityOutstanding
+		if inventory.Quantity < take {
+			take = inventory.Quantity
+		}
+		if take <= 0 {
+			break
+		}
+
+		if _, err := changeStock(tx, userID, productID, -take); err != nil {
+			if errors.Is(err, errInsufficientStock) {
+				break
+			}
+			return fulfilled, err
+		}
+
+		movement := models.StockMovement{
+			UserID:         userID,
+			ProductID:      productID,
+			ChangeType:     models.MovementSale,
+			QuantityChange: -take,
+			UnitCost:       unitCost,
+			Note:           fmt.Sprintf("Backorder fulfilled for receipt %d", backorder.ReceiptID),
+			CreatedAt:      time.Now(),
+		}
+		if err := tx.Create(&movement).Error; err != nil {
+			return fulfilled, err
+		}
+
+		updates := map[string]interface{}{"quantity_outstanding": backorder.QuantityOutstanding - take}
+		if take == backorder.QuantityOutstanding {
+			updates["status"] = models.StockExceptionResolved
+			updates["resolved_at"] = time.Now()
+		}
+		if err := tx.Model(&backorder).Updates(updates).Error; err != nil {
+			return fulfilled, err
+		}
+		fulfilled += take
+	}
+
+	return fulfilled, nil
+}
+
+// stockExceptionRow is a stock exception with its product and receipt
+type stockExceptionRow struct {
+	models.StockException
+	ProductName   string `json:"product_name"`
+	ReceiptNumber string `json:"receipt_number"`
+}
+
+var stockExceptionListSpec = listSpec[stockExceptionRow]{
+	id: listField[stockExceptionRow]{column: "stock_exceptions.id", kind: listNumber, value: func(r stockExceptionRow) any { return r.ID }},
+	fields: map[string]listField[stockExceptionRow]{
+		"product_id":     {column: "stock_exceptions.product_id", kind: listNumber, value: func(r stockExceptionRow) any { return r.ProductID }},
+		"product_name":   {column: "products.name", kind: listText, value: func(r stockExceptionRow) any { return r.ProductName }},
+		"receipt_number": {column: "receipts.receipt_number", kind: listText},
+		"quantity_short": {column: "stock_exceptions.quantity_short", kind: listNumber, value: func(r stockExceptionRow) any { return r.QuantityShort }},
+		"created_at":     {column: "stock_exceptions.created_at", kind: listTime, value: func(r stockExceptionRow) any { return r.CreatedAt }},
+	},
+	defaultSort: "-created_at",
+	params:      []string{"status", "type", "startDate", "endDate"},
+}
+
+// GetStockExceptions lists sales made under the allow-negative or backorder policies
+func (im *InventoryManagementHandler) GetStockExceptions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	list, err := parseListQuery(c, stockExceptionListSpec)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exceptions []stockExceptionRow
+	query := im.Db.Table("stock_exceptions").
+		Select("stock_exceptions.*, products.name as product_name, receipts.receipt_number as receipt_number").
+		Joins("JOIN products ON stock_exceptions.product_id = products.id").
+		Joins("LEFT JOIN receipts ON stock_exceptions.receipt_id = receipts.id").
+		Where("stock_exceptions.user_id = ?", userID)
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("stock_exceptions.status = ?", status)
+	}
+	if exceptionType := c.Query("type"); exceptionType != "" {
+		query = query.Where("stock_exceptions.type = ?", exceptionType)
+	}
+	if c.Query("startDate") != "" || c.Query("endDate") != "" {
+		start, end, err := parseDateRange(c)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid date range. Use YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("stock_exceptions.created_at >= ? AND stock_exceptions.created_at < ?", start, end)
+	}
+
+	if err := list.find(query, &exceptions); err != nil {
+		utils.ErrorLogger("Failed to fetch stock exceptions for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch stock exceptions"})
+		return
+	}
+
+	c.JSON(200, exceptions)
+}
+
+// ResolveStockException marks an exception as dealt with once the stock count has been fixed
+func (im *InventoryManagementHandler) ResolveStockException(c *gin.Context) {
+	id := c.Param("id")
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&input)
+
+	result := im.Db.Model(&models.StockException{}).
+		Where("id = ? AND user_id = ? AND status = ?", id, userID, models.StockExceptionOpen).
+		Updates(map[string]interface{}{
+			"status":               models.StockExceptionResolved,
+			"quantity_outstanding": 0,
+			"note":                 input.Note,
+			"resolved_at":          time.Now(),
+		})
+	if result.Error != nil {
+		utils.ErrorLogger("Failed to resolve stock exception %s: %v", id, result.Error)
+		c.JSON(500, gin.H{"error": "Failed to resolve stock exception"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "Open stock exception not found"})
+		return
+	}
+
+	utils.InfoLogger("Resolved stock exception %s for user %d", id, userID)
+	c.JSON(200, gin.H{"message": "Stock exception resolved"})
+}
+
+// cancelBackorders drops up to quantity outstanding backordered units of a
+// product sold on a receipt, for when the sale is returned before they
+// arrive. It returns how many of the units had actually been handed over.
+func cancelBackorders(tx *gorm.DB, userID, receiptID, productID uint, quantity int) (int, error) {
+	var backorders []models.StockException
+	if err := tx.Where("user_id = ? AND receipt_id = ? AND product_id = ? AND type = ? AND status = ?",
+		userID, receiptID, productID, models.StockExceptionBackorder, models.StockExceptionOpen).
+		Find(&backorders).Error; err != nil {
+		return quantity, err
+	}
+
+	for _, backorder := range backorders {
+		cancel := backorder.QuantityOutstanding
+		if cancel > quantity {
+			cancel = quantity
+		}
+		if cancel <= 0 {
+			break
+		}
+
+		updates := map[string]interface{}{"quantity_outstanding": backorder.QuantityOutstanding - cancel}
+		if cancel == backorder.QuantityOutstanding {
+			updates["status"] = models.StockExceptionResolved
+			updates["resolved_at"] = time.Now()
+		}
+		if err := tx.Model(&backorder).Updates(updates).Error; err != nil {
+			return quantity, err
+		}
+		quantity -= cancel
+	}
+
+	return quantity, nil
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"sort"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// lineTaxResult splits a sale line into its taxable value and VAT
+type lineTaxResult struct {
+	Class   string
+	Rate    float64
+	Taxable float64
+	Tax     float64
+	Total   float64
+}
+
+// taxRate is the VAT rate a business charges on a tax class
+func taxRate(settings models.BusinessSettings, class string) float64 {
+	if !settings.VATRegistered || class != models.TaxStandard {
+		return 0
+	}
+	return settings.VATRate
+}
+
+// lineTax works out the VAT on a line amount. Under tax-inclusive pricing
+// the amount already contains the VAT; under exclusive pricing VAT is added.
+func lineTax(settings models.BusinessSettings, class string, amount float64) lineTaxResult {
+	if !models.TaxClasses[class] {
+		class = models.TaxStandard
+	}
+	rate := taxRate(settings, class)
+	result := lineTaxResult{Class: class, Rate: rate}
+
+	if settings.TaxPricing == models.TaxExclusive {
+		result.Taxable = roundMoney(amount)
+		result.Tax = roundMoney(amount * rate / 100)
+	} else {
+		result.Tax = roundMoney(amount * rate / (100 + rate))
+		result.Taxable = roundMoney(amount - result.Tax)
+	}
+	result.Total = roundMoney(result.Taxable + result.Tax)
+	return result
+}
+
+// agreedLineTax splits a tax-inclusive total agreed before the sale at the
+// rate in force at the sale, so the customer pays what was agreed even when
+// the VAT settings have changed since
+func agreedLineTax(settings models.BusinessSettings, class string, total float64) lineTaxResult {
+	if !models.TaxClasses[class] {
+		class = models.TaxStandard
+	}
+	rate := taxRate(settings, class)
+	result := lineTaxResult{Class: class, Rate: rate, Total: roundMoney(total)}
+	result.Tax = roundMoney(total * rate / (100 + rate))
+	result.Taxable = roundMoney(result.Total - result.Tax)
+	return result
+}
+
+// vatSummaryLine totals sales for one tax class
+type vatSummaryLine struct {
+	TaxClass      string  `json:"tax_class"`
+	TaxRate       float64 `json:"tax_rate"`
+	Transactions  int     `json:"transactions"`
+	TaxableAmount float64 `json:"taxable_amount"`
+	TaxAmount     float64 `json:"tax_amount"`
+	GrossAmount   float64 `json:"gross_amount"`
+}
+
+// FetchVATSummary totals output VAT by tax class for a filing period.
+// Returns and voids are included as negative sales so they reduce the VAT due.
+func (im *SalesManagementHandler) FetchVATSummary(c *gin.Context) {
+	userID := c.GetUint("userID")
+	if userID == 0 {
+		utils.ErrorLogger("User not authenticated")
+		c.JSON(401, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	start, end, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid date range. Use YYYY-MM-DD"})
+		return
+	}
+
+	var lines []vatSummaryLine
+	if err := im.db.Model(&models.SalesTransaction{}).
+		Select("COALESCE(tax_class, '') as tax_class, tax_rate, COUNT(*) as transactions, "+
+			"COALESCE(SUM(taxable_amount), 0) as taxable_amount, COALESCE(SUM(tax_amount), 0) as tax_amount, "+
+			"COALESCE(SUM(total_amount), 0) as gross_amount").
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, start, end).
+		Group("tax_class, tax_rate").
+		Scan(&lines).Error; err != nil {
+		utils.ErrorLogger("Failed to fetch VAT summary for user %d: %v", userID, err)
+		c.JSON(500, gin.H{"error": "Failed to fetch VAT summary"})
+		return
+	}
+
+	var taxable, tax, gross float64
+	for i := range lines {
+		// Sales recorded before tax was tracked have no class
+		if lines[i].TaxClass == "" {
+			lines[i].TaxClass = "UNCLASSIFIED"
+			lines[i].TaxableAmount = lines[i].GrossAmount
+		}
+		lines[i].TaxableAmount = roundMoney(lines[i].TaxableAmount)
+		lines[i].TaxAmount = roundMoney(lines[i].TaxAmount)
+		lines[i].GrossAmount = roundMoney(lines[i].GrossAmount)
+		taxable += lines[i].TaxableAmount
+		tax += lines[i].TaxAmount
+		gross += lines[i].GrossAmount
+	}
+	order := map[string]int{models.TaxStandard: 0, models.TaxZeroRated: 1, models.TaxExempt: 2}
+	sort.Slice(lines, func(i, j int) bool {
+		oi, ok := order[lines[i].TaxClass]
+		if !ok {
+			oi = len(order)
+		}
+		oj, ok := order[lines[j].TaxClass]
+		if !ok {
+			oj = len(order)
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		return lines[i].TaxRate > lines[j].TaxRate
+	})
+
+	c.JSON(200, gin.H{
+		"startDate":     start.Format("2006-01-02"),
+		"endDate":       end.AddDate(0, 0, -1).Format("2006-01-02"),
+		"byTaxClass":    lines,
+		"taxableAmount": roundMoney(taxable),
+		"outputVAT":     roundMoney(tax),
+		"grossAmount":   roundMoney(gross),
+	})
+}
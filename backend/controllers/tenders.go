@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"gorm.io/gorm"
+)
+
+// TenderRequest is one way the customer pays for a sale. For cash, Amount is
+// what was handed over and change is worked out. For credit, Amount may be
+// left out and the credit takes whatever the other tenders leave unpaid.
+type TenderRequest struct {
+	Method    string  `json:"method" binding:"required"`
+	Amount    float64 `json:"amount"`
+	Reference string  `json:"reference"`
+	// rest marks tenders built from the single payment method fields, which
+	// pay whatever is left rather than a stated amount
+	rest bool
+}
+
+// saleTenders returns the tenders for a sale, building them from the single
+// payment method fields for clients that do not send a payments list.
+func saleTenders(saleData SaleData) []TenderRequest {
+	if len(saleData.Payments) > 0 {
+		return saleData.Payments
+	}
+
+	method := strings.ToUpper(saleData.PaymentMethod)
+	switch method {
+	case "CREDIT":
+		var tenders []TenderRequest
+		if saleData.AmountPaid > 0 {
+			tenders = append(tenders, TenderRequest{Method: "CASH", Amount: saleData.AmountPaid})
+		}
+		return append(tenders, TenderRequest{Method: "CREDIT"})
+	case "CASH":
+		return []TenderRequest{{Method: method, Amount: saleData.AmountPaid, rest: true}}
+	}
+	return []TenderRequest{{Method: method, Reference: saleData.ReferenceNumber, rest: true}}
+}
+
+// validateTenders checks tenders before any stock is taken
+func validateTenders(tenders []TenderRequest) error {
+	credits := 0
+	for i := range tenders {
+		tender := &tenders[i]
+		tender.Method = strings.ToUpper(tender.Method)
+		if !models.PaymentMethods[tender.Method] {
+			return fmt.Errorf("Unknown payment method %s", tender.Method)
+		}
+		if tender.Amount < 0 {
+			return fmt.Errorf("%s amount cannot be negative", tender.Method)
+		}
+		switch tender.Method {
+		case "CREDIT":
+			credits++
+		case "MPESA":
+			if !tender.rest && tender.Reference == "" {
+				return errors.New("M-Pesa payments need the transaction reference")
+			}
+		}
+		if !tender.rest && tender.Method != "CREDIT" && tender.Amount == 0 {
+			return fmt.Errorf("%s amount is required", tender.Method)
+		}
+	}
+	if credits > 1 {
+		return errors.New("Only one credit tender is allowed")
+	}
+	return nil
+}
+
+// tendersHaveCredit reports whether part of a sale goes on credit
+func tendersHaveCredit(tenders []TenderRequest) bool {
+	for _, tender := range tenders {
+		if strings.ToUpper(tender.Method) == "CREDIT" {
+			return true
+		}
+	}
+	return false
+}
+
+// settleTenders applies tenders to a receipt total. M-Pesa, points and
+// layaway deposits are applied first and may not overpay; cash covers what is left and any
+// excess is change; credit takes the remainder. It returns the payments to
+// record, the change due and the credited amount.
+func settleTenders(tenders []TenderRequest, total float64) ([]models.ReceiptPayment, float64, float64, error) {
+	total = roundMoney(total)
+	due := total
+	var payments []models.ReceiptPayment
+
+	for _, tender := range tenders {
+		if tender.Method != "MPESA" && tender.Method != "POINTS" && tender.Method != models.PaymentLayaway {
+			continue
+		}
+		amount := tender.Amount
+		if tender.rest {
+			amount = due
+		}
+		if amount > due+0.005 {
+			label := "M-Pesa"
+			switch tender.Method {
+			case "POINTS":
+				label = "Points"
+			case models.PaymentLayaway:
+				label = "Layaway deposits"
+			}
+			return nil, 0, 0, fmt.Errorf("%s payments of %.2f exceed the %.2f due", label, amount, due)
+		}
+		due = roundMoney(due - amount)
+		payments = append(payments, models.ReceiptPayment{Method: tender.Method, Amount: roundMoney(amount), Tendered: roundMoney(amount), Reference: tender.Reference})
+	}
+
+	var change float64
+	for _, tender := range tenders {
+		if tender.Method != "CASH" {
+			continue
+		}
+		tendered := tender.Amount
+		if tender.rest && tendered < due {
+			tendered = due
+		}
+		applied := math.Min(tendered, due)
+		due = roundMoney(due - applied)
+		change = roundMoney(change + tendered - applied)
+		payments = append(payments, models.ReceiptPayment{Method: tender.Method, Amount: roundMoney(applied), Tendered: roundMoney(tendered), ChangeGiven: roundMoney(tendered - applied), Reference: tender.Reference})
+	}
+
+	var credit float64
+	for _, tender := range tenders {
+		if tender.Method != "CREDIT" {
+			continue
+		}
+		if due <= 0 {
+			return nil, 0, 0, errors.New("Nothing is left to put on credit")
+		}
+		if tender.Amount > 0 && math.Abs(tender.Amount-due) > 0.005 {
+			return nil, 0, 0, fmt.Errorf("Credit must cover the remaining %.2f, got %.2f", due, tender.Amount)
+		}
+		credit = due
+		due = 0
+		payments = append(payments, models.ReceiptPayment{Method: tender.Method, Amount: credit, Reference: tender.Reference})
+	}
+
+	if due > 0.005 {
+		return nil, 0, 0, fmt.Errorf("Payments are %.2f short of the %.2f total", due, total)
+	}
+	return payments, change, credit, nil
+}
+
+// salePaymentMethod is the single tender used, or SPLIT
+func salePaymentMethod(tenders []TenderRequest) string {
+	if len(tenders) == 1 {
+		return strings.ToUpper(tenders[0].Method)
+	}
+	return models.PaymentSplit
+}
+
+// tenderTotal is what one tender took over a period
+type tenderTotal struct {
+	Method       string  `json:"method"`
+	Transactions int     `json:"transactions"`
+	Amount       float64 `json:"amount"`
+	ChangeGiven  float64 `json:"change"`
+	Refunds      float64 `json:"refunds"`
+	Net          float64 `json:"net"`
+}
+
+// tenderScope narrows the receipt payments, refunds and layaway deposits
+// summed by sumTenders, to a period or to one register session
+type tenderScope struct {
+	payments func(*gorm.DB) *gorm.DB
+	refunds  func(*gorm.DB) *gorm.DB
+	deposits func(*gorm.DB) *gorm.DB
+}
+
+// periodTenders scopes tender totals to a user's takings since a time
+func periodTenders(userID uint, since time.Time) tenderScope {
+	scope := func(table string) func(*gorm.DB) *gorm.DB {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where(table+".user_id = ? AND "+table+".created_at >= ?", userID, since)
+		}
+	}
+	return tenderScope{
+		payments: scope("receipt_payments"),
+		refunds:  scope("sale_return_refunds"),
+		deposits: scope("layaway_payments"),
+	}
+}
+
+// sessionTenders scopes tender totals to what went through one register session
+func sessionTenders(sessionID uint) tenderScope {
+	return tenderScope{
+		payments: func(db *gorm.DB) *gorm.DB {
+			return db.Joins("JOIN receipts ON receipts.id = receipt_payments.receipt_id").
+				Where("receipts.register_session_id = ?", sessionID)
+		},
+		refunds: func(db *gorm.DB) *gorm.DB {
+			return db.Joins("JOIN sale_returns ON sale_returns.id = sale_return_refunds.sale_return_id").
+				Where("sale_returns.register_session_id = ?", sessionID)
+		},
+		deposits: func(db *gorm.DB) *gorm.DB {
+			return db.Where("layaway_payments.register_session_id = ?", sessionID)
+		},
+	}
+}
+
+// sumTenders sums receipt payments and layaway deposits by tender and takes
+// off refunds paid out the same way. The totals are in no particular order.
+// A completed layaway's receipt is paid by LAYAWAY, which only settles it
+// with deposits already counted when they were taken, so it is left out.
+func sumTenders(db *gorm.DB, scope tenderScope) ([]tenderTotal, error) {
+	var payments []tenderTotal
+	if err := db.Table("receipt_payments").
+		Scopes(scope.payments).
+		Where("receipt_payments.method <> ?", models.PaymentLayaway).
+		Select("receipt_payments.method, COUNT(*) as transactions, COALESCE(SUM(receipt_payments.amount), 0) as amount, COALESCE(SUM(receipt_payments.change_given), 0) as change_given").
+		Group("receipt_payments.method").
+		Scan(&payments).Error; err != nil {
+		return nil, err
+	}
+
+	var refunds []struct {
+		RefundMethod string
+		Amount       float64
+	}
+	if err := db.Table("sale_return_refunds").
+		Scopes(scope.refunds).
+		Select("sale_return_refunds.method as refund_method, COALESCE(SUM(sale_return_refunds.amount), 0) as amount").
+		Group("sale_return_refunds.method").
+		Scan(&refunds).Error; err != nil {
+		return nil, err
+	}
+
+	var deposits []tenderTotal
+	if err := db.Table("layaway_payments").
+		Scopes(scope.deposits).
+		Select("layaway_payments.method, COUNT(*) as transactions, COALESCE(SUM(layaway_payments.amount), 0) as amount").
+		Group("layaway_payments.method").
+		Scan(&deposits).Error; err != nil {
+		return nil, err
+	}
+
+	byMethod := make(map[string]tenderTotal, len(payments))
+	for _, payment := range payments {
+		byMethod[payment.Method] = payment
+	}
+	// Layaway deposits are money taken in even before the goods are collected
+	for _, deposit := range deposits {
+		total := byMethod[deposit.Method]
+		total.Method = deposit.Method
+		total.Transactions += deposit.Transactions
+		total.Amount += deposit.Amount
+		byMethod[deposit.Method] = total
+	}
+	for _, refund := range refunds {
+		total := byMethod[refund.RefundMethod]
+		total.Method = refund.RefundMethod
+		total.Refunds = refund.Amount
+		byMethod[refund.RefundMethod] = total
+	}
+
+	totals := make([]tenderTotal, 0, len(byMethod))
+	for _, total := range byMethod {
+		total.Amount = roundMoney(total.Amount)
+		total.ChangeGiven = roundMoney(total.ChangeGiven)
+		total.Refunds = roundMoney(total.Refunds)
+		total.Net = roundMoney(total.Amount - total.Refunds)
+		totals = append(totals, total)
+	}
+	return totals, nil
+}
+
+// tenderTotals sums takings by tender since a time, largest first
+func tenderTotals(db *gorm.DB, userID uint, since time.Time) ([]tenderTotal, error) {
+	totals, err := sumTenders(db, periodTenders(userID, since))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Net > totals[j].Net })
+	return totals, nil
+}
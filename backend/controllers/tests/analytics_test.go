@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSalesAnalytics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Maize flour", Category: "Flour", Price: 150})
+	db.Create(&models.Product{ID: 2, UserID: 1, Name: "Sugar", Category: "Sugar", Price: 150})
+	db.Create(&models.User{ID: 1, FullName: "Owner", Email: "owner@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Kisumu"})
+	db.Create(&models.User{ID: 7, FullName: "Cashier", Email: "cashier@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000001", Location: "Kisumu", Role: models.RoleCashier})
+	db.Create(&models.Receipt{ID: 1, UserID: 1, CashierID: 7, ReceiptNumber: "R-1"})
+	db.Create(&models.Receipt{ID: 2, UserID: 1, ReceiptNumber: "R-2"})
+	db.Create(&models.Receipt{ID: 3, UserID: 1, ReceiptNumber: "R-3"})
+
+	at := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 0, 0, 0, time.Local) }
+	sale := func(receiptID, productID uint, returnID uint, quantity int, amount, cost float64, method string, when time.Time) {
+		db.Create(&models.SalesTransaction{UserID: 1, ReceiptID: receiptID, ProductID: productID, SaleReturnID: returnID, Quantity: quantity,
+			TotalAmount: amount, TotalCost: cost, PaymentMethod: method, CreatedAt: when})
+	}
+	sale(1, 1, 0, 2, 300, 200, "CASH", at(2, 10))
+	sale(1, 2, 0, 1, 150, 100, "CASH", at(2, 10))
+	sale(2, 1, 0, 1, 150, 100, "MPESA", at(3, 9))
+	sale(2, 1, 1, -1, -150, -100, "MPESA", at(3, 12))
+	// The previous period of the same length
+	sale(3, 1, 0, 1, 200, 120, "CASH", at(1, 15))
+	// The first receipt was rung up by a staff login with VAT of a sixth
+	// included in its prices; the others by the owner before tax
+	db.Model(&models.SalesTransaction{}).Where("receipt_id = ?", 1).
+		Updates(map[string]interface{}{"cashier_id": 7, "tax_amount": gorm.Expr("total_amount / 6")})
+
+	sm := controllers.NewSalesManagementHandler(db)
+	analytics := func(t *testing.T, query string) controllers.SalesAnalytics {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/sales-analytics"+query, nil)
+		c.Set("userID", uint(1))
+		sm.FetchSalesAnalytics(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var report controllers.SalesAnalytics
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return report
+	}
+
+	t.Run("Totals, buckets and the previous period", func(t *testing.T) {
+		report := analytics(t, "?startDate=2026-03-02&endDate=2026-03-03&group_by=category")
+		if report.Figures.Revenue != 450 || report.Figures.Quantity != 3 || report.Figures.Transactions != 2 {
+			t.Errorf("Expected 450 revenue from 3 units on 2 receipts, got %+v", report.Figures)
+		}
+		// Profit is on the 375 left after 75 VAT, less 300 cost
+		if report.Figures.NetRevenue != 375 || report.Figures.GrossProfit != 75 || report.Figures.GrossMargin != 20 {
+			t.Errorf("Expected 75 gross profit at 20%% on 375 net revenue, got %+v", report.Figures)
+		}
+		if report.Previous.Figures.Revenue != 200 || report.Previous.Changes.Revenue == nil || *report.Previous.Changes.Revenue != 125 {
+			t.Errorf("Expected revenue up 125%% on the previous 200, got %+v", report.Previous)
+		}
+		if len(report.Series) != 2 || report.Series[0].Revenue != 450 || report.Series[1].Revenue != 0 || report.Series[1].PreviousRevenue != 200 {
+			t.Errorf("Expected daily buckets of 450 and 0 after the return, got %+v", report.Series)
+		}
+		if len(report.Top) != 2 || report.Top[0].Label != "Flour" || report.Top[0].Revenue != 300 || report.Top[0].Change == nil || *report.Top[0].Change != 50 {
+			t.Errorf("Expected flour on top at 300, up 50%%, got %+v", report.Top)
+		}
+	})
+
+	t.Run("Hourly buckets and the cashier grouping", func(t *testing.T) {
+		report := analytics(t, "?startDate=2026-03-02&endDate=2026-03-03&interval=hour&group_by=cashier&top=1")
+		if len(report.Series) != 48 || report.Series[10].Revenue != 450 {
+			t.Errorf("Expected 48 hourly buckets with 450 at 10:00, got %d", len(report.Series))
+		}
+		if len(report.Top) != 1 || report.Top[0].Key != "7" || report.Top[0].Label != "Cashier" || report.Top[0].Revenue != 450 {
+			t.Errorf("Expected the staff cashier on top with 450, got %+v", report.Top)
+		}
+
+		report = analytics(t, "?startDate=2026-03-01&endDate=2026-03-01&group_by=cashier")
+		if len(report.Top) != 1 || report.Top[0].Key != "1" || report.Top[0].Label != "Owner" || report.Top[0].Revenue != 200 {
+			t.Errorf("Expected sales with no cashier recorded under the owner, got %+v", report.Top)
+		}
+	})
+
+	t.Run("Bad parameters", func(t *testing.T) {
+		for _, query := range []string{"?interval=minute", "?group_by=colour", "?top=0", "?startDate=2020-01-01&endDate=2026-01-01&interval=hour"} {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/sales-analytics"+query, nil)
+			c.Set("userID", uint(1))
+			sm.FetchSalesAnalytics(c)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected %s to be refused, got %d", query, w.Code)
+			}
+		}
+	})
+
+	t.Run("Metrics payment breakdown matches uppercase methods", func(t *testing.T) {
+		sale(3, 2, 0, 1, 80, 50, "CASH", time.Now())
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/sales-metrics", nil)
+		c.Set("userID", uint(1))
+		sm.FetchSalesMetrics(c)
+		var metrics struct {
+			PaymentMethodBreakdown struct{ Cash float64 } `json:"paymentMethodBreakdown"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &metrics)
+		if metrics.PaymentMethodBreakdown.Cash != 80 {
+			t.Errorf("Expected 80 cash this month, got %s", w.Body.String())
+		}
+	})
+}
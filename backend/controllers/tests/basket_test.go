@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBasketAnalysis(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	for id, name := range []string{"Bread", "Milk", "Eggs", "Sugar"} {
+		db.Create(&models.Product{ID: uint(id + 1), UserID: 1, Name: name, Price: 100})
+	}
+
+	receipt := func(id uint, status string, items ...models.Item) {
+		db.Create(&models.Receipt{ID: id, UserID: 1, ReceiptNumber: fmt.Sprintf("R-%d", id), Status: status,
+			CreatedAt: time.Date(2026, 3, int(id), 12, 0, 0, 0, time.Local), Items: items})
+	}
+	item := func(productID uint) models.Item { return models.Item{ProductID: productID, Quantity: 1} }
+	receipt(1, models.ReceiptCompleted, item(1), item(2))
+	receipt(2, models.ReceiptCompleted, item(1), item(2), item(3))
+	receipt(3, models.ReceiptCompleted, item(1), item(2), item(2))
+	receipt(4, models.ReceiptCompleted, item(3), item(4))
+	receipt(5, models.ReceiptVoided, item(1), item(2))
+	receipt(6, models.ReceiptPartiallyReturned, item(1), models.Item{ProductID: 2, Quantity: 1, ReturnedQuantity: 1})
+
+	sm := controllers.NewSalesManagementHandler(db)
+	get := func(t *testing.T, handler gin.HandlerFunc, path, query string, params gin.Params, status int, report any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", path+"?startDate=2026-03-01&endDate=2026-03-31"+query, nil)
+		c.Params = params
+		c.Set("userID", uint(1))
+		handler(c)
+		if w.Code != status {
+			t.Fatalf("Expected status code %d, but got %d: %s", status, w.Code, w.Body.String())
+		}
+		if report != nil {
+			json.Unmarshal(w.Body.Bytes(), report)
+		}
+	}
+
+	t.Run("Pairs bought on enough receipts", func(t *testing.T) {
+		var report controllers.BasketAnalysis
+		get(t, sm.FetchBasketAnalysis, "/basket-analysis", "", nil, http.StatusOK, &report)
+		if report.Receipts != 5 || report.SortBy != controllers.BasketSortLift || report.MinReceipts != 2 {
+			t.Errorf("Expected 5 receipts ranked by lift, got %+v", report)
+		}
+		if len(report.Associations) != 1 {
+			t.Fatalf("Expected only bread and milk to be bought together twice, got %+v", report.Associations)
+		}
+		pair := report.Associations[0]
+		if pair.ProductName != "Milk" || pair.WithProductName != "Bread" || pair.Receipts != 3 ||
+			pair.Support != 60 || pair.Confidence != 100 || pair.ReverseConfidence != 75 || pair.Lift != 1.25 {
+			t.Errorf("Expected milk then bread on 3 receipts with lift 1.25, got %+v", pair)
+		}
+	})
+
+	t.Run("Ranking every pair", func(t *testing.T) {
+		var report controllers.BasketAnalysis
+		get(t, sm.FetchBasketAnalysis, "/basket-analysis", "&min_receipts=1", nil, http.StatusOK, &report)
+		var order []string
+		for _, pair := range report.Associations {
+			order = append(order, pair.ProductName+">"+pair.WithProductName)
+		}
+		if fmt.Sprint(order) != "[Sugar>Eggs Milk>Bread Eggs>Milk Eggs>Bread]" {
+			t.Errorf("Expected pairs ranked by lift, got %v", order)
+		}
+
+		get(t, sm.FetchBasketAnalysis, "/basket-analysis", "&min_receipts=1&sort=support&top=1", nil, http.StatusOK, &report)
+		if len(report.Associations) != 1 || report.Associations[0].ProductName != "Milk" {
+			t.Errorf("Expected milk and bread to have the most support, got %+v", report.Associations)
+		}
+	})
+
+	t.Run("Also bought with a product", func(t *testing.T) {
+		var report controllers.AlsoBoughtReport
+		get(t, sm.FetchAlsoBought, "/basket-analysis/1", "&min_receipts=1", gin.Params{{Key: "id", Value: "1"}}, http.StatusOK, &report)
+		if report.ProductName != "Bread" || report.ProductReceipts != 4 || report.SortBy != controllers.BasketSortConfidence {
+			t.Errorf("Expected bread on 4 receipts ranked by confidence, got %+v", report)
+		}
+		if len(report.AlsoBought) != 2 || report.AlsoBought[0].ProductName != "Milk" || report.AlsoBought[0].Confidence != 75 ||
+			report.AlsoBought[1].ProductName != "Eggs" || report.AlsoBought[1].Confidence != 25 {
+			t.Errorf("Expected milk then eggs, got %+v", report.AlsoBought)
+		}
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		get(t, sm.FetchBasketAnalysis, "/basket-analysis", "&sort=price", nil, http.StatusBadRequest, nil)
+		get(t, sm.FetchBasketAnalysis, "/basket-analysis", "&min_receipts=0", nil, http.StatusBadRequest, nil)
+		get(t, sm.FetchAlsoBought, "/basket-analysis/99", "", gin.Params{{Key: "id", Value: "99"}}, http.StatusNotFound, nil)
+	})
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBundles_SaleAndReturn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Flour 2kg", Price: 150, AverageCost: 100, Active: true})
+	db.Create(&models.Product{ID: 2, UserID: 1, Name: "Sugar 1kg", Price: 80, AverageCost: 50, Active: true})
+	db.Create(&models.Product{ID: 3, UserID: 1, Name: "Baking pack", Price: 350, Active: true})
+	db.Create(&models.Product{ID: 4, UserID: 1, Name: "Cooking oil", Price: 300, AverageCost: 250, Active: true})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 20, LowStockThreshold: 1})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 2, Quantity: 10, LowStockThreshold: 1})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 4, Quantity: 5, LowStockThreshold: 1})
+
+	im := controllers.NewInventoryManagementHandler(db)
+	sm := controllers.NewSalesManagementHandler(db)
+	rh := controllers.NewReceiptHandler(db)
+	call := func(handler gin.HandlerFunc, params gin.Params, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = params
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+	product := func(id string) gin.Params { return gin.Params{{Key: "id", Value: id}} }
+	stock := func(productID uint) int {
+		var inventory models.Inventory
+		db.Where("product_id = ?", productID).First(&inventory)
+		return inventory.Quantity
+	}
+	available := func() int {
+		var bundle struct {
+			Available int `json:"available"`
+		}
+		json.Unmarshal(call(im.GetBundleComponents, product("3"), "").Body.Bytes(), &bundle)
+		return bundle.Available
+	}
+
+	t.Run("Bundle made up from components", func(t *testing.T) {
+		w := call(im.SetBundleComponents, product("3"), `{"components":[{"product_id":1,"quantity":2},{"product_id":2,"quantity":1}]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if available() != 10 {
+			t.Errorf("Expected 10 packs from 20 flour and 10 sugar, got %d", available())
+		}
+	})
+
+	t.Run("Components and stocked products cannot become bundles", func(t *testing.T) {
+		if w := call(im.SetBundleComponents, product("1"), `{"components":[{"product_id":2,"quantity":1}]}`); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected a component to be refused as a bundle, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := call(im.SetBundleComponents, product("4"), `{"components":[{"product_id":2,"quantity":1}]}`); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected a product with stock to be refused as a bundle, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	var sale struct {
+		ReceiptNumber string `json:"receiptNumber"`
+	}
+	t.Run("Sale depletes the components", func(t *testing.T) {
+		w := call(sm.SellProducts, nil, `{"products":[{"product_id":3,"quantity":3}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		json.Unmarshal(w.Body.Bytes(), &sale)
+		if stock(1) != 14 || stock(2) != 7 || available() != 7 {
+			t.Errorf("Expected 14 flour, 7 sugar and 7 packs left, got %d, %d and %d", stock(1), stock(2), available())
+		}
+
+		var receipt models.Receipt
+		json.Unmarshal(call(rh.GetReceipt, gin.Params{{Key: "receiptNumber", Value: sale.ReceiptNumber}}, "").Body.Bytes(), &receipt)
+		if len(receipt.Items) != 1 || receipt.Items[0].Name != "Baking pack" || receipt.Items[0].Quantity != 3 || receipt.Items[0].TotalPrice != 1050 {
+			t.Errorf("Expected one line of 3 baking packs, got %+v", receipt.Items)
+		}
+	})
+
+	t.Run("Return restores what the sale took", func(t *testing.T) {
+		// The pack has since lost its sugar
+		w := call(im.SetBundleComponents, product("3"), `{"components":[{"product_id":1,"quantity":2}]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var item models.Item
+		db.Where("product_id = ?", 3).First(&item)
+		w = call(sm.ReturnSale, gin.Params{{Key: "receiptNumber", Value: sale.ReceiptNumber}}, fmt.Sprintf(`{"items":[{"item_id":%d,"quantity":1}]}`, item.ID))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if stock(1) != 16 || stock(2) != 8 {
+			t.Errorf("Expected 2 flour and 1 sugar back, got %d flour and %d sugar", stock(1), stock(2))
+		}
+	})
+}
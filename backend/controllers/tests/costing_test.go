@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCosting_AverageCostAndMargin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.BusinessSettings{UserID: 1, NegativeStockPolicy: models.StockPolicyBlock, VATRegistered: true, VATRate: 16, TaxPricing: models.TaxInclusive})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Cooking oil 1L", Price: 116, AverageCost: 60, TaxClass: models.TaxStandard, Active: true})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 10, LowStockThreshold: 1})
+
+	im := controllers.NewInventoryManagementHandler(db)
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, params gin.Params, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = params
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+	averageCost := func() float64 {
+		var product models.Product
+		db.First(&product, 1)
+		return product.AverageCost
+	}
+	receive := func(quantity int, unitCost float64) {
+		w := call(im.UpdateProduct, gin.Params{{Key: "id", Value: "1"}}, fmt.Sprintf(`{"quantity_change":%d,"unit_cost":%v}`, quantity, unitCost))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+	}
+
+	t.Run("Purchases move the weighted average", func(t *testing.T) {
+		receive(10, 80)
+		if averageCost() != 70 {
+			t.Errorf("Expected 10 at 60 and 10 at 80 to average 70, got %v", averageCost())
+		}
+	})
+
+	var sale struct {
+		ReceiptNumber string `json:"receiptNumber"`
+	}
+	t.Run("Sales keep the cost they were made at", func(t *testing.T) {
+		w := call(sm.SellProducts, nil, `{"products":[{"product_id":1,"quantity":2}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		json.Unmarshal(w.Body.Bytes(), &sale)
+
+		// 18 at 70 and 20 at 100
+		receive(20, 100)
+		if averageCost() != 85.79 {
+			t.Errorf("Expected an average cost of 85.79, got %v", averageCost())
+		}
+		var item models.Item
+		db.Where("product_id = ?", 1).First(&item)
+		var transaction models.SalesTransaction
+		db.Where("product_id = ?", 1).First(&transaction)
+		if item.UnitCost != 70 || transaction.TotalCost != 140 {
+			t.Errorf("Expected the sale to keep a unit cost of 70, got item %v and transaction cost %v", item.UnitCost, transaction.TotalCost)
+		}
+	})
+
+	t.Run("Returns come back at the sale's cost", func(t *testing.T) {
+		var item models.Item
+		db.Where("product_id = ?", 1).First(&item)
+		w := call(sm.ReturnSale, gin.Params{{Key: "receiptNumber", Value: sale.ReceiptNumber}}, fmt.Sprintf(`{"items":[{"item_id":%d,"quantity":1}]}`, item.ID))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		// 38 at 85.79 and 1 at 70
+		if averageCost() != 85.39 {
+			t.Errorf("Expected an average cost of 85.39, got %v", averageCost())
+		}
+	})
+
+	t.Run("Margin is taken net of tax", func(t *testing.T) {
+		var report struct {
+			Products []controllers.ProductProfitability `json:"products"`
+		}
+		json.Unmarshal(call(sm.FetchProductProfitability, nil, "").Body.Bytes(), &report)
+		// One oil kept at 116 with 16 VAT, costing 70
+		if len(report.Products) != 1 || report.Products[0].Revenue != 116 || report.Products[0].NetRevenue != 100 ||
+			report.Products[0].GrossProfit != 30 || report.Products[0].GrossMargin != 30 {
+			t.Errorf("Expected 30 profit on 100 net revenue, got %+v", report.Products)
+		}
+
+		var metrics struct {
+			MonthlyGrossProfit float64 `json:"monthlyGrossProfit"`
+			MonthlyGrossMargin float64 `json:"monthlyGrossMargin"`
+		}
+		json.Unmarshal(call(sm.FetchSalesMetrics, nil, "").Body.Bytes(), &metrics)
+		if metrics.MonthlyGrossProfit != 30 || metrics.MonthlyGrossMargin != 30 {
+			t.Errorf("Expected a monthly profit of 30 at 30%%, got %+v", metrics)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/database"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCustomerHandler_CustomersAndHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Tea leaves 250g", Price: 120, AverageCost: 90})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 50, LowStockThreshold: 1})
+
+	ch := controllers.NewCustomerHandler(db)
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, id, query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/?"+query, bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: id}}
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+
+	t.Run("Create and search", func(t *testing.T) {
+		w := call(ch.CreateCustomer, "", "", `{"name":"Wanjiku Kamau","phone":"0712 345 678"}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+		var customer models.Customer
+		json.Unmarshal(w.Body.Bytes(), &customer)
+		if customer.Phone != "254712345678" {
+			t.Errorf("Expected phone normalised to 254712345678, got %s", customer.Phone)
+		}
+
+		w = call(ch.CreateCustomer, "", "", `{"name":"W. Kamau","phone":"+254-712-345678"}`)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+		}
+
+		var found []models.Customer
+		json.Unmarshal(call(ch.SearchCustomers, "", "q=0712345", "").Body.Bytes(), &found)
+		if len(found) != 1 {
+			t.Errorf("Expected to find 1 customer by phone, got %d", len(found))
+		}
+	})
+
+	t.Run("Sales link to the customer", func(t *testing.T) {
+		// Same person, different spelling and phone format
+		w := call(sm.SellProducts, "", "", `{"products":[{"product_id":1,"quantity":1}],"payment_method":"CASH","customer_name":"Shiku","customer_phone":"712-345-678"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		// Credit sale by customer ID alone
+		w = call(sm.SellProducts, "", "", `{"products":[{"product_id":1,"quantity":2}],"payment_method":"CREDIT","customer_id":1}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var customers int64
+		db.Model(&models.Customer{}).Count(&customers)
+		if customers != 1 {
+			t.Errorf("Expected 1 customer, got %d", customers)
+		}
+		var credit models.CreditTransaction
+		db.First(&credit)
+		if credit.CustomerID == nil || *credit.CustomerID != 1 || credit.PhoneNumber != "254712345678" || credit.Name != "Wanjiku Kamau" {
+			t.Errorf("Expected the credit linked to customer 1, got %+v", credit)
+		}
+
+		var history struct {
+			Summary struct {
+				Receipts   int64   `json:"receipts"`
+				TotalSpent float64 `json:"total_spent"`
+				BalanceDue float64 `json:"balance_due"`
+			} `json:"summary"`
+			Receipts []models.Receipt `json:"receipts"`
+		}
+		json.Unmarshal(call(ch.GetCustomerHistory, "1", "", "").Body.Bytes(), &history)
+		if len(history.Receipts) != 2 || history.Summary.TotalSpent != 360 || history.Summary.BalanceDue != 240 {
+			t.Errorf("Expected 2 receipts, 360 spent and 240 owed, got %+v", history.Summary)
+		}
+	})
+
+	t.Run("Customers with history cannot be deleted", func(t *testing.T) {
+		if w := call(ch.DeleteCustomer, "1", "", ""); w.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Unrecognised phone on a sale", func(t *testing.T) {
+		w := call(sm.SellProducts, "", "", `{"products":[{"product_id":1,"quantity":1}],"payment_method":"CASH","customer_name":"Baraka","customer_phone":"call me"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var sale struct {
+			ReceiptNumber string   `json:"receiptNumber"`
+			Warnings      []string `json:"warnings"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &sale)
+		if len(sale.Warnings) != 1 {
+			t.Errorf("Expected a warning about the phone, got %s", w.Body.String())
+		}
+		var transaction models.SalesTransaction
+		db.Joins("JOIN receipts ON receipts.id = sales_transactions.receipt_id").
+			Where("receipts.receipt_number = ?", sale.ReceiptNumber).First(&transaction)
+		if transaction.CustomerID != nil || transaction.CustomerPhone != "call me" || transaction.CustomerName != "Baraka" {
+			t.Errorf("Expected an unlinked sale keeping the phone as typed, got %+v", transaction)
+		}
+	})
+
+	t.Run("Unknown customer on a sale", func(t *testing.T) {
+		w := call(sm.SellProducts, "", "", `{"products":[{"product_id":1,"quantity":1}],"payment_method":"CASH","customer_id":99}`)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestMigrate_BackfillsCustomers(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.User{}, &models.Receipt{}, &models.SalesTransaction{}, &models.CreditTransaction{})
+
+	// Rows recorded before customers existed, one person under two spellings
+	db.Create(&models.Receipt{ID: 1, UserID: 1, ReceiptNumber: "RCP-1", CustomerName: "Otieno"})
+	db.Create(&models.Receipt{ID: 2, UserID: 1, ReceiptNumber: "RCP-2", CustomerName: "J. Otieno"})
+	db.Create(&models.SalesTransaction{UserID: 1, ProductID: 1, ReceiptID: 1, Quantity: 1, TotalAmount: 50, CustomerName: "Otieno", CustomerPhone: "0722 000 111"})
+	db.Create(&models.SalesTransaction{UserID: 1, ProductID: 1, ReceiptID: 2, Quantity: 1, TotalAmount: 50, CustomerName: "J. Otieno", CustomerPhone: "254722000111"})
+	db.Create(&models.CreditTransaction{UserID: 1, ReceiptID: 2, Name: "J. Otieno", PhoneNumber: "+254722000111", Quantity: 1, CreditAmount: 50, BalanceDue: 50})
+	db.Create(&models.SalesTransaction{UserID: 1, ProductID: 1, Quantity: 1, TotalAmount: 50, CustomerName: "Walk-in", CustomerPhone: "n/a"})
+
+	for run := 1; run <= 2; run++ {
+		if err := (&database.DB{DB: db}).Migrate(); err != nil {
+			t.Fatalf("Migrate run %d failed: %v", run, err)
+		}
+	}
+
+	var customers []models.Customer
+	db.Find(&customers)
+	if len(customers) != 1 || customers[0].Phone != "254722000111" {
+		t.Fatalf("Expected one backfilled customer 254722000111, got %+v", customers)
+	}
+
+	var linked int64
+	db.Model(&models.SalesTransaction{}).Where("customer_id = ?", customers[0].ID).Count(&linked)
+	var credits int64
+	db.Model(&models.CreditTransaction{}).Where("customer_id = ?", customers[0].ID).Count(&credits)
+	var receipts int64
+	db.Model(&models.Receipt{}).Where("customer_id = ?", customers[0].ID).Count(&receipts)
+	if got := fmt.Sprint(linked, credits, receipts); got != "2 1 2" {
+		t.Errorf("Expected 2 sales, 1 credit and 2 receipts linked, got %s", got)
+	}
+}
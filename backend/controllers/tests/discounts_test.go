@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSalesManagementHandler_SellProductsWithDiscounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.User{ID: 1, FullName: "Owner", Email: "owner@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Kisumu"})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Soda 500ml", Price: 60, AverageCost: 40})
+	db.Create(&models.Product{ID: 2, UserID: 1, Name: "Bread", Price: 65, AverageCost: 50})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 50, LowStockThreshold: 1})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 2, Quantity: 50, LowStockThreshold: 1})
+
+	productID := uint(1)
+	db.Create(&models.Promotion{UserID: 1, Name: "Buy 2 get 1 soda", Type: models.PromotionBuyXGetY, ProductID: &productID,
+		BuyQuantity: 2, FreeQuantity: 1, StartsAt: time.Now().Add(-time.Hour), Active: true})
+	db.Create(&models.Coupon{UserID: 1, Code: "KARIBU10", DiscountType: models.DiscountPercent, Value: 10, UsageLimit: 1, Active: true})
+
+	sm := controllers.NewSalesManagementHandler(db)
+	sell := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/record-sale", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("userID", uint(1))
+		sm.SellProducts(c)
+		return w
+	}
+
+	t.Run("Promotion, line discount and coupon", func(t *testing.T) {
+		// Soda: 3 x 60 = 180 less one free = 120. Bread: 2 x 65 = 130 less 10 fixed = 120.
+		// Coupon takes 10% of 240 = 24, split evenly.
+		w := sell(`{"products":[{"product_id":1,"quantity":3},{"product_id":2,"quantity":2,"discount_type":"FIXED","discount_value":10,"override_reason":"Day-old bread"}],"payment_method":"CASH","coupon_code":"karibu10"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var receipt models.Receipt
+		db.Preload("Items").First(&receipt)
+		if receipt.TotalAmount != 216 || receipt.DiscountAmount != 94 || receipt.CouponCode != "KARIBU10" {
+			t.Errorf("Expected total 216 with 94 discount and coupon KARIBU10, got %v, %v and %q", receipt.TotalAmount, receipt.DiscountAmount, receipt.CouponCode)
+		}
+		for _, item := range receipt.Items {
+			if item.ListPrice*float64(item.Quantity)-item.DiscountAmount != item.NetAmount || item.NetAmount != 108 {
+				t.Errorf("Expected item %s to net 108 from list less discount, got %+v", item.Name, item)
+			}
+		}
+
+		var discounts []models.SaleDiscount
+		db.Find(&discounts)
+		if len(discounts) != 4 {
+			t.Errorf("Expected 4 discount records (promotion, line, coupon x2), got %d", len(discounts))
+		}
+	})
+
+	t.Run("Coupon usage limit", func(t *testing.T) {
+		w := sell(`{"products":[{"product_id":2,"quantity":1}],"payment_method":"CASH","coupon_code":"KARIBU10"}`)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Unknown coupon", func(t *testing.T) {
+		w := sell(`{"products":[{"product_id":2,"quantity":1}],"payment_method":"CASH","coupon_code":"NOPE"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Percentage over 100", func(t *testing.T) {
+		w := sell(`{"products":[{"product_id":2,"quantity":1}],"payment_method":"CASH","discount_type":"PERCENT","discount_value":150}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	})
+}
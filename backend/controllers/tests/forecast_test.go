@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestDemandForecast(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		t.Skipf("Timezone data unavailable: %v", err)
+	}
+	now := time.Now().In(nairobi)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, nairobi)
+
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Bread", Price: 60, Active: true, CreatedAt: today.AddDate(0, 0, -100)})
+	db.Create(&models.Product{ID: 2, UserID: 1, Name: "Milk", Price: 50, Active: true, CreatedAt: today.AddDate(0, 0, -100)})
+	// Eggs were only added when they started selling, 60 days ago
+	db.Create(&models.Product{ID: 3, UserID: 1, Name: "Eggs", Price: 15, Active: true, CreatedAt: today.AddDate(0, 0, -60)})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 35})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 2, Quantity: 5})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 3, Quantity: 1000})
+	// Bread sells 10 a day except on Sundays, when the shop is shut. Eggs
+	// swing between 5 and 15 a day.
+	for i := 1; i <= 60; i++ {
+		day := today.AddDate(0, 0, -i).Add(12 * time.Hour)
+		if day.Weekday() != time.Sunday {
+			db.Create(&models.SalesTransaction{UserID: 1, ProductID: 1, Quantity: 10, TotalAmount: 600, PaymentMethod: "CASH", CreatedAt: day})
+		}
+		eggs := 5
+		if i%2 == 0 {
+			eggs = 15
+		}
+		db.Create(&models.SalesTransaction{UserID: 1, ProductID: 3, Quantity: eggs, TotalAmount: float64(eggs) * 15, PaymentMethod: "CASH", CreatedAt: day})
+	}
+	// Today's sales are still coming in and are left out
+	db.Create(&models.SalesTransaction{UserID: 1, ProductID: 1, Quantity: 500, TotalAmount: 30000, PaymentMethod: "CASH", CreatedAt: now})
+
+	sm := controllers.NewSalesManagementHandler(db)
+	get := func(t *testing.T, handler gin.HandlerFunc, path string, id string, status int, body any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", path, nil)
+		if id != "" {
+			c.Params = gin.Params{{Key: "id", Value: id}}
+		}
+		c.Set("userID", uint(1))
+		handler(c)
+		if w.Code != status {
+			t.Fatalf("Expected status code %d, but got %d: %s", status, w.Code, w.Body.String())
+		}
+		if body != nil {
+			json.Unmarshal(w.Body.Bytes(), body)
+		}
+	}
+
+	// Bread's 35 loaves last until the fourth day the shop is open
+	var stockOut string
+	for day, sold := today, 0; sold < 35; day = day.AddDate(0, 0, 1) {
+		if day.Weekday() != time.Sunday {
+			sold += 10
+			stockOut = day.Format("2006-01-02")
+		}
+	}
+
+	t.Run("Weekly pattern and stock-out date", func(t *testing.T) {
+		var forecast controllers.DemandForecast
+		get(t, sm.FetchDemandForecast, "/demand-forecast/1?history=56&days=7", "1", http.StatusOK, &forecast)
+		if forecast.Timezone != "Africa/Nairobi" || len(forecast.Days) != 7 || forecast.Seasonality["Sunday"] != 0 {
+			t.Fatalf("Expected 7 days in Africa/Nairobi with nothing on Sundays, got %+v", forecast)
+		}
+		for _, day := range forecast.Days {
+			date, _ := time.ParseInLocation("2006-01-02", day.Date, nairobi)
+			want := 10.0
+			if date.Weekday() == time.Sunday {
+				want = 0
+			}
+			if day.Forecast != want || day.Lower != want || day.Upper != want {
+				t.Errorf("Expected %v on %s with no spread, got %+v", want, day.Date, day)
+			}
+		}
+		if forecast.StockOnHand == nil || *forecast.StockOnHand != 35 || forecast.StockOutDate == nil || *forecast.StockOutDate != stockOut {
+			t.Errorf("Expected 35 loaves to run out on %s, got %v", stockOut, forecast.StockOutDate)
+		}
+	})
+
+	t.Run("Band around noisy demand", func(t *testing.T) {
+		var forecast controllers.DemandForecast
+		get(t, sm.FetchDemandForecast, "/demand-forecast/3?days=3&alpha=0.1", "3", http.StatusOK, &forecast)
+		if forecast.HistoryDays != 60 || forecast.ErrorStdDev == 0 || forecast.AverageDailyDemand != 10 {
+			t.Fatalf("Expected an error spread around 10 eggs a day, got %+v", forecast)
+		}
+		for _, day := range forecast.Days {
+			if day.Forecast < 5 || day.Forecast > 15 || day.Lower >= day.Forecast || day.Upper <= day.Forecast {
+				t.Errorf("Expected a band around a forecast between 5 and 15, got %+v", day)
+			}
+		}
+		if forecast.StockOutEarliest == nil || forecast.StockOutDate == nil || *forecast.StockOutEarliest > *forecast.StockOutDate {
+			t.Errorf("Expected the earliest stock-out no later than the expected one, got %v and %v", forecast.StockOutEarliest, forecast.StockOutDate)
+		}
+	})
+
+	t.Run("Products soonest to run out first", func(t *testing.T) {
+		var forecasts []controllers.StockOutForecast
+		get(t, sm.FetchStockOutForecasts, "/demand-forecast?history=56&days=7", "", http.StatusOK, &forecasts)
+		if len(forecasts) != 3 || forecasts[0].ProductName != "Bread" || forecasts[0].Demand != 60 || forecasts[2].ProductName != "Milk" {
+			t.Fatalf("Expected bread first and unsold milk last, got %+v", forecasts)
+		}
+		if forecasts[2].StockOutDate != nil || forecasts[2].Demand != 0 {
+			t.Errorf("Expected milk never to run out, got %+v", forecasts[2])
+		}
+	})
+
+	t.Run("Back-test against held out days", func(t *testing.T) {
+		var report controllers.DemandBacktest
+		get(t, sm.FetchDemandBacktest, "/demand-forecast/1/backtest?history=28&days=14", "1", http.StatusOK, &report)
+		if len(report.Days) != 14 || report.HoldoutFrom != today.AddDate(0, 0, -14).Format("2006-01-02") {
+			t.Fatalf("Expected 14 held out days, got %+v", report)
+		}
+		if report.MAE != 0 || report.RMSE != 0 || report.WAPE == nil || *report.WAPE != 0 || report.Coverage != 100 || report.Actual != report.Forecast {
+			t.Errorf("Expected a perfect forecast of a regular week, got %+v", report)
+		}
+		if report.NaiveMAE <= report.MAE {
+			t.Errorf("Expected the forecast to beat the naive average, got %v against %v", report.MAE, report.NaiveMAE)
+		}
+
+		get(t, sm.FetchDemandBacktest, "/demand-forecast/3/backtest?history=28&days=14", "3", http.StatusOK, &report)
+		if report.MAE == 0 || report.MAPE == nil || report.Coverage == 0 {
+			t.Errorf("Expected some error on noisy demand, got %+v", report)
+		}
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		get(t, sm.FetchDemandForecast, "/demand-forecast/1?alpha=1", "1", http.StatusBadRequest, nil)
+		get(t, sm.FetchDemandForecast, "/demand-forecast/1?history=7", "1", http.StatusBadRequest, nil)
+		get(t, sm.FetchDemandBacktest, "/demand-forecast/99/backtest", "99", http.StatusNotFound, nil)
+	})
+
+	t.Run("Bundle sales count towards their components", func(t *testing.T) {
+		// A breakfast pack of two milks sells once a day
+		db.Create(&models.Product{ID: 4, UserID: 1, Name: "Breakfast pack", Price: 90, Active: true, IsBundle: true, CreatedAt: today.AddDate(0, 0, -100)})
+		db.Create(&models.BundleComponent{UserID: 1, BundleID: 4, ComponentID: 2, Quantity: 2})
+		for i := 1; i <= 56; i++ {
+			db.Create(&models.SalesTransaction{UserID: 1, ProductID: 4, Quantity: 1, TotalAmount: 90, PaymentMethod: "CASH", CreatedAt: today.AddDate(0, 0, -i).Add(12 * time.Hour)})
+		}
+
+		var forecast controllers.DemandForecast
+		get(t, sm.FetchDemandForecast, "/demand-forecast/2?history=56&days=7", "2", http.StatusOK, &forecast)
+		if forecast.AverageDailyDemand != 2 {
+			t.Errorf("Expected 2 milks a day sold in bundles, got %+v", forecast)
+		}
+
+		var forecasts []controllers.StockOutForecast
+		get(t, sm.FetchStockOutForecasts, "/demand-forecast?history=56&days=7", "", http.StatusOK, &forecasts)
+		if len(forecasts) != 3 || forecasts[0].ProductName != "Milk" || forecasts[0].Demand != 14 || forecasts[0].StockOutDate == nil {
+			t.Errorf("Expected milk to run out first on 14 units of bundle demand, got %+v", forecasts)
+		}
+	})
+}
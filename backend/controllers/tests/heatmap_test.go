@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSalesHeatmap(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Maize flour", Category: "Flour", Price: 150})
+	db.Create(&models.Product{ID: 2, UserID: 1, Name: "Sugar", Category: "Sugar", Price: 200})
+
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		t.Skipf("Timezone data unavailable: %v", err)
+	}
+	now := time.Now().In(nairobi)
+	yesterday := func(hour, minute int) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day()-1, hour, minute, 0, 0, nairobi)
+	}
+	weekday := int(yesterday(0, 0).Weekday())
+	sale := func(productID, returnID uint, quantity int, amount float64, when time.Time) {
+		db.Create(&models.SalesTransaction{UserID: 1, ProductID: productID, SaleReturnID: returnID, Quantity: quantity,
+			TotalAmount: amount, PaymentMethod: "CASH", CreatedAt: when})
+	}
+	sale(1, 0, 2, 300, yesterday(10, 5))
+	sale(1, 0, 1, 150, yesterday(10, 40))
+	sale(1, 1, -1, -150, yesterday(11, 0))
+	sale(2, 0, 1, 200, yesterday(22, 30))
+	// Outside a seven day window
+	sale(2, 0, 1, 200, yesterday(9, 0).AddDate(0, 0, -10))
+
+	sm := controllers.NewSalesManagementHandler(db)
+	heatmap := func(t *testing.T, query string) controllers.SalesHeatmap {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/sales-heatmap"+query, nil)
+		c.Set("userID", uint(1))
+		sm.FetchSalesHeatmap(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var report controllers.SalesHeatmap
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return report
+	}
+
+	t.Run("Sales land in their local weekday and hour", func(t *testing.T) {
+		report := heatmap(t, "?days=7")
+		if report.Timezone != "Africa/Nairobi" || report.Days != 7 || report.Weekdays[0] != "Sunday" {
+			t.Errorf("Expected a seven day window in Africa/Nairobi, got %+v", report)
+		}
+		if cell := report.Cells[weekday][10]; cell.Transactions != 2 || cell.Quantity != 3 || cell.Revenue != 450 || cell.AverageRevenue != 450 {
+			t.Errorf("Expected 2 sales worth 450 at 10:00, got %+v", cell)
+		}
+		if cell := report.Cells[weekday][11]; cell.Transactions != 0 || cell.Revenue != -150 {
+			t.Errorf("Expected the return to reduce revenue without counting a sale, got %+v", cell)
+		}
+		if cell := report.Cells[weekday][22]; cell.Transactions != 1 || cell.Revenue != 200 {
+			t.Errorf("Expected the evening sale at 22:00, got %+v", cell)
+		}
+		if report.ByWeekday[weekday].Transactions != 3 || report.ByHour[10].Revenue != 450 {
+			t.Errorf("Expected weekday and hour totals, got %+v and %+v", report.ByWeekday[weekday], report.ByHour[10])
+		}
+		if report.Busiest == nil || report.Busiest.Hour != 10 || report.Busiest.Transactions != 2 {
+			t.Errorf("Expected 10:00 to be the busiest hour, got %+v", report.Busiest)
+		}
+		if report.RefreshedAt.IsZero() {
+			t.Errorf("Expected the refresh time to be reported")
+		}
+	})
+
+	t.Run("New sales are added without counting old ones twice", func(t *testing.T) {
+		sale(1, 0, 1, 150, yesterday(10, 50))
+		report := heatmap(t, "?days=7")
+		if cell := report.Cells[weekday][10]; cell.Transactions != 3 || cell.Revenue != 600 {
+			t.Errorf("Expected 3 sales worth 600 at 10:00, got %+v", cell)
+		}
+		var unrolled int64
+		db.Model(&models.SalesTransaction{}).Where("rolled_up = ?", false).Count(&unrolled)
+		if unrolled != 0 {
+			t.Errorf("Expected every sale to be rolled up, %d were not", unrolled)
+		}
+	})
+
+	t.Run("Wider windows and filters", func(t *testing.T) {
+		report := heatmap(t, "?days=30")
+		total := 0
+		for _, day := range report.ByWeekday {
+			total += day.Transactions
+		}
+		if total != 5 {
+			t.Errorf("Expected the older sale inside a 30 day window, got %d sales", total)
+		}
+		if report := heatmap(t, "?days=7&product_id=2"); report.Cells[weekday][10].Transactions != 0 || report.Cells[weekday][22].Transactions != 1 {
+			t.Errorf("Expected only sugar sales, got %+v", report.Cells[weekday])
+		}
+		if report := heatmap(t, "?days=7&category=flour"); report.Cells[weekday][10].Transactions != 3 || report.Cells[weekday][22].Transactions != 0 {
+			t.Errorf("Expected only flour sales, got %+v", report.Cells[weekday])
+		}
+	})
+
+	t.Run("Changing timezone rebuilds the rollup", func(t *testing.T) {
+		db.Create(&models.BusinessSettings{UserID: 1, Timezone: "UTC"})
+		report := heatmap(t, "?days=7")
+		utc := yesterday(10, 5).UTC()
+		if report.Timezone != "UTC" || report.Cells[int(utc.Weekday())][utc.Hour()].Transactions != 3 {
+			t.Errorf("Expected the morning sales at %02d:00 UTC, got %+v", utc.Hour(), report.Cells[int(utc.Weekday())])
+		}
+		var transactions int64
+		db.Model(&models.SalesHourlyRollup{}).Select("COALESCE(SUM(transactions), 0)").Scan(&transactions)
+		if transactions != 5 {
+			t.Errorf("Expected 5 sales in the rebuilt rollup, got %d", transactions)
+		}
+	})
+
+	t.Run("Invalid window", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/sales-heatmap?days=0", nil)
+		c.Set("userID", uint(1))
+		sm.FetchSalesHeatmap(c)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestIdempotency_RecordSale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(append(salesTestModels(), &models.IdempotencyKey{})...)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Sugar 1kg", Price: 180, AverageCost: 150})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 20, LowStockThreshold: 1})
+
+	sm := controllers.NewSalesManagementHandler(db)
+	router := gin.New()
+	router.POST("/record-sale", func(c *gin.Context) { c.Set("userID", uint(1)) }, middleware.Idempotency(db), sm.SellProducts)
+
+	sale := `{"products":[{"product_id":1,"quantity":2}],"payment_method":"CASH"}`
+	send := func(key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/record-sale", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyHeader, key)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Retry replays the first response", func(t *testing.T) {
+		first := send("sale-1", sale)
+		if first.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, first.Code, first.Body.String())
+		}
+		retry := send("sale-1", sale)
+		if retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+			t.Errorf("Expected the first response replayed, got %d: %s", retry.Code, retry.Body.String())
+		}
+		if retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+			t.Errorf("Expected replayed header on retry")
+		}
+
+		var receipts int64
+		db.Model(&models.Receipt{}).Count(&receipts)
+		var inventory models.Inventory
+		db.Where("product_id = ?", 1).First(&inventory)
+		if receipts != 1 || inventory.Quantity != 18 {
+			t.Errorf("Expected one receipt and 18 in stock, got %d receipts and %d in stock", receipts, inventory.Quantity)
+		}
+	})
+
+	t.Run("Key reused for a different sale", func(t *testing.T) {
+		w := send("sale-1", `{"products":[{"product_id":1,"quantity":5}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusUnprocessableEntity, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Duplicate while the first is in progress", func(t *testing.T) {
+		inFlight := send("sale-2", sale)
+		if inFlight.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, inFlight.Code, inFlight.Body.String())
+		}
+		db.Model(&models.IdempotencyKey{}).Where("status = ?", models.IdempotencyCompleted).
+			Update("status", models.IdempotencyInProgress)
+
+		w := send("sale-2", sale)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Expired keys are purged", func(t *testing.T) {
+		purged, err := middleware.PurgeIdempotencyKeys(db, time.Now().Add(48*time.Hour))
+		if err != nil || purged != 2 {
+			t.Errorf("Expected 2 keys purged, got %d: %v", purged, err)
+		}
+	})
+
+	t.Run("Refused requests can be corrected and retried", func(t *testing.T) {
+		w := send("sale-3", `{"products":[{"product_id":1,"quantity":100}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+		}
+		w = send("sale-3", sale)
+		if w.Code != http.StatusOK || w.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+			t.Errorf("Expected the corrected sale processed, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestIdempotency_AnonymousCallers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.IdempotencyKey{})
+
+	calls := 0
+	router := gin.New()
+	router.POST("/api/mpesa/initiate", middleware.Idempotency(db), func(c *gin.Context) {
+		calls++
+		c.JSON(200, gin.H{"call": calls})
+	})
+	send := func(address string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/mpesa/initiate", bytes.NewBufferString(`{"amount":100}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(middleware.IdempotencyHeader, "push-1")
+		req.RemoteAddr = address
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	send("10.0.0.1:5000")
+	send("10.0.0.1:5001")
+	other := send("10.0.0.2:5000")
+	if calls != 2 || other.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Errorf("Expected each caller's key kept apart, got %d calls: %s", calls, other.Body.String())
+	}
+}
+
+func TestIdempotency_ServerErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.IdempotencyKey{})
+
+	// Each handler answers with the next status in its list
+	calls := map[string]int{}
+	respond := func(path string, statuses ...int) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			status := statuses[min(calls[path], len(statuses)-1)]
+			calls[path]++
+			c.JSON(status, gin.H{"call": calls[path]})
+		}
+	}
+	router := gin.New()
+	router.POST("/record-sale", middleware.Idempotency(db), respond("/record-sale", 500, 200))
+	router.POST("/api/mpesa/initiate", middleware.IdempotencyWithSideEffects(db), respond("/api/mpesa/initiate", 400, 500, 200))
+	send := func(path, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(`{"amount":100}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(middleware.IdempotencyHeader, key)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("A rolled back server error releases the key", func(t *testing.T) {
+		send("/record-sale", "sale-1")
+		w := send("/record-sale", "sale-1")
+		if w.Code != http.StatusOK || calls["/record-sale"] != 2 {
+			t.Errorf("Expected the retry processed, got %d after %d calls", w.Code, calls["/record-sale"])
+		}
+	})
+
+	t.Run("A server error after an outside call is kept as failed", func(t *testing.T) {
+		if w := send("/api/mpesa/initiate", "push-1"); w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+		}
+		if w := send("/api/mpesa/initiate", "push-1"); w.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected the refused request retried, got %d: %s", w.Code, w.Body.String())
+		}
+
+		w := send("/api/mpesa/initiate", "push-1")
+		if w.Code != http.StatusInternalServerError || w.Header().Get(middleware.IdempotentReplayedHeader) != "true" || calls["/api/mpesa/initiate"] != 2 {
+			t.Errorf("Expected the failure replayed without a second push, got %d after %d calls", w.Code, calls["/api/mpesa/initiate"])
+		}
+		var key models.IdempotencyKey
+		db.Where("path = ?", "/api/mpesa/initiate").First(&key)
+		if key.Status != models.IdempotencyFailed {
+			t.Errorf("Expected the key kept as failed, got %s", key.Status)
+		}
+	})
+}
@@ -263,7 +263,27 @@ func TestInventoryManagementHandler_GetAllProducts(t *testing.T) {
 			name: "No products found",
 			fields: fields{db: func() *gorm.DB {
 				db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-				db.AutoMigrate(&models.Product{})
+				db.AutoMigrate(&models.Product{}, &models.Inventory{})
+				return db
+			}()},
+			args: args{c: func() *gin.Context {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest("GET", "/products", nil)
+				c.Set("userID", uint(1))
+				return c
+			}()},
+			expectedCode: http.StatusOK,
+			expectedBody: `null`,
+			setup:        func() {},
+		},
+		{
+			name: "Archived products are excluded",
+			fields: fields{db: func() *gorm.DB {
+				db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+				db.AutoMigrate(&models.Product{}, &models.Inventory{})
+				db.Create(&models.Product{ID: 1, UserID: 1, Name: "Archived Product"})
+				db.Model(&models.Product{}).Where("id = ?", 1).Update("active", false)
 				return db
 			}()},
 			args: args{c: func() *gin.Context {
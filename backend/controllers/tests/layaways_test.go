@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParkedSalesAndLayaways(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.BusinessSettings{UserID: 1, NegativeStockPolicy: models.StockPolicyBlock, VATRate: 16,
+		TaxPricing: models.TaxInclusive, LayawayDepositPercent: 20, LayawayDays: 30})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Gas cooker", Price: 1000, AverageCost: 700})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 5, LowStockThreshold: 1})
+
+	lh := controllers.NewLayawayHandler(db)
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: id}}
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+	expect := func(t *testing.T, w *httptest.ResponseRecorder, code int) {
+		t.Helper()
+		if w.Code != code {
+			t.Fatalf("Expected status code %d, but got %d: %s", code, w.Code, w.Body.String())
+		}
+	}
+	stock := func() int {
+		var inventory models.Inventory
+		db.Where("product_id = ?", 1).First(&inventory)
+		return inventory.Quantity
+	}
+
+	t.Run("Parked sales reserve nothing and resume once", func(t *testing.T) {
+		expect(t, call(sm.ParkSale, "", `{"label":"Lady in red","products":[{"product_id":1,"quantity":2}],"payment_method":"CASH"}`), http.StatusCreated)
+
+		w := call(sm.ResumeParkedSale, "1", "")
+		expect(t, w, http.StatusOK)
+		var resumed struct {
+			Label string               `json:"label"`
+			Sale  controllers.SaleData `json:"sale"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resumed)
+		if resumed.Label != "Lady in red" || len(resumed.Sale.Products) != 1 || resumed.Sale.Products[0].Quantity != 2 {
+			t.Errorf("Expected the parked basket back, got %+v", resumed)
+		}
+		expect(t, call(sm.ResumeParkedSale, "1", ""), http.StatusNotFound)
+		if stock() != 5 {
+			t.Errorf("Expected parking to leave stock at 5, got %d", stock())
+		}
+	})
+
+	t.Run("Layaway reserves stock and completes when paid off", func(t *testing.T) {
+		body := `{"products":[{"product_id":1,"quantity":2}],"customer_name":"Baraka","customer_phone":"0700111222","deposit":{"method":"CASH","amount":%s}}`
+		expect(t, call(lh.CreateLayaway, "", fmt.Sprintf(body, "100")), http.StatusBadRequest)
+		expect(t, call(lh.CreateLayaway, "", fmt.Sprintf(body, "500")), http.StatusCreated)
+		if stock() != 3 {
+			t.Fatalf("Expected 2 units reserved leaving 3, got %d", stock())
+		}
+
+		// The price goes up after the layaway was agreed
+		db.Create(&models.PriceChange{UserID: 1, ProductID: 1, OldPrice: 1000, NewPrice: 1200, EffectiveAt: time.Now().Add(time.Second), Status: models.PriceChangeApplied, ChangedBy: 1})
+		db.Model(&models.Product{}).Where("id = ?", 1).Update("price", 1200)
+
+		expect(t, call(lh.AddLayawayPayment, "1", `{"method":"CASH","amount":2000}`), http.StatusBadRequest)
+		expect(t, call(lh.AddLayawayPayment, "1", `{"method":"MPESA","amount":500}`), http.StatusBadRequest)
+		expect(t, call(lh.AddLayawayPayment, "1", `{"method":"MPESA","amount":500,"reference":"QAB12CD34"}`), http.StatusCreated)
+		w := call(lh.AddLayawayPayment, "1", `{"method":"CASH","amount":1000}`)
+		expect(t, w, http.StatusCreated)
+
+		var response struct {
+			Layaway models.Layaway `json:"layaway"`
+			Sale    struct {
+				ReceiptNumber string  `json:"receiptNumber"`
+				TotalAmount   float64 `json:"totalAmount"`
+			} `json:"sale"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Layaway.Status != models.LayawayCompleted || response.Sale.TotalAmount != 2000 {
+			t.Fatalf("Expected the layaway completed as a 2000 sale, got %s", w.Body.String())
+		}
+		var receipt models.Receipt
+		db.Preload("Payments").Where("receipt_number = ?", response.Sale.ReceiptNumber).First(&receipt)
+		if receipt.PaymentMethod != models.PaymentLayaway || len(receipt.Payments) != 1 || receipt.Payments[0].Amount != 2000 {
+			t.Errorf("Expected the receipt paid by 2000 of layaway deposits, got %+v", receipt)
+		}
+		if stock() != 3 {
+			t.Errorf("Expected the reserved units to be the ones sold, leaving 3, got %d", stock())
+		}
+
+		var metrics struct {
+			TenderBreakdown []struct {
+				Method string  `json:"method"`
+				Net    float64 `json:"net"`
+			} `json:"tenderBreakdown"`
+		}
+		json.Unmarshal(call(sm.FetchSalesMetrics, "", "").Body.Bytes(), &metrics)
+		tenders := map[string]float64{}
+		for _, tender := range metrics.TenderBreakdown {
+			tenders[tender.Method] = tender.Net
+		}
+		if len(tenders) != 2 || tenders["CASH"] != 1500 || tenders["MPESA"] != 500 {
+			t.Errorf("Expected the deposits counted once as 1500 cash and 500 M-Pesa, got %v", tenders)
+		}
+	})
+
+	t.Run("Expired layaways are cancelled and refunded", func(t *testing.T) {
+		expect(t, call(lh.CreateLayaway, "", `{"products":[{"product_id":1,"quantity":1}],"customer_id":1,"deposit":{"method":"CASH","amount":300}}`), http.StatusCreated)
+		if stock() != 2 {
+			t.Fatalf("Expected 1 unit reserved leaving 2, got %d", stock())
+		}
+		db.Model(&models.Layaway{}).Where("id = ?", 2).Update("expires_at", time.Now().Add(-time.Hour))
+
+		count, err := controllers.ExpireLayaways(db, time.Now())
+		if err != nil || count != 1 {
+			t.Fatalf("Expected 1 layaway expired, got %d (%v)", count, err)
+		}
+		if stock() != 3 {
+			t.Errorf("Expected the reserved unit back on sale, got %d", stock())
+		}
+		expect(t, call(lh.AddLayawayPayment, "2", `{"method":"CASH","amount":100}`), http.StatusConflict)
+
+		w := call(lh.CancelLayaway, "2", `{"refund_method":"CASH"}`)
+		expect(t, w, http.StatusOK)
+		var response struct {
+			Layaway models.Layaway `json:"layaway"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Layaway.Status != models.LayawayCancelled || response.Layaway.AmountRefunded != 300 {
+			t.Errorf("Expected the cancelled layaway refunded 300, got %+v", response.Layaway)
+		}
+		expect(t, call(lh.CancelLayaway, "2", `{"refund_method":"CASH"}`), http.StatusBadRequest)
+	})
+}
+
+func TestLayaways_CompleteAtAgreedPrices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.BusinessSettings{UserID: 1, NegativeStockPolicy: models.StockPolicyBlock, VATRegistered: true, VATRate: 16,
+		TaxPricing: models.TaxInclusive, LayawayDepositPercent: 20, LayawayDays: 30})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Fridge", Price: 1000, AverageCost: 700, TaxClass: models.TaxStandard, Active: true})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 5, LowStockThreshold: 1})
+	productID := uint(1)
+	db.Create(&models.Promotion{UserID: 1, Name: "Ten off", Type: models.PromotionPercentOff, ProductID: &productID, Value: 10, StartsAt: time.Now().Add(-time.Hour)})
+
+	lh := controllers.NewLayawayHandler(db)
+	call := func(handler gin.HandlerFunc, id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: id}}
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+
+	w := call(lh.CreateLayaway, "", `{"products":[{"product_id":1,"quantity":1}],"customer_name":"Baraka","customer_phone":"0700111222","deposit":{"method":"CASH","amount":500}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	// The promotion ends and the VAT rate changes before the last payment
+	db.Model(&models.Promotion{}).Where("id = ?", 1).Update("active", false)
+	db.Model(&models.BusinessSettings{}).Where("user_id = ?", 1).Update("vat_rate", 8)
+
+	w = call(lh.AddLayawayPayment, "1", `{"method":"CASH","amount":400}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var layaway models.Layaway
+	db.First(&layaway, 1)
+	if layaway.Status != models.LayawayCompleted || layaway.ReceiptID == nil {
+		t.Fatalf("Expected the paid-off layaway completed, got %+v", layaway)
+	}
+	var receipt models.Receipt
+	db.First(&receipt, *layaway.ReceiptID)
+	if receipt.TotalAmount != 900 || receipt.TaxAmount != 66.67 {
+		t.Errorf("Expected the agreed 900 with VAT at today's 8%%, got %v with VAT %v", receipt.TotalAmount, receipt.TaxAmount)
+	}
+	var discount models.SaleDiscount
+	db.Where("source = ?", models.DiscountSourceLayaway).First(&discount)
+	if discount.Amount != 100 {
+		t.Errorf("Expected the agreed 100 discount recorded, got %+v", discount)
+	}
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestListEndpointsFilterSortAndPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Maize flour", Category: "Flour", Price: 150})
+	db.Create(&models.Product{ID: 2, UserID: 1, Name: "Wheat flour", Category: "Flour", Price: 180})
+	db.Create(&models.Product{ID: 3, UserID: 1, Name: "Sugar", Category: "Sugar", Price: 150})
+	db.Create(&models.Product{ID: 4, UserID: 1, Name: "Baking pack", Price: 300, IsBundle: true})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 12, LowStockThreshold: 1})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 2, Quantity: 7, LowStockThreshold: 1})
+	db.Create(&models.BundleComponent{UserID: 1, BundleID: 4, ComponentID: 1, Quantity: 2})
+	db.Create(&models.BundleComponent{UserID: 1, BundleID: 4, ComponentID: 2, Quantity: 2})
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 7; i++ {
+		db.Create(&models.Receipt{UserID: 1, ReceiptNumber: "R-" + string(rune('A'+i)), PaymentMethod: "CASH",
+			TotalAmount: float64(100 * (i%3 + 1)), Date: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	get := func(handler gin.HandlerFunc, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+query, nil)
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+
+	t.Run("Products carry stock from the join and bundles from their components", func(t *testing.T) {
+		im := controllers.NewInventoryManagementHandler(db)
+		w := get(im.GetAllProducts, "?category=Flour&sort=-price")
+		var products []struct {
+			Product  models.Product `json:"product"`
+			Quantity int            `json:"quantity"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &products)
+		if w.Code != http.StatusOK || len(products) != 2 || products[0].Product.Name != "Wheat flour" || products[0].Quantity != 7 {
+			t.Fatalf("Expected flour dearest first with its stock, got %d %s", w.Code, w.Body.String())
+		}
+
+		w = get(im.GetAllProducts, "?is_bundle=true")
+		json.Unmarshal(w.Body.Bytes(), &products)
+		if len(products) != 1 || products[0].Quantity != 3 {
+			t.Errorf("Expected the bundle to make up 3 from 7 wheat flour, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("Cursors walk every receipt once in sort order", func(t *testing.T) {
+		rh := controllers.NewReceiptHandler(db)
+		var seen []string
+		query := "?sort=-total_amount,date&limit=3&total=true"
+		for pages := 0; pages < 5; pages++ {
+			w := get(rh.GetAllReceipts, query)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if total := w.Header().Get(controllers.TotalCountHeader); total != "7" {
+				t.Errorf("Expected a total of 7, got %q", total)
+			}
+			var receipts []models.Receipt
+			json.Unmarshal(w.Body.Bytes(), &receipts)
+			for _, receipt := range receipts {
+				seen = append(seen, receipt.ReceiptNumber)
+			}
+			cursor := w.Header().Get(controllers.NextCursorHeader)
+			if cursor == "" {
+				break
+			}
+			query = "?sort=-total_amount,date&limit=3&total=true&cursor=" + cursor
+		}
+
+		want := []string{"R-C", "R-F", "R-B", "R-E", "R-A", "R-D", "R-G"}
+		if len(seen) != len(want) {
+			t.Fatalf("Expected %v, got %v", want, seen)
+		}
+		for i := range want {
+			if seen[i] != want[i] {
+				t.Fatalf("Expected %v, got %v", want, seen)
+			}
+		}
+	})
+
+	t.Run("Filters and sorts outside the whitelist are refused", func(t *testing.T) {
+		rh := controllers.NewReceiptHandler(db)
+		for _, query := range []string{"?user_id=2", "?sort=user_id", "?total_amount.gte=abc", "?date.like=2026", "?limit=0", "?cursor=nonsense"} {
+			if w := get(rh.GetAllReceipts, query); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected %s to be refused, got %d: %s", query, w.Code, w.Body.String())
+			}
+		}
+
+		w := get(rh.GetAllReceipts, "?sort=date&limit=2")
+		cursor := w.Header().Get(controllers.NextCursorHeader)
+		if w := get(rh.GetAllReceipts, "?sort=-date&limit=2&cursor="+cursor); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected a cursor used with another sort to be refused, got %d", w.Code)
+		}
+	})
+
+	t.Run("Range and set filters", func(t *testing.T) {
+		rh := controllers.NewReceiptHandler(db)
+		w := get(rh.GetAllReceipts, "?total_amount.gte=200&receipt_number.in=R-A,R-B,R-C")
+		var receipts []models.Receipt
+		json.Unmarshal(w.Body.Bytes(), &receipts)
+		if len(receipts) != 2 {
+			t.Errorf("Expected R-B and R-C, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("Lists are not paged unless asked", func(t *testing.T) {
+		for i := 0; i < 60; i++ {
+			status := models.CreditPending
+			if i%10 == 0 {
+				status = models.CreditReversed
+			}
+			db.Create(&models.CreditTransaction{UserID: 1, Name: "Customer", Quantity: 1, CreditAmount: 100, BalanceDue: 100, Status: status})
+		}
+		cm := controllers.NewCreditManager(db)
+
+		w := get(cm.GetCreditsHistory, "")
+		var credits []models.CreditCustomer
+		json.Unmarshal(w.Body.Bytes(), &credits)
+		if len(credits) != 60 || w.Header().Get(controllers.NextCursorHeader) != "" {
+			t.Errorf("Expected all 60 credits, reversed ones included, on one page, got %d", len(credits))
+		}
+
+		w = get(cm.GetCreditsHistory, "?status.ne=REVERSED&limit=50")
+		json.Unmarshal(w.Body.Bytes(), &credits)
+		if len(credits) != 50 || w.Header().Get(controllers.NextCursorHeader) == "" {
+			t.Errorf("Expected a first page of 50 and a cursor, got %d", len(credits))
+		}
+		w = get(cm.GetCreditsHistory, "?status.ne=REVERSED&cursor="+w.Header().Get(controllers.NextCursorHeader))
+		json.Unmarshal(w.Body.Bytes(), &credits)
+		if len(credits) != 4 {
+			t.Errorf("Expected the last 4 credits still standing, got %d", len(credits))
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLoyalty_EarnRedeemAndExpire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.BusinessSettings{UserID: 1, NegativeStockPolicy: models.StockPolicyBlock, VATRate: 16,
+		TaxPricing: models.TaxInclusive, LoyaltyEnabled: true, PointsPerShilling: 0.1, PointValue: 1, PointsExpiryDays: 365})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Pishori rice 1kg", Category: "Groceries", Price: 100, AverageCost: 80})
+	db.Create(&models.Product{ID: 2, UserID: 1, Name: "Soda 2L", Category: "Beverages", Price: 200, AverageCost: 150})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 50, LowStockThreshold: 1})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 2, Quantity: 50, LowStockThreshold: 1})
+
+	ch := controllers.NewCustomerHandler(db)
+	sh := controllers.NewSettingsHandler(db)
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: id}}
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+	expect := func(t *testing.T, w *httptest.ResponseRecorder, code int) {
+		t.Helper()
+		if w.Code != code {
+			t.Fatalf("Expected status code %d, but got %d: %s", code, w.Code, w.Body.String())
+		}
+	}
+	balance := func(t *testing.T) int {
+		t.Helper()
+		var result struct {
+			Points int `json:"points"`
+		}
+		w := call(ch.GetPointsBalance, "1", "")
+		expect(t, w, http.StatusOK)
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result.Points
+	}
+
+	expect(t, call(ch.CreateCustomer, "", `{"name":"Njeri","phone":"0711222333"}`), http.StatusCreated)
+	expect(t, call(sh.SetLoyaltyMultiplier, "", `{"category":"beverages","multiplier":2}`), http.StatusOK)
+
+	t.Run("Earn with a category multiplier", func(t *testing.T) {
+		w := call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":1},{"product_id":2,"quantity":1}],"payment_method":"CASH","customer_id":1}`)
+		expect(t, w, http.StatusOK)
+		var response struct {
+			PointsEarned int `json:"pointsEarned"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		// (100 + 200 x 2) x 0.1
+		if response.PointsEarned != 50 {
+			t.Errorf("Expected 50 points earned, got %d", response.PointsEarned)
+		}
+	})
+
+	t.Run("Redeem points as a tender", func(t *testing.T) {
+		w := call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":1}],"payments":[{"method":"POINTS","amount":30},{"method":"CASH","amount":70}],"customer_id":1}`)
+		expect(t, w, http.StatusOK)
+		// 50 - 30 redeemed + 7 earned on the 70 paid in cash
+		if got := balance(t); got != 27 {
+			t.Errorf("Expected a balance of 27 points, got %d", got)
+		}
+	})
+
+	t.Run("Points cannot be overdrawn", func(t *testing.T) {
+		expect(t, call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":1}],"payments":[{"method":"POINTS","amount":100}],"customer_id":1}`), http.StatusBadRequest)
+		expect(t, call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":1}],"payments":[{"method":"POINTS","amount":10},{"method":"CASH","amount":90}]}`), http.StatusBadRequest)
+
+		var inventory models.Inventory
+		db.Where("product_id = ?", 1).First(&inventory)
+		if inventory.Quantity != 48 {
+			t.Errorf("Expected rejected sales to leave stock at 48, got %d", inventory.Quantity)
+		}
+	})
+
+	t.Run("Expired points come off the balance", func(t *testing.T) {
+		expired := time.Now().AddDate(0, 0, -1)
+		db.Create(&models.LoyaltyEntry{UserID: 1, CustomerID: 1, Type: models.LoyaltyEarn, Points: 10, Remaining: 10, ExpiresAt: &expired})
+
+		count, err := controllers.ExpireLoyaltyPoints(db, time.Now())
+		if err != nil || count != 10 {
+			t.Fatalf("Expected 10 points expired, got %d (%v)", count, err)
+		}
+		if got := balance(t); got != 27 {
+			t.Errorf("Expected a balance of 27 points, got %d", got)
+		}
+
+		var history []models.LoyaltyEntry
+		w := call(ch.GetPointsHistory, "1", "")
+		expect(t, w, http.StatusOK)
+		json.Unmarshal(w.Body.Bytes(), &history)
+		if len(history) != 5 || history[0].Type != models.LoyaltyExpire || history[0].Points != -10 {
+			t.Errorf("Expected 5 ledger entries ending in a 10 point expiry, got %+v", history)
+		}
+	})
+}
+
+func TestLoyalty_SplitReturnRefundsPointsShareAsPoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.BusinessSettings{UserID: 1, NegativeStockPolicy: models.StockPolicyBlock, VATRate: 16,
+		TaxPricing: models.TaxInclusive, LoyaltyEnabled: true, PointsPerShilling: 0.1, PointValue: 1, PointsExpiryDays: 365})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Pishori rice 1kg", Category: "Groceries", Price: 100, AverageCost: 80})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 50, LowStockThreshold: 1})
+
+	ch := controllers.NewCustomerHandler(db)
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: id}, gin.Param{Key: "receiptNumber", Value: id}}
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+	expect := func(t *testing.T, w *httptest.ResponseRecorder, code int) {
+		t.Helper()
+		if w.Code != code {
+			t.Fatalf("Expected status code %d, but got %d: %s", code, w.Code, w.Body.String())
+		}
+	}
+
+	expect(t, call(ch.CreateCustomer, "", `{"name":"Njeri","phone":"0711222333"}`), http.StatusCreated)
+	db.Create(&models.LoyaltyEntry{UserID: 1, CustomerID: 1, Type: models.LoyaltyEarn, Points: 100, Remaining: 100})
+
+	expect(t, call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":1}],"payments":[{"method":"POINTS","amount":90},{"method":"CASH","amount":10}],"customer_id":1}`), http.StatusOK)
+	var receipt models.Receipt
+	db.First(&receipt)
+
+	w := call(sm.ReturnSale, receipt.ReceiptNumber, `{"items":[{"item_id":1,"quantity":1}],"reason":"Wrong item"}`)
+	expect(t, w, http.StatusOK)
+	var response struct {
+		Return models.SaleReturn `json:"return"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	refunds := map[string]float64{}
+	for _, refund := range response.Return.Refunds {
+		refunds[refund.Method] = refund.Amount
+	}
+	if len(refunds) != 2 || refunds["POINTS"] != 90 || refunds["CASH"] != 10 {
+		t.Errorf("Expected 90 back as points and 10 in cash, got %v", refunds)
+	}
+	if response.Return.RefundMethod != models.PaymentSplit || response.Return.PointsRefunded != 90 {
+		t.Errorf("Expected a split refund with 90 points refunded, got %+v", response.Return)
+	}
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSalesManagementHandler_SyncOfflineSales(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Maize flour 2kg", Price: 120, AverageCost: 90})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 5, LowStockThreshold: 1})
+	// The price went up an hour ago; sales rung up before then keep the old price
+	appliedAt := time.Now().Add(-time.Hour)
+	db.Create(&models.PriceChange{UserID: 1, ProductID: 1, OldPrice: 100, NewPrice: 120, EffectiveAt: appliedAt,
+		Status: models.PriceChangeApplied, ChangedBy: 1, AppliedAt: &appliedAt})
+
+	sm := controllers.NewSalesManagementHandler(db)
+	sync := func(body string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/sync-sales", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("userID", uint(1))
+		sm.SyncOfflineSales(c)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+	statuses := func(response map[string]interface{}) []string {
+		var out []string
+		results, _ := response["results"].([]interface{})
+		for _, result := range results {
+			out = append(out, result.(map[string]interface{})["status"].(string))
+		}
+		return out
+	}
+
+	soldAt := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	saleA := fmt.Sprintf(`{"client_sale_id":"6f1c2a4e-2b7d-4a53-9a43-0f4f7b1f2c11","sold_at":%q,"products":[{"product_id":1,"quantity":2}],"payment_method":"CASH"}`, soldAt)
+	saleB := fmt.Sprintf(`{"client_sale_id":"0b9e6c1d-8a31-4a1e-b7d2-3c5e4f6a7b22","sold_at":%q,"products":[{"product_id":1,"quantity":10}],"payment_method":"CASH"}`, soldAt)
+	saleC := fmt.Sprintf(`{"client_sale_id":"not-a-uuid","sold_at":%q,"products":[{"product_id":1,"quantity":1}],"payment_method":"CASH"}`, soldAt)
+
+	t.Run("Batch reports each sale", func(t *testing.T) {
+		code, response := sync(`{"sales":[` + saleA + `,` + saleB + `,` + saleC + `]}`)
+		if code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %v", http.StatusOK, code, response)
+		}
+		got := statuses(response)
+		want := []string{controllers.SyncSynced, controllers.SyncConflict, controllers.SyncRejected}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected statuses %v, got %v", want, got)
+		}
+
+		var receipt models.Receipt
+		db.First(&receipt)
+		if receipt.TotalAmount != 200 || receipt.ClientSaleID == nil || receipt.Date.After(appliedAt) {
+			t.Errorf("Expected 200 priced and dated at the original sale time, got %+v", receipt)
+		}
+		var inventory models.Inventory
+		db.Where("product_id = ?", 1).First(&inventory)
+		if inventory.Quantity != 3 {
+			t.Errorf("Expected 3 in stock, got %d", inventory.Quantity)
+		}
+	})
+
+	t.Run("Resynced sale is a duplicate", func(t *testing.T) {
+		code, response := sync(`{"sales":[` + saleA + `]}`)
+		if code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %v", http.StatusOK, code, response)
+		}
+		if got := statuses(response); len(got) != 1 || got[0] != controllers.SyncDuplicate {
+			t.Errorf("Expected a duplicate, got %v", got)
+		}
+		var receipts int64
+		db.Model(&models.Receipt{}).Count(&receipts)
+		if receipts != 1 {
+			t.Errorf("Expected 1 receipt, got %d", receipts)
+		}
+	})
+
+	t.Run("Empty batch", func(t *testing.T) {
+		if code, _ := sync(`{"sales":[]}`); code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, code)
+		}
+	})
+}
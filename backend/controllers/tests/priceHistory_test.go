@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestApplyDuePriceChanges(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Product{}, &models.PriceChange{})
+
+	now := time.Now()
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Petrol", Price: 180, Active: true})
+	db.Create(&models.PriceChange{UserID: 1, ProductID: 1, OldPrice: 180, NewPrice: 195, EffectiveAt: now.Add(-time.Minute), Status: models.PriceChangePending, ChangedBy: 1})
+	db.Create(&models.PriceChange{UserID: 1, ProductID: 1, OldPrice: 195, NewPrice: 210, EffectiveAt: now.Add(time.Hour), Status: models.PriceChangePending, ChangedBy: 1})
+
+	applied, err := controllers.ApplyDuePriceChanges(db, now)
+	if err != nil {
+		t.Fatalf("ApplyDuePriceChanges() error = %v", err)
+	}
+	if applied != 1 {
+		t.Errorf("ApplyDuePriceChanges() applied %d changes, want 1", applied)
+	}
+
+	var product models.Product
+	db.First(&product, 1)
+	if product.Price != 195 {
+		t.Errorf("Expected price 195 after applying due change, got %v", product.Price)
+	}
+
+	var pending int64
+	db.Model(&models.PriceChange{}).Where("status = ?", models.PriceChangePending).Count(&pending)
+	if pending != 1 {
+		t.Errorf("Expected the future change to stay pending, got %d pending", pending)
+	}
+}
+
+func TestInventoryManagementHandler_GetEffectivePrice(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Product{}, &models.PriceChange{})
+
+	created := time.Date(2024, 11, 1, 8, 0, 0, 0, time.UTC)
+	levy := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Petrol", Price: 195, Active: true})
+	db.Create(&models.PriceChange{UserID: 1, ProductID: 1, OldPrice: 180, NewPrice: 180, EffectiveAt: created, Status: models.PriceChangeApplied, ChangedBy: 1})
+	db.Create(&models.PriceChange{UserID: 1, ProductID: 1, OldPrice: 180, NewPrice: 195, EffectiveAt: levy, Status: models.PriceChangeApplied, ChangedBy: 1})
+
+	tests := []struct {
+		name          string
+		at            string
+		expectedCode  int
+		expectedPrice float64
+	}{
+		{name: "Before the levy", at: "2024-11-15T12:00:00Z", expectedCode: http.StatusOK, expectedPrice: 180},
+		{name: "After the levy", at: "2024-12-02T12:00:00Z", expectedCode: http.StatusOK, expectedPrice: 195},
+		{name: "Before the product existed", at: "2024-10-01T00:00:00Z", expectedCode: http.StatusOK, expectedPrice: 180},
+		{name: "Invalid timestamp", at: "yesterday", expectedCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im := controllers.NewInventoryManagementHandler(db)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/effective-price/1?at="+tt.at, nil)
+			c.Params = gin.Params{gin.Param{Key: "id", Value: "1"}}
+			c.Set("userID", uint(1))
+
+			im.GetEffectivePrice(c)
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("Expected status code %d, but got %d", tt.expectedCode, w.Code)
+			}
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				Price float64 `json:"price"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Price != tt.expectedPrice {
+				t.Errorf("Expected price %v, but got %v", tt.expectedPrice, body.Price)
+			}
+		})
+	}
+}
+
+func TestInventoryManagementHandler_GetEffectivePriceAppliesDueChanges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Product{}, &models.PriceChange{})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Petrol", Price: 180, Active: true})
+	db.Create(&models.PriceChange{UserID: 1, ProductID: 1, OldPrice: 180, NewPrice: 195, EffectiveAt: time.Now().Add(-time.Minute), Status: models.PriceChangePending, ChangedBy: 1})
+
+	im := controllers.NewInventoryManagementHandler(db)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/effective-price/1", nil)
+	c.Params = gin.Params{gin.Param{Key: "id", Value: "1"}}
+	c.Set("userID", uint(1))
+
+	im.GetEffectivePrice(c)
+
+	var body struct {
+		Price float64 `json:"price"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	var product models.Product
+	db.First(&product, 1)
+	if body.Price != 195 || product.Price != 195 {
+		t.Errorf("Expected the due change applied at 195, got price %v and product price %v", body.Price, product.Price)
+	}
+
+	applied, err := controllers.ApplyDuePriceChanges(db, time.Now())
+	if err != nil || applied != 0 {
+		t.Errorf("Expected nothing left for the scheduler, got %d applied (%v)", applied, err)
+	}
+}
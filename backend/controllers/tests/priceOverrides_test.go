@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSalesManagementHandler_PriceOverrides(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.User{ID: 1, FullName: "Owner", Email: "owner@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Kisumu"})
+	db.Create(&models.User{ID: 2, FullName: "Cashier", Email: "cashier@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000001", Location: "Kisumu", Role: models.RoleCashier})
+	business := uint(1)
+	db.Create(&models.User{ID: 3, FullName: "Till", Email: "till@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Kisumu", Role: models.RoleCashier, BusinessID: &business})
+	for _, userID := range []uint{1, 2} {
+		db.Create(&models.Product{ID: userID, UserID: userID, Name: "Rice 1kg", Price: 200, AverageCost: 150})
+		db.Create(&models.Inventory{UserID: userID, ProductID: userID, Quantity: 50, LowStockThreshold: 1})
+	}
+
+	sm := controllers.NewSalesManagementHandler(db)
+	sell := func(userID uint, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/record-sale", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("userID", userID)
+		sm.SellProducts(c)
+		return w
+	}
+	sellAs := func(staffID uint, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/record-sale", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("userID", uint(1))
+		c.Set("staffID", staffID)
+		sm.SellProducts(c)
+		return w
+	}
+
+	t.Run("Cashier cannot change the price", func(t *testing.T) {
+		w := sell(2, `{"products":[{"product_id":2,"quantity":2,"amount":100,"override_reason":"Regular"}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Cashier cannot give a basket discount", func(t *testing.T) {
+		w := sell(2, `{"products":[{"product_id":2,"quantity":1}],"payment_method":"CASH","discount_type":"PERCENT","discount_value":10,"override_reason":"Regular"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Cashier sale is priced by the server", func(t *testing.T) {
+		w := sell(2, `{"products":[{"product_id":2,"quantity":2,"amount":400}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var receipt models.Receipt
+		db.Where("user_id = ?", 2).First(&receipt)
+		if receipt.TotalAmount != 400 {
+			t.Errorf("Expected total 400, got %v", receipt.TotalAmount)
+		}
+	})
+
+	t.Run("Override needs a reason", func(t *testing.T) {
+		w := sell(1, `{"products":[{"product_id":1,"quantity":2,"amount":350}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Owner override is logged", func(t *testing.T) {
+		w := sell(1, `{"products":[{"product_id":1,"quantity":2,"amount":350,"override_reason":"Damaged packaging"}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var item models.Item
+		db.Where("product_id = ?", 1).First(&item)
+		if item.ListPrice != 200 || item.DiscountAmount != 50 || item.TotalPrice != 350 {
+			t.Errorf("Expected list 200 less 50 override for 350, got %+v", item)
+		}
+
+		var override models.PriceOverride
+		if err := db.Where("user_id = ?", 1).First(&override).Error; err != nil {
+			t.Fatalf("Expected a price override record: %v", err)
+		}
+		if override.Kind != models.OverridePrice || override.ListAmount != 400 || override.ChargedAmount != 350 || override.Reviewed {
+			t.Errorf("Unexpected price override %+v", override)
+		}
+	})
+	t.Run("Owner's cashier cannot change the price", func(t *testing.T) {
+		var before, after int64
+		db.Model(&models.Receipt{}).Where("user_id = ?", 1).Count(&before)
+		w := sellAs(3, `{"products":[{"product_id":1,"quantity":2,"amount":300,"override_reason":"Regular"}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+		}
+		db.Model(&models.Receipt{}).Where("user_id = ?", 1).Count(&after)
+		if after != before {
+			t.Errorf("Expected no receipt for a refused override, got %d more", after-before)
+		}
+
+		w = sellAs(3, `{"products":[{"product_id":1,"quantity":1}],"payment_method":"CASH"}`)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected the cashier to sell at list price, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+}
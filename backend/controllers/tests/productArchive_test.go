@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestProductArchive_RestoreAndHardDelete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	for id, name := range map[uint]string{1: "Quoted", 2: "Never traded", 3: "On layaway", 4: "On promotion", 5: "Returned"} {
+		db.Create(&models.Product{ID: id, UserID: 1, Name: name, Price: 100, Active: true})
+		db.Create(&models.Inventory{UserID: 1, ProductID: id, Quantity: 5, LowStockThreshold: 1})
+	}
+	productID := uint(4)
+	db.Create(&models.QuotationItem{QuotationID: 1, ProductID: 1, Quantity: 1})
+	db.Create(&models.LayawayReservation{LayawayID: 1, ProductID: 3, Quantity: 1})
+	db.Create(&models.Promotion{UserID: 1, Name: "Ten off", Type: "PERCENT", ProductID: &productID, Value: 10})
+	db.Create(&models.SaleReturnItem{SaleReturnID: 1, ItemID: 1, ProductID: 5, Quantity: 1})
+
+	im := controllers.NewInventoryManagementHandler(db)
+	call := func(handler gin.HandlerFunc, id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", nil)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+
+	t.Run("Archived product is restored", func(t *testing.T) {
+		if w := call(im.DeleteProduct, "1"); w.Code != http.StatusOK {
+			t.Fatalf("Expected archive to succeed, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := call(im.RestoreProduct, "1"); w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var product models.Product
+		db.First(&product, 1)
+		if !product.Active {
+			t.Errorf("Expected product 1 active again")
+		}
+		if w := call(im.RestoreProduct, "1"); w.Code != http.StatusNotFound {
+			t.Errorf("Expected an active product not to be restored, got %d", w.Code)
+		}
+	})
+
+	t.Run("Products with history are refused", func(t *testing.T) {
+		for _, id := range []string{"1", "3", "4", "5"} {
+			if w := call(im.HardDeleteProduct, id); w.Code != http.StatusConflict {
+				t.Errorf("Expected product %s to be refused, got %d: %s", id, w.Code, w.Body.String())
+			}
+		}
+		var products int64
+		db.Model(&models.Product{}).Count(&products)
+		if products != 5 {
+			t.Errorf("Expected every product kept, got %d", products)
+		}
+	})
+
+	t.Run("Never traded product is deleted", func(t *testing.T) {
+		if w := call(im.HardDeleteProduct, "2"); w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var products, inventory int64
+		db.Model(&models.Product{}).Where("id = ?", 2).Count(&products)
+		db.Model(&models.Inventory{}).Where("product_id = ?", 2).Count(&inventory)
+		if products != 0 || inventory != 0 {
+			t.Errorf("Expected product 2 and its stock gone, got %d products and %d stock rows", products, inventory)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestQuotations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.User{ID: 1, FullName: "Owner", Email: "owner@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Kisumu"})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Cement 50kg", Price: 800, AverageCost: 650})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 100, LowStockThreshold: 10})
+
+	qh := controllers.NewQuotationHandler(db)
+	call := func(handler gin.HandlerFunc, id, query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/"+query, bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: id}}
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+	expect := func(t *testing.T, w *httptest.ResponseRecorder, code int) {
+		t.Helper()
+		if w.Code != code {
+			t.Fatalf("Expected status code %d, but got %d: %s", code, w.Code, w.Body.String())
+		}
+	}
+	stock := func() int {
+		var inventory models.Inventory
+		db.Where("product_id = ?", 1).First(&inventory)
+		return inventory.Quantity
+	}
+
+	t.Run("Quote is priced without taking stock", func(t *testing.T) {
+		w := call(qh.CreateQuotation, "", "", `{"products":[{"product_id":1,"quantity":20}],"customer_name":"Mjengo Ltd","valid_days":7}`)
+		expect(t, w, http.StatusCreated)
+		var quotation models.Quotation
+		json.Unmarshal(w.Body.Bytes(), &quotation)
+		if quotation.TotalAmount != 16000 || len(quotation.Items) != 1 || quotation.Status != models.QuotationOpen {
+			t.Errorf("Expected an open 16000 quote, got %+v", quotation)
+		}
+		if stock() != 100 {
+			t.Errorf("Expected quoting to leave stock at 100, got %d", stock())
+		}
+	})
+
+	t.Run("Conversion honours the quoted price and re-checks stock", func(t *testing.T) {
+		// The price goes up after the quote was given
+		db.Create(&models.PriceChange{UserID: 1, ProductID: 1, OldPrice: 800, NewPrice: 850, EffectiveAt: time.Now(), Status: models.PriceChangeApplied, ChangedBy: 1})
+		db.Model(&models.Product{}).Where("id = ?", 1).Update("price", 850)
+
+		w := call(qh.ConvertQuotation, "1", "", `{"payment_method":"CASH","amount_paid":16000}`)
+		expect(t, w, http.StatusOK)
+
+		var quotation models.Quotation
+		db.First(&quotation, 1)
+		if quotation.Status != models.QuotationConverted || quotation.ReceiptID == nil {
+			t.Fatalf("Expected the quote converted onto a receipt, got %+v", quotation)
+		}
+		var receipt models.Receipt
+		db.First(&receipt, *quotation.ReceiptID)
+		if receipt.TotalAmount != 16000 {
+			t.Errorf("Expected the sale at the quoted 16000, got %v", receipt.TotalAmount)
+		}
+		if stock() != 80 {
+			t.Errorf("Expected 20 units sold leaving 80, got %d", stock())
+		}
+
+		expect(t, call(qh.ConvertQuotation, "1", "", `{"payment_method":"CASH","amount_paid":16000}`), http.StatusConflict)
+	})
+
+	t.Run("Quotes for more than is in stock do not convert", func(t *testing.T) {
+		expect(t, call(qh.CreateQuotation, "", "", `{"products":[{"product_id":1,"quantity":500}],"customer_name":"Mjengo Ltd"}`), http.StatusCreated)
+		w := call(qh.ConvertQuotation, "2", "", `{"payment_method":"CASH","amount_paid":425000,"reprice":true}`)
+		if w.Code == http.StatusOK {
+			t.Fatalf("Expected converting 500 units with 80 in stock to fail, got %s", w.Body.String())
+		}
+		var quotation models.Quotation
+		db.First(&quotation, 2)
+		if quotation.Status != models.QuotationOpen {
+			t.Errorf("Expected the quote still open after a failed conversion, got %s", quotation.Status)
+		}
+		expect(t, call(qh.DeclineQuotation, "2", "", ""), http.StatusOK)
+	})
+
+	t.Run("Expired quotes do not convert", func(t *testing.T) {
+		expect(t, call(qh.CreateQuotation, "", "", `{"products":[{"product_id":1,"quantity":1}]}`), http.StatusCreated)
+		db.Model(&models.Quotation{}).Where("id = ?", 3).Update("valid_until", time.Now().Add(-time.Hour))
+		expect(t, call(qh.ConvertQuotation, "3", "", `{"payment_method":"CASH","amount_paid":850}`), http.StatusConflict)
+	})
+
+	t.Run("Conversion rate", func(t *testing.T) {
+		w := call(qh.GetQuotationConversion, "", "", "")
+		expect(t, w, http.StatusOK)
+		var report controllers.QuotationConversion
+		json.Unmarshal(w.Body.Bytes(), &report)
+		if report.Quotations != 3 || report.Converted != 1 || report.ByStatus[models.QuotationExpired] != 1 || report.ConvertedValue != 16000 {
+			t.Errorf("Expected 1 of 3 quotes converted for 16000, got %+v", report)
+		}
+	})
+
+	t.Run("Cashiers sell discounted quotes as quoted", func(t *testing.T) {
+		business := uint(1)
+		db.Create(&models.User{ID: 2, FullName: "Cashier", Email: "cashier@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000002", Location: "Kisumu", Role: models.RoleCashier, BusinessID: &business})
+		w := call(qh.CreateQuotation, "", "", `{"products":[{"product_id":1,"quantity":10,"discount_type":"PERCENT","discount_value":10,"override_reason":"Bulk buyer"}]}`)
+		expect(t, w, http.StatusCreated)
+		var quotation models.Quotation
+		json.Unmarshal(w.Body.Bytes(), &quotation)
+
+		w = httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"payment_method":"CASH","amount_paid":7650}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: fmt.Sprint(quotation.ID)}}
+		c.Set("userID", uint(1))
+		c.Set("staffID", uint(2))
+		qh.ConvertQuotation(c)
+		expect(t, w, http.StatusOK)
+
+		var overrides int64
+		db.Model(&models.PriceOverride{}).Count(&overrides)
+		var discount models.SaleDiscount
+		db.Where("source = ?", models.DiscountSourceQuotation).First(&discount)
+		if overrides != 0 || discount.Amount != 850 {
+			t.Errorf("Expected the quoted 850 discount without an override, got %d overrides and %+v", overrides, discount)
+		}
+	})
+}
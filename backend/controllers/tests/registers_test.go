@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRegisterHandler_SessionAndZReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(append(salesTestModels(), &models.RegisterMovement{})...)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Cooking oil 1L", Price: 150, AverageCost: 110})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 50, LowStockThreshold: 1})
+
+	rh := controllers.NewRegisterHandler(db)
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: id}, gin.Param{Key: "receiptNumber", Value: id}}
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+	expect := func(t *testing.T, w *httptest.ResponseRecorder, code int) {
+		t.Helper()
+		if w.Code != code {
+			t.Fatalf("Expected status code %d, but got %d: %s", code, w.Code, w.Body.String())
+		}
+	}
+
+	t.Run("Sales need an open register when required", func(t *testing.T) {
+		db.Create(&models.BusinessSettings{UserID: 1, NegativeStockPolicy: models.StockPolicyBlock, VATRate: 16,
+			TaxPricing: models.TaxInclusive, RequireRegisterSession: true})
+		expect(t, call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":1}],"payment_method":"CASH"}`), http.StatusConflict)
+	})
+
+	expect(t, call(rh.OpenSession, "", `{"register":"Till 1","opening_float":1000}`), http.StatusCreated)
+	expect(t, call(rh.OpenSession, "", `{"register":"Till 2","opening_float":500}`), http.StatusConflict)
+
+	// Cash 300 (500 tendered), M-Pesa 150, and 100 cash with 50 on credit
+	expect(t, call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":2}],"payments":[{"method":"CASH","amount":500}]}`), http.StatusOK)
+	expect(t, call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":1}],"payments":[{"method":"MPESA","amount":150,"reference":"QWE123RTY"}]}`), http.StatusOK)
+	expect(t, call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":1}],"payments":[{"method":"CASH","amount":100},{"method":"CREDIT"}],"customer_name":"Achieng","customer_phone":"0712345678"}`), http.StatusOK)
+
+	var first models.Receipt
+	db.Preload("Items").Order("id").First(&first)
+	if first.RegisterSessionID == nil {
+		t.Fatalf("Expected the sale to be tied to the register session")
+	}
+	expect(t, call(sm.ReturnSale, first.ReceiptNumber, `{"items":[{"item_id":1,"quantity":1}],"refund_method":"CASH","reason":"Leaking"}`), http.StatusOK)
+
+	expect(t, call(rh.RecordCashDrop, "1", `{"amount":500}`), http.StatusCreated)
+	expect(t, call(rh.RecordPayOut, "1", `{"amount":50}`), http.StatusBadRequest)
+	expect(t, call(rh.RecordPayOut, "1", `{"amount":50,"reason":"Transport for delivery"}`), http.StatusCreated)
+	expect(t, call(rh.RecordPayOut, "1", `{"amount":5000,"reason":"Too much"}`), http.StatusBadRequest)
+
+	w := call(rh.CloseSession, "1", `{"counted_cash":690}`)
+	expect(t, w, http.StatusOK)
+
+	var report controllers.ZReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	// 1000 float + 400 cash sales - 150 refund - 500 drop - 50 pay-out
+	if report.ExpectedCash != 700 || report.OverShort != -10 || report.Receipts != 3 {
+		t.Errorf("Expected 700 expected cash, -10 short over 3 receipts, got %+v", report)
+	}
+	tenders := map[string]float64{}
+	for _, tender := range report.Tenders {
+		tenders[tender.Method] = tender.Net
+	}
+	if tenders["MPESA"] != 150 || tenders["CREDIT"] != 50 || tenders["CASH"] != 250 {
+		t.Errorf("Expected M-Pesa 150, credit 50 and cash 250 net, got %v", tenders)
+	}
+
+	expect(t, call(rh.CloseSession, "1", `{"counted_cash":690}`), http.StatusConflict)
+	var session models.RegisterSession
+	db.First(&session, 1)
+	if session.Status != models.RegisterClosed || session.CountedCash == nil || *session.CountedCash != 690 {
+		t.Errorf("Expected the session closed with 690 counted, got %+v", session)
+	}
+}
+
+func TestRegisterHandler_CashierIsStaffLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(append(salesTestModels(), &models.RegisterMovement{})...)
+
+	rh := controllers.NewRegisterHandler(db)
+	call := func(handler gin.HandlerFunc, id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: id}}
+		c.Set("userID", uint(1))
+		c.Set("staffID", uint(7))
+		handler(c)
+		return w
+	}
+
+	if w := call(rh.OpenSession, "", `{"register":"Till 1","opening_float":200}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	w := call(rh.CloseSession, "1", `{"counted_cash":200}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var report controllers.ZReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if report.CashierID != 7 {
+		t.Errorf("Expected the staff login that opened the till as cashier, got %d", report.CashierID)
+	}
+}
+
+func TestRegisterHandler_SessionsPerCashier(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(append(salesTestModels(), &models.RegisterMovement{})...)
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Cooking oil 1L", Price: 150, AverageCost: 110, Active: true})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 50, LowStockThreshold: 1})
+
+	rh := controllers.NewRegisterHandler(db)
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, staffID uint, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("userID", uint(1))
+		c.Set("staffID", staffID)
+		handler(c)
+		return w
+	}
+	expect := func(t *testing.T, w *httptest.ResponseRecorder, code int) {
+		t.Helper()
+		if w.Code != code {
+			t.Fatalf("Expected status code %d, but got %d: %s", code, w.Code, w.Body.String())
+		}
+	}
+
+	expect(t, call(rh.OpenSession, 7, `{"register":"Till 1","opening_float":200}`), http.StatusCreated)
+	expect(t, call(rh.OpenSession, 8, `{"register":"Till 1","opening_float":200}`), http.StatusConflict)
+	expect(t, call(rh.OpenSession, 8, `{"register":"Till 2","opening_float":300}`), http.StatusCreated)
+	expect(t, call(rh.OpenSession, 7, `{"register":"Till 3","opening_float":100}`), http.StatusConflict)
+
+	expect(t, call(sm.SellProducts, 7, `{"products":[{"product_id":1,"quantity":1}],"payment_method":"CASH"}`), http.StatusOK)
+	expect(t, call(sm.SellProducts, 8, `{"products":[{"product_id":1,"quantity":2}],"payment_method":"CASH"}`), http.StatusOK)
+
+	var receipts []models.Receipt
+	db.Order("id").Find(&receipts)
+	if len(receipts) != 2 {
+		t.Fatalf("Expected 2 receipts, got %d", len(receipts))
+	}
+	for i, want := range []struct{ cashier, session uint }{{7, 1}, {8, 2}} {
+		receipt := receipts[i]
+		if receipt.CashierID != want.cashier || receipt.RegisterSessionID == nil || *receipt.RegisterSessionID != want.session {
+			t.Errorf("Expected receipt %d rung up by %d on session %d, got cashier %d on %v", i+1, want.cashier, want.session, receipt.CashierID, receipt.RegisterSessionID)
+		}
+		var sale models.SalesTransaction
+		db.Where("receipt_id = ?", receipt.ID).First(&sale)
+		if sale.CashierID != want.cashier {
+			t.Errorf("Expected the sale line on receipt %d stored with cashier %d, got %d", i+1, want.cashier, sale.CashierID)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCustomerSegments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+
+	now := time.Now()
+	receiptID := uint(0)
+	purchase := func(name, phone string, daysAgo int, amount float64) uint {
+		receiptID++
+		db.Create(&models.SalesTransaction{UserID: 1, ReceiptID: receiptID, ProductID: 1, Quantity: 1, TotalAmount: amount,
+			PaymentMethod: "CASH", CustomerName: name, CustomerPhone: phone, CreatedAt: now.AddDate(0, 0, -daysAgo)})
+		return receiptID
+	}
+	// Amina buys often, recently and big, under two spellings of her number
+	for i := 0; i < 6; i++ {
+		phone := "0711000001"
+		if i%2 == 1 {
+			phone = "+254 711 000 001"
+		}
+		purchase("Amina", phone, 1+i*10, 600)
+	}
+	returned := purchase("Amina", "0711000001", 3, 600)
+	db.Create(&models.SalesTransaction{UserID: 1, ReceiptID: returned, ProductID: 1, SaleReturnID: 1, Quantity: -1, TotalAmount: -600,
+		PaymentMethod: "CASH", CreatedAt: now.AddDate(0, 0, -2)})
+	// Brian used to buy often but has not been back
+	for i := 0; i < 5; i++ {
+		purchase("Brian", "0711000002", 200+i*20, 500)
+	}
+	purchase("Chebet", "0711000003", 2, 50)
+	purchase("Daudi", "0711000004", 300, 20)
+	purchase("Esther", "0711000005", 30, 100)
+	purchase("Esther", "0711000005", 60, 100)
+	purchase("", "", 1, 1000)
+	// Too long ago to count
+	purchase("Faith", "0711000006", 400, 100)
+	// Another business's customer
+	db.Create(&models.SalesTransaction{UserID: 2, ReceiptID: 999, ProductID: 1, Quantity: 1, TotalAmount: 100,
+		PaymentMethod: "CASH", CustomerPhone: "0711000001", CreatedAt: now})
+
+	ch := controllers.NewCustomerHandler(db)
+	request := func(t *testing.T, handler gin.HandlerFunc, method, path string, params gin.Params, status int, body any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, path, nil)
+		c.Params = params
+		c.Set("userID", uint(1))
+		handler(c)
+		if w.Code != status {
+			t.Fatalf("Expected status code %d, but got %d: %s", status, w.Code, w.Body.String())
+		}
+		if body != nil {
+			json.Unmarshal(w.Body.Bytes(), body)
+		}
+	}
+
+	t.Run("Segments are scored on first request", func(t *testing.T) {
+		var report controllers.CustomerSegments
+		request(t, ch.GetCustomerSegments, "GET", "/customer-segments", nil, http.StatusOK, &report)
+		if report.Customers != 5 || report.ComputedAt == nil || len(report.Segments) != 10 {
+			t.Fatalf("Expected 5 customers across 10 segments, got %+v", report)
+		}
+		counts := map[string]int{}
+		for _, segment := range report.Segments {
+			counts[segment.Segment] = segment.Customers
+		}
+		for segment, want := range map[string]int{
+			models.SegmentChampions: 1, models.SegmentAtRisk: 1, models.SegmentPotentialLoyalist: 1,
+			models.SegmentNeedAttention: 1, models.SegmentLost: 1, models.SegmentLoyal: 0,
+		} {
+			if counts[segment] != want {
+				t.Errorf("Expected %d %s customers, got %d", want, segment, counts[segment])
+			}
+		}
+	})
+
+	t.Run("Members of a segment", func(t *testing.T) {
+		var members []models.CustomerRFM
+		request(t, ch.GetSegmentCustomers, "GET", "/customer-segments/champions", gin.Params{{Key: "segment", Value: "champions"}}, http.StatusOK, &members)
+		if len(members) != 1 {
+			t.Fatalf("Expected one champion, got %+v", members)
+		}
+		amina := members[0]
+		if amina.CustomerName != "Amina" || amina.CustomerPhone != "254711000001" || amina.Frequency != 7 || amina.Monetary != 3600 ||
+			amina.RecencyScore != 5 || amina.FrequencyScore != 5 || amina.MonetaryScore != 5 {
+			t.Errorf("Expected Amina on 7 receipts worth 3600 net of her return, got %+v", amina)
+		}
+
+		request(t, ch.GetSegmentCustomers, "GET", "/customer-segments/at_risk", gin.Params{{Key: "segment", Value: "at_risk"}}, http.StatusOK, &members)
+		if len(members) != 1 || members[0].CustomerName != "Brian" || members[0].RecencyDays != 200 {
+			t.Errorf("Expected Brian to be at risk, got %+v", members)
+		}
+		request(t, ch.GetSegmentCustomers, "GET", "/customer-segments/vip", gin.Params{{Key: "segment", Value: "vip"}}, http.StatusNotFound, nil)
+	})
+
+	t.Run("Recomputing picks up new sales", func(t *testing.T) {
+		for i := 0; i < 6; i++ {
+			purchase("Daudi", "0711000004", 0, 1000)
+		}
+		var result struct{ Customers int }
+		request(t, ch.RecomputeCustomerSegments, "POST", "/customer-segments/recompute", nil, http.StatusOK, &result)
+		if result.Customers != 5 {
+			t.Errorf("Expected 5 customers rescored, got %d", result.Customers)
+		}
+		var members []models.CustomerRFM
+		request(t, ch.GetSegmentCustomers, "GET", "/customer-segments/champions?sort=customer_name", gin.Params{{Key: "segment", Value: "champions"}}, http.StatusOK, &members)
+		if len(members) != 2 || members[0].CustomerName != "Amina" || members[1].CustomerName != "Daudi" {
+			t.Errorf("Expected Amina and Daudi as champions, got %+v", members)
+		}
+	})
+
+	t.Run("Nightly run scores every business", func(t *testing.T) {
+		scored, err := controllers.ComputeRFMSegments(db, time.Now())
+		if err != nil || scored != 6 {
+			t.Errorf("Expected 6 customers scored across both businesses, got %d (%v)", scored, err)
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSalesManagementHandler_ReturnAndVoidSale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.User{ID: 1, FullName: "Owner", Email: "owner@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Kisumu"})
+	db.Create(&models.User{ID: 2, FullName: "Cashier", Email: "cashier@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000001", Location: "Kisumu", Role: models.RoleCashier})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Sugar 1kg", Price: 150, AverageCost: 120})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 10, LowStockThreshold: 1})
+
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, userID uint, receiptNumber, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "receiptNumber", Value: receiptNumber}}
+		c.Set("userID", userID)
+		handler(c)
+		return w
+	}
+
+	w := call(sm.SellProducts, 1, "", `{"products":[{"product_id":1,"quantity":4,"amount":600}],"payment_method":"CREDIT","customer_name":"Achieng","customer_phone":"0711000000","remaining_balance":600}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected sale to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var sale struct {
+		ReceiptNumber string `json:"receiptNumber"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &sale)
+	var item models.Item
+	db.First(&item)
+
+	stock := func() int {
+		var inventory models.Inventory
+		db.Where("product_id = ?", 1).First(&inventory)
+		return inventory.Quantity
+	}
+
+	t.Run("Return part of a line", func(t *testing.T) {
+		w := call(sm.ReturnSale, 1, sale.ReceiptNumber, fmt.Sprintf(`{"items":[{"item_id":%d,"quantity":1}],"reason":"Torn packet"}`, item.ID))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if stock() != 7 {
+			t.Errorf("Expected stock 7 after return, got %d", stock())
+		}
+		var credit models.CreditTransaction
+		db.First(&credit)
+		if credit.CreditAmount != 450 || credit.BalanceDue != 450 || credit.Quantity != 3 {
+			t.Errorf("Expected credit of 450 for 3 units, got %+v", credit)
+		}
+
+		var original, reversal models.SalesTransaction
+		db.Where("quantity > 0").First(&original)
+		db.Where("quantity < 0").First(&reversal)
+		if original.CustomerID == nil || reversal.CustomerID == nil || *reversal.CustomerID != *original.CustomerID || reversal.CustomerPhone != original.CustomerPhone {
+			t.Errorf("Expected the reversal to carry the sale's customer, got %+v", reversal)
+		}
+	})
+
+	t.Run("Return more than is left", func(t *testing.T) {
+		w := call(sm.ReturnSale, 1, sale.ReceiptNumber, fmt.Sprintf(`{"items":[{"item_id":%d,"quantity":4}]}`, item.ID))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("Void needs a reason", func(t *testing.T) {
+		w := call(sm.VoidSale, 1, sale.ReceiptNumber, `{}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("Cashier cannot void", func(t *testing.T) {
+		w := call(sm.VoidSale, 2, sale.ReceiptNumber, `{"reason":"Keyed twice"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+		}
+	})
+
+	t.Run("Void the rest", func(t *testing.T) {
+		w := call(sm.VoidSale, 1, sale.ReceiptNumber, `{"reason":"Keyed twice"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if stock() != 10 {
+			t.Errorf("Expected stock 10 after void, got %d", stock())
+		}
+
+		var revenue float64
+		db.Model(&models.SalesTransaction{}).Select("COALESCE(SUM(total_amount), 0)").Scan(&revenue)
+		if revenue != 0 {
+			t.Errorf("Expected net revenue 0 after void, got %v", revenue)
+		}
+		var credit models.CreditTransaction
+		db.First(&credit)
+		if credit.Status != models.CreditReversed || credit.BalanceDue != 0 {
+			t.Errorf("Expected credit reversed with nothing due, got %s owing %v", credit.Status, credit.BalanceDue)
+		}
+		var receipt models.Receipt
+		db.First(&receipt)
+		if receipt.Status != models.ReceiptVoided {
+			t.Errorf("Expected receipt status %s, got %s", models.ReceiptVoided, receipt.Status)
+		}
+	})
+
+	t.Run("Void twice", func(t *testing.T) {
+		w := call(sm.VoidSale, 1, sale.ReceiptNumber, `{"reason":"Again"}`)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d, but got %d", http.StatusConflict, w.Code)
+		}
+	})
+}
+
+func TestSalesManagementHandler_SplitTenderRefunds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.User{ID: 1, FullName: "Owner", Email: "owner@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Kisumu"})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Soap", Price: 100, AverageCost: 60})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 20, LowStockThreshold: 1})
+
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, receiptNumber, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "receiptNumber", Value: receiptNumber}}
+		c.Set("userID", uint(1))
+		handler(c)
+		return w
+	}
+
+	w := call(sm.SellProducts, "", `{"products":[{"product_id":1,"quantity":10}],"customer_name":"Achieng","customer_phone":"0711000000",
+		"payments":[{"method":"CASH","amount":600},{"method":"CREDIT","amount":400}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected sale to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var sale struct {
+		ReceiptNumber string `json:"receiptNumber"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &sale)
+	var item models.Item
+	db.First(&item)
+
+	var result struct {
+		Return models.SaleReturn `json:"return"`
+	}
+	refunded := func() map[string]float64 {
+		byMethod := map[string]float64{}
+		for _, refund := range result.Return.Refunds {
+			byMethod[refund.Method] += refund.Amount
+		}
+		return byMethod
+	}
+
+	t.Run("Return comes off the credit first", func(t *testing.T) {
+		w := call(sm.ReturnSale, sale.ReceiptNumber, fmt.Sprintf(`{"items":[{"item_id":%d,"quantity":2}]}`, item.ID))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		json.Unmarshal(w.Body.Bytes(), &result)
+		if result.Return.RefundMethod != "CREDIT" || len(result.Return.Refunds) != 1 || refunded()["CREDIT"] != 200 {
+			t.Errorf("Expected 200 taken off the credit, got %+v", result.Return)
+		}
+		var credit models.CreditTransaction
+		db.First(&credit)
+		if credit.BalanceDue != 200 || credit.CreditAmount != 200 {
+			t.Errorf("Expected 200 still owed, got %+v", credit)
+		}
+	})
+
+	t.Run("Void pays back what the credit no longer covers", func(t *testing.T) {
+		// The customer has since paid 100 of the 200 owed
+		db.Model(&models.CreditTransaction{}).Where("receipt_id <> 0").Update("balance_due", 100)
+
+		w := call(sm.VoidSale, sale.ReceiptNumber, `{"reason":"Wrong customer"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		json.Unmarshal(w.Body.Bytes(), &result)
+		byMethod := refunded()
+		if result.Return.RefundMethod != models.PaymentSplit || result.Return.RefundAmount != 800 ||
+			result.Return.CreditReversed != 100 || byMethod["CREDIT"] != 100 || byMethod["CASH"] != 700 {
+			t.Errorf("Expected 100 off the credit and 700 in cash, got %+v", result.Return)
+		}
+		var credit models.CreditTransaction
+		db.First(&credit)
+		if credit.Status != models.CreditReversed || credit.BalanceDue != 0 {
+			t.Errorf("Expected credit reversed with nothing due, got %s owing %v", credit.Status, credit.BalanceDue)
+		}
+	})
+
+	t.Run("Takings net off refunds by method", func(t *testing.T) {
+		w := call(sm.FetchSalesMetrics, "", "")
+		var metrics struct {
+			TenderBreakdown []struct {
+				Method  string  `json:"method"`
+				Amount  float64 `json:"amount"`
+				Refunds float64 `json:"refunds"`
+			} `json:"tenderBreakdown"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &metrics)
+		refunds := map[string]float64{}
+		for _, tender := range metrics.TenderBreakdown {
+			refunds[tender.Method] = tender.Refunds
+		}
+		if refunds["CASH"] != 700 || refunds["CREDIT"] != 300 {
+			t.Errorf("Expected 700 cash and 300 credit refunded, got %+v", metrics.TenderBreakdown)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// concurrencyTestDatabases returns a file-backed SQLite database and, when
+// BIASHARATRACK_TEST_MYSQL_DSN is set, a MySQL database to run the sale race against.
+func concurrencyTestDatabases(t *testing.T) map[string]*gorm.DB {
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+	databases := make(map[string]*gorm.DB)
+
+	// BEGIN IMMEDIATE plus a busy timeout lets concurrent SQLite writers queue instead of failing
+	dsn := filepath.Join(t.TempDir(), "sales.db") + "?_busy_timeout=10000&_txlock=immediate&_journal_mode=WAL"
+	sqliteDB, err := gorm.Open(sqlite.Open(dsn), config)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	databases["sqlite"] = sqliteDB
+
+	if mysqlDSN := os.Getenv("BIASHARATRACK_TEST_MYSQL_DSN"); mysqlDSN != "" {
+		mysqlDB, err := gorm.Open(mysql.Open(mysqlDSN), config)
+		if err != nil {
+			t.Fatalf("Failed to open MySQL database: %v", err)
+		}
+		databases["mysql"] = mysqlDB
+	} else {
+		t.Log("BIASHARATRACK_TEST_MYSQL_DSN not set, skipping MySQL")
+	}
+
+	return databases
+}
+
+// salesTestModels lists every table a sale touches
+func salesTestModels() []interface{} {
+	return []interface{}{
+		&models.User{},
+		&models.Product{},
+		&models.Inventory{},
+		&models.StockMovement{},
+		&models.LowStockAlert{},
+		&models.CreditTransaction{},
+		&models.SalesTransaction{},
+		&models.Receipt{},
+		&models.Item{},
+		&models.BundleComponent{},
+		&models.BusinessSettings{},
+		&models.StockException{},
+		&models.SaleReturn{},
+		&models.SaleReturnItem{},
+		&models.SaleReturnRefund{},
+		&models.Promotion{},
+		&models.Coupon{},
+		&models.SaleDiscount{},
+		&models.ReceiptPayment{},
+		&models.PriceOverride{},
+		&models.PriceChange{},
+		&models.RegisterSession{},
+		&models.Customer{},
+		&models.LoyaltyMultiplier{},
+		&models.LoyaltyEntry{},
+		&models.ParkedSale{},
+		&models.Layaway{},
+		&models.LayawayLine{},
+		&models.LayawayReservation{},
+		&models.LayawayPayment{},
+		&models.Quotation{},
+		&models.QuotationItem{},
+		&models.SalesHourlyRollup{},
+		&models.SalesRollupState{},
+		&models.CustomerRFM{},
+	}
+}
+
+func TestSalesManagementHandler_ConcurrentSellProducts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const stock = 10
+	const tills = 40
+
+	for name, db := range concurrencyTestDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := db.AutoMigrate(salesTestModels()...); err != nil {
+				t.Fatalf("Failed to migrate: %v", err)
+			}
+
+			user := models.User{FullName: "Till Tester", Email: fmt.Sprintf("till-%s-%d@example.com", name, time.Now().UnixNano()), Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Nakuru"}
+			db.Create(&user)
+			product := models.Product{UserID: user.ID, Name: "Last Loaf", Price: 65, AverageCost: 50}
+			db.Create(&product)
+			db.Create(&models.Inventory{UserID: user.ID, ProductID: product.ID, Quantity: stock, LowStockThreshold: 2})
+
+			sm := controllers.NewSalesManagementHandler(db)
+			body := fmt.Sprintf(`{"products":[{"product_id":%d,"quantity":1,"amount":65}],"payment_method":"CASH"}`, product.ID)
+
+			var wg sync.WaitGroup
+			codes := make(chan int, tills)
+			for i := 0; i < tills; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w := httptest.NewRecorder()
+					c, _ := gin.CreateTestContext(w)
+					c.Request = httptest.NewRequest("POST", "/record-sale", bytes.NewBufferString(body))
+					c.Request.Header.Set("Content-Type", "application/json")
+					c.Set("userID", user.ID)
+					sm.SellProducts(c)
+					codes <- w.Code
+				}()
+			}
+			wg.Wait()
+			close(codes)
+
+			sold, rejected := 0, 0
+			for code := range codes {
+				switch code {
+				case http.StatusOK:
+					sold++
+				case http.StatusBadRequest:
+					rejected++
+				default:
+					t.Errorf("Unexpected status code %d", code)
+				}
+			}
+			if sold != stock || rejected != tills-stock {
+				t.Errorf("Expected %d sales and %d rejections, got %d and %d", stock, tills-stock, sold, rejected)
+			}
+
+			var inventory models.Inventory
+			db.Where("product_id = ?", product.ID).First(&inventory)
+			if inventory.Quantity != 0 {
+				t.Errorf("Expected stock to end at 0, got %d", inventory.Quantity)
+			}
+
+			var movements, sales int64
+			db.Model(&models.StockMovement{}).Where("product_id = ?", product.ID).Count(&movements)
+			db.Model(&models.SalesTransaction{}).Where("product_id = ?", product.ID).Count(&sales)
+			if movements != stock || sales != stock {
+				t.Errorf("Expected %d movements and sales, got %d and %d", stock, movements, sales)
+			}
+		})
+	}
+}
+
+func TestSalesManagementHandler_ConcurrentPointsRedemption(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const points = 100
+	const tills = 10
+
+	for name, db := range concurrencyTestDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := db.AutoMigrate(salesTestModels()...); err != nil {
+				t.Fatalf("Failed to migrate: %v", err)
+			}
+
+			user := models.User{FullName: "Till Tester", Email: fmt.Sprintf("points-%s-%d@example.com", name, time.Now().UnixNano()), Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Nakuru"}
+			db.Create(&user)
+			db.Create(&models.BusinessSettings{UserID: user.ID, NegativeStockPolicy: models.StockPolicyBlock, VATRate: 16,
+				TaxPricing: models.TaxInclusive, LoyaltyEnabled: true, PointsPerShilling: 0.1, PointValue: 1, PointsExpiryDays: 365})
+			product := models.Product{UserID: user.ID, Name: "Maandazi pack", Price: 30, AverageCost: 20}
+			db.Create(&product)
+			db.Create(&models.Inventory{UserID: user.ID, ProductID: product.ID, Quantity: 50, LowStockThreshold: 2})
+			customer := models.Customer{UserID: user.ID, Name: "Njeri", Phone: fmt.Sprintf("07%08d", time.Now().UnixNano()%100000000)}
+			db.Create(&customer)
+			db.Create(&models.LoyaltyEntry{UserID: user.ID, CustomerID: customer.ID, Type: models.LoyaltyEarn, Points: points, Remaining: points})
+
+			sm := controllers.NewSalesManagementHandler(db)
+			body := fmt.Sprintf(`{"products":[{"product_id":%d,"quantity":1}],"payments":[{"method":"POINTS","amount":30}],"customer_id":%d}`, product.ID, customer.ID)
+
+			var wg sync.WaitGroup
+			codes := make(chan int, tills)
+			for i := 0; i < tills; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w := httptest.NewRecorder()
+					c, _ := gin.CreateTestContext(w)
+					c.Request = httptest.NewRequest("POST", "/record-sale", bytes.NewBufferString(body))
+					c.Request.Header.Set("Content-Type", "application/json")
+					c.Set("userID", user.ID)
+					sm.SellProducts(c)
+					codes <- w.Code
+				}()
+			}
+			wg.Wait()
+			close(codes)
+
+			redeemed := 0
+			for code := range codes {
+				switch code {
+				case http.StatusOK:
+					redeemed++
+				case http.StatusBadRequest:
+				default:
+					t.Errorf("Unexpected status code %d", code)
+				}
+			}
+			var remaining int
+			db.Model(&models.LoyaltyEntry{}).Where("customer_id = ?", customer.ID).Select("COALESCE(SUM(remaining), 0)").Scan(&remaining)
+			if redeemed != points/30 || remaining != points-redeemed*30 {
+				t.Errorf("Expected %d redemptions leaving %d points, got %d leaving %d", points/30, points%30, redeemed, remaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSettingsHandler_ZeroValues(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+
+	sh := controllers.NewSettingsHandler(db)
+	call := func(handler gin.HandlerFunc, method, body string) models.BusinessSettings {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, "/settings", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("userID", uint(1))
+		handler(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var settings models.BusinessSettings
+		json.Unmarshal(w.Body.Bytes(), &settings)
+		return settings
+	}
+
+	for _, field := range []string{"points_expiry_days", "vat_rate", "layaway_deposit_percent", "points_per_shilling"} {
+		t.Run("First save keeps "+field+" at zero", func(t *testing.T) {
+			db.Where("user_id = ?", 1).Delete(&models.BusinessSettings{})
+			call(sh.UpdateSettings, "PUT", `{"`+field+`":0}`)
+
+			settings := call(sh.GetSettings, "GET", "")
+			values := map[string]float64{
+				"points_expiry_days":      float64(settings.PointsExpiryDays),
+				"vat_rate":                settings.VATRate,
+				"layaway_deposit_percent": settings.LayawayDepositPercent,
+				"points_per_shilling":     settings.PointsPerShilling,
+			}
+			if values[field] != 0 || settings.ID == 0 {
+				t.Errorf("Expected %s saved as 0, got %+v", field, settings)
+			}
+		})
+	}
+
+	t.Run("Later saves leave other fields alone", func(t *testing.T) {
+		call(sh.UpdateSettings, "PUT", `{"vat_rate":0}`)
+		settings := call(sh.GetSettings, "GET", "")
+		if settings.VATRate != 0 || settings.PointsPerShilling != 0 || settings.LayawayDays != models.DefaultLayawayDays {
+			t.Errorf("Expected zeros kept and defaults elsewhere, got %+v", settings)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestStaffRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(salesTestModels()...)
+	db.Create(&models.User{ID: 1, FullName: "Owner", Email: "owner@example.com", Password: "x", BusinessName: "Duka", Telephone: "0700000000", Location: "Kisumu", Role: models.RoleOwner})
+	db.Create(&models.User{ID: 9, FullName: "Other Owner", Email: "other@example.com", Password: "x", BusinessName: "Kiosk", Telephone: "0700000009", Location: "Nakuru", Role: models.RoleOwner})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Sugar 1kg", Price: 150, AverageCost: 120})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 10, LowStockThreshold: 1})
+
+	sh := controllers.NewStaffHandler(db)
+	sm := controllers.NewSalesManagementHandler(db)
+	call := func(handler gin.HandlerFunc, staffID uint, params gin.Params, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = params
+		c.Set("userID", uint(1))
+		if staffID != 0 {
+			c.Set("staffID", staffID)
+		}
+		handler(c)
+		return w
+	}
+
+	w := call(sm.SellProducts, 0, nil, `{"products":[{"product_id":1,"quantity":2,"amount":300}],"payment_method":"CASH"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected sale to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var sale struct {
+		ReceiptNumber string `json:"receiptNumber"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &sale)
+	receipt := gin.Params{{Key: "receiptNumber", Value: sale.ReceiptNumber}}
+
+	var cashier struct {
+		ID   uint   `json:"id"`
+		Role string `json:"role"`
+	}
+	t.Run("Owner adds a cashier", func(t *testing.T) {
+		w := call(sh.CreateStaff, 0, nil, `{"full_name":"Wanjiru","email":"wanjiru@example.com","password":"secret","role":"cashier"}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+		}
+		json.Unmarshal(w.Body.Bytes(), &cashier)
+		if cashier.ID == 0 || cashier.Role != models.RoleCashier {
+			t.Fatalf("Expected a cashier login, got %+v", cashier)
+		}
+		var staff models.User
+		db.First(&staff, cashier.ID)
+		if staff.BusinessID == nil || *staff.BusinessID != 1 || staff.Password == "secret" {
+			t.Errorf("Expected a hashed login under business 1, got %+v", staff)
+		}
+
+		w = call(sh.CreateStaff, 0, nil, `{"full_name":"Wanjiru","email":"wanjiru@example.com","password":"secret","role":"CASHIER"}`)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status code %d for a taken email, but got %d", http.StatusConflict, w.Code)
+		}
+		w = call(sh.CreateStaff, 0, nil, `{"full_name":"Otieno","email":"otieno@example.com","password":"secret","role":"OWNER"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for a second owner, but got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("Cashier is refused", func(t *testing.T) {
+		w := call(sm.VoidSale, cashier.ID, receipt, `{"reason":"Wrong customer"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+		}
+		w = call(sh.CreateStaff, cashier.ID, nil, `{"full_name":"Otieno","email":"otieno@example.com","password":"secret","role":"MANAGER"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+		}
+		path := gin.Params{{Key: "id", Value: fmt.Sprint(cashier.ID)}}
+		w = call(sh.UpdateStaffRole, cashier.ID, path, `{"role":"MANAGER"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected a cashier not to promote themselves, got %d", w.Code)
+		}
+	})
+
+	t.Run("Another business's login is refused", func(t *testing.T) {
+		w := call(sm.VoidSale, 9, receipt, `{"reason":"Wrong customer"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+		}
+	})
+
+	t.Run("Promoted manager may void", func(t *testing.T) {
+		path := gin.Params{{Key: "id", Value: fmt.Sprint(cashier.ID)}}
+		w := call(sh.UpdateStaffRole, 0, path, `{"role":"MANAGER"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		w = call(sm.VoidSale, cashier.ID, receipt, `{"reason":"Wrong customer"}`)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var staff []map[string]any
+		json.Unmarshal(call(sh.GetStaff, 0, nil, "").Body.Bytes(), &staff)
+		if len(staff) != 1 || staff[0]["role"] != models.RoleManager || staff[0]["password"] != nil {
+			t.Errorf("Expected one manager without a password, got %+v", staff)
+		}
+	})
+}
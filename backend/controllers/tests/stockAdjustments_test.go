@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestInventoryManagementHandler_AdjustStock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&models.Product{}, &models.Inventory{}, &models.StockMovement{}, &models.LowStockAlert{}, &models.StockException{})
+	db.Create(&models.Product{ID: 1, UserID: 1, Name: "Milk 500ml", Price: 60, AverageCost: 45})
+	db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 20, LowStockThreshold: 5})
+
+	tests := []struct {
+		name             string
+		body             string
+		expectedCode     int
+		expectedQuantity int
+	}{
+		{name: "Expired stock written off", body: `{"reason_code":"expired","quantity":3,"note":"Past sell-by date"}`, expectedCode: http.StatusOK, expectedQuantity: 17},
+		{name: "Found stock added back", body: `{"reason_code":"FOUND","quantity":1}`, expectedCode: http.StatusOK, expectedQuantity: 18},
+		{name: "Unknown reason", body: `{"reason_code":"LOST_IN_SPACE","quantity":1}`, expectedCode: http.StatusBadRequest, expectedQuantity: 18},
+		{name: "Write-off larger than stock", body: `{"reason_code":"THEFT","quantity":50}`, expectedCode: http.StatusBadRequest, expectedQuantity: 18},
+		{name: "Missing quantity", body: `{"reason_code":"DAMAGED"}`, expectedCode: http.StatusBadRequest, expectedQuantity: 18},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im := controllers.NewInventoryManagementHandler(db)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("POST", "/adjust-stock/1", bytes.NewBufferString(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{gin.Param{Key: "id", Value: "1"}}
+			c.Set("userID", uint(1))
+
+			im.AdjustStock(c)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, but got %d: %s", tt.expectedCode, w.Code, w.Body.String())
+			}
+			var inventory models.Inventory
+			db.Where("product_id = ?", 1).First(&inventory)
+			if inventory.Quantity != tt.expectedQuantity {
+				t.Errorf("Expected quantity %d, but got %d", tt.expectedQuantity, inventory.Quantity)
+			}
+		})
+	}
+
+	t.Run("Shrinkage report valued at cost", func(t *testing.T) {
+		im := controllers.NewInventoryManagementHandler(db)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/shrinkage-report", nil)
+		c.Set("userID", uint(1))
+
+		im.GetShrinkageReport(c)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+		}
+		var body struct {
+			ShrinkageQuantity int     `json:"shrinkageQuantity"`
+			ShrinkageValue    float64 `json:"shrinkageValue"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body.ShrinkageQuantity != 2 || body.ShrinkageValue != 90 {
+			t.Errorf("Expected shrinkage of 2 units worth 90, got %d units worth %v", body.ShrinkageQuantity, body.ShrinkageValue)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSalesManagementHandler_NegativeStockPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name              string
+		policy            string
+		expectedCode      int
+		expectedQuantity  int
+		expectedException string
+	}{
+		{name: "Block rejects the sale", policy: models.StockPolicyBlock, expectedCode: http.StatusBadRequest, expectedQuantity: 2},
+		{name: "Allow negative sells past zero", policy: models.StockPolicyAllowNegative, expectedCode: http.StatusOK, expectedQuantity: -3, expectedException: models.StockExceptionNegative},
+		{name: "Backorder takes what is there", policy: models.StockPolicyBackorder, expectedCode: http.StatusOK, expectedQuantity: 0, expectedException: models.StockExceptionBackorder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+			db.AutoMigrate(salesTestModels()...)
+			db.Create(&models.BusinessSettings{UserID: 1, NegativeStockPolicy: tt.policy})
+			db.Create(&models.Product{ID: 1, UserID: 1, Name: "Unga 2kg", Price: 180, AverageCost: 150})
+			db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 2, LowStockThreshold: 1})
+
+			sm := controllers.NewSalesManagementHandler(db)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			body := `{"products":[{"product_id":1,"quantity":5,"amount":900}],"payment_method":"CASH"}`
+			c.Request = httptest.NewRequest("POST", "/record-sale", bytes.NewBufferString(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("userID", uint(1))
+
+			sm.SellProducts(c)
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("Expected status code %d, but got %d: %s", tt.expectedCode, w.Code, w.Body.String())
+			}
+			var inventory models.Inventory
+			db.Where("product_id = ?", 1).First(&inventory)
+			if inventory.Quantity != tt.expectedQuantity {
+				t.Errorf("Expected quantity %d, but got %d", tt.expectedQuantity, inventory.Quantity)
+			}
+
+			var exceptions []models.StockException
+			db.Find(&exceptions)
+			if tt.expectedException == "" {
+				if len(exceptions) != 0 {
+					t.Errorf("Expected no stock exceptions, got %d", len(exceptions))
+				}
+				return
+			}
+			if len(exceptions) != 1 || exceptions[0].Type != tt.expectedException || exceptions[0].QuantityShort != 3 {
+				t.Fatalf("Expected one %s exception short by 3, got %+v", tt.expectedException, exceptions)
+			}
+		})
+	}
+
+	t.Run("Received stock fulfils backorders", func(t *testing.T) {
+		db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		db.AutoMigrate(&models.Product{}, &models.Inventory{}, &models.StockMovement{}, &models.LowStockAlert{},
+			&models.PriceChange{}, &models.BundleComponent{}, &models.StockException{})
+		db.Create(&models.Product{ID: 1, UserID: 1, Name: "Unga 2kg", Price: 180, AverageCost: 150})
+		db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 0, LowStockThreshold: 1})
+		db.Create(&models.StockException{UserID: 1, ProductID: 1, Type: models.StockExceptionBackorder,
+			QuantityRequested: 5, QuantityShort: 3, QuantityOutstanding: 3, Status: models.StockExceptionOpen})
+
+		im := controllers.NewInventoryManagementHandler(db)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("PUT", "/update-product/1", bytes.NewBufferString(`{"quantity_change":10,"unit_cost":150}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{gin.Param{Key: "id", Value: "1"}}
+		c.Set("userID", uint(1))
+
+		im.UpdateProduct(c)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		var inventory models.Inventory
+		db.Where("product_id = ?", 1).First(&inventory)
+		var backorder models.StockException
+		db.First(&backorder)
+		if inventory.Quantity != 7 || backorder.Status != models.StockExceptionResolved || backorder.QuantityOutstanding != 0 {
+			t.Errorf("Expected 7 in stock and a resolved backorder, got %d and %s", inventory.Quantity, fmt.Sprintf("%s/%d", backorder.Status, backorder.QuantityOutstanding))
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSalesManagementHandler_SellProductsWithVAT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		pricing       string
+		expectedTotal float64
+		expectedTax   float64
+	}{
+		// Cooking oil 116 standard-rated, maize flour 100 zero-rated
+		{name: "Tax-inclusive prices", pricing: models.TaxInclusive, expectedTotal: 216, expectedTax: 16},
+		{name: "Tax-exclusive prices", pricing: models.TaxExclusive, expectedTotal: 234.56, expectedTax: 18.56},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+			db.AutoMigrate(salesTestModels()...)
+			db.Create(&models.BusinessSettings{UserID: 1, NegativeStockPolicy: models.StockPolicyBlock, VATRegistered: true, VATRate: 16, TaxPricing: tt.pricing})
+			db.Create(&models.Product{ID: 1, UserID: 1, Name: "Cooking oil 1L", Price: 116, TaxClass: models.TaxStandard})
+			db.Create(&models.Product{ID: 2, UserID: 1, Name: "Maize flour 2kg", Price: 100, TaxClass: models.TaxZeroRated})
+			db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 10})
+			db.Create(&models.Inventory{UserID: 1, ProductID: 2, Quantity: 10})
+
+			sm := controllers.NewSalesManagementHandler(db)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			body := `{"products":[{"product_id":1,"quantity":1},{"product_id":2,"quantity":1}],"payment_method":"CASH"}`
+			c.Request = httptest.NewRequest("POST", "/record-sale", bytes.NewBufferString(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("userID", uint(1))
+
+			sm.SellProducts(c)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			var receipt models.Receipt
+			db.First(&receipt)
+			if receipt.TotalAmount != tt.expectedTotal || receipt.TaxAmount != tt.expectedTax {
+				t.Errorf("Expected total %v with VAT %v, got %v with VAT %v", tt.expectedTotal, tt.expectedTax, receipt.TotalAmount, receipt.TaxAmount)
+			}
+
+			w = httptest.NewRecorder()
+			c, _ = gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/vat-summary", nil)
+			c.Set("userID", uint(1))
+
+			sm.FetchVATSummary(c)
+
+			var summary struct {
+				OutputVAT  float64 `json:"outputVAT"`
+				ByTaxClass []struct {
+					TaxClass string `json:"tax_class"`
+				} `json:"byTaxClass"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &summary)
+			if summary.OutputVAT != tt.expectedTax || len(summary.ByTaxClass) != 2 || summary.ByTaxClass[0].TaxClass != models.TaxStandard {
+				t.Errorf("Expected output VAT %v over standard and zero-rated sales, got %s", tt.expectedTax, w.Body.String())
+			}
+		})
+	}
+}
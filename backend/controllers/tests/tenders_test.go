@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSalesManagementHandler_SplitTenders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Two items at 500 and 300 make an 800 receipt
+	products := `"products":[{"product_id":1,"quantity":1},{"product_id":2,"quantity":1}]`
+	tests := []struct {
+		name            string
+		body            string
+		expectedCode    int
+		expectedMethod  string
+		expectedChange  float64
+		expectedCredits int
+		expectedCredit  float64
+	}{
+		{
+			name:           "Cash with change and M-Pesa",
+			body:           `{` + products + `,"payments":[{"method":"MPESA","amount":500,"reference":"QHX12ABC"},{"method":"cash","amount":500}]}`,
+			expectedCode:   http.StatusOK,
+			expectedMethod: models.PaymentSplit,
+			expectedChange: 200,
+		},
+		{
+			name:            "Cash deposit with credit remainder",
+			body:            `{` + products + `,"customer_name":"Wanjiru","customer_phone":"0722000000","payments":[{"method":"CASH","amount":300},{"method":"CREDIT"}]}`,
+			expectedCode:    http.StatusOK,
+			expectedMethod:  models.PaymentSplit,
+			expectedCredits: 1,
+			expectedCredit:  500,
+		},
+		{
+			name:         "Tenders short of the total",
+			body:         `{` + products + `,"payments":[{"method":"CASH","amount":300},{"method":"MPESA","amount":100,"reference":"QHX12ABD"}]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "M-Pesa overpays",
+			body:         `{` + products + `,"payments":[{"method":"MPESA","amount":900,"reference":"QHX12ABE"}]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "M-Pesa without reference",
+			body:         `{` + products + `,"payments":[{"method":"MPESA","amount":800}]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Two credit tenders",
+			body:         `{` + products + `,"customer_name":"Wanjiru","customer_phone":"0722000000","payments":[{"method":"CREDIT","amount":400},{"method":"CREDIT"}]}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Single payment method still works",
+			body:           `{` + products + `,"payment_method":"CASH","amount_paid":1000}`,
+			expectedCode:   http.StatusOK,
+			expectedMethod: "CASH",
+			expectedChange: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+			db.AutoMigrate(salesTestModels()...)
+			db.Create(&models.Product{ID: 1, UserID: 1, Name: "School shoes", Price: 500})
+			db.Create(&models.Product{ID: 2, UserID: 1, Name: "Socks", Price: 300})
+			db.Create(&models.Inventory{UserID: 1, ProductID: 1, Quantity: 5})
+			db.Create(&models.Inventory{UserID: 1, ProductID: 2, Quantity: 5})
+
+			sm := controllers.NewSalesManagementHandler(db)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("POST", "/record-sale", bytes.NewBufferString(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("userID", uint(1))
+
+			sm.SellProducts(c)
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("Expected status code %d, but got %d: %s", tt.expectedCode, w.Code, w.Body.String())
+			}
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var receipt models.Receipt
+			db.Preload("Payments").First(&receipt)
+			var paid float64
+			for _, payment := range receipt.Payments {
+				paid += payment.Amount
+			}
+			if receipt.PaymentMethod != tt.expectedMethod || receipt.ChangeGiven != tt.expectedChange || paid != receipt.TotalAmount {
+				t.Errorf("Expected %s receipt with change %v and payments adding up to %v, got %s, %v and %v",
+					tt.expectedMethod, tt.expectedChange, receipt.TotalAmount, receipt.PaymentMethod, receipt.ChangeGiven, paid)
+			}
+
+			var credits []models.CreditTransaction
+			db.Find(&credits)
+			if len(credits) != tt.expectedCredits {
+				t.Fatalf("Expected %d credit entries, got %d", tt.expectedCredits, len(credits))
+			}
+			if tt.expectedCredits == 1 && (credits[0].CreditAmount != tt.expectedCredit || credits[0].BalanceDue != tt.expectedCredit) {
+				t.Errorf("Expected credit of %v, got %+v", tt.expectedCredit, credits[0])
+			}
+		})
+	}
+}
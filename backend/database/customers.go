@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// customerContact is a name and phone number copied onto a sale or credit
+type customerContact struct {
+	UserID uint
+	Name   string
+	Phone  string
+}
+
+// backfillCustomers creates a Customer for every phone number recorded on
+// sales and credits before customers existed and links those rows, and
+// their receipts, to it. Rows already linked are skipped so it is safe to
+// run on every start.
+func backfillCustomers(db *gorm.DB) error {
+	var contacts []customerContact
+	if err := db.Model(&models.SalesTransaction{}).
+		Select("user_id, customer_name as name, customer_phone as phone").
+		Where("customer_id IS NULL AND customer_phone <> ''").
+		Order("created_at").
+		Scan(&contacts).Error; err != nil {
+		return fmt.Errorf("load sale customers: %w", err)
+	}
+	var creditContacts []customerContact
+	if err := db.Model(&models.CreditTransaction{}).
+		Select("user_id, name, phone_number as phone").
+		Where("customer_id IS NULL AND phone_number <> ''").
+		Order("created_at").
+		Scan(&creditContacts).Error; err != nil {
+		return fmt.Errorf("load credit customers: %w", err)
+	}
+	contacts = append(contacts, creditContacts...)
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	type customerKey struct {
+		UserID uint
+		Phone  string
+	}
+	// Later rows win, so a customer gets the name they were last recorded under
+	names := map[customerKey]string{}
+	rawPhones := map[customerKey]map[string]bool{}
+	for _, contact := range contacts {
+		phone, err := utils.NormalisePhone(contact.Phone)
+		if err != nil {
+			utils.WarningLogger("Skipping customer backfill for unrecognised phone %q: %v", contact.Phone, err)
+			continue
+		}
+		key := customerKey{contact.UserID, phone}
+		if name := strings.TrimSpace(contact.Name); name != "" {
+			names[key] = name
+		} else if _, ok := names[key]; !ok {
+			names[key] = ""
+		}
+		if rawPhones[key] == nil {
+			rawPhones[key] = map[string]bool{}
+		}
+		rawPhones[key][contact.Phone] = true
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for key, name := range names {
+			if name == "" {
+				name = key.Phone
+			}
+			customer := models.Customer{UserID: key.UserID, Name: name, Phone: key.Phone}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&customer).Error; err != nil {
+				return fmt.Errorf("create customer %s: %w", key.Phone, err)
+			}
+			if err := tx.Where("user_id = ? AND phone = ?", key.UserID, key.Phone).First(&customer).Error; err != nil {
+				return fmt.Errorf("load customer %s: %w", key.Phone, err)
+			}
+
+			for raw := range rawPhones[key] {
+				if err := tx.Model(&models.SalesTransaction{}).
+					Where("user_id = ? AND customer_phone = ? AND customer_id IS NULL", key.UserID, raw).
+					Update("customer_id", customer.ID).Error; err != nil {
+					return fmt.Errorf("link sales to customer %d: %w", customer.ID, err)
+				}
+				if err := tx.Model(&models.CreditTransaction{}).
+					Where("user_id = ? AND phone_number = ? AND customer_id IS NULL", key.UserID, raw).
+					Update("customer_id", customer.ID).Error; err != nil {
+					return fmt.Errorf("link credits to customer %d: %w", customer.ID, err)
+				}
+			}
+		}
+
+		// Receipts take the customer of their sales, or of their credit
+		for _, source := range []string{"sales_transactions", "credit_transactions"} {
+			if err := tx.Exec(`UPDATE receipts SET customer_id = (
+					SELECT MIN(s.customer_id) FROM ` + source + ` s WHERE s.receipt_id = receipts.id AND s.customer_id IS NOT NULL
+				) WHERE customer_id IS NULL AND EXISTS (
+					SELECT 1 FROM ` + source + ` s WHERE s.receipt_id = receipts.id AND s.customer_id IS NOT NULL
+				)`).Error; err != nil {
+				return fmt.Errorf("link receipts to customers: %w", err)
+			}
+		}
+
+		utils.InfoLogger("Backfilled %d customers from sales and credits", len(names))
+		return nil
+	})
+}
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"gorm.io/gorm"
+)
+
+// backfillReservationCosts values stock reserved by open layaways before
+// reservations carried a cost at the product's current average cost, so
+// releasing it does not drag the average towards zero. Reservations that
+// already have a cost are skipped so it is safe to run on every start.
+func backfillReservationCosts(db *gorm.DB) error {
+	result := db.Exec(`UPDATE layaway_reservations
+		SET unit_cost = (SELECT p.average_cost FROM products p WHERE p.id = layaway_reservations.product_id)
+		WHERE unit_cost = 0 AND layaway_id IN (SELECT l.id FROM layaways l WHERE l.status = ?)`, models.LayawayOpen)
+	if result.Error != nil {
+		return fmt.Errorf("backfill reservation costs: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		utils.InfoLogger("Backfilled costs for %d layaway reservations", result.RowsAffected)
+	}
+	return nil
+}
@@ -18,9 +18,43 @@ func (d *DB) Migrate() error {
 		&models.SalesTransaction{},
 		&models.Receipt{},
 		&models.Item{},
+		&models.PriceChange{},
+		&models.BundleComponent{},
+		&models.StockException{},
+		&models.BusinessSettings{},
+		&models.SaleReturn{},
+		&models.SaleReturnItem{},
+		&models.SaleReturnRefund{},
+		&models.Promotion{},
+		&models.Coupon{},
+		&models.SaleDiscount{},
+		&models.ReceiptPayment{},
+		&models.PriceOverride{},
+		&models.IdempotencyKey{},
+		&models.RegisterSession{},
+		&models.RegisterMovement{},
+		&models.Customer{},
+		&models.LoyaltyMultiplier{},
+		&models.LoyaltyEntry{},
+		&models.ParkedSale{},
+		&models.Layaway{},
+		&models.LayawayLine{},
+		&models.LayawayReservation{},
+		&models.LayawayPayment{},
+		&models.Quotation{},
+		&models.QuotationItem{},
+		&models.SalesHourlyRollup{},
+		&models.SalesRollupState{},
+		&models.CustomerRFM{},
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+	if err := backfillCustomers(d.DB); err != nil {
+		return err
+	}
+	if err := backfillReturnRefunds(d.DB); err != nil {
+		return err
+	}
+	return backfillReservationCosts(d.DB)
 }
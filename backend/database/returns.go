@@ -0,0 +1,27 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"gorm.io/gorm"
+)
+
+// backfillReturnRefunds records the refund of every return made before
+// refunds were split by method as one refund by its RefundMethod. Returns
+// that already have refunds are skipped so it is safe to run on every start.
+func backfillReturnRefunds(db *gorm.DB) error {
+	result := db.Exec(`INSERT INTO sale_return_refunds (user_id, sale_return_id, method, amount, reference, created_at)
+		SELECT r.user_id, r.id, r.refund_method, r.refund_amount, r.refund_reference, r.created_at
+		FROM sale_returns r
+		WHERE r.refund_amount > 0 AND NOT EXISTS (
+			SELECT 1 FROM sale_return_refunds f WHERE f.sale_return_id = r.id
+		)`)
+	if result.Error != nil {
+		return fmt.Errorf("backfill return refunds: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		utils.InfoLogger("Backfilled refunds for %d returns", result.RowsAffected)
+	}
+	return nil
+}
@@ -4,9 +4,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
 	"github.com/OAthooh/BiasharaTrack.git/database"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
 	"github.com/OAthooh/BiasharaTrack.git/routes"
+	"github.com/OAthooh/BiasharaTrack.git/scheduler"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -50,7 +55,8 @@ func main() {
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:5173", callbackURL}
 	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", middleware.IdempotencyHeader}
+	config.ExposeHeaders = []string{middleware.IdempotentReplayedHeader, controllers.NextCursorHeader, controllers.TotalCountHeader}
 	router.Use(cors.New(config))
 
 	fmt.Println("Gin router initialized successfully")
@@ -62,6 +68,40 @@ func main() {
 	routes.SalesManagementRoutes(router, db.DB)
 	routes.MpesaRoutes(router, db.DB)
 	routes.SetupReceiptRoutes(router, db.DB)
+	routes.SettingsRoutes(router, db.DB)
+	routes.PromotionRoutes(router, db.DB)
+	routes.RegisterRoutes(router, db.DB)
+	routes.CustomerRoutes(router, db.DB)
+	routes.LayawayRoutes(router, db.DB)
+	routes.QuotationRoutes(router, db.DB)
+	routes.StaffRoutes(router, db.DB)
+
+	// Start background jobs
+	stopPriceChanges := scheduler.Every("apply-price-changes", time.Minute, func() error {
+		_, err := controllers.ApplyDuePriceChanges(db.DB, time.Now())
+		return err
+	})
+	defer stopPriceChanges()
+	stopIdempotencyPurge := scheduler.Every("purge-idempotency-keys", time.Hour, func() error {
+		_, err := middleware.PurgeIdempotencyKeys(db.DB, time.Now())
+		return err
+	})
+	defer stopIdempotencyPurge()
+	stopPointsExpiry := scheduler.Every("expire-loyalty-points", time.Hour, func() error {
+		_, err := controllers.ExpireLoyaltyPoints(db.DB, time.Now())
+		return err
+	})
+	defer stopPointsExpiry()
+	stopLayawayExpiry := scheduler.Every("expire-layaways", time.Hour, func() error {
+		_, err := controllers.ExpireLayaways(db.DB, time.Now())
+		return err
+	})
+	defer stopLayawayExpiry()
+	stopRFMSegments := scheduler.Daily("compute-rfm-segments", 2, 0, func() error {
+		_, err := controllers.ComputeRFMSegments(db.DB, time.Now())
+		return err
+	})
+	defer stopRFMSegments()
 
 	fmt.Println("Server is running on port 8080")
 	// Start server on port 8080
@@ -56,6 +56,11 @@ func AuthMiddleware() gin.HandlerFunc {
 			if userID, ok := claims["user_id"].(float64); ok {
 				c.Set("userID", uint(userID))
 			}
+			// staffID is the login acting for the business, which decides
+			// what it may do. Tokens from before staff logins act as the owner.
+			if staffID, ok := claims["staff_id"].(float64); ok {
+				c.Set("staffID", uint(staffID))
+			}
 		}
 
 		c.Next()
@@ -0,0 +1,227 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/models"
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// IdempotencyHeader is the request header carrying the client's key
+	IdempotencyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response replayed from an earlier request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	defaultIdempotencyRetention = 24 * time.Hour
+	// A request still in progress after this long is taken to have died
+	// with the server and its key may be used again
+	idempotencyLockTimeout  = 2 * time.Minute
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotencyRetention is how long keys are kept, from IDEMPOTENCY_RETENTION_HOURS
+func idempotencyRetention() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_RETENTION_HOURS")); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultIdempotencyRetention
+}
+
+func sha256Hex(parts ...[]byte) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write(part)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotencyWriter keeps a copy of the response so it can be replayed
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes a route safe to retry. Requests with an Idempotency-Key
+// header are processed once; repeats with the same body get the stored
+// response, repeats with a different body are rejected with 422, and
+// repeats while the first is still running are rejected with 409. Only
+// successful responses are stored: a refused request did nothing and a
+// server error rolled its database work back, so the key is released and
+// the client can correct the request and retry it. Keys belong to the
+// signed-in user, or on routes without a login to the client address, so
+// callers cannot replay each other's responses.
+func Idempotency(db *gorm.DB) gin.HandlerFunc {
+	return idempotency(db, false)
+}
+
+// IdempotencyWithSideEffects is Idempotency for routes that call outside
+// services, which a server error does not undo. A server error keeps the
+// key as failed and repeats get the failure back, so the outside call is
+// not made twice; the client checks what happened and retries with a new
+// key. Refused requests still release the key.
+func IdempotencyWithSideEffects(db *gorm.DB) gin.HandlerFunc {
+	return idempotency(db, true)
+}
+
+func idempotency(db *gorm.DB, sideEffects bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(400, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.ErrorLogger("Failed to read request body: %v", err)
+			c.JSON(400, gin.H{"error": "Invalid request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		userID := c.GetUint("userID")
+		keyHash := sha256Hex([]byte(key))
+		if userID == 0 {
+			keyHash = sha256Hex([]byte(key), []byte(c.ClientIP()))
+		}
+		record := models.IdempotencyKey{
+			UserID:      userID,
+			Path:        c.Request.URL.Path,
+			KeyHash:     keyHash,
+			RequestHash: sha256Hex([]byte(c.Request.Method), []byte(c.Request.URL.Path), body),
+			Status:      models.IdempotencyInProgress,
+			ExpiresAt:   now.Add(idempotencyRetention()),
+		}
+
+		claimed, err := claimIdempotencyKey(db, &record, now)
+		if err != nil {
+			utils.ErrorLogger("Failed to claim idempotency key for %s: %v", record.Path, err)
+			c.JSON(500, gin.H{"error": "Failed to process request"})
+			c.Abort()
+			return
+		}
+		if !claimed {
+			replayIdempotentResponse(c, db, record)
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		status := models.IdempotencyCompleted
+		switch {
+		case writer.Status() >= 500 && sideEffects:
+			status = models.IdempotencyFailed
+		case writer.Status() >= 400:
+			if err := db.Delete(&models.IdempotencyKey{}, record.ID).Error; err != nil {
+				utils.ErrorLogger("Failed to release idempotency key %d: %v", record.ID, err)
+			}
+			return
+		}
+		if err := db.Model(&models.IdempotencyKey{}).Where("id = ?", record.ID).Updates(map[string]interface{}{
+			"status":        status,
+			"response_code": writer.Status(),
+			"response_body": writer.body.String(),
+		}).Error; err != nil {
+			utils.ErrorLogger("Failed to store response for idempotency key %d: %v", record.ID, err)
+		}
+	}
+}
+
+// claimIdempotencyKey inserts the key as in progress. It returns false when
+// another live request already holds it. Expired keys and abandoned
+// in-progress keys are cleared and claimed again.
+func claimIdempotencyKey(db *gorm.DB, record *models.IdempotencyKey, now time.Time) (bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return true, nil
+		}
+		record.ID = 0
+
+		cleared := db.Where("user_id = ? AND path = ? AND key_hash = ?", record.UserID, record.Path, record.KeyHash).
+			Where("expires_at <= ? OR (status = ? AND created_at <= ?)", now, models.IdempotencyInProgress, now.Add(-idempotencyLockTimeout)).
+			Delete(&models.IdempotencyKey{})
+		if cleared.Error != nil {
+			return false, cleared.Error
+		}
+		if cleared.RowsAffected == 0 {
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// replayIdempotentResponse answers a repeated key from the stored request
+func replayIdempotentResponse(c *gin.Context, db *gorm.DB, record models.IdempotencyKey) {
+	defer c.Abort()
+
+	var existing models.IdempotencyKey
+	err := db.Where("user_id = ? AND path = ? AND key_hash = ?", record.UserID, record.Path, record.KeyHash).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The first request failed and released the key in the meantime
+		c.JSON(409, gin.H{"error": "A request with this Idempotency-Key is being retried, please try again"})
+		return
+	}
+	if err != nil {
+		utils.ErrorLogger("Failed to load idempotency key for %s: %v", record.Path, err)
+		c.JSON(500, gin.H{"error": "Failed to process request"})
+		return
+	}
+
+	if existing.RequestHash != record.RequestHash {
+		utils.WarningLogger("Idempotency key reused with a different request on %s", record.Path)
+		c.JSON(422, gin.H{"error": "Idempotency-Key has already been used for a different request"})
+		return
+	}
+	if existing.Status == models.IdempotencyInProgress {
+		c.JSON(409, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+		return
+	}
+	if existing.Status == models.IdempotencyFailed {
+		utils.WarningLogger("Replaying failed request for idempotency key %d on %s", existing.ID, existing.Path)
+	}
+
+	utils.InfoLogger("Replaying response for idempotency key %d on %s", existing.ID, existing.Path)
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(existing.ResponseCode, "application/json; charset=utf-8", []byte(existing.ResponseBody))
+}
+
+// PurgeIdempotencyKeys deletes keys past their retention window
+func PurgeIdempotencyKeys(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
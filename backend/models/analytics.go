@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// SalesHourlyRollup is the sales of one product in one hour of one day, in
+// the business's timezone. It is built up from sales transactions as they
+// come in so reports over long windows do not rescan every sale.
+type SalesHourlyRollup struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_sales_rollup_cell" json:"user_id"`
+	User      User   `gorm:"foreignKey:UserID" json:"-"`
+	ProductID uint   `gorm:"not null;uniqueIndex:idx_sales_rollup_cell" json:"product_id"`
+	Day       string `gorm:"type:varchar(10);not null;uniqueIndex:idx_sales_rollup_cell" json:"day"`
+	Hour      int    `gorm:"not null;uniqueIndex:idx_sales_rollup_cell" json:"hour"`
+	// Weekday runs from 0 for Sunday to 6 for Saturday
+	Weekday int `gorm:"not null" json:"weekday"`
+	// Transactions counts sales lines; returns only take off quantity and revenue
+	Transactions int       `gorm:"not null;default:0" json:"transactions"`
+	Quantity     int       `gorm:"not null;default:0" json:"quantity"`
+	Revenue      float64   `gorm:"not null;default:0" json:"revenue"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// SalesRollupState records the timezone a business's rollup was built in,
+// so a change of timezone rebuilds it
+type SalesRollupState struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;uniqueIndex" json:"user_id"`
+	User        User      `gorm:"foreignKey:UserID" json:"-"`
+	Timezone    string    `gorm:"type:varchar(64);not null" json:"timezone"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+// Customer segments from recency, frequency and monetary scores
+const (
+	SegmentChampions         = "champions"
+	SegmentLoyal             = "loyal"
+	SegmentPotentialLoyalist = "potential_loyalist"
+	SegmentNew               = "new"
+	SegmentPromising         = "promising"
+	SegmentNeedAttention     = "need_attention"
+	SegmentAtRisk            = "at_risk"
+	SegmentCantLose          = "cant_lose"
+	SegmentHibernating       = "hibernating"
+	SegmentLost              = "lost"
+)
+
+// CustomerRFM is a customer's recency, frequency and monetary standing
+// among the business's customers, keyed by the phone number their sales
+// were recorded with. Scores run from 1 to 5, higher being better.
+type CustomerRFM struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	UserID         uint      `gorm:"not null;uniqueIndex:idx_customer_rfm_phone;index:idx_customer_rfm_segment" json:"user_id"`
+	User           User      `gorm:"foreignKey:UserID" json:"-"`
+	CustomerPhone  string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_customer_rfm_phone" json:"customer_phone"`
+	CustomerName   string    `json:"customer_name"`
+	LastPurchaseAt time.Time `json:"last_purchase_at"`
+	// RecencyDays is how long ago the last purchase was
+	RecencyDays    int       `gorm:"not null" json:"recency_days"`
+	Frequency      int       `gorm:"not null" json:"frequency"`
+	Monetary       float64   `gorm:"not null" json:"monetary"`
+	RecencyScore   int       `gorm:"not null" json:"recency_score"`
+	FrequencyScore int       `gorm:"not null" json:"frequency_score"`
+	MonetaryScore  int       `gorm:"not null" json:"monetary_score"`
+	Segment        string    `gorm:"type:varchar(30);not null;index:idx_customer_rfm_segment" json:"segment"`
+	ComputedAt     time.Time `json:"computed_at"`
+}
@@ -15,14 +15,41 @@ type Register struct {
 	Telephone    string `json:"telephone"`
 	Location     string `json:"location"`
 }
+
+// Staff roles
+const (
+	RoleOwner   = "OWNER"
+	RoleManager = "MANAGER"
+	RoleCashier = "CASHIER"
+)
+
+// Permissions granted to roles
+const (
+	PermissionVoidSale        = "VOID_SALE"
+	PermissionOverridePrice   = "OVERRIDE_PRICE"
+	PermissionReviewOverrides = "REVIEW_OVERRIDES"
+	PermissionManageStaff     = "MANAGE_STAFF"
+)
+
+// RolePermissions lists what each role may do beyond recording sales
+var RolePermissions = map[string]map[string]bool{
+	RoleOwner:   {PermissionVoidSale: true, PermissionOverridePrice: true, PermissionReviewOverrides: true, PermissionManageStaff: true},
+	RoleManager: {PermissionVoidSale: true, PermissionOverridePrice: true},
+	RoleCashier: {},
+}
+
 type User struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	FullName     string    `gorm:"not null" json:"fullName"`
-	Email        string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"email"`
-	Password     string    `gorm:"not null" json:"password"`
-	BusinessName string    `gorm:"not null" json:"businessName"`
-	Telephone    string    `gorm:"not null" json:"telephone"`
-	Location     string    `gorm:"not null" json:"location"`
-	CreatedAt    time.Time `gorm:"autoCreateTime" json:"createdAt"`
-	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	FullName     string `gorm:"not null" json:"fullName"`
+	Email        string `gorm:"type:varchar(255);uniqueIndex;not null" json:"email"`
+	Password     string `gorm:"not null" json:"password"`
+	BusinessName string `gorm:"not null" json:"businessName"`
+	Telephone    string `gorm:"not null" json:"telephone"`
+	Location     string `gorm:"not null" json:"location"`
+	Role         string `gorm:"type:varchar(20);not null;default:'OWNER'" json:"role"`
+	// BusinessID is the owner's user ID for a staff login. Staff work on the
+	// owner's data under their own role; owners have none.
+	BusinessID *uint     `gorm:"index" json:"businessId,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 }
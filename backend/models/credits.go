@@ -11,17 +11,30 @@ type CreditCustomer struct {
 	LastPaymentDate time.Time `json:"last_payment_date"`
 	Status          string    `json:"status"`
 }
+
+// Credit transaction statuses
+const (
+	CreditPending   = "PENDING"
+	CreditPaid      = "PAID"
+	CreditCancelled = "CANCELLED"
+	CreditReversed  = "REVERSED"
+)
+
 type CreditTransaction struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	UserID       uint      `gorm:"not null" json:"user_id"`
-	User         User      `gorm:"foreignKey:UserID" json:"-"`
-	ProductID    uint      `gorm:"not null" json:"product_id"`
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"not null" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+	// ProductID is only set on credits recorded per product before sales
+	// took split tenders; newer credits cover the credited part of a receipt
+	ProductID    *uint     `json:"product_id,omitempty"`
 	Product      Product   `gorm:"foreignKey:ProductID" json:"-"`
+	ReceiptID    uint      `gorm:"index" json:"receipt_id,omitempty"`
+	CustomerID   *uint     `gorm:"index" json:"customer_id,omitempty"`
 	Name         string    `gorm:"not null" json:"name"`
 	PhoneNumber  string    `json:"phone_number,omitempty"`
 	Quantity     int       `gorm:"not null" json:"quantity"`
 	BalanceDue   float64   `gorm:"not null" json:"balance_due"`
 	CreditAmount float64   `gorm:"not null" json:"credit_amount"`
-	Status       string    `gorm:"type:enum('PENDING','PAID','CANCELLED');default:'PENDING'" json:"status"`
+	Status       string    `gorm:"type:varchar(20);default:'PENDING'" json:"status"`
 	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
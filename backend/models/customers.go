@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Customer is one person who buys from a business, keyed on their phone
+// number normalised to 254XXXXXXXXX so the same person is not recorded
+// once per spelling of their name or number.
+type Customer struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_customer_phone" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"-"`
+	Name      string    `gorm:"not null" json:"name"`
+	Phone     string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_customer_phone" json:"phone"`
+	Email     string    `gorm:"type:varchar(255)" json:"email,omitempty"`
+	Notes     string    `gorm:"type:text" json:"notes,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Idempotency request states
+const (
+	IdempotencyInProgress = "IN_PROGRESS"
+	IdempotencyCompleted  = "COMPLETED"
+	// IdempotencyFailed is a server error on a route whose outside effects,
+	// such as an M-Pesa STK push, may already have happened
+	IdempotencyFailed = "FAILED"
+)
+
+// IdempotencyKey remembers a request sent with an Idempotency-Key header so
+// a retry gets the first response back instead of being processed again.
+// The key itself is stored hashed. UserID is 0 on unauthenticated routes.
+type IdempotencyKey struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"not null;uniqueIndex:idx_idempotency_key" json:"user_id"`
+	Path         string    `gorm:"type:varchar(191);not null;uniqueIndex:idx_idempotency_key" json:"path"`
+	KeyHash      string    `gorm:"type:char(64);not null;uniqueIndex:idx_idempotency_key" json:"key_hash"`
+	RequestHash  string    `gorm:"type:char(64);not null" json:"request_hash"`
+	Status       string    `gorm:"type:varchar(20);not null" json:"status"`
+	ResponseCode int       `gorm:"not null;default:0" json:"response_code"`
+	ResponseBody string    `gorm:"type:text" json:"response_body"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -10,11 +10,30 @@ type Product struct {
 	Description string    `gorm:"type:text" json:"description,omitempty"`
 	Category    string    `json:"category,omitempty"`
 	Price       float64   `gorm:"not null" json:"price"`
+	CostPrice   float64   `gorm:"not null;default:0" json:"cost_price"`
+	AverageCost float64   `gorm:"not null;default:0" json:"average_cost"`
 	Barcode     string    `gorm:"type:varchar(255)" json:"barcode,omitempty"`
 	PhotoPath   string    `json:"photo_path,omitempty"`
 	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 	Active      bool      `gorm:"default:true" json:"active"`
+	IsBundle    bool      `gorm:"default:false" json:"is_bundle"`
+	TaxClass    string    `gorm:"type:varchar(20);not null;default:'STANDARD'" json:"tax_class"`
+	// NegativeStockPolicy overrides the business policy when set
+	NegativeStockPolicy string `gorm:"type:varchar(20)" json:"negative_stock_policy,omitempty"`
+}
+
+// BundleComponent links a bundle product to one of the products it is made of
+type BundleComponent struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null" json:"user_id"`
+	User        User      `gorm:"foreignKey:UserID" json:"-"`
+	BundleID    uint      `gorm:"not null;index" json:"bundle_id"`
+	Bundle      Product   `gorm:"foreignKey:BundleID" json:"-"`
+	ComponentID uint      `gorm:"not null" json:"component_id"`
+	Component   Product   `gorm:"foreignKey:ComponentID" json:"-"`
+	Quantity    int       `gorm:"not null" json:"quantity"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
 type Inventory struct {
@@ -33,18 +52,99 @@ func (Inventory) TableName() string {
 	return "inventory"
 }
 
+// StockMovement is one change to a product's stock. Sale movements carry
+// their receipt, and the bundle a component was sold in, so returns can
+// restore what the sale took.
 type StockMovement struct {
 	ID             uint      `gorm:"primaryKey" json:"id"`
 	UserID         uint      `gorm:"not null" json:"user_id"`
 	User           User      `gorm:"foreignKey:UserID" json:"-"`
 	ProductID      uint      `gorm:"not null" json:"product_id"`
 	Product        Product   `gorm:"foreignKey:ProductID" json:"-"`
-	ChangeType     string    `gorm:"type:enum('SALE','PURCHASE','ADJUSTMENT');not null" json:"change_type"`
+	ChangeType     string    `gorm:"type:varchar(30);not null" json:"change_type"`
+	ReasonCode     string    `gorm:"type:varchar(30);index" json:"reason_code,omitempty"`
 	QuantityChange int       `gorm:"not null" json:"quantity_change"`
+	UnitCost       float64   `gorm:"not null;default:0" json:"unit_cost"`
 	Note           string    `gorm:"type:text" json:"note,omitempty"`
+	ReceiptID      uint      `gorm:"index" json:"receipt_id,omitempty"`
+	BundleID       *uint     `json:"bundle_id,omitempty"`
 	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
+// Stock movement types
+const (
+	MovementSale           = "SALE"
+	MovementPurchase       = "PURCHASE"
+	MovementAdjustment     = "ADJUSTMENT"
+	MovementWriteOff       = "WRITE_OFF"
+	MovementSupplierReturn = "SUPPLIER_RETURN"
+	MovementCustomerReturn = "CUSTOMER_RETURN"
+	// MovementLayaway takes stock out when a layaway reserves it and puts
+	// it back when the layaway is completed or cancelled
+	MovementLayaway = "LAYAWAY"
+)
+
+// MovementTypes is the catalogue of valid StockMovement change types
+var MovementTypes = map[string]bool{
+	MovementSale:           true,
+	MovementPurchase:       true,
+	MovementAdjustment:     true,
+	MovementWriteOff:       true,
+	MovementSupplierReturn: true,
+	MovementCustomerReturn: true,
+	MovementLayaway:        true,
+}
+
+// StockReason describes why stock was adjusted outside of sales and purchases
+type StockReason struct {
+	Code       string `json:"code"`
+	Label      string `json:"label"`
+	ChangeType string `json:"change_type"`
+	Direction  int    `json:"direction"` // -1 removes stock, +1 adds it back
+	Shrinkage  bool   `json:"shrinkage"` // counts towards shrinkage (loss or recovery)
+}
+
+// StockReasons is the catalogue of reason codes accepted for stock adjustments
+var StockReasons = map[string]StockReason{
+	"DAMAGED":              {Code: "DAMAGED", Label: "Damaged", ChangeType: MovementWriteOff, Direction: -1, Shrinkage: true},
+	"EXPIRED":              {Code: "EXPIRED", Label: "Expired", ChangeType: MovementWriteOff, Direction: -1, Shrinkage: true},
+	"THEFT":                {Code: "THEFT", Label: "Theft", ChangeType: MovementWriteOff, Direction: -1, Shrinkage: true},
+	"OWN_USE":              {Code: "OWN_USE", Label: "Own use", ChangeType: MovementWriteOff, Direction: -1, Shrinkage: true},
+	"RETURNED_TO_SUPPLIER": {Code: "RETURNED_TO_SUPPLIER", Label: "Returned to supplier", ChangeType: MovementSupplierReturn, Direction: -1, Shrinkage: false},
+	"FOUND":                {Code: "FOUND", Label: "Found", ChangeType: MovementAdjustment, Direction: 1, Shrinkage: true},
+}
+
+// Stock exception types and statuses
+const (
+	StockExceptionNegative  = "NEGATIVE_STOCK"
+	StockExceptionBackorder = "BACKORDER"
+
+	StockExceptionOpen     = "OPEN"
+	StockExceptionResolved = "RESOLVED"
+)
+
+// StockException flags a sale made without enough stock on hand, either by
+// letting stock go negative or by backordering the units that were short.
+// BundleID is set when the product was short as a component of a bundle.
+type StockException struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	UserID              uint       `gorm:"not null;index" json:"user_id"`
+	User                User       `gorm:"foreignKey:UserID" json:"-"`
+	ProductID           uint       `gorm:"not null" json:"product_id"`
+	Product             Product    `gorm:"foreignKey:ProductID" json:"-"`
+	ReceiptID           uint       `json:"receipt_id"`
+	BundleID            *uint      `json:"bundle_id,omitempty"`
+	Type                string     `gorm:"type:varchar(20);not null" json:"type"`
+	QuantityRequested   int        `gorm:"not null" json:"quantity_requested"`
+	QuantityShort       int        `gorm:"not null" json:"quantity_short"`
+	QuantityOutstanding int        `gorm:"not null;default:0" json:"quantity_outstanding"`
+	StockAfter          int        `json:"stock_after"`
+	Status              string     `gorm:"type:varchar(20);not null;default:'OPEN'" json:"status"`
+	Note                string     `gorm:"type:text" json:"note,omitempty"`
+	ResolvedAt          *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt           time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
 type LowStockAlert struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
 	UserID       uint      `gorm:"not null" json:"user_id"`
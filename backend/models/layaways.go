@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// Layaway states
+const (
+	LayawayOpen      = "OPEN"
+	LayawayCompleted = "COMPLETED"
+	LayawayCancelled = "CANCELLED"
+)
+
+// PaymentLayaway is the tender a completed layaway's receipt is paid with:
+// the deposits already taken against it. It is never accepted from the till.
+const PaymentLayaway = "LAYAWAY"
+
+// LayawayPaymentMethods lists the tenders deposits can be taken in
+var LayawayPaymentMethods = map[string]bool{
+	"CASH":  true,
+	"MPESA": true,
+}
+
+// Layaway is an order the customer pays for in instalments before taking
+// the goods. Its stock is reserved from the moment it is placed, its lines
+// are priced as at that moment, and once fully paid it becomes a receipt.
+type Layaway struct {
+	ID             uint                 `gorm:"primaryKey" json:"id"`
+	UserID         uint                 `gorm:"not null;index" json:"user_id"`
+	User           User                 `gorm:"foreignKey:UserID" json:"-"`
+	LayawayNumber  string               `gorm:"type:varchar(50);uniqueIndex;not null" json:"layaway_number"`
+	CustomerID     *uint                `gorm:"index" json:"customer_id,omitempty"`
+	CustomerName   string               `json:"customer_name"`
+	CustomerPhone  string               `gorm:"type:varchar(20)" json:"customer_phone"`
+	Status         string               `gorm:"type:varchar(20);not null;default:'OPEN';index" json:"status"`
+	TotalAmount    float64              `gorm:"not null" json:"total_amount"`
+	AmountPaid     float64              `gorm:"not null;default:0" json:"amount_paid"`
+	AmountRefunded float64              `gorm:"not null;default:0" json:"amount_refunded"`
+	ExpiresAt      time.Time            `gorm:"not null;index" json:"expires_at"`
+	ReceiptID      *uint                `json:"receipt_id,omitempty"`
+	CancelReason   string               `gorm:"type:text" json:"cancel_reason,omitempty"`
+	CancelledAt    *time.Time           `json:"cancelled_at,omitempty"`
+	Lines          []LayawayLine        `gorm:"foreignKey:LayawayID" json:"lines,omitempty"`
+	Payments       []LayawayPayment     `gorm:"foreignKey:LayawayID" json:"payments,omitempty"`
+	Reservations   []LayawayReservation `gorm:"foreignKey:LayawayID" json:"reservations,omitempty"`
+	CreatedAt      time.Time            `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time            `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// LayawayLine is one product on a layaway at the price agreed when it was placed
+type LayawayLine struct {
+	ID             uint    `gorm:"primaryKey" json:"id"`
+	LayawayID      uint    `gorm:"not null;index" json:"layaway_id"`
+	ProductID      uint    `gorm:"not null" json:"product_id"`
+	Name           string  `gorm:"not null" json:"name"`
+	Quantity       int     `gorm:"not null" json:"quantity"`
+	ListPrice      float64 `gorm:"not null" json:"list_price"`
+	DiscountAmount float64 `gorm:"not null;default:0" json:"discount_amount"`
+	TotalPrice     float64 `gorm:"not null" json:"total_price"`
+}
+
+// LayawayReservation is stock held back for a layaway. Bundles reserve
+// their components, so this can differ from the lines.
+type LayawayReservation struct {
+	ID        uint    `gorm:"primaryKey" json:"id"`
+	LayawayID uint    `gorm:"not null;index" json:"layaway_id"`
+	ProductID uint    `gorm:"not null" json:"product_id"`
+	Quantity  int     `gorm:"not null" json:"quantity"`
+	UnitCost  float64 `gorm:"not null;default:0" json:"unit_cost"`
+}
+
+// LayawayPayment is a deposit taken against a layaway, or a refund of
+// deposits when it is cancelled (a negative amount)
+type LayawayPayment struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	UserID            uint      `gorm:"not null;index" json:"user_id"`
+	LayawayID         uint      `gorm:"not null;index" json:"layaway_id"`
+	RegisterSessionID *uint     `gorm:"index" json:"register_session_id,omitempty"`
+	Method            string    `gorm:"type:varchar(20);not null" json:"method"`
+	Amount            float64   `gorm:"not null" json:"amount"`
+	Reference         string    `json:"reference,omitempty"`
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
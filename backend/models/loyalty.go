@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Loyalty ledger entry types
+const (
+	LoyaltyEarn   = "EARN"
+	LoyaltyRedeem = "REDEEM"
+	LoyaltyExpire = "EXPIRE"
+	// LoyaltyRefund gives points back for a return refunded as points
+	LoyaltyRefund = "REFUND"
+	// LoyaltyReverse takes back points earned on goods later returned
+	LoyaltyReverse = "REVERSE"
+)
+
+// LoyaltyMultiplier scales the points earned on one product category
+type LoyaltyMultiplier struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"not null;uniqueIndex:idx_loyalty_category" json:"user_id"`
+	User       User      `gorm:"foreignKey:UserID" json:"-"`
+	Category   string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_loyalty_category" json:"category"`
+	Multiplier float64   `gorm:"not null;default:1" json:"multiplier"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// LoyaltyEntry is one movement of a customer's points. A customer's balance
+// is the sum of Points. Entries that add points track how many are left in
+// Remaining; redemptions use up the oldest first and whatever is left when
+// ExpiresAt passes expires.
+type LoyaltyEntry struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	User         User       `gorm:"foreignKey:UserID" json:"-"`
+	CustomerID   uint       `gorm:"not null;index" json:"customer_id"`
+	ReceiptID    *uint      `gorm:"index" json:"receipt_id,omitempty"`
+	SaleReturnID *uint      `json:"sale_return_id,omitempty"`
+	Type         string     `gorm:"type:varchar(20);not null" json:"type"`
+	Points       int        `gorm:"not null" json:"points"`
+	Remaining    int        `gorm:"not null;default:0" json:"remaining,omitempty"`
+	ExpiresAt    *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	Description  string     `json:"description"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ParkedSale is a basket put on hold so the till can serve someone else.
+// It reserves no stock and is priced only when it is rung up.
+type ParkedSale struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	UserID       uint   `gorm:"not null;index" json:"user_id"`
+	User         User   `gorm:"foreignKey:UserID" json:"-"`
+	Label        string `gorm:"type:varchar(100)" json:"label,omitempty"`
+	CustomerName string `json:"customer_name,omitempty"`
+	Lines        int    `gorm:"not null" json:"lines"`
+	// Sale is the basket as the till sent it, in JSON
+	Sale      string    `gorm:"type:text;not null" json:"-"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
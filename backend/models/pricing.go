@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Price change statuses
+const (
+	PriceChangePending   = "PENDING"
+	PriceChangeApplied   = "APPLIED"
+	PriceChangeCancelled = "CANCELLED"
+)
+
+// PriceChange records every selling price a product has had, including
+// future-dated changes that the scheduler applies once they fall due.
+type PriceChange struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	User        User       `gorm:"foreignKey:UserID" json:"-"`
+	ProductID   uint       `gorm:"not null;index" json:"product_id"`
+	Product     Product    `gorm:"foreignKey:ProductID" json:"-"`
+	OldPrice    float64    `gorm:"not null" json:"old_price"`
+	NewPrice    float64    `gorm:"not null" json:"new_price"`
+	EffectiveAt time.Time  `gorm:"not null;index" json:"effective_at"`
+	Status      string     `gorm:"type:varchar(20);not null;default:'PENDING'" json:"status"`
+	Reason      string     `gorm:"type:text" json:"reason,omitempty"`
+	ChangedBy   uint       `gorm:"not null" json:"changed_by"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
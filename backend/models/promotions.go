@@ -0,0 +1,132 @@
+package models
+
+import "time"
+
+// Discount types for manual line and basket discounts and coupons
+const (
+	DiscountPercent = "PERCENT"
+	DiscountFixed   = "FIXED"
+)
+
+// DiscountTypes lists the accepted manual discount types
+var DiscountTypes = map[string]bool{
+	DiscountPercent: true,
+	DiscountFixed:   true,
+}
+
+// Promotion types
+const (
+	// PromotionPercentOff takes Value percent off each unit
+	PromotionPercentOff = "PERCENT_OFF"
+	// PromotionAmountOff takes Value off each unit
+	PromotionAmountOff = "AMOUNT_OFF"
+	// PromotionFixedPrice sells each unit at Value, e.g. happy-hour prices
+	PromotionFixedPrice = "FIXED_PRICE"
+	// PromotionBuyXGetY gives FreeQuantity units free for every BuyQuantity bought
+	PromotionBuyXGetY = "BUY_X_GET_Y"
+)
+
+// PromotionTypes lists the accepted promotion types
+var PromotionTypes = map[string]bool{
+	PromotionPercentOff: true,
+	PromotionAmountOff:  true,
+	PromotionFixedPrice: true,
+	PromotionBuyXGetY:   true,
+}
+
+// Discount sources recorded in the SaleDiscount ledger
+const (
+	DiscountSourcePromotion = "PROMOTION"
+	DiscountSourceLine      = "LINE"
+	DiscountSourceBasket    = "BASKET"
+	DiscountSourceCoupon    = "COUPON"
+	// DiscountSourceOverride is a price keyed over the list price. It is
+	// negative when the line was sold above list.
+	DiscountSourceOverride = "OVERRIDE"
+	// DiscountSourceQuotation is the discount agreed on a converted quotation
+	DiscountSourceQuotation = "QUOTATION"
+	// DiscountSourceLayaway is the discount agreed when a layaway was placed
+	DiscountSourceLayaway = "LAYAWAY"
+)
+
+// Kinds of price override
+const (
+	OverridePrice          = "PRICE"
+	OverrideLineDiscount   = "LINE_DISCOUNT"
+	OverrideBasketDiscount = "BASKET_DISCOUNT"
+)
+
+// PriceOverride logs a cashier changing what the server priced, for the
+// owner to review. Basket discounts have no product or item.
+type PriceOverride struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"not null;index" json:"user_id"`
+	User          User       `gorm:"foreignKey:UserID" json:"-"`
+	ReceiptID     uint       `gorm:"not null;index" json:"receipt_id"`
+	ItemID        uint       `json:"item_id,omitempty"`
+	ProductID     *uint      `json:"product_id,omitempty"`
+	Kind          string     `gorm:"type:varchar(20);not null" json:"kind"`
+	ListAmount    float64    `gorm:"not null" json:"list_amount"`
+	ChargedAmount float64    `gorm:"not null" json:"charged_amount"`
+	Reason        string     `gorm:"type:text;not null" json:"reason"`
+	Reviewed      bool       `gorm:"not null;default:false" json:"reviewed"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Promotion is an automatic, time-boxed discount applied at sale time. It
+// targets one product, a category, or every product when both are empty.
+// DailyStart and DailyEnd ("15:00", "18:00") limit it to part of each day.
+type Promotion struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	User         User       `gorm:"foreignKey:UserID" json:"-"`
+	Name         string     `gorm:"not null" json:"name"`
+	Type         string     `gorm:"type:varchar(20);not null" json:"type"`
+	ProductID    *uint      `gorm:"index" json:"product_id,omitempty"`
+	Category     string     `json:"category,omitempty"`
+	Value        float64    `gorm:"not null;default:0" json:"value"`
+	BuyQuantity  int        `gorm:"not null;default:0" json:"buy_quantity,omitempty"`
+	FreeQuantity int        `gorm:"not null;default:0" json:"free_quantity,omitempty"`
+	StartsAt     time.Time  `gorm:"not null" json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at,omitempty"`
+	DailyStart   string     `gorm:"type:varchar(5)" json:"daily_start,omitempty"`
+	DailyEnd     string     `gorm:"type:varchar(5)" json:"daily_end,omitempty"`
+	Active       bool       `gorm:"default:true" json:"active"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Coupon is a code the customer presents for a basket discount
+type Coupon struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;uniqueIndex:idx_coupon_code" json:"user_id"`
+	User         User       `gorm:"foreignKey:UserID" json:"-"`
+	Code         string     `gorm:"type:varchar(50);not null;uniqueIndex:idx_coupon_code" json:"code"`
+	DiscountType string     `gorm:"type:varchar(20);not null" json:"discount_type"`
+	Value        float64    `gorm:"not null" json:"value"`
+	MinSpend     float64    `gorm:"not null;default:0" json:"min_spend"`
+	UsageLimit   int        `gorm:"not null;default:0" json:"usage_limit"` // 0 is unlimited
+	TimesUsed    int        `gorm:"not null;default:0" json:"times_used"`
+	StartsAt     *time.Time `json:"starts_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Active       bool       `gorm:"default:true" json:"active"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// SaleDiscount is one discount given on a receipt. Line discounts carry the
+// receipt item; basket and coupon discounts have no item.
+type SaleDiscount struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	User        User      `gorm:"foreignKey:UserID" json:"-"`
+	ReceiptID   uint      `gorm:"not null;index" json:"receipt_id"`
+	ItemID      uint      `json:"item_id,omitempty"`
+	Source      string    `gorm:"type:varchar(20);not null" json:"source"`
+	PromotionID *uint     `json:"promotion_id,omitempty"`
+	CouponID    *uint     `json:"coupon_id,omitempty"`
+	Description string    `json:"description"`
+	Amount      float64   `gorm:"not null" json:"amount"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Quotation statuses
+const (
+	QuotationOpen      = "OPEN"
+	QuotationConverted = "CONVERTED"
+	QuotationDeclined  = "DECLINED"
+	QuotationExpired   = "EXPIRED"
+)
+
+// DefaultQuotationDays is how long a quotation is valid unless stated
+const DefaultQuotationDays = 14
+
+// Quotation is a priced offer, or pro-forma invoice, made to a customer
+// before they buy. It is laid out like a Receipt and becomes one when it
+// is converted into a sale.
+type Quotation struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	UserID          uint      `json:"userId" gorm:"not null;index"`
+	QuotationNumber string    `json:"quotationNumber" gorm:"type:varchar(50);unique;not null"`
+	CustomerID      *uint     `json:"customerId,omitempty" gorm:"index"`
+	CustomerName    string    `json:"customerName"`
+	CustomerPhone   string    `json:"customerPhone,omitempty" gorm:"type:varchar(20)"`
+	Date            time.Time `json:"date"`
+	ValidUntil      time.Time `json:"validUntil" gorm:"not null;index"`
+	Status          string    `json:"status" gorm:"type:varchar(20);not null;default:'OPEN';index"`
+	TotalAmount     float64   `json:"totalAmount"`
+	DiscountAmount  float64   `json:"discountAmount" gorm:"not null;default:0"`
+	TaxAmount       float64   `json:"taxAmount" gorm:"not null;default:0"`
+	TaxPricing      string    `json:"taxPricing,omitempty" gorm:"type:varchar(20)"`
+	Notes           string    `json:"notes,omitempty" gorm:"type:text"`
+	// ReceiptID is the sale the quotation was converted into
+	ReceiptID   *uint           `json:"receiptId,omitempty"`
+	ConvertedAt *time.Time      `json:"convertedAt,omitempty"`
+	Items       []QuotationItem `json:"items" gorm:"foreignKey:QuotationID"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// QuotationItem is a quoted line, priced like a receipt Item. The keyed
+// amount and discount are kept so the sale can be priced the same way.
+type QuotationItem struct {
+	ID             uint    `json:"id" gorm:"primaryKey"`
+	QuotationID    uint    `json:"quotationId" gorm:"not null;index"`
+	ProductID      uint    `json:"productId"`
+	Name           string  `json:"name"`
+	Quantity       int     `json:"quantity"`
+	UnitPrice      float64 `json:"unitPrice"`
+	TotalPrice     float64 `json:"totalPrice"`
+	ListPrice      float64 `json:"listPrice" gorm:"not null;default:0"`
+	DiscountAmount float64 `json:"discountAmount" gorm:"not null;default:0"`
+	NetAmount      float64 `json:"netAmount" gorm:"not null;default:0"`
+	TaxClass       string  `json:"taxClass,omitempty" gorm:"type:varchar(20)"`
+	TaxRate        float64 `json:"taxRate" gorm:"not null;default:0"`
+	TaxableAmount  float64 `json:"taxableAmount" gorm:"not null;default:0"`
+	TaxAmount      float64 `json:"taxAmount" gorm:"not null;default:0"`
+	KeyedAmount    float64 `json:"keyedAmount,omitempty" gorm:"not null;default:0"`
+	DiscountType   string  `json:"discountType,omitempty" gorm:"type:varchar(20)"`
+	DiscountValue  float64 `json:"discountValue,omitempty" gorm:"not null;default:0"`
+	OverrideReason string  `json:"overrideReason,omitempty" gorm:"type:text"`
+}
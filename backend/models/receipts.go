@@ -2,17 +2,45 @@ package models
 
 import "time"
 
+// Receipt statuses
+const (
+	ReceiptCompleted         = "COMPLETED"
+	ReceiptPartiallyReturned = "PARTIALLY_RETURNED"
+	ReceiptReturned          = "RETURNED"
+	ReceiptVoided            = "VOIDED"
+)
+
 type Receipt struct {
 	ID            uint      `json:"id" gorm:"primaryKey"`
 	UserID        uint      `json:"userId" gorm:"not null"` // Added UserID to associate receipt with a user
 	ReceiptNumber string    `json:"receiptNumber" gorm:"unique;not null"`
+	CustomerID    *uint     `json:"customerId,omitempty" gorm:"index"`
 	CustomerName  string    `json:"customerName"`
 	Date          time.Time `json:"date"`
 	PaymentMethod string    `json:"paymentMethod"`
 	TotalAmount   float64   `json:"totalAmount"`
-	Items         []Item    `json:"items" gorm:"foreignKey:ReceiptID"`
-	CreatedAt     time.Time `json:"createdAt"`
-	UpdatedAt     time.Time `json:"updatedAt"`
+	// DiscountAmount is everything given away on the receipt, line and basket
+	DiscountAmount float64 `json:"discountAmount" gorm:"not null;default:0"`
+	CouponCode     string  `json:"couponCode,omitempty" gorm:"type:varchar(50)"`
+	// TaxAmount is the VAT included in TotalAmount
+	TaxAmount  float64 `json:"taxAmount" gorm:"not null;default:0"`
+	TaxPricing string  `json:"taxPricing,omitempty" gorm:"type:varchar(20)"`
+	Status     string  `json:"status" gorm:"type:varchar(20);not null;default:'COMPLETED'"`
+	// Loyalty points earned on the receipt and redeemed to pay for it
+	PointsEarned   int     `json:"pointsEarned" gorm:"not null;default:0"`
+	PointsRedeemed int     `json:"pointsRedeemed" gorm:"not null;default:0"`
+	ChangeGiven    float64 `json:"changeGiven" gorm:"not null;default:0"`
+	// ClientSaleID is the UUID a till gave a sale it captured offline
+	ClientSaleID *string    `json:"clientSaleId,omitempty" gorm:"type:varchar(64);uniqueIndex"`
+	SyncedAt     *time.Time `json:"syncedAt,omitempty"`
+	// CashierID is the login that rang the sale up
+	CashierID uint `json:"cashierId" gorm:"not null;default:0;index"`
+	// RegisterSessionID is the till shift the sale was rung up on
+	RegisterSessionID *uint            `json:"registerSessionId,omitempty" gorm:"index"`
+	Items             []Item           `json:"items" gorm:"foreignKey:ReceiptID"`
+	Payments          []ReceiptPayment `json:"payments" gorm:"foreignKey:ReceiptID"`
+	CreatedAt         time.Time        `json:"createdAt"`
+	UpdatedAt         time.Time        `json:"updatedAt"`
 }
 
 type Item struct {
@@ -23,4 +51,33 @@ type Item struct {
 	Quantity   int     `json:"quantity"`
 	UnitPrice  float64 `json:"unitPrice"`
 	TotalPrice float64 `json:"totalPrice"`
+	// ListPrice is the undiscounted unit price and NetAmount the line after
+	// discounts, both as entered (with or without VAT per the business setting)
+	ListPrice      float64 `json:"listPrice" gorm:"not null;default:0"`
+	DiscountAmount float64 `json:"discountAmount" gorm:"not null;default:0"`
+	NetAmount      float64 `json:"netAmount" gorm:"not null;default:0"`
+	// TotalPrice is TaxableAmount plus TaxAmount
+	TaxClass      string  `json:"taxClass,omitempty" gorm:"type:varchar(20)"`
+	TaxRate       float64 `json:"taxRate" gorm:"not null;default:0"`
+	TaxableAmount float64 `json:"taxableAmount" gorm:"not null;default:0"`
+	TaxAmount     float64 `json:"taxAmount" gorm:"not null;default:0"`
+	UnitCost      float64 `json:"unitCost"`
+	TotalCost     float64 `json:"totalCost"`
+	// ReturnedQuantity counts units already returned or voided
+	ReturnedQuantity int `json:"returnedQuantity" gorm:"not null;default:0"`
+}
+
+// ReceiptPayment is one tender used to pay a receipt. Amount is what the
+// tender paid towards the receipt; for cash, Tendered is what the customer
+// handed over and Change what they got back.
+type ReceiptPayment struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"userId" gorm:"not null;index"`
+	ReceiptID   uint      `json:"receiptId" gorm:"not null;index"`
+	Method      string    `json:"method" gorm:"type:varchar(20);not null"`
+	Amount      float64   `json:"amount" gorm:"not null"`
+	Tendered    float64   `json:"tendered" gorm:"not null;default:0"`
+	ChangeGiven float64   `json:"change" gorm:"not null;default:0"`
+	Reference   string    `json:"reference,omitempty" gorm:"type:varchar(50)"`
+	CreatedAt   time.Time `json:"createdAt"`
 }
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Register session states
+const (
+	RegisterOpen   = "OPEN"
+	RegisterClosed = "CLOSED"
+)
+
+// Cash taken out of the drawer during a session
+const (
+	// CashDrop moves cash from the drawer to the safe or bank
+	CashDrop = "DROP"
+	// CashPayOut pays a supplier or expense from the drawer
+	CashPayOut = "PAY_OUT"
+)
+
+// RegisterSession is one cashier's shift on a till, from opening float to
+// the counted cash at close. Receipts and refunds taken while it is open
+// point back at it.
+type RegisterSession struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	User         User       `gorm:"foreignKey:UserID" json:"-"`
+	Register     string     `gorm:"type:varchar(50);not null" json:"register"`
+	Status       string     `gorm:"type:varchar(20);not null;default:'OPEN'" json:"status"`
+	OpeningFloat float64    `gorm:"not null;default:0" json:"opening_float"`
+	OpenedAt     time.Time  `gorm:"not null" json:"opened_at"`
+	OpenedBy     uint       `gorm:"not null;default:0" json:"opened_by"`
+	ClosedAt     *time.Time `json:"closed_at,omitempty"`
+	// Set at close from the Z report
+	ExpectedCash float64            `gorm:"not null;default:0" json:"expected_cash"`
+	CountedCash  *float64           `json:"counted_cash,omitempty"`
+	OverShort    float64            `gorm:"not null;default:0" json:"over_short"`
+	ClosingNote  string             `gorm:"type:text" json:"closing_note,omitempty"`
+	Movements    []RegisterMovement `gorm:"foreignKey:SessionID" json:"movements,omitempty"`
+	CreatedAt    time.Time          `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time          `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// RegisterMovement is a cash drop or pay-out from a session's drawer
+type RegisterMovement struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	SessionID uint      `gorm:"not null;index" json:"session_id"`
+	Type      string    `gorm:"type:varchar(20);not null" json:"type"`
+	Amount    float64   `gorm:"not null" json:"amount"`
+	Reason    string    `gorm:"type:text;not null" json:"reason"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
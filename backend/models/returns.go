@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// Sale return types
+const (
+	SaleReturnVoid   = "VOID"
+	SaleReturnReturn = "RETURN"
+)
+
+// RefundMethods lists how money from a void or return goes back to the
+// customer. CREDIT reduces what a credit customer owes instead of paying out;
+// POINTS gives it back as loyalty points.
+var RefundMethods = map[string]bool{
+	"CASH":   true,
+	"MPESA":  true,
+	"CREDIT": true,
+	"POINTS": true,
+}
+
+// SaleReturn records a void of a whole receipt or a return of some of its
+// lines. The matching negative SalesTransactions point back at it.
+type SaleReturn struct {
+	ID              uint    `gorm:"primaryKey" json:"id"`
+	UserID          uint    `gorm:"not null;index" json:"user_id"`
+	User            User    `gorm:"foreignKey:UserID" json:"-"`
+	ReceiptID       uint    `gorm:"not null;index" json:"receipt_id"`
+	Receipt         Receipt `gorm:"foreignKey:ReceiptID" json:"-"`
+	Type            string  `gorm:"type:varchar(20);not null" json:"type"`
+	Reason          string  `gorm:"type:text" json:"reason,omitempty"`
+	RefundMethod    string  `gorm:"type:varchar(20);not null" json:"refund_method"`
+	RefundReference string  `gorm:"type:varchar(50)" json:"refund_reference,omitempty"`
+	RefundAmount    float64 `gorm:"not null" json:"refund_amount"`
+	CreditReversed  float64 `gorm:"not null;default:0" json:"credit_reversed"`
+	PointsReversed  int     `gorm:"not null;default:0" json:"points_reversed"`
+	PointsRefunded  int     `gorm:"not null;default:0" json:"points_refunded"`
+	ProcessedBy     uint    `gorm:"not null" json:"processed_by"`
+	// RegisterSessionID is the till shift the refund was paid from
+	RegisterSessionID *uint            `gorm:"index" json:"register_session_id,omitempty"`
+	Items             []SaleReturnItem `gorm:"foreignKey:SaleReturnID" json:"items"`
+	// Refunds is what went back by each method. RefundMethod is SPLIT when
+	// there is more than one.
+	Refunds   []SaleReturnRefund `gorm:"foreignKey:SaleReturnID" json:"refunds"`
+	CreatedAt time.Time          `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// SaleReturnRefund is the part of a refund given back by one method
+type SaleReturnRefund struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	SaleReturnID uint      `gorm:"not null;index" json:"sale_return_id"`
+	Method       string    `gorm:"type:varchar(20);not null" json:"method"`
+	Amount       float64   `gorm:"not null" json:"amount"`
+	Reference    string    `gorm:"type:varchar(50)" json:"reference,omitempty"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// SaleReturnItem is one receipt line given back
+type SaleReturnItem struct {
+	ID           uint    `gorm:"primaryKey" json:"id"`
+	SaleReturnID uint    `gorm:"not null;index" json:"sale_return_id"`
+	ItemID       uint    `gorm:"not null" json:"item_id"`
+	ProductID    uint    `gorm:"not null" json:"product_id"`
+	Quantity     int     `gorm:"not null" json:"quantity"`
+	RefundAmount float64 `gorm:"not null" json:"refund_amount"`
+	UnitCost     float64 `gorm:"not null;default:0" json:"unit_cost"`
+	Restocked    bool    `gorm:"not null" json:"restocked"`
+}
@@ -2,20 +2,49 @@ package models
 
 import "time"
 
+// PaymentMethods lists the accepted tenders
+var PaymentMethods = map[string]bool{
+	"CASH":   true,
+	"MPESA":  true,
+	"CREDIT": true,
+	// POINTS redeems a customer's loyalty points
+	"POINTS": true,
+}
+
+// PaymentSplit is the payment method of a receipt paid with more than one tender
+const PaymentSplit = "SPLIT"
+
 type SalesTransaction struct {
-	ID              uint      `gorm:"primaryKey" json:"id"`
-	UserID          uint      `gorm:"not null" json:"user_id"`
-	User            User      `gorm:"foreignKey:UserID" json:"-"`
-	ProductID       uint      `gorm:"not null" json:"product_id"`
-	Product         Product   `gorm:"foreignKey:ProductID" json:"-"`
-	Quantity        int       `gorm:"not null" json:"quantity"`
-	TotalAmount     float64   `gorm:"not null" json:"total_amount"`
-	PaymentMethod   string    `gorm:"type:enum('CASH','MPESA','CREDIT');not null" json:"payment_method"`
-	CustomerName    string    `json:"customer_name,omitempty"`
-	CustomerPhone   string    `json:"customer_phone,omitempty"`
-	ReferenceNumber string    `json:"reference_number,omitempty"`
-	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID              uint    `gorm:"primaryKey" json:"id"`
+	UserID          uint    `gorm:"not null" json:"user_id"`
+	User            User    `gorm:"foreignKey:UserID" json:"-"`
+	ProductID       uint    `gorm:"not null" json:"product_id"`
+	Product         Product `gorm:"foreignKey:ProductID" json:"-"`
+	ReceiptID       uint    `gorm:"index" json:"receipt_id,omitempty"`
+	SaleReturnID    uint    `gorm:"index" json:"sale_return_id,omitempty"`
+	Quantity        int     `gorm:"not null" json:"quantity"`
+	TotalAmount     float64 `gorm:"not null" json:"total_amount"`
+	ListPrice       float64 `gorm:"not null;default:0" json:"list_price"`
+	DiscountAmount  float64 `gorm:"not null;default:0" json:"discount_amount"`
+	NetAmount       float64 `gorm:"not null;default:0" json:"net_amount"`
+	TaxClass        string  `gorm:"type:varchar(20)" json:"tax_class,omitempty"`
+	TaxRate         float64 `gorm:"not null;default:0" json:"tax_rate"`
+	TaxableAmount   float64 `gorm:"not null;default:0" json:"taxable_amount"`
+	TaxAmount       float64 `gorm:"not null;default:0" json:"tax_amount"`
+	UnitCost        float64 `gorm:"not null;default:0" json:"unit_cost"`
+	TotalCost       float64 `gorm:"not null;default:0" json:"total_cost"`
+	PaymentMethod   string  `gorm:"type:varchar(20);not null" json:"payment_method"`
+	CustomerID      *uint   `gorm:"index" json:"customer_id,omitempty"`
+	CustomerName    string  `json:"customer_name,omitempty"`
+	CustomerPhone   string  `json:"customer_phone,omitempty"`
+	ReferenceNumber string  `json:"reference_number,omitempty"`
+	StockException  string  `gorm:"type:varchar(20)" json:"stock_exception,omitempty"`
+	// CashierID is the login that rang up the sale or processed the return
+	CashierID uint `gorm:"not null;default:0;index" json:"cashier_id"`
+	// RolledUp is set once the line is counted in the hourly sales rollup
+	RolledUp  bool      `gorm:"not null;default:false;index" json:"-"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 type MpesaTransaction struct {
@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+// Negative stock policies decide what happens when a sale needs more stock than is on hand
+const (
+	StockPolicyBlock         = "BLOCK"
+	StockPolicyAllowNegative = "ALLOW_NEGATIVE"
+	StockPolicyBackorder     = "BACKORDER"
+)
+
+// StockPolicies lists the accepted negative stock policies
+var StockPolicies = map[string]bool{
+	StockPolicyBlock:         true,
+	StockPolicyAllowNegative: true,
+	StockPolicyBackorder:     true,
+}
+
+// Tax pricing modes say whether entered prices already include VAT
+const (
+	TaxInclusive = "INCLUSIVE"
+	TaxExclusive = "EXCLUSIVE"
+)
+
+// TaxPricingModes lists the accepted tax pricing modes
+var TaxPricingModes = map[string]bool{
+	TaxInclusive: true,
+	TaxExclusive: true,
+}
+
+// StandardVATRate is the Kenyan standard VAT rate in percent
+const StandardVATRate = 16.0
+
+// Loyalty defaults: one point per KES 100, worth KES 1, kept for a year
+const (
+	DefaultPointsPerShilling = 0.01
+	DefaultPointValue        = 1.0
+	DefaultPointsExpiryDays  = 365
+)
+
+// Layaway defaults: 10% down and 30 days to pay the rest
+const (
+	DefaultLayawayDepositPercent = 10.0
+	DefaultLayawayDays           = 30
+)
+
+// DefaultTimezone is where a business is unless it says otherwise
+const DefaultTimezone = "Africa/Nairobi"
+
+// BusinessSettings holds per-business configuration. A business is a User.
+type BusinessSettings struct {
+	ID                  uint   `gorm:"primaryKey" json:"id"`
+	UserID              uint   `gorm:"not null;uniqueIndex" json:"user_id"`
+	User                User   `gorm:"foreignKey:UserID" json:"-"`
+	NegativeStockPolicy string `gorm:"type:varchar(20);not null;default:'BLOCK'" json:"negative_stock_policy"`
+	// VAT is only charged once a business is registered for it
+	VATRegistered bool    `gorm:"not null;default:false" json:"vat_registered"`
+	VATRate       float64 `gorm:"not null;default:16" json:"vat_rate"`
+	TaxPricing    string  `gorm:"type:varchar(20);not null;default:'INCLUSIVE'" json:"tax_pricing"`
+	// RequireRegisterSession refuses sales unless a register session is open
+	RequireRegisterSession bool `gorm:"not null;default:false" json:"require_register_session"`
+	// Loyalty points: PointsPerShilling are earned on each shilling spent,
+	// each point is worth PointValue shillings when redeemed, and points
+	// expire PointsExpiryDays after they are earned (0 never expires)
+	LoyaltyEnabled    bool    `gorm:"not null;default:false" json:"loyalty_enabled"`
+	PointsPerShilling float64 `gorm:"not null;default:0.01" json:"points_per_shilling"`
+	PointValue        float64 `gorm:"not null;default:1" json:"point_value"`
+	PointsExpiryDays  int     `gorm:"not null;default:365" json:"points_expiry_days"`
+	// Layaways need LayawayDepositPercent of the total down and are
+	// cancelled if not paid off within LayawayDays
+	LayawayDepositPercent float64 `gorm:"not null;default:10" json:"layaway_deposit_percent"`
+	LayawayDays           int     `gorm:"not null;default:30" json:"layaway_days"`
+	// Timezone is the IANA zone reports read hours and days in
+	Timezone  string    `gorm:"type:varchar(64);not null;default:'Africa/Nairobi'" json:"timezone"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// DefaultBusinessSettings returns the settings used until a business saves its own
+func DefaultBusinessSettings(userID uint) BusinessSettings {
+	return BusinessSettings{
+		UserID:                userID,
+		NegativeStockPolicy:   StockPolicyBlock,
+		VATRate:               StandardVATRate,
+		TaxPricing:            TaxInclusive,
+		PointsPerShilling:     DefaultPointsPerShilling,
+		PointValue:            DefaultPointValue,
+		PointsExpiryDays:      DefaultPointsExpiryDays,
+		LayawayDepositPercent: DefaultLayawayDepositPercent,
+		LayawayDays:           DefaultLayawayDays,
+		Timezone:              DefaultTimezone,
+	}
+}
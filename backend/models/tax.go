@@ -0,0 +1,15 @@
+package models
+
+// VAT classes a product can be sold under
+const (
+	TaxStandard  = "STANDARD"
+	TaxZeroRated = "ZERO_RATED"
+	TaxExempt    = "EXEMPT"
+)
+
+// TaxClasses lists the accepted product tax classes
+var TaxClasses = map[string]bool{
+	TaxStandard:  true,
+	TaxZeroRated: true,
+	TaxExempt:    true,
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func CustomerRoutes(router *gin.Engine, db *gorm.DB) {
+	ch := controllers.NewCustomerHandler(db)
+
+	authenticated := router.Group("/")
+	authenticated.Use(middleware.AuthMiddleware())
+	{
+		authenticated.POST("/customers", ch.CreateCustomer)
+		authenticated.GET("/customers", ch.SearchCustomers)
+		authenticated.GET("/customers/:id", ch.GetCustomer)
+		authenticated.PUT("/customers/:id", ch.UpdateCustomer)
+		authenticated.DELETE("/customers/:id", ch.DeleteCustomer)
+		authenticated.GET("/customers/:id/history", ch.GetCustomerHistory)
+		authenticated.GET("/customers/:id/points", ch.GetPointsBalance)
+		authenticated.GET("/customers/:id/points/history", ch.GetPointsHistory)
+		authenticated.GET("/customer-segments", ch.GetCustomerSegments)
+		authenticated.POST("/customer-segments/recompute", ch.RecomputeCustomerSegments)
+		authenticated.GET("/customer-segments/:segment", ch.GetSegmentCustomers)
+	}
+}
@@ -17,11 +17,25 @@ func InventoryManagementRoutes(router *gin.Engine, db *gorm.DB) {
 		authenticated.POST("/create-product", im.CreateProduct)
 		authenticated.PUT("/update-product/:id", im.UpdateProduct)
 		authenticated.DELETE("/delete-product/:id", im.DeleteProduct)
+		authenticated.GET("/get-archived-products", im.GetArchivedProducts)
+		authenticated.PUT("/restore-product/:id", im.RestoreProduct)
+		authenticated.DELETE("/hard-delete-product/:id", im.HardDeleteProduct)
 		authenticated.GET("/get-product/:id", im.GetProduct)
 		authenticated.GET("/get-all-products", im.GetAllProducts)
 		authenticated.GET("/get-low-stock-alerts", im.GetLowStockAlerts)
 		authenticated.GET("/lookup-barcode/:barcode", im.LookupBarcode)
 		authenticated.GET("/search-products", im.SearchProducts)
+		authenticated.GET("/stock-reasons", im.GetStockReasons)
+		authenticated.POST("/adjust-stock/:id", im.AdjustStock)
+		authenticated.GET("/shrinkage-report", im.GetShrinkageReport)
+		authenticated.GET("/stock-exceptions", im.GetStockExceptions)
+		authenticated.PUT("/resolve-stock-exception/:id", im.ResolveStockException)
+		authenticated.POST("/schedule-price-change/:id", im.SchedulePriceChange)
+		authenticated.DELETE("/cancel-price-change/:id", im.CancelPriceChange)
+		authenticated.GET("/price-history/:id", im.GetPriceHistory)
+		authenticated.GET("/effective-price/:id", im.GetEffectivePrice)
+		authenticated.PUT("/bundle-components/:id", im.SetBundleComponents)
+		authenticated.GET("/bundle-components/:id", im.GetBundleComponents)
 	}
 
 	// Public routes (if any)
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func LayawayRoutes(router *gin.Engine, db *gorm.DB) {
+	lh := controllers.NewLayawayHandler(db)
+
+	authenticated := router.Group("/")
+	authenticated.Use(middleware.AuthMiddleware())
+	{
+		authenticated.POST("/layaways", middleware.Idempotency(db), lh.CreateLayaway)
+		authenticated.GET("/layaways", lh.GetLayaways)
+		authenticated.GET("/layaways/:id", lh.GetLayaway)
+		authenticated.POST("/layaways/:id/payments", middleware.Idempotency(db), lh.AddLayawayPayment)
+		authenticated.POST("/layaways/:id/complete", lh.CompleteLayaway)
+		authenticated.POST("/layaways/:id/cancel", lh.CancelLayaway)
+	}
+}
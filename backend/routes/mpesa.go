@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
 	"github.com/OAthooh/BiasharaTrack.git/mpesa"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -26,7 +27,7 @@ func MpesaRoutes(router *gin.Engine, db *gorm.DB) {
 
 	mpesaGroup := router.Group("/api/mpesa")
 	{
-		mpesaGroup.POST("/initiate", handler.InitiatePayment)
+		mpesaGroup.POST("/initiate", middleware.IdempotencyWithSideEffects(db), handler.InitiatePayment)
 		mpesaGroup.POST("/callback", handler.HandleCallback)
 	}
 
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func PromotionRoutes(router *gin.Engine, db *gorm.DB) {
+	ph := controllers.NewPromotionHandler(db)
+
+	authenticated := router.Group("/")
+	authenticated.Use(middleware.AuthMiddleware())
+	{
+		authenticated.POST("/promotions", ph.CreatePromotion)
+		authenticated.GET("/promotions", ph.GetPromotions)
+		authenticated.PUT("/promotions/:id", ph.UpdatePromotion)
+		authenticated.DELETE("/promotions/:id", ph.EndPromotion)
+		authenticated.POST("/coupons", ph.CreateCoupon)
+		authenticated.GET("/coupons", ph.GetCoupons)
+		authenticated.DELETE("/coupons/:id", ph.DisableCoupon)
+		authenticated.GET("/discount-report", ph.GetDiscountReport)
+	}
+}
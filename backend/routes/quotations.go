@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func QuotationRoutes(router *gin.Engine, db *gorm.DB) {
+	qh := controllers.NewQuotationHandler(db)
+
+	authenticated := router.Group("/")
+	authenticated.Use(middleware.AuthMiddleware())
+	{
+		authenticated.POST("/quotations", qh.CreateQuotation)
+		authenticated.GET("/quotations", qh.GetQuotations)
+		authenticated.GET("/quotations/:id", qh.GetQuotation)
+		authenticated.POST("/quotations/:id/convert", middleware.Idempotency(db), qh.ConvertQuotation)
+		authenticated.POST("/quotations/:id/decline", qh.DeclineQuotation)
+		authenticated.GET("/quotation-conversion", qh.GetQuotationConversion)
+	}
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterRoutes(router *gin.Engine, db *gorm.DB) {
+	rh := controllers.NewRegisterHandler(db)
+
+	authenticated := router.Group("/")
+	authenticated.Use(middleware.AuthMiddleware())
+	{
+		authenticated.POST("/register-sessions", rh.OpenSession)
+		authenticated.GET("/register-sessions", rh.GetSessions)
+		authenticated.GET("/register-sessions/current", rh.GetCurrentSession)
+		authenticated.POST("/register-sessions/:id/cash-drop", rh.RecordCashDrop)
+		authenticated.POST("/register-sessions/:id/pay-out", rh.RecordPayOut)
+		authenticated.POST("/register-sessions/:id/close", rh.CloseSession)
+		authenticated.GET("/register-sessions/:id/z-report", rh.GetZReport)
+	}
+}
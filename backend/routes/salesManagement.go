@@ -13,8 +13,28 @@ func SalesManagementRoutes(router *gin.Engine, db *gorm.DB) {
 	authenticated := router.Group("/")
 	authenticated.Use(middleware.AuthMiddleware())
 	{
-		authenticated.POST("/record-sale", sm.SellProducts)
+		authenticated.POST("/record-sale", middleware.Idempotency(db), sm.SellProducts)
+		authenticated.POST("/sync-sales", sm.SyncOfflineSales)
 		authenticated.GET("/sales-history", sm.FetchSalesHistory)
 		authenticated.GET("/sales-metrics", sm.FetchSalesMetrics)
+		authenticated.GET("/sales-analytics", sm.FetchSalesAnalytics)
+		authenticated.GET("/sales-heatmap", sm.FetchSalesHeatmap)
+		authenticated.GET("/basket-analysis", sm.FetchBasketAnalysis)
+		authenticated.GET("/basket-analysis/:id", sm.FetchAlsoBought)
+		authenticated.GET("/demand-forecast", sm.FetchStockOutForecasts)
+		authenticated.GET("/demand-forecast/:id", sm.FetchDemandForecast)
+		authenticated.GET("/demand-forecast/:id/backtest", sm.FetchDemandBacktest)
+		authenticated.GET("/product-profitability", sm.FetchProductProfitability)
+		authenticated.GET("/vat-summary", sm.FetchVATSummary)
+		authenticated.POST("/void-sale/:receiptNumber", sm.VoidSale)
+		authenticated.POST("/return-sale/:receiptNumber", sm.ReturnSale)
+		authenticated.GET("/sale-returns/:receiptNumber", sm.GetSaleReturns)
+		authenticated.GET("/price-overrides", sm.GetPriceOverrides)
+		authenticated.PUT("/review-price-override/:id", sm.ReviewPriceOverride)
+		authenticated.POST("/parked-sales", sm.ParkSale)
+		authenticated.GET("/parked-sales", sm.GetParkedSales)
+		authenticated.GET("/parked-sales/:id", sm.GetParkedSale)
+		authenticated.POST("/parked-sales/:id/resume", sm.ResumeParkedSale)
+		authenticated.DELETE("/parked-sales/:id", sm.DeleteParkedSale)
 	}
 }
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func SettingsRoutes(router *gin.Engine, db *gorm.DB) {
+	sh := controllers.NewSettingsHandler(db)
+
+	authenticated := router.Group("/")
+	authenticated.Use(middleware.AuthMiddleware())
+	{
+		authenticated.GET("/business-settings", sh.GetSettings)
+		authenticated.PUT("/business-settings", sh.UpdateSettings)
+		authenticated.GET("/loyalty/multipliers", sh.GetLoyaltyMultipliers)
+		authenticated.PUT("/loyalty/multipliers", sh.SetLoyaltyMultiplier)
+		authenticated.DELETE("/loyalty/multipliers/:id", sh.DeleteLoyaltyMultiplier)
+	}
+}
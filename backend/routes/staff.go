@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/OAthooh/BiasharaTrack.git/controllers"
+	"github.com/OAthooh/BiasharaTrack.git/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func StaffRoutes(router *gin.Engine, db *gorm.DB) {
+	sh := controllers.NewStaffHandler(db)
+
+	authenticated := router.Group("/")
+	authenticated.Use(middleware.AuthMiddleware())
+	{
+		authenticated.POST("/staff", sh.CreateStaff)
+		authenticated.GET("/staff", sh.GetStaff)
+		authenticated.PUT("/staff/:id/role", sh.UpdateStaffRole)
+	}
+}
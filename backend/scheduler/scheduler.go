@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/OAthooh/BiasharaTrack.git/utils"
+)
+
+// run runs job once, logging rather than returning its error or panic
+func run(name string, job func() error) {
+	defer func() {
+		if r := recover(); r != nil {
+			utils.ErrorLogger("Background job %s panicked: %v", name, r)
+		}
+	}()
+	if err := job(); err != nil {
+		utils.ErrorLogger("Background job %s failed: %v", name, err)
+	}
+}
+
+// Every runs job in the background once straight away and then on every
+// interval. Errors are logged and do not stop later runs. Calling the
+// returned function stops the schedule.
+func Every(name string, interval time.Duration, job func() error) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		run(name, job)
+		for {
+			select {
+			case <-ticker.C:
+				run(name, job)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	utils.InfoLogger("Scheduled background job %s every %s", name, interval)
+	return func() { close(done) }
+}
+
+// Daily runs job in the background every day at hour:minute server time,
+// for work best done overnight. Errors are logged and do not stop later
+// runs. Calling the returned function stops the schedule.
+func Daily(name string, hour, minute int, job func() error) func() {
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-timer.C:
+				run(name, job)
+			case <-done:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+
+	utils.InfoLogger("Scheduled background job %s daily at %02d:%02d", name, hour, minute)
+	return func() { close(done) }
+}
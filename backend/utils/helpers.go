@@ -1,10 +1,41 @@
 package utils
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/google/uuid"
 )
 
 // GenerateUUID generates a new UUID string
 func GenerateUUID() string {
 	return uuid.New().String()
-}
\ No newline at end of file
+}
+
+// NormalisePhone turns a Kenyan phone number in any common format
+// ("0712 345 678", "+254-712-345678", "712345678") into 254XXXXXXXXX
+func NormalisePhone(phone string) (string, error) {
+	var digits strings.Builder
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '+' || r == '(' || r == ')' || r == '.':
+		default:
+			return "", errors.New("phone number may only contain digits")
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case strings.HasPrefix(number, "254"):
+	case strings.HasPrefix(number, "0"):
+		number = "254" + number[1:]
+	default:
+		number = "254" + number
+	}
+	if len(number) != 12 {
+		return "", errors.New("invalid phone number")
+	}
+	return number, nil
+}